@@ -33,11 +33,20 @@ func main() {
 	podName := os.Getenv("POD_NAME")
 	podNamespace := os.Getenv("POD_NAMESPACE")
 	podIP := os.Getenv("POD_IP")
+	nodeName := os.Getenv("NODE_NAME")
 	sessionID := os.Getenv("SESSION_ID")
 	iface := os.Getenv("INTERFACE")
 	if iface == "" {
 		iface = "eth0"
 	}
+	gracePeriod := agent.DefaultGracePeriod
+	if v := os.Getenv("HUB_GRACE_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid HUB_GRACE_PERIOD %q: %v", v, err)
+		}
+		gracePeriod = d
+	}
 
 	// Generate agent ID
 	agentID := uuid.New().String()[:8]
@@ -52,8 +61,10 @@ func main() {
 	log.Printf("  Session: %s", sessionID)
 	log.Printf("  Pod: %s/%s", podNamespace, podName)
 	log.Printf("  Pod IP: %q", podIP) // Use %q to show if empty
+	log.Printf("  Node: %s", nodeName)
 	log.Printf("  Interface: %s", iface)
 	log.Printf("  Hub: %s", hubAddress)
+	log.Printf("  Hub grace period: %v", gracePeriod)
 
 	// Create agent info
 	agentInfo := &protocol.AgentInfo{
@@ -61,10 +72,22 @@ func main() {
 		PodName:   podName,
 		Namespace: podNamespace,
 		PodIP:     podIP,
+		NodeName:  nodeName,
 	}
 
 	// Create Hub client
 	hubClient := agent.NewHubClient(hubAddress, agentInfo)
+	hubClient.SetGracePeriod(gracePeriod)
+
+	// Create capturer
+	capturer := agent.NewCapturer(iface, agentInfo, hubClient)
+
+	// Link capturer to hub client for dynamic BPF filter updates
+	hubClient.SetCapturer(capturer)
+
+	// Report the pod's listening ports when registering
+	agentInfo.ListeningPorts = capturer.ListeningPorts()
+	log.Printf("  Listening ports: %v", agentInfo.ListeningPorts)
 
 	// Connect to Hub with retry
 	var connected bool
@@ -88,18 +111,12 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Set disconnect callback to trigger graceful shutdown when hub goes away
+	// Set disconnect callback to trigger graceful shutdown when hub stays away
 	hubClient.SetOnDisconnect(func() {
 		log.Println("Hub disconnected, initiating graceful shutdown...")
 		cancel()
 	})
 
-	// Create capturer
-	capturer := agent.NewCapturer(iface, agentInfo, hubClient)
-
-	// Link capturer to hub client for dynamic BPF filter updates
-	hubClient.SetCapturer(capturer)
-
 	// Set BPF filter to exclude agent->Hub traffic only (prevent feedback loop)
 	// Uses source IP constraint to avoid filtering legitimate pod traffic to other 8080/9090 services
 	bpfFilter, hubIP := buildHubExclusionFilter(hubAddress, podIP)
@@ -150,6 +167,8 @@ func main() {
 	log.Printf("  TCP: %d", stats.TCPPackets)
 	log.Printf("  HTTP: %d", stats.HTTPRequests)
 	log.Printf("  TLS: %d", stats.TLSHandshakes)
+	log.Printf("  DNS: %d", stats.DNSQueries)
+	log.Printf("  Truncated flows: %d", stats.TruncatedFlows)
 }
 
 // buildHubExclusionFilter creates a BPF filter to exclude agent->Hub traffic.
@@ -158,7 +177,7 @@ func main() {
 func buildHubExclusionFilter(hubAddress, podIP string) (filter string, hubIP string) {
 	// Parse the hub address to get host and port
 	// Hub address format: "podscope-hub.namespace.svc.cluster.local:9090"
-	// But we actually connect to port 8080 for HTTP
+	// Agents stream over gRPC on 9090; 8080 is the hub's HTTP API and UI
 
 	host := hubAddress
 	if idx := strings.LastIndex(hubAddress, ":"); idx != -1 {
@@ -5,10 +5,11 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
+	"maps"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gopacket"
@@ -20,15 +21,34 @@ import (
 const (
 	// MaxBodySize is the maximum request/response body to capture
 	MaxBodySize = 1024 // 1KB for MVP
-	// FlowTimeout is how long to keep incomplete flows
+	// FlowTimeout is how long to wait for a connection to be established
 	FlowTimeout = 30 * time.Second
+	// IdleFlowTimeout is how long an established connection may be silent
+	// before it is reported as timed out and no longer tracked
+	IdleFlowTimeout = time.Hour
+	// SnapshotInterval is how often active flows are reported while open
+	SnapshotInterval = 10 * time.Second
+	// MaxFlowBufferSize is the most unparsed payload kept for one direction
+	// of a flow. Past it the direction is truncated and no longer parsed.
+	MaxFlowBufferSize = 64 * 1024
+	// MaxBufferedBytes is the most payload kept across all flows
+	MaxBufferedBytes = 32 * 1024 * 1024
+	// MaxFlowExchanges is the most HTTP exchanges kept for one connection.
+	// Past it the oldest are dropped and counted.
+	MaxFlowExchanges = 256
+	// HubGRPCPort is the port agents stream to the Hub on
+	HubGRPCPort = 9090
 )
 
 // TCPAssembler reassembles TCP streams
 type TCPAssembler struct {
 	flows          map[string]*TCPFlow
+	closed         map[string]time.Time // completed connections, absorbing teardown packets until the time
 	mutex          sync.RWMutex
-	onFlowComplete func(*protocol.Flow)
+	onFlowComplete func(*protocol.Flow) // Also receives StatusOpen snapshots
+
+	// Payload held in flow buffers, bounded by MaxBufferedBytes
+	buffered atomic.Int64
 
 	// Agent info for populating pod names
 	agentPodName   string
@@ -37,10 +57,20 @@ type TCPAssembler struct {
 
 	// Hub info for agent traffic tagging
 	hubIP string
+
+	// Ports the pod listens on, for the direction of connections joined late
+	listeners *ListeningPorts
+
+	// Sockets of the pod's processes, for attributing flows
+	processes *ProcessTable
+
+	// Addresses the pod resolved, for naming destinations
+	names *ResolvedNames
 }
 
 // TCPFlow represents a TCP connection
 type TCPFlow struct {
+	mu          sync.Mutex // Held while a packet or snapshot touches the flow
 	ID          string
 	SrcIP       string
 	SrcPort     uint16
@@ -50,6 +80,7 @@ type TCPFlow struct {
 	LastSeen    time.Time
 
 	// State tracking
+	JoinedLate  bool // Already open when capture started, no handshake seen
 	SYNSeen     bool
 	SYNACKSeen  bool
 	FINSeen     bool
@@ -72,17 +103,64 @@ type TCPFlow struct {
 	PacketsRecv   uint32
 	BytesSent     uint64
 	BytesReceived uint64
+	Retransmits   uint32
+	OutOfOrder    uint32
+	ZeroWindows   uint32
+	DupAcks       uint32
+	ResetBy       string // "client" or "server"
+
+	// Local process that owns the connection
+	Process *protocol.ProcessInfo
+
+	// Hostname the destination was resolved from, when the answer was seen
+	DstName string
+
+	// Per-direction sequence reassembly
+	client tcpStream
+	server tcpStream
+
+	// Payload that is no longer buffered. A direction is done once nothing
+	// more can be parsed from it; skip counts body bytes to drop unread.
+	clientDone bool
+	serverDone bool
+	clientSkip int64
+	serverSkip int64
+	Truncated  bool // A buffer budget was hit and payload was dropped unparsed
+
+	completed    bool      // Final flow sent, later packets start a new one
+	lastSnapshot time.Time // LastSeen when the last open snapshot was sent
 
 	// Parsed data
-	HTTP        *protocol.HTTPInfo
+	HTTP        *protocol.HTTPInfo // First exchange, kept for existing consumers
 	TLS         *protocol.TLSInfo
 	Protocol    protocol.Protocol
+
+	// HTTP/1.x exchanges in request order. Requests and responses are
+	// consumed from the data buffers once complete, so keep-alive and
+	// pipelined connections yield one exchange per request. Exchanges a
+	// snapshot sent that can no longer change are let go.
+	HTTPExchanges    []*protocol.HTTPExchange
+	exchangeBase     int                    // Position of HTTPExchanges[0] on the connection
+	droppedExchanges int                    // Oldest exchanges dropped past MaxFlowExchanges
+	httpPartial      *protocol.HTTPExchange // Request whose body is still arriving
+	httpResponses int                    // Exchanges whose response is complete
+	httpUpgraded  bool                   // 101 Switching Protocols, stop parsing
+	h2            *http2Conn             // HTTP/2 framing and HPACK state
+	clientMarks   []dataMark
+	serverMarks   []dataMark
+}
+
+// dataMark records when the bytes starting at offset in a data buffer arrived
+type dataMark struct {
+	offset int
+	ts     time.Time
 }
 
 // NewTCPAssembler creates a new TCP stream assembler
 func NewTCPAssembler(onComplete func(*protocol.Flow), agentInfo *protocol.AgentInfo) *TCPAssembler {
 	a := &TCPAssembler{
 		flows:          make(map[string]*TCPFlow),
+		closed:         make(map[string]time.Time),
 		onFlowComplete: onComplete,
 	}
 
@@ -105,46 +183,48 @@ func (a *TCPAssembler) SetHubIP(hubIP string) {
 	a.hubIP = hubIP
 }
 
-// isAgentTraffic checks if a flow is agent-to-Hub communication.
-// Returns true and the traffic type if this is agent traffic.
+// SetListeningPorts sets the pod's listening ports, used to tell client from
+// server on connections that were open before capture started.
+func (a *TCPAssembler) SetListeningPorts(listeners *ListeningPorts) {
+	a.listeners = listeners
+}
+
+// SetProcessTable sets the table used to find the process that owns each
+// connection
+func (a *TCPAssembler) SetProcessTable(processes *ProcessTable) {
+	a.processes = processes
+}
+
+// SetResolvedNames sets the cache of addresses from DNS answers, used to
+// name destinations
+func (a *TCPAssembler) SetResolvedNames(names *ResolvedNames) {
+	a.names = names
+}
+
+// ActiveFlows returns the number of connections being assembled
+func (a *TCPAssembler) ActiveFlows() int {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return len(a.flows)
+}
+
+// isAgentTraffic checks if a flow is this agent's gRPC connection to the
+// Hub. Returns true and the traffic type if this is agent traffic.
 func (a *TCPAssembler) isAgentTraffic(flow *TCPFlow) (bool, string) {
 	// Need both pod IP and hub IP to identify agent traffic
 	if a.agentPodIP == "" || a.hubIP == "" {
 		return false, ""
 	}
 
-	// Check if this is traffic from pod to hub on agent ports
-	isFromPodToHub := flow.SrcIP == a.agentPodIP && flow.DstIP == a.hubIP
-	isFromHubToPod := flow.SrcIP == a.hubIP && flow.DstIP == a.agentPodIP
-
+	// Connections joined late may have their direction guessed either way
+	isFromPodToHub := flow.SrcIP == a.agentPodIP && flow.DstIP == a.hubIP && flow.DstPort == HubGRPCPort
+	isFromHubToPod := flow.SrcIP == a.hubIP && flow.DstIP == a.agentPodIP && flow.SrcPort == HubGRPCPort
 	if !isFromPodToHub && !isFromHubToPod {
 		return false, ""
 	}
 
-	// Check if it's on agent communication ports (8080 or 9090)
-	isAgentPort := flow.DstPort == 8080 || flow.DstPort == 9090 ||
-		flow.SrcPort == 8080 || flow.SrcPort == 9090
-
-	if !isAgentPort {
-		return false, ""
-	}
-
-	// Determine traffic type from HTTP path if available
-	if flow.HTTP != nil && flow.HTTP.URL != "" {
-		switch {
-		case strings.HasPrefix(flow.HTTP.URL, "/api/health"):
-			return true, "health"
-		case strings.HasPrefix(flow.HTTP.URL, "/api/flows"):
-			return true, "flow"
-		case strings.HasPrefix(flow.HTTP.URL, "/api/pcap"):
-			return true, "pcap"
-		case strings.HasPrefix(flow.HTTP.URL, "/api/agents"):
-			return true, "registration"
-		}
-	}
-
-	// It's agent traffic but we couldn't determine the specific type
-	return true, "unknown"
+	// Registration, heartbeats and both streams share one connection
+	return true, "grpc"
 }
 
 // flowKey generates a unique key for a TCP flow
@@ -163,6 +243,17 @@ func (a *TCPAssembler) ProcessPacket(srcIP, dstIP string, srcPort, dstPort uint1
 	a.mutex.Lock()
 	flow, exists := a.flows[key]
 	if !exists {
+		// The rest of the teardown of a connection already reported, or
+		// data it retransmits. Only a new handshake starts another flow on
+		// the same ports.
+		if until, ok := a.closed[key]; ok {
+			if timestamp.Before(until) && !tcp.SYN {
+				a.mutex.Unlock()
+				return
+			}
+			delete(a.closed, key)
+		}
+
 		flow = &TCPFlow{
 			ID:        uuid.New().String()[:8],
 			SrcIP:     srcIP,
@@ -172,13 +263,43 @@ func (a *TCPAssembler) ProcessPacket(srcIP, dstIP string, srcPort, dstPort uint1
 			StartTime: timestamp,
 			Protocol:  protocol.ProtocolTCP,
 		}
+		// Without a SYN the first packet may come from either side
+		if !tcp.SYN {
+			flow.JoinedLate = true
+		}
+		if (tcp.SYN && tcp.ACK) || (flow.JoinedLate && a.isServerPort(srcPort, dstPort)) {
+			flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort = dstIP, dstPort, srcIP, srcPort
+		}
 		a.flows[key] = flow
 	}
-	flow.LastSeen = timestamp
 	a.mutex.Unlock()
 
+	flow.mu.Lock()
+	defer flow.mu.Unlock()
+
+	// Completed by the cleanup loop after the lookup
+	if flow.completed {
+		return
+	}
+	flow.LastSeen = timestamp
+
+	// The socket can only be found while it is open, so look it up as soon
+	// as the connection is seen
+	if !exists && a.processes != nil {
+		flow.Process = a.processes.Lookup("tcp", flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort)
+	}
+	// The answer that led to the connection comes just before it, and the
+	// address may be resolved from another name later
+	if !exists && a.names != nil {
+		flow.DstName = a.names.Lookup(flow.DstIP, timestamp)
+	}
+
 	// Track TCP state
 	isFromClient := srcIP == flow.SrcIP && srcPort == flow.SrcPort
+	stream, peer := &flow.server, &flow.client
+	if isFromClient {
+		stream, peer = &flow.client, &flow.server
+	}
 
 	if tcp.SYN && !tcp.ACK {
 		flow.SYNSeen = true
@@ -190,65 +311,247 @@ func (a *TCPAssembler) ProcessPacket(srcIP, dstIP string, srcPort, dstPort uint1
 		flow.SYNACKTime = timestamp
 	}
 
+	if tcp.SYN {
+		if stream.syn(tcp.Seq) {
+			flow.Retransmits++
+			stream.retransmitted()
+		} else {
+			// The SYN takes a sequence number, so its ACK times the handshake
+			stream.sent(tcp.Seq+1, timestamp)
+		}
+	}
+
 	if tcp.FIN {
 		flow.FINSeen = true
+		stream.finished = true
 	}
 
 	if tcp.RST {
 		flow.RSTSeen = true
+		flow.ResetBy = "server"
+		if isFromClient {
+			flow.ResetBy = "client"
+		}
 		a.completeFlow(key, flow)
 		return
 	}
 
+	if tcp.ACK {
+		peer.acked(tcp.Ack, timestamp)
+
+		// Repeated ACKs without data signal loss to the other side
+		pureAck := (appLayer == nil || len(appLayer.Payload()) == 0) && !tcp.SYN && !tcp.FIN
+		if pureAck && stream.duplicateAck(tcp.Ack, tcp.Window, peer) {
+			flow.DupAcks++
+		}
+	}
+
+	// Count transitions into a zero receive window, not every probe while stalled
+	if tcp.Window == 0 && !tcp.SYN && !tcp.FIN {
+		if !stream.zeroWindow {
+			flow.ZeroWindows++
+		}
+		stream.zeroWindow = true
+	} else {
+		stream.zeroWindow = false
+	}
+
 	// Track payload
 	if appLayer != nil && len(appLayer.Payload()) > 0 {
 		payload := appLayer.Payload()
 
-		if flow.FirstDataTime.IsZero() {
-			flow.FirstDataTime = timestamp
-		}
-
 		if isFromClient {
 			flow.PacketsSent++
 			flow.BytesSent += uint64(len(payload))
-			flow.ClientData.Write(payload)
 		} else {
 			flow.PacketsRecv++
 			flow.BytesReceived += uint64(len(payload))
-			flow.ServerData.Write(payload)
-			// Track first server response byte for TTFB
-			if flow.FirstServerDataTime.IsZero() {
-				flow.FirstServerDataTime = timestamp
-			}
 		}
 
-		// Try to detect protocol from first data packet
-		if flow.Protocol == protocol.ProtocolTCP {
-			flow.Protocol = a.detectProtocol(payload, dstPort)
+		// Payload sits after the SYN's sequence number (TCP Fast Open)
+		seq := tcp.Seq
+		if tcp.SYN {
+			seq++
 		}
 
-		// Track TLS timing events
-		if len(payload) > 0 {
-			// TLS record type 0x16 = Handshake (ClientHello starts here)
-			if payload[0] == 0x16 && flow.TLSClientHelloTime.IsZero() && isFromClient {
-				flow.TLSClientHelloTime = timestamp
-			}
-			// TLS record type 0x17 = Application Data (handshake complete)
-			if payload[0] == 0x17 && flow.TLSAppDataTime.IsZero() {
-				flow.TLSAppDataTime = timestamp
-			}
+		buffered := flow.bufferedBytes()
+		kind, segments := stream.add(seq, payload, timestamp)
+		switch kind {
+		case segmentRetransmit:
+			flow.Retransmits++
+			stream.retransmitted()
+		case segmentOutOfOrder:
+			flow.OutOfOrder++
+			stream.sent(seq+uint32(len(payload)), timestamp)
+		default:
+			stream.sent(seq+uint32(len(payload)), timestamp)
+		}
+
+		for _, seg := range segments {
+			a.addData(flow, seg.data, seg.ts, isFromClient, flow.DstPort)
 		}
 
 		// Parse protocol-specific data
-		a.parsePayload(flow)
+		if len(segments) > 0 {
+			a.parsePayload(flow)
+			a.releaseParsed(flow)
+		}
+		a.buffered.Add(int64(flow.bufferedBytes() - buffered))
 	}
 
-	// Complete flow on FIN
-	if flow.FINSeen && flow.SYNACKSeen {
+	// Complete flow once both sides have closed it. After the first FIN
+	// the other side may still send, e.g. the response to a half-closed
+	// request.
+	if flow.client.finished && flow.server.finished && (flow.SYNACKSeen || flow.JoinedLate) {
 		a.completeFlow(key, flow)
 	}
 }
 
+// isServerPort guesses whether the sender of a packet on a connection that
+// was already open is the server. Ports the pod listens on decide it; for
+// the pod's outgoing connections the local side uses an ephemeral port.
+func (a *TCPAssembler) isServerPort(srcPort, dstPort uint16) bool {
+	if podServes(a.listeners, srcPort, dstPort) {
+		return true
+	}
+	if podServes(a.listeners, dstPort, srcPort) {
+		return false
+	}
+	return !isEphemeralPort(srcPort) && isEphemeralPort(dstPort)
+}
+
+// podServes reports whether the pod listens on port but not on peer, so it
+// is the server of a connection between them. Without the listening ports
+// it never is.
+func podServes(listeners *ListeningPorts, port, peer uint16) bool {
+	return listeners != nil && listeners.Contains(port) && !listeners.Contains(peer)
+}
+
+// isEphemeralPort reports whether port is in Linux's default range for
+// outgoing connections (net.ipv4.ip_local_port_range)
+func isEphemeralPort(port uint16) bool {
+	return port >= 32768 && port <= 60999
+}
+
+// addData handles in-order stream data, buffering what is left to parse
+func (a *TCPAssembler) addData(flow *TCPFlow, payload []byte, timestamp time.Time, isFromClient bool, dstPort uint16) {
+	if flow.FirstDataTime.IsZero() {
+		flow.FirstDataTime = timestamp
+	}
+
+	// Track first server response byte for TTFB
+	if !isFromClient && flow.FirstServerDataTime.IsZero() {
+		flow.FirstServerDataTime = timestamp
+	}
+
+	// Try to detect protocol from first data packet
+	if flow.Protocol == protocol.ProtocolTCP {
+		flow.Protocol = a.detectProtocol(payload, dstPort)
+	}
+
+	// Track TLS timing events
+	// TLS record type 0x16 = Handshake (ClientHello starts here)
+	if payload[0] == 0x16 && flow.TLSClientHelloTime.IsZero() && isFromClient {
+		flow.TLSClientHelloTime = timestamp
+	}
+	// TLS record type 0x17 = Application Data (handshake complete)
+	if payload[0] == 0x17 && flow.TLSAppDataTime.IsZero() {
+		flow.TLSAppDataTime = timestamp
+	}
+
+	a.bufferData(flow, payload, timestamp, isFromClient)
+}
+
+// bufferData appends payload to the direction's buffer for parsing, within
+// the per-flow and global budgets
+func (a *TCPAssembler) bufferData(flow *TCPFlow, payload []byte, timestamp time.Time, isFromClient bool) {
+	// Nothing parses unrecognized streams
+	if flow.Protocol == protocol.ProtocolTCP {
+		return
+	}
+
+	buf, marks, skip, done := &flow.ServerData, &flow.serverMarks, &flow.serverSkip, flow.serverDone
+	if isFromClient {
+		buf, marks, skip, done = &flow.ClientData, &flow.clientMarks, &flow.clientSkip, flow.clientDone
+	}
+	if done {
+		return
+	}
+
+	// Drop the rest of a body that has already been captured
+	if *skip > 0 {
+		n := min(*skip, int64(len(payload)))
+		*skip -= n
+		payload = payload[n:]
+		if len(payload) == 0 {
+			return
+		}
+	}
+
+	if buf.Len()+len(payload) > MaxFlowBufferSize || a.buffered.Load()+int64(len(payload)) > MaxBufferedBytes {
+		flow.Truncated = true
+		flow.release(isFromClient)
+		return
+	}
+
+	mark := dataMark{offset: buf.Len(), ts: timestamp}
+	buf.Write(payload)
+
+	// Remember arrival times so each HTTP exchange gets its own timing
+	switch flow.Protocol {
+	case protocol.ProtocolHTTP, protocol.ProtocolHTTP2, protocol.ProtocolGRPC:
+		*marks = append(*marks, mark)
+	}
+}
+
+// releaseParsed stops buffering directions nothing more can be parsed from
+func (a *TCPAssembler) releaseParsed(flow *TCPFlow) {
+	switch flow.Protocol {
+	case protocol.ProtocolHTTP:
+		if flow.httpUpgraded {
+			flow.release(true)
+			flow.release(false)
+		}
+	case protocol.ProtocolHTTP2, protocol.ProtocolGRPC:
+		if flow.h2 != nil && flow.h2.client.failed {
+			flow.release(true)
+		}
+		if flow.h2 != nil && flow.h2.server.failed {
+			flow.release(false)
+		}
+	case protocol.ProtocolTLS, protocol.ProtocolHTTPS:
+		// Only the ClientHello and ServerHello are parsed
+		if flow.TLS == nil && flow.ClientData.Len() > 0 && flow.ClientData.Bytes()[0] != 0x16 {
+			flow.release(true)
+			flow.release(false)
+		}
+		if flow.TLS != nil {
+			flow.release(true)
+		}
+		if flow.TLS != nil && flow.TLS.CipherSuite != "" {
+			flow.release(false)
+		}
+	}
+}
+
+// release drops one direction's buffered payload and stops buffering it
+func (f *TCPFlow) release(fromClient bool) {
+	if fromClient {
+		f.clientDone = true
+		f.ClientData = bytes.Buffer{}
+		f.clientMarks = nil
+	} else {
+		f.serverDone = true
+		f.ServerData = bytes.Buffer{}
+		f.serverMarks = nil
+	}
+}
+
+// bufferedBytes is the payload held for the flow, in order or not
+func (f *TCPFlow) bufferedBytes() int {
+	return f.ClientData.Len() + f.ServerData.Len() + f.client.pendingBytes + f.server.pendingBytes
+}
+
 // detectProtocol tries to detect the application protocol
 func (a *TCPAssembler) detectProtocol(payload []byte, dstPort uint16) protocol.Protocol {
 	// Check for TLS ClientHello
@@ -256,6 +559,11 @@ func (a *TCPAssembler) detectProtocol(payload []byte, dstPort uint16) protocol.P
 		return protocol.ProtocolTLS
 	}
 
+	// Check for the HTTP/2 preface (h2c, including plaintext gRPC)
+	if isHTTP2Preface(payload) {
+		return protocol.ProtocolHTTP2
+	}
+
 	// Check for HTTP
 	if isHTTPMethod(payload) {
 		return protocol.ProtocolHTTP
@@ -289,72 +597,244 @@ func (a *TCPAssembler) parsePayload(flow *TCPFlow) {
 	switch flow.Protocol {
 	case protocol.ProtocolHTTP:
 		a.parseHTTP(flow)
+	case protocol.ProtocolHTTP2, protocol.ProtocolGRPC:
+		a.parseHTTP2(flow)
 	case protocol.ProtocolTLS, protocol.ProtocolHTTPS:
 		a.parseTLS(flow)
 	}
 }
 
-// parseHTTP parses HTTP request/response
+// parseHTTP parses every HTTP/1.x request and response on the connection
 func (a *TCPAssembler) parseHTTP(flow *TCPFlow) {
-	// Parse request from client data (only if not already parsed)
-	if flow.HTTP == nil && flow.ClientData.Len() > 0 {
-		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(flow.ClientData.Bytes())))
-		if err == nil {
-			flow.HTTP = &protocol.HTTPInfo{
-				Method:         req.Method,
-				URL:            req.URL.String(),
-				Host:           req.Host,
-				RequestHeaders: make(map[string]string),
-			}
+	if flow.httpUpgraded {
+		return
+	}
+
+	a.parseHTTPRequests(flow)
+	a.parseHTTPResponses(flow)
+}
 
-			// Copy headers
-			for k, v := range req.Header {
-				flow.HTTP.RequestHeaders[k] = strings.Join(v, ", ")
+// parseHTTPRequests reads requests from the client data in order, starting a
+// new exchange for each one
+func (a *TCPAssembler) parseHTTPRequests(flow *TCPFlow) {
+	for flow.ClientData.Len() > 0 {
+		data := flow.ClientData.Bytes()
+		rd := bytes.NewReader(data)
+		br := bufio.NewReader(rd)
+
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			// Headers incomplete or not HTTP, wait for more data
+			return
+		}
+		headerLen := len(data) - rd.Len() - br.Buffered()
+		body, complete := readHTTPBody(req.Body)
+
+		// A request with a partial body is re-read as data arrives
+		ex := flow.httpPartial
+		if ex == nil {
+			// Responses pair with requests by position, so requests still
+			// waiting for theirs can't be dropped. A client that far ahead of
+			// the server is no longer followed.
+			if len(flow.HTTPExchanges)-flow.httpResponses >= MaxFlowExchanges {
+				flow.Truncated = true
+				flow.release(true)
+				return
 			}
+			ex = &protocol.HTTPExchange{RequestTime: markTime(flow.clientMarks)}
+			flow.addExchange(ex)
+		}
 
-			// Extract request body (limited to MaxBodySize)
-			if req.Body != nil {
-				bodyData, err := io.ReadAll(io.LimitReader(req.Body, MaxBodySize))
-				req.Body.Close()
-				if err != nil {
-					log.Printf("WARN: Failed to read request body: %v", err)
-				}
-				if len(bodyData) > 0 {
-					flow.HTTP.RequestBody = string(bodyData)
-				}
+		ex.Method = req.Method
+		ex.URL = req.URL.String()
+		ex.Host = req.Host
+		ex.RequestHeaders = make(map[string]string)
+		for k, v := range req.Header {
+			ex.RequestHeaders[k] = strings.Join(v, ", ")
+		}
+		if len(body) > 0 {
+			ex.RequestBody = string(body)
+		}
+
+		flow.Protocol = protocol.ProtocolHTTP
+
+		if !complete {
+			// Once the captured body is full the rest is dropped, not buffered
+			if req.ContentLength > MaxBodySize && len(body) == MaxBodySize {
+				flow.httpPartial = nil
+				flow.clientSkip = req.ContentLength - int64(len(data)-headerLen)
+				flow.ClientData.Reset()
+				flow.clientMarks = nil
+				return
 			}
+			flow.httpPartial = ex
+			return
+		}
+		flow.httpPartial = nil
+
+		n := len(data) - rd.Len() - br.Buffered()
+		flow.ClientData.Next(n)
+		flow.clientMarks = consumeMarks(flow.clientMarks, n)
+	}
+}
+
+// addExchange records a new exchange, dropping the oldest once the
+// connection has MaxFlowExchanges of them. The first one stays the flow's
+// HTTP info either way.
+func (flow *TCPFlow) addExchange(ex *protocol.HTTPExchange) {
+	if flow.HTTP == nil {
+		flow.HTTP = &ex.HTTPInfo
+	}
+	flow.HTTPExchanges = append(flow.HTTPExchanges, ex)
+	if len(flow.HTTPExchanges) <= MaxFlowExchanges {
+		return
+	}
+
+	flow.HTTPExchanges[0] = nil // let it be collected
+	flow.HTTPExchanges = flow.HTTPExchanges[1:]
+	flow.exchangeBase++
+	flow.droppedExchanges++
+	if flow.httpResponses > 0 {
+		flow.httpResponses--
+	}
+}
 
-			flow.Protocol = protocol.ProtocolHTTP
+// releaseSentExchanges lets go of the leading exchanges that can no longer
+// change once a snapshot has sent them, so the next one only carries what
+// is new. HTTP/1.x exchanges are done once their response is, HTTP/2 ones
+// once their stream has closed.
+func (flow *TCPFlow) releaseSentExchanges() {
+	done := flow.httpResponses
+	if flow.h2 != nil {
+		open := make(map[*protocol.HTTPExchange]bool, len(flow.h2.streams))
+		for _, st := range flow.h2.streams {
+			open[st.ex] = true
+		}
+		for done < len(flow.HTTPExchanges) && !open[flow.HTTPExchanges[done]] {
+			done++
 		}
 	}
 
-	// Parse response from server data (only if request parsed and response not yet parsed)
-	if flow.HTTP != nil && flow.HTTP.StatusCode == 0 && flow.ServerData.Len() > 0 {
-		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(flow.ServerData.Bytes())), nil)
-		if err == nil {
-			flow.HTTP.StatusCode = resp.StatusCode
-			flow.HTTP.StatusText = resp.Status
-			flow.HTTP.ResponseHeaders = make(map[string]string)
-			flow.HTTP.ContentType = resp.Header.Get("Content-Type")
-			flow.HTTP.ContentLength = resp.ContentLength
+	clear(flow.HTTPExchanges[:done]) // let them be collected
+	flow.HTTPExchanges = flow.HTTPExchanges[done:]
+	flow.exchangeBase += done
+	flow.httpResponses = max(flow.httpResponses-done, 0)
+}
 
-			for k, v := range resp.Header {
-				flow.HTTP.ResponseHeaders[k] = strings.Join(v, ", ")
+// parseHTTPResponses reads responses from the server data and pairs them
+// with requests in order, as HTTP/1.1 requires for pipelining
+func (a *TCPAssembler) parseHTTPResponses(flow *TCPFlow) {
+	for flow.ServerData.Len() > 0 && flow.httpResponses < len(flow.HTTPExchanges) {
+		ex := flow.HTTPExchanges[flow.httpResponses]
+		data := flow.ServerData.Bytes()
+		rd := bytes.NewReader(data)
+		br := bufio.NewReader(rd)
+
+		// The request method decides whether a body follows (e.g. HEAD)
+		resp, err := http.ReadResponse(br, &http.Request{Method: ex.Method})
+		if err != nil {
+			return
+		}
+		headerLen := len(data) - rd.Len() - br.Buffered()
+
+		// Without a length the body runs until the connection closes
+		untilClose := resp.Body != http.NoBody && resp.ContentLength < 0 && len(resp.TransferEncoding) == 0
+		body, complete := readHTTPBody(resp.Body)
+		n := len(data) - rd.Len() - br.Buffered()
+
+		// Interim responses such as 100 Continue precede the final one
+		if resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+			flow.ServerData.Next(n)
+			flow.serverMarks = consumeMarks(flow.serverMarks, n)
+			continue
+		}
+
+		if ex.ResponseTime.IsZero() {
+			ex.ResponseTime = markTime(flow.serverMarks)
+			if !ex.RequestTime.IsZero() && !ex.ResponseTime.IsZero() {
+				ex.DurationMs = ex.ResponseTime.Sub(ex.RequestTime).Seconds() * 1000
 			}
+		}
 
-			// Extract response body (limited to MaxBodySize)
-			if resp.Body != nil {
-				bodyData, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySize))
-				resp.Body.Close()
-				if err != nil {
-					log.Printf("WARN: Failed to read response body: %v", err)
-				}
-				if len(bodyData) > 0 {
-					flow.HTTP.ResponseBody = string(bodyData)
-				}
+		ex.StatusCode = resp.StatusCode
+		ex.StatusText = resp.Status
+		ex.ContentType = resp.Header.Get("Content-Type")
+		ex.ContentLength = resp.ContentLength
+		ex.ResponseHeaders = make(map[string]string)
+		for k, v := range resp.Header {
+			ex.ResponseHeaders[k] = strings.Join(v, ", ")
+		}
+		if len(body) > 0 {
+			ex.ResponseBody = string(body)
+		}
+
+		if !complete || untilClose {
+			if len(body) < MaxBodySize {
+				return
 			}
+			// The captured body is full, drop the rest instead of buffering it
+			if untilClose {
+				flow.release(false)
+				return
+			}
+			if resp.ContentLength > MaxBodySize && len(resp.TransferEncoding) == 0 {
+				flow.serverSkip = resp.ContentLength - int64(len(data)-headerLen)
+				flow.ServerData.Reset()
+				flow.serverMarks = nil
+				flow.httpResponses++
+			}
+			return
+		}
+
+		flow.ServerData.Next(n)
+		flow.serverMarks = consumeMarks(flow.serverMarks, n)
+		flow.httpResponses++
+
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			flow.httpUpgraded = true
+			return
+		}
+	}
+}
+
+// readHTTPBody drains a message body, keeping at most MaxBodySize bytes.
+// complete is false when the body continues past the data captured so far.
+func readHTTPBody(body io.ReadCloser) ([]byte, bool) {
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, MaxBodySize))
+	if err == nil {
+		_, err = io.Copy(io.Discard, body)
+	}
+	return data, err == nil
+}
+
+// markTime returns when the first byte still in a data buffer arrived
+func markTime(marks []dataMark) time.Time {
+	var ts time.Time
+	for _, m := range marks {
+		if m.offset > 0 {
+			break
 		}
+		ts = m.ts
 	}
+	return ts
+}
+
+// consumeMarks shifts marks after n bytes are removed from the front of a buffer
+func consumeMarks(marks []dataMark, n int) []dataMark {
+	i := 0
+	for i+1 < len(marks) && marks[i+1].offset <= n {
+		i++
+	}
+	marks = marks[i:]
+	for j := range marks {
+		marks[j].offset -= n
+		if marks[j].offset < 0 {
+			marks[j].offset = 0
+		}
+	}
+	return marks
 }
 
 // parseTLS parses TLS ClientHello and ServerHello to extract SNI, cipher suites, and negotiated cipher
@@ -601,13 +1081,124 @@ func extractSNI(data []byte) string {
 	return extractTLSClientHelloInfo(data).SNI
 }
 
-// completeFlow marks a flow as complete and sends it
+// completeFlow marks a flow as complete and sends it. The caller holds flow.mu.
 func (a *TCPAssembler) completeFlow(key string, flow *TCPFlow) {
+	if flow.completed {
+		return
+	}
+	flow.completed = true
+
 	a.mutex.Lock()
-	delete(a.flows, key)
+	if a.flows[key] == flow {
+		delete(a.flows, key)
+		// A connection that timed out may still be alive, so only a torn
+		// down one absorbs what follows
+		if flow.FINSeen || flow.RSTSeen {
+			if a.closed == nil {
+				a.closed = make(map[string]time.Time)
+			}
+			a.closed[key] = flow.LastSeen.Add(FlowTimeout)
+		}
+	}
 	a.mutex.Unlock()
 
-	// Build final Flow struct
+	a.buffered.Add(-int64(flow.bufferedBytes()))
+
+	f := a.buildFlow(flow)
+	f.HTTP = flow.HTTP
+	f.HTTPExchanges = flow.HTTPExchanges
+	f.TLS = flow.TLS
+
+	// Set status
+	if flow.RSTSeen {
+		f.Status = protocol.StatusReset
+	} else if flow.FINSeen {
+		f.Status = protocol.StatusClosed
+	} else {
+		f.Status = protocol.StatusTimeout
+	}
+
+	// Notify callback
+	if a.onFlowComplete != nil {
+		a.onFlowComplete(f)
+	}
+}
+
+// hasPayload reports whether the connection carried any data
+func (flow *TCPFlow) hasPayload() bool {
+	return flow.PacketsSent > 0 || flow.PacketsRecv > 0
+}
+
+// hasContent reports whether there is anything to report about the
+// connection: an attempt to open it or data sent over it
+func (flow *TCPFlow) hasContent() bool {
+	return flow.SYNSeen || flow.SYNACKSeen || flow.hasPayload()
+}
+
+// snapshotFlow builds an open flow for a connection that is still active.
+// Parsed data is copied, since later packets keep updating it. Exchanges
+// sent in an earlier snapshot that have not changed since are left out. The
+// caller holds flow.mu.
+func (a *TCPAssembler) snapshotFlow(flow *TCPFlow) *protocol.Flow {
+	// Retry an owner missed when the connection was new
+	if flow.Process == nil && a.processes != nil {
+		flow.Process = a.processes.Lookup("tcp", flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort)
+	}
+
+	f := a.buildFlow(flow)
+	f.Status = protocol.StatusOpen
+	f.HTTPExchanges = cloneExchanges(flow.HTTPExchanges)
+	if flow.HTTP != nil {
+		// The first exchange, which may have been dropped from the list since
+		http := *flow.HTTP
+		http.RequestHeaders = maps.Clone(flow.HTTP.RequestHeaders)
+		http.ResponseHeaders = maps.Clone(flow.HTTP.ResponseHeaders)
+		f.HTTP = &http
+	}
+	if flow.TLS != nil {
+		tls := *flow.TLS
+		f.TLS = &tls
+	}
+	flow.releaseSentExchanges()
+	flow.lastSnapshot = flow.LastSeen
+	return f
+}
+
+// destinationName returns the hostname the client reached the server by:
+// the name it resolved, else the one it sent in TLS or HTTP
+func (flow *TCPFlow) destinationName() (string, string) {
+	switch {
+	case flow.DstName != "":
+		return flow.DstName, NameSourceDNS
+	case flow.TLS != nil && flow.TLS.SNI != "":
+		return flow.TLS.SNI, NameSourceSNI
+	case flow.HTTP != nil && flow.HTTP.Host != "":
+		return hostName(flow.HTTP.Host), NameSourceHost
+	}
+	return "", ""
+}
+
+// cloneExchanges copies exchanges along with their header maps
+func cloneExchanges(exchanges []*protocol.HTTPExchange) []*protocol.HTTPExchange {
+	if exchanges == nil {
+		return nil
+	}
+	out := make([]*protocol.HTTPExchange, len(exchanges))
+	for i, ex := range exchanges {
+		c := *ex
+		c.RequestHeaders = maps.Clone(ex.RequestHeaders)
+		c.ResponseHeaders = maps.Clone(ex.ResponseHeaders)
+		if ex.GRPC != nil {
+			grpc := *ex.GRPC
+			c.GRPC = &grpc
+		}
+		out[i] = &c
+	}
+	return out
+}
+
+// buildFlow converts connection state into a Flow, without parsed payload data
+func (a *TCPAssembler) buildFlow(flow *TCPFlow) *protocol.Flow {
 	f := &protocol.Flow{
 		ID:            flow.ID,
 		Timestamp:     flow.StartTime,
@@ -621,56 +1212,34 @@ func (a *TCPAssembler) completeFlow(key string, flow *TCPFlow) {
 		BytesReceived: flow.BytesReceived,
 		PacketsSent:   flow.PacketsSent,
 		PacketsRecv:   flow.PacketsRecv,
-		HTTP:          flow.HTTP,
-		TLS:           flow.TLS,
+		Retransmits:   flow.Retransmits,
+		OutOfOrder:    flow.OutOfOrder,
+		ZeroWindows:   flow.ZeroWindows,
+		DupAcks:       flow.DupAcks,
+		ResetBy:       flow.ResetBy,
+		Truncated:     flow.Truncated,
+		JoinedLate:    flow.JoinedLate,
+		Process:       flow.Process,
+
+		ExchangeOffset:   flow.exchangeBase,
+		DroppedExchanges: flow.droppedExchanges,
 	}
+	f.DstName, f.DstNameSource = flow.destinationName()
 
-	// Populate pod names based on agent info
-	// The agent is injected into a specific pod, so we know its IP
-	// All traffic on the pod's network interface involves this pod
-	log.Printf("DEBUG: completeFlow - agentPodName=%q agentPodIP=%q flow.SrcIP=%s flow.DstIP=%s flow.SrcPort=%d flow.DstPort=%d",
-		a.agentPodName, a.agentPodIP, flow.SrcIP, flow.DstIP, flow.SrcPort, flow.DstPort)
-
-	if a.agentPodName != "" && a.agentNamespace != "" {
-		// Since the agent runs in the target pod's network namespace,
-		// all captured traffic is to/from this pod
-		// Try to match IPs, but also use the pod info as a fallback
-		if a.agentPodIP != "" {
-			if flow.SrcIP == a.agentPodIP {
-				f.SrcPod = a.agentPodName
-				f.SrcNamespace = a.agentNamespace
-				log.Printf("DEBUG: Matched SrcIP=%s to pod %s/%s", flow.SrcIP, a.agentNamespace, a.agentPodName)
-			}
-			if flow.DstIP == a.agentPodIP {
-				f.DstPod = a.agentPodName
-				f.DstNamespace = a.agentNamespace
-				log.Printf("DEBUG: Matched DstIP=%s to pod %s/%s", flow.DstIP, a.agentNamespace, a.agentPodName)
-			}
-		}
-		// If neither IP matched but we have agent info, the source is likely our pod
-		// (since we're capturing on the pod's interface, outgoing traffic has our IP as source)
-		if f.SrcPod == "" && f.DstPod == "" && a.agentPodName != "" {
-			// For outgoing connections (high src port), source is our pod
-			// For incoming connections (listening on low port), dest is our pod
-			if flow.SrcPort > 1024 {
-				f.SrcPod = a.agentPodName
-				f.SrcNamespace = a.agentNamespace
-				log.Printf("DEBUG: Fallback - assigned SrcPod=%s/%s (high src port %d)", a.agentNamespace, a.agentPodName, flow.SrcPort)
-			} else {
-				f.DstPod = a.agentPodName
-				f.DstNamespace = a.agentNamespace
-				log.Printf("DEBUG: Fallback - assigned DstPod=%s/%s (low src port %d)", a.agentNamespace, a.agentPodName, flow.SrcPort)
-			}
-		}
+	// The capture point sits at one end of the connection, so that host's
+	// own ACKs return almost at once. The slower direction is the round trip
+	// across the network.
+	if srtt := max(flow.client.srtt, flow.server.srtt); srtt > 0 {
+		f.SmoothedRTTMs = srtt.Seconds() * 1000
 	}
 
-	log.Printf("DEBUG: Final flow - SrcPod=%q DstPod=%q", f.SrcPod, f.DstPod)
+	// Populate pod names based on agent info
+	assignPods(f, a.agentPodName, a.agentNamespace, a.agentPodIP, a.listeners)
 
 	// Tag agent traffic for filtering
 	if isAgent, trafficType := a.isAgentTraffic(flow); isAgent {
 		f.IsAgentTraffic = true
 		f.AgentTrafficType = trafficType
-		log.Printf("DEBUG: Tagged as agent traffic - type=%s", trafficType)
 	}
 
 	// Calculate timing
@@ -697,36 +1266,116 @@ func (a *TCPAssembler) completeFlow(key string, flow *TCPFlow) {
 		}
 	}
 
-	// Set status
-	if flow.RSTSeen {
-		f.Status = protocol.StatusReset
-	} else if flow.FINSeen {
-		f.Status = protocol.StatusClosed
-	} else {
-		f.Status = protocol.StatusTimeout
+	return f
+}
+
+// assignPods fills in the agent's pod on whichever side of the flow it is on
+func assignPods(f *protocol.Flow, podName, namespace, podIP string, listeners *ListeningPorts) {
+	// The agent is injected into a specific pod, so we know its IP
+	// All traffic on the pod's network interface involves this pod
+	if podName != "" && namespace != "" {
+		// Since the agent runs in the target pod's network namespace,
+		// all captured traffic is to/from this pod
+		// Try to match IPs, but also use the pod info as a fallback
+		if podIP != "" {
+			if f.SrcIP == podIP {
+				f.SrcPod = podName
+				f.SrcNamespace = namespace
+			}
+			if f.DstIP == podIP {
+				f.DstPod = podName
+				f.DstNamespace = namespace
+			}
+		}
+		// If neither IP matched but we have agent info, decide by the ports.
+		// Flows run from client to server, so the pod is the destination of
+		// connections to a port it listens on and the source of the rest.
+		if f.SrcPod == "" && f.DstPod == "" && podName != "" {
+			if podServes(listeners, f.DstPort, f.SrcPort) {
+				f.DstPod = podName
+				f.DstNamespace = namespace
+			} else {
+				f.SrcPod = podName
+				f.SrcNamespace = namespace
+			}
+		}
 	}
+}
 
-	// Notify callback
-	if a.onFlowComplete != nil {
-		a.onFlowComplete(f)
+// expire ends connections that never got established within FlowTimeout,
+// and established ones silent for IdleFlowTimeout, as timed out. Ones only
+// one side closed are reported closed once silent for FlowTimeout. Stray
+// packets that carried nothing are forgotten without a report. Completed
+// connections stop absorbing teardown packets once their window is over.
+func (a *TCPAssembler) expire(now time.Time) {
+	a.mutex.Lock()
+	flows := make(map[string]*TCPFlow, len(a.flows))
+	maps.Copy(flows, a.flows)
+	for key, until := range a.closed {
+		if now.After(until) {
+			delete(a.closed, key)
+		}
+	}
+	a.mutex.Unlock()
+
+	for key, flow := range flows {
+		flow.mu.Lock()
+		idle := now.Sub(flow.LastSeen)
+		established := flow.SYNACKSeen || (flow.JoinedLate && flow.hasPayload()) || (flow.PacketsSent > 0 && flow.PacketsRecv > 0)
+		switch {
+		case flow.completed:
+		case !flow.hasContent() && idle > FlowTimeout:
+			// e.g. keepalives of a connection that ended before capture
+			flow.completed = true
+			a.mutex.Lock()
+			if a.flows[key] == flow {
+				delete(a.flows, key)
+			}
+			a.mutex.Unlock()
+		case !established && idle > FlowTimeout, idle > IdleFlowTimeout:
+			a.completeFlow(key, flow)
+		case flow.FINSeen && idle > FlowTimeout:
+			// Half closed, and the other side's FIN was missed
+			a.completeFlow(key, flow)
+		}
+		flow.mu.Unlock()
 	}
 }
 
-// cleanupLoop removes stale flows
+// snapshot reports flows open for at least SnapshotInterval that have seen
+// traffic since they were last reported. Flows without a handshake or
+// payload have nothing to show yet.
+func (a *TCPAssembler) snapshot(now time.Time) {
+	a.mutex.RLock()
+	flows := make([]*TCPFlow, 0, len(a.flows))
+	for _, flow := range a.flows {
+		flows = append(flows, flow)
+	}
+	a.mutex.RUnlock()
+
+	for _, flow := range flows {
+		var snapshot *protocol.Flow
+
+		flow.mu.Lock()
+		if !flow.completed && flow.hasContent() && now.Sub(flow.StartTime) >= SnapshotInterval && flow.LastSeen.After(flow.lastSnapshot) {
+			snapshot = a.snapshotFlow(flow)
+		}
+		flow.mu.Unlock()
+
+		if snapshot != nil && a.onFlowComplete != nil {
+			a.onFlowComplete(snapshot)
+		}
+	}
+}
+
+// cleanupLoop expires stale flows and reports the ones still open
 func (a *TCPAssembler) cleanupLoop() {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(SnapshotInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		a.mutex.Lock()
 		now := time.Now()
-		for key, flow := range a.flows {
-			if now.Sub(flow.LastSeen) > FlowTimeout {
-				delete(a.flows, key)
-				// Complete the flow with timeout
-				go a.completeFlow(key, flow)
-			}
-		}
-		a.mutex.Unlock()
+		a.expire(now)
+		a.snapshot(now)
 	}
 }
@@ -1,8 +1,13 @@
 package agent
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/podscope/podscope/pkg/protocol"
 )
 
@@ -1165,202 +1170,358 @@ func TestParseHTTP_URLWithQueryString(t *testing.T) {
 	}
 }
 
-// Test isAgentTraffic - verifies correct identification of agent-to-hub communication
+// Test HTTP keep-alive and pipelining - one exchange per request/response pair
 
-// Helper to create an assembler with agent and hub info for testing
-func newTestAssemblerWithInfo(podIP, hubIP string) *TCPAssembler {
-	a := &TCPAssembler{
-		flows:      make(map[string]*TCPFlow),
-		agentPodIP: podIP,
-		hubIP:      hubIP,
+func TestParseHTTP_KeepAlive_OneExchangePerRequest(t *testing.T) {
+	assembler := newTestAssembler()
+	flow := newTestFlowWithHTTPData(nil, nil)
+
+	paths := []string{"/a", "/b", "/c"}
+	for i, path := range paths {
+		flow.ClientData.WriteString("GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		assembler.parseHTTP(flow)
+		flow.ServerData.WriteString(fmt.Sprintf("HTTP/1.1 %d OK\r\nContent-Length: 2\r\n\r\nok", 200+i))
+		assembler.parseHTTP(flow)
+	}
+
+	if len(flow.HTTPExchanges) != len(paths) {
+		t.Fatalf("got %d exchanges, want %d", len(flow.HTTPExchanges), len(paths))
+	}
+	for i, ex := range flow.HTTPExchanges {
+		if ex.URL != paths[i] {
+			t.Errorf("exchange %d URL = %q, want %q", i, ex.URL, paths[i])
+		}
+		if ex.StatusCode != 200+i {
+			t.Errorf("exchange %d StatusCode = %d, want %d", i, ex.StatusCode, 200+i)
+		}
+		if ex.ResponseBody != "ok" {
+			t.Errorf("exchange %d ResponseBody = %q, want %q", i, ex.ResponseBody, "ok")
+		}
+	}
+	if flow.HTTP == nil || flow.HTTP.URL != "/a" {
+		t.Errorf("flow.HTTP should be the first exchange, got %+v", flow.HTTP)
+	}
+	if flow.ClientData.Len() != 0 || flow.ServerData.Len() != 0 {
+		t.Errorf("complete messages should be consumed, %d client and %d server bytes left",
+			flow.ClientData.Len(), flow.ServerData.Len())
 	}
-	return a
 }
 
-func TestIsAgentTraffic_PodToHubPort8080(t *testing.T) {
-	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
+func TestParseHTTP_Pipelined_MatchesResponsesInOrder(t *testing.T) {
+	assembler := newTestAssembler()
+	requests := "GET /first HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+		"POST /second HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello" +
+		"GET /third HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	responses := "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none" +
+		"HTTP/1.1 201 Created\r\nTransfer-Encoding: chunked\r\n\r\n3\r\ntwo\r\n0\r\n\r\n" +
+		"HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"
+	flow := newTestFlowWithHTTPData([]byte(requests), []byte(responses))
 
-	flow := &TCPFlow{
-		SrcIP:   "10.0.0.5",   // Pod IP
-		DstIP:   "10.0.0.100", // Hub IP
-		SrcPort: 45678,
-		DstPort: 8080, // Agent HTTP port
+	assembler.parseHTTP(flow)
+
+	want := []struct {
+		method string
+		url    string
+		status int
+		body   string
+	}{
+		{"GET", "/first", 200, "one"},
+		{"POST", "/second", 201, "two"},
+		{"GET", "/third", 404, ""},
+	}
+	if len(flow.HTTPExchanges) != len(want) {
+		t.Fatalf("got %d exchanges, want %d", len(flow.HTTPExchanges), len(want))
+	}
+	for i, w := range want {
+		ex := flow.HTTPExchanges[i]
+		if ex.Method != w.method || ex.URL != w.url || ex.StatusCode != w.status || ex.ResponseBody != w.body {
+			t.Errorf("exchange %d = %s %s -> %d %q, want %s %s -> %d %q",
+				i, ex.Method, ex.URL, ex.StatusCode, ex.ResponseBody, w.method, w.url, w.status, w.body)
+		}
 	}
+	if flow.HTTPExchanges[1].RequestBody != "hello" {
+		t.Errorf("exchange 1 RequestBody = %q, want %q", flow.HTTPExchanges[1].RequestBody, "hello")
+	}
+}
 
-	isAgent, trafficType := assembler.isAgentTraffic(flow)
+func TestParseHTTP_KeepAlive_DropsOldestPastLimit(t *testing.T) {
+	assembler := newTestAssembler()
+	flow := newTestFlowWithHTTPData(nil, nil)
 
-	if !isAgent {
-		t.Error("isAgentTraffic() should return true for pod->hub on port 8080")
+	total := MaxFlowExchanges + 5
+	for i := 0; i < total; i++ {
+		flow.ClientData.WriteString(fmt.Sprintf("GET /%d HTTP/1.1\r\nHost: example.com\r\n\r\n", i))
+		flow.ServerData.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+		assembler.parseHTTP(flow)
+	}
+
+	if len(flow.HTTPExchanges) != MaxFlowExchanges {
+		t.Fatalf("got %d exchanges, want %d", len(flow.HTTPExchanges), MaxFlowExchanges)
+	}
+	if flow.HTTPExchanges[0].URL != "/5" {
+		t.Errorf("oldest kept URL = %q, want %q", flow.HTTPExchanges[0].URL, "/5")
+	}
+	if last := flow.HTTPExchanges[len(flow.HTTPExchanges)-1]; last.StatusCode != 200 {
+		t.Errorf("newest exchange StatusCode = %d, want 200", last.StatusCode)
+	}
+	if flow.HTTP == nil || flow.HTTP.URL != "/0" {
+		t.Errorf("flow.HTTP should stay the first exchange, got %+v", flow.HTTP)
 	}
-	if trafficType != "unknown" {
-		t.Errorf("trafficType = %q, want %q (no HTTP parsed)", trafficType, "unknown")
+	if f := assembler.buildFlow(flow); f.DroppedExchanges != 5 {
+		t.Errorf("DroppedExchanges = %d, want 5", f.DroppedExchanges)
 	}
 }
 
-func TestIsAgentTraffic_PodToHubPort9090(t *testing.T) {
-	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
+func TestParseHTTP_Pipelined_StopsFollowingPastLimit(t *testing.T) {
+	assembler := newTestAssembler()
+	flow := newTestFlowWithHTTPData(nil, nil)
 
-	flow := &TCPFlow{
-		SrcIP:   "10.0.0.5",
-		DstIP:   "10.0.0.100",
-		SrcPort: 45678,
-		DstPort: 9090, // Agent gRPC port
+	// No responses, so none of the requests can be dropped
+	for i := 0; i <= MaxFlowExchanges; i++ {
+		flow.ClientData.WriteString(fmt.Sprintf("GET /%d HTTP/1.1\r\nHost: example.com\r\n\r\n", i))
 	}
+	assembler.parseHTTP(flow)
 
-	isAgent, _ := assembler.isAgentTraffic(flow)
+	if len(flow.HTTPExchanges) != MaxFlowExchanges {
+		t.Fatalf("got %d exchanges, want %d", len(flow.HTTPExchanges), MaxFlowExchanges)
+	}
+	if !flow.Truncated || !flow.clientDone {
+		t.Errorf("client side should be truncated, Truncated=%v clientDone=%v", flow.Truncated, flow.clientDone)
+	}
 
-	if !isAgent {
-		t.Error("isAgentTraffic() should return true for pod->hub on port 9090")
+	// Responses still pair with the requests that were kept
+	flow.ServerData.WriteString("HTTP/1.1 204 No Content\r\n\r\n")
+	assembler.parseHTTP(flow)
+	if flow.HTTPExchanges[0].StatusCode != 204 {
+		t.Errorf("first exchange StatusCode = %d, want 204", flow.HTTPExchanges[0].StatusCode)
 	}
 }
 
-func TestIsAgentTraffic_HubToPodResponse(t *testing.T) {
-	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
+func TestParseHTTP_PartialBody_CompletesLater(t *testing.T) {
+	assembler := newTestAssembler()
+	flow := newTestFlowWithHTTPData([]byte("POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 10\r\n\r\n01234"), nil)
 
-	// Response from hub back to pod
-	flow := &TCPFlow{
-		SrcIP:   "10.0.0.100", // Hub IP
-		DstIP:   "10.0.0.5",   // Pod IP
-		SrcPort: 8080,
-		DstPort: 45678,
+	assembler.parseHTTP(flow)
+	if len(flow.HTTPExchanges) != 1 {
+		t.Fatalf("got %d exchanges after partial body, want 1", len(flow.HTTPExchanges))
 	}
 
-	isAgent, _ := assembler.isAgentTraffic(flow)
+	flow.ClientData.WriteString("56789GET /next HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assembler.parseHTTP(flow)
 
-	if !isAgent {
-		t.Error("isAgentTraffic() should return true for hub->pod response")
+	if len(flow.HTTPExchanges) != 2 {
+		t.Fatalf("got %d exchanges, want 2", len(flow.HTTPExchanges))
+	}
+	if flow.HTTPExchanges[0].RequestBody != "0123456789" {
+		t.Errorf("RequestBody = %q, want %q", flow.HTTPExchanges[0].RequestBody, "0123456789")
+	}
+	if flow.HTTPExchanges[1].URL != "/next" {
+		t.Errorf("second URL = %q, want %q", flow.HTTPExchanges[1].URL, "/next")
 	}
 }
 
-func TestIsAgentTraffic_NotAgentTraffic_DifferentDestination(t *testing.T) {
-	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
+func TestParseHTTP_HeadResponseHasNoBody(t *testing.T) {
+	assembler := newTestAssembler()
+	requests := "HEAD /file HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+		"GET /file HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	// The HEAD response advertises a length but carries no body
+	responses := "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\ndata"
+	flow := newTestFlowWithHTTPData([]byte(requests), []byte(responses))
 
-	// Traffic from pod to a different service on port 8080
-	flow := &TCPFlow{
-		SrcIP:   "10.0.0.5",
-		DstIP:   "10.0.0.200", // Different IP (not hub)
-		SrcPort: 45678,
-		DstPort: 8080,
+	assembler.parseHTTP(flow)
+
+	if len(flow.HTTPExchanges) != 2 {
+		t.Fatalf("got %d exchanges, want 2", len(flow.HTTPExchanges))
 	}
+	if flow.HTTPExchanges[0].ResponseBody != "" {
+		t.Errorf("HEAD ResponseBody = %q, want empty", flow.HTTPExchanges[0].ResponseBody)
+	}
+	if flow.HTTPExchanges[1].StatusCode != 200 || flow.HTTPExchanges[1].ResponseBody != "data" {
+		t.Errorf("GET exchange = %d %q, want 200 %q",
+			flow.HTTPExchanges[1].StatusCode, flow.HTTPExchanges[1].ResponseBody, "data")
+	}
+}
 
-	isAgent, _ := assembler.isAgentTraffic(flow)
+func TestParseHTTP_SkipsInterimResponse(t *testing.T) {
+	assembler := newTestAssembler()
+	request := []byte("POST /upload HTTP/1.1\r\nHost: example.com\r\nExpect: 100-continue\r\nContent-Length: 2\r\n\r\nhi")
+	response := []byte("HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 204 No Content\r\n\r\n")
+	flow := newTestFlowWithHTTPData(request, response)
 
-	if isAgent {
-		t.Error("isAgentTraffic() should return false for traffic to non-hub destination")
+	assembler.parseHTTP(flow)
+
+	if len(flow.HTTPExchanges) != 1 {
+		t.Fatalf("got %d exchanges, want 1", len(flow.HTTPExchanges))
+	}
+	if flow.HTTPExchanges[0].StatusCode != 204 {
+		t.Errorf("StatusCode = %d, want 204", flow.HTTPExchanges[0].StatusCode)
 	}
 }
 
-func TestIsAgentTraffic_NotAgentTraffic_DifferentPort(t *testing.T) {
+func TestProcessPacket_HTTPExchangeTiming(t *testing.T) {
+	var completed *protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { completed = f },
+	}
+
+	client, server := "10.0.0.1", "10.0.0.2"
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	send := func(fromClient bool, offset time.Duration, tcp *layers.TCP, payload string) {
+		var app gopacket.ApplicationLayer
+		if payload != "" {
+			app = gopacket.Payload(payload)
+		}
+		if fromClient {
+			assembler.ProcessPacket(client, server, 40000, 80, tcp, base.Add(offset), app)
+		} else {
+			assembler.ProcessPacket(server, client, 80, 40000, tcp, base.Add(offset), app)
+		}
+	}
+
+	req1 := "GET /one HTTP/1.1\r\nHost: server\r\n\r\n"
+	resp1 := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+	send(true, 0, &layers.TCP{SYN: true, Seq: 1000}, "")
+	send(false, time.Millisecond, &layers.TCP{SYN: true, ACK: true, Seq: 5000}, "")
+	send(true, 10*time.Millisecond, &layers.TCP{ACK: true, Seq: 1001}, req1)
+	send(false, 15*time.Millisecond, &layers.TCP{ACK: true, Seq: 5001}, resp1)
+	send(true, 100*time.Millisecond, &layers.TCP{ACK: true, Seq: 1001 + uint32(len(req1))}, "GET /two HTTP/1.1\r\nHost: server\r\n\r\n")
+	send(false, 140*time.Millisecond, &layers.TCP{ACK: true, Seq: 5001 + uint32(len(resp1))}, "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\n\r\n")
+	send(true, 150*time.Millisecond, &layers.TCP{FIN: true, ACK: true}, "")
+	send(false, 150*time.Millisecond, &layers.TCP{FIN: true, ACK: true}, "")
+
+	if completed == nil {
+		t.Fatal("flow was not completed")
+	}
+	if len(completed.HTTPExchanges) != 2 {
+		t.Fatalf("got %d exchanges, want 2", len(completed.HTTPExchanges))
+	}
+
+	want := []struct {
+		url        string
+		status     int
+		start      time.Duration
+		durationMs float64
+	}{
+		{"/one", 200, 10 * time.Millisecond, 5},
+		{"/two", 500, 100 * time.Millisecond, 40},
+	}
+	for i, w := range want {
+		ex := completed.HTTPExchanges[i]
+		if ex.URL != w.url || ex.StatusCode != w.status {
+			t.Errorf("exchange %d = %s -> %d, want %s -> %d", i, ex.URL, ex.StatusCode, w.url, w.status)
+		}
+		if !ex.RequestTime.Equal(base.Add(w.start)) {
+			t.Errorf("exchange %d RequestTime = %v, want %v", i, ex.RequestTime, base.Add(w.start))
+		}
+		if ex.DurationMs < w.durationMs-0.001 || ex.DurationMs > w.durationMs+0.001 {
+			t.Errorf("exchange %d DurationMs = %v, want %v", i, ex.DurationMs, w.durationMs)
+		}
+	}
+}
+
+// Test isAgentTraffic - verifies correct identification of agent-to-hub communication
+
+// Helper to create an assembler with agent and hub info for testing
+func newTestAssemblerWithInfo(podIP, hubIP string) *TCPAssembler {
+	a := &TCPAssembler{
+		flows:      make(map[string]*TCPFlow),
+		agentPodIP: podIP,
+		hubIP:      hubIP,
+	}
+	return a
+}
+
+func TestIsAgentTraffic_NotAgentTraffic_HubHTTPPort(t *testing.T) {
 	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
 
-	// Traffic to hub but on a different port
+	// Agents only speak gRPC to the hub; its HTTP port serves the UI and API
 	flow := &TCPFlow{
 		SrcIP:   "10.0.0.5",
 		DstIP:   "10.0.0.100",
 		SrcPort: 45678,
-		DstPort: 443, // HTTPS, not agent port
+		DstPort: 8080,
 	}
 
 	isAgent, _ := assembler.isAgentTraffic(flow)
 
 	if isAgent {
-		t.Error("isAgentTraffic() should return false for non-agent ports")
+		t.Error("isAgentTraffic() should return false for pod->hub on the HTTP port")
 	}
 }
 
-func TestIsAgentTraffic_HealthCheckPath(t *testing.T) {
+func TestIsAgentTraffic_PodToHubPort9090(t *testing.T) {
 	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
 
 	flow := &TCPFlow{
 		SrcIP:   "10.0.0.5",
 		DstIP:   "10.0.0.100",
 		SrcPort: 45678,
-		DstPort: 8080,
-		HTTP: &protocol.HTTPInfo{
-			Method: "GET",
-			URL:    "/api/health",
-		},
+		DstPort: 9090, // Agent gRPC port
 	}
 
 	isAgent, trafficType := assembler.isAgentTraffic(flow)
 
 	if !isAgent {
-		t.Error("isAgentTraffic() should return true for health check")
+		t.Error("isAgentTraffic() should return true for pod->hub on port 9090")
 	}
-	if trafficType != "health" {
-		t.Errorf("trafficType = %q, want %q", trafficType, "health")
+	if trafficType != "grpc" {
+		t.Errorf("trafficType = %q, want %q", trafficType, "grpc")
 	}
 }
 
-func TestIsAgentTraffic_FlowsPath(t *testing.T) {
+func TestIsAgentTraffic_HubToPodResponse(t *testing.T) {
 	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
 
+	// Response from hub back to pod
 	flow := &TCPFlow{
-		SrcIP:   "10.0.0.5",
-		DstIP:   "10.0.0.100",
-		SrcPort: 45678,
-		DstPort: 8080,
-		HTTP: &protocol.HTTPInfo{
-			Method: "POST",
-			URL:    "/api/flows",
-		},
+		SrcIP:   "10.0.0.100", // Hub IP
+		DstIP:   "10.0.0.5",   // Pod IP
+		SrcPort: 9090,
+		DstPort: 45678,
 	}
 
-	isAgent, trafficType := assembler.isAgentTraffic(flow)
+	isAgent, _ := assembler.isAgentTraffic(flow)
 
 	if !isAgent {
-		t.Error("isAgentTraffic() should return true for flows endpoint")
-	}
-	if trafficType != "flow" {
-		t.Errorf("trafficType = %q, want %q", trafficType, "flow")
+		t.Error("isAgentTraffic() should return true for hub->pod response")
 	}
 }
 
-func TestIsAgentTraffic_PcapPath(t *testing.T) {
+func TestIsAgentTraffic_NotAgentTraffic_DifferentDestination(t *testing.T) {
 	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
 
+	// Traffic from pod to a different service on port 8080
 	flow := &TCPFlow{
 		SrcIP:   "10.0.0.5",
-		DstIP:   "10.0.0.100",
+		DstIP:   "10.0.0.200", // Different IP (not hub)
 		SrcPort: 45678,
 		DstPort: 8080,
-		HTTP: &protocol.HTTPInfo{
-			Method: "POST",
-			URL:    "/api/pcap/upload",
-		},
 	}
 
-	isAgent, trafficType := assembler.isAgentTraffic(flow)
+	isAgent, _ := assembler.isAgentTraffic(flow)
 
-	if !isAgent {
-		t.Error("isAgentTraffic() should return true for pcap upload")
-	}
-	if trafficType != "pcap" {
-		t.Errorf("trafficType = %q, want %q", trafficType, "pcap")
+	if isAgent {
+		t.Error("isAgentTraffic() should return false for traffic to non-hub destination")
 	}
 }
 
-func TestIsAgentTraffic_AgentsPath(t *testing.T) {
+func TestIsAgentTraffic_NotAgentTraffic_DifferentPort(t *testing.T) {
 	assembler := newTestAssemblerWithInfo("10.0.0.5", "10.0.0.100")
 
+	// Traffic to hub but on a different port
 	flow := &TCPFlow{
 		SrcIP:   "10.0.0.5",
 		DstIP:   "10.0.0.100",
 		SrcPort: 45678,
-		DstPort: 8080,
-		HTTP: &protocol.HTTPInfo{
-			Method: "POST",
-			URL:    "/api/agents",
-		},
+		DstPort: 443, // HTTPS, not agent port
 	}
 
-	isAgent, trafficType := assembler.isAgentTraffic(flow)
+	isAgent, _ := assembler.isAgentTraffic(flow)
 
-	if !isAgent {
-		t.Error("isAgentTraffic() should return true for agent registration")
-	}
-	if trafficType != "registration" {
-		t.Errorf("trafficType = %q, want %q", trafficType, "registration")
+	if isAgent {
+		t.Error("isAgentTraffic() should return false for non-agent ports")
 	}
 }
 
@@ -1372,7 +1533,7 @@ func TestIsAgentTraffic_NoPodIP(t *testing.T) {
 		SrcIP:   "10.0.0.5",
 		DstIP:   "10.0.0.100",
 		SrcPort: 45678,
-		DstPort: 8080,
+		DstPort: 9090,
 	}
 
 	isAgent, _ := assembler.isAgentTraffic(flow)
@@ -1390,7 +1551,7 @@ func TestIsAgentTraffic_NoHubIP(t *testing.T) {
 		SrcIP:   "10.0.0.5",
 		DstIP:   "10.0.0.100",
 		SrcPort: 45678,
-		DstPort: 8080,
+		DstPort: 9090,
 	}
 
 	isAgent, _ := assembler.isAgentTraffic(flow)
@@ -1407,7 +1568,7 @@ func TestIsAgentTraffic_IPv6Addresses(t *testing.T) {
 		SrcIP:   "2001:db8::1",
 		DstIP:   "2001:db8::100",
 		SrcPort: 45678,
-		DstPort: 8080,
+		DstPort: 9090,
 	}
 
 	isAgent, _ := assembler.isAgentTraffic(flow)
@@ -2240,3 +2401,420 @@ func TestParseHTTP_RequestAndResponseBodiesBothExtracted(t *testing.T) {
 		t.Errorf("HTTP.ResponseBody = %q, want %q", flow.HTTP.ResponseBody, responseBody)
 	}
 }
+
+// testConn drives a handshaken connection through ProcessPacket with
+// consecutive sequence numbers
+type testConn struct {
+	t         *testing.T
+	assembler *TCPAssembler
+	clientSeq uint32
+	serverSeq uint32
+	now       time.Time
+}
+
+func newTestConn(t *testing.T, assembler *TCPAssembler) *testConn {
+	c := &testConn{t: t, assembler: assembler, clientSeq: 1000, serverSeq: 5000, now: time.Now()}
+	assembler.ProcessPacket("10.0.0.1", "10.0.0.2", 40000, 80, &layers.TCP{SYN: true, Seq: c.clientSeq - 1, Window: 65535}, c.now, nil)
+	assembler.ProcessPacket("10.0.0.2", "10.0.0.1", 80, 40000, &layers.TCP{SYN: true, ACK: true, Seq: c.serverSeq - 1, Window: 65535}, c.now, nil)
+	return c
+}
+
+func (c *testConn) send(fromClient bool, payload []byte) {
+	if fromClient {
+		c.assembler.ProcessPacket("10.0.0.1", "10.0.0.2", 40000, 80, &layers.TCP{ACK: true, Seq: c.clientSeq, Window: 65535}, c.now, gopacket.Payload(payload))
+		c.clientSeq += uint32(len(payload))
+	} else {
+		c.assembler.ProcessPacket("10.0.0.2", "10.0.0.1", 80, 40000, &layers.TCP{ACK: true, Seq: c.serverSeq, Window: 65535}, c.now, gopacket.Payload(payload))
+		c.serverSeq += uint32(len(payload))
+	}
+}
+
+// sendChunked sends payload in segments of at most 1400 bytes
+func (c *testConn) sendChunked(fromClient bool, payload []byte) {
+	for len(payload) > 0 {
+		n := min(1400, len(payload))
+		c.send(fromClient, payload[:n])
+		payload = payload[n:]
+	}
+}
+
+func (c *testConn) flow() *TCPFlow {
+	c.t.Helper()
+	f := c.assembler.flows[flowKey("10.0.0.1", "10.0.0.2", 40000, 80)]
+	if f == nil {
+		c.t.Fatal("flow not found")
+	}
+	return f
+}
+
+// close closes the connection from both sides
+func (c *testConn) close() {
+	c.assembler.ProcessPacket("10.0.0.1", "10.0.0.2", 40000, 80, &layers.TCP{FIN: true, ACK: true, Seq: c.clientSeq, Window: 65535}, c.now, nil)
+	c.assembler.ProcessPacket("10.0.0.2", "10.0.0.1", 80, 40000, &layers.TCP{FIN: true, ACK: true, Seq: c.serverSeq, Ack: c.clientSeq + 1, Window: 65535}, c.now, nil)
+}
+
+func TestProcessPacket_LargeBodyIsSkippedNotBuffered(t *testing.T) {
+	var completed *protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { completed = f },
+	}
+	conn := newTestConn(t, assembler)
+
+	upload := bytes.Repeat([]byte("u"), 200*1024)
+	conn.send(true, []byte(fmt.Sprintf("PUT /blob HTTP/1.1\r\nHost: store\r\nContent-Length: %d\r\n\r\n", len(upload))))
+	conn.sendChunked(true, upload)
+	conn.send(false, []byte("HTTP/1.1 204 No Content\r\n\r\n"))
+
+	download := bytes.Repeat([]byte("d"), 500*1024)
+	conn.send(true, []byte("GET /blob HTTP/1.1\r\nHost: store\r\n\r\n"))
+	conn.send(false, []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n", len(download))))
+	conn.sendChunked(false, download)
+
+	if n := assembler.buffered.Load(); n > MaxBodySize*2 {
+		t.Errorf("buffered = %d bytes during a large download, want under %d", n, MaxBodySize*2)
+	}
+
+	// The connection is still parsed after both large bodies
+	conn.send(true, []byte("GET /health HTTP/1.1\r\nHost: store\r\n\r\n"))
+	conn.send(false, []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+	conn.close()
+
+	if completed == nil {
+		t.Fatal("flow was not completed")
+	}
+	if len(completed.HTTPExchanges) != 3 {
+		t.Fatalf("got %d exchanges, want 3", len(completed.HTTPExchanges))
+	}
+	put, get, health := completed.HTTPExchanges[0], completed.HTTPExchanges[1], completed.HTTPExchanges[2]
+	if put.StatusCode != 204 || len(put.RequestBody) != MaxBodySize {
+		t.Errorf("PUT = %d with %d byte body, want 204 with %d", put.StatusCode, len(put.RequestBody), MaxBodySize)
+	}
+	if get.StatusCode != 200 || len(get.ResponseBody) != MaxBodySize {
+		t.Errorf("GET = %d with %d byte body, want 200 with %d", get.StatusCode, len(get.ResponseBody), MaxBodySize)
+	}
+	if health.URL != "/health" || health.ResponseBody != "ok" {
+		t.Errorf("last exchange = %s -> %q, want /health -> \"ok\"", health.URL, health.ResponseBody)
+	}
+	if completed.Truncated {
+		t.Error("skipped bodies should not mark the flow truncated")
+	}
+	if n := assembler.buffered.Load(); n != 0 {
+		t.Errorf("buffered = %d after completion, want 0", n)
+	}
+}
+
+func TestProcessPacket_FlowBufferBudgetTruncates(t *testing.T) {
+	var completed *protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { completed = f },
+	}
+	conn := newTestConn(t, assembler)
+
+	// A chunked stream has no length to skip by, so it fills the buffer
+	conn.send(true, []byte("GET /events HTTP/1.1\r\nHost: feed\r\n\r\n"))
+	conn.send(false, []byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"))
+	chunk := []byte(fmt.Sprintf("%x\r\n%s\r\n", 1000, bytes.Repeat([]byte("e"), 1000)))
+	for i := 0; i < 100; i++ {
+		conn.send(false, chunk)
+	}
+
+	flow := conn.flow()
+	if !flow.Truncated || !flow.serverDone || flow.ServerData.Len() != 0 {
+		t.Errorf("Truncated=%v serverDone=%v buffered=%d, want the server side dropped",
+			flow.Truncated, flow.serverDone, flow.ServerData.Len())
+	}
+	if n := assembler.buffered.Load(); n > MaxFlowBufferSize {
+		t.Errorf("buffered = %d, want at most %d", n, MaxFlowBufferSize)
+	}
+	conn.close()
+
+	if completed == nil || !completed.Truncated {
+		t.Fatal("completed flow should be marked truncated")
+	}
+	if completed.HTTP == nil || completed.HTTP.StatusCode != 200 {
+		t.Error("exchange parsed before truncation should be kept")
+	}
+	if n := assembler.buffered.Load(); n != 0 {
+		t.Errorf("buffered = %d after completion, want 0", n)
+	}
+}
+
+func TestProcessPacket_GlobalBufferBudget(t *testing.T) {
+	assembler := newTestAssembler()
+	assembler.buffered.Store(MaxBufferedBytes - 10)
+	conn := newTestConn(t, assembler)
+
+	conn.send(true, []byte("GET /a HTTP/1.1\r\nHost: x\r\n"))
+
+	flow := conn.flow()
+	if !flow.Truncated || flow.ClientData.Len() != 0 {
+		t.Errorf("Truncated=%v buffered=%d, want data dropped over the global budget", flow.Truncated, flow.ClientData.Len())
+	}
+}
+
+func TestProcessPacket_ReleasesParsedPayload(t *testing.T) {
+	assembler := newTestAssembler()
+
+	// Unrecognized protocols are never buffered
+	conn := newTestConn(t, assembler)
+	conn.send(true, []byte("\x00\x01binary protocol"))
+	if flow := conn.flow(); flow.ClientData.Len() != 0 || flow.Truncated {
+		t.Errorf("TCP flow buffered %d bytes, want none", flow.ClientData.Len())
+	}
+
+	// An upgraded connection stops buffering both directions
+	assembler = newTestAssembler()
+	conn = newTestConn(t, assembler)
+	conn.send(true, []byte("GET /ws HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	conn.send(false, []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	conn.sendChunked(false, bytes.Repeat([]byte{0x81}, 100*1024))
+
+	flow := conn.flow()
+	if !flow.clientDone || !flow.serverDone || flow.Truncated {
+		t.Errorf("clientDone=%v serverDone=%v Truncated=%v, want both released without truncation",
+			flow.clientDone, flow.serverDone, flow.Truncated)
+	}
+	if n := assembler.buffered.Load(); n != 0 {
+		t.Errorf("buffered = %d, want 0", n)
+	}
+}
+
+func TestProcessPacket_FourWayTeardownEmitsOneFlow(t *testing.T) {
+	var sent []*protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { sent = append(sent, f) },
+	}
+	conn := newTestConn(t, assembler)
+	conn.send(true, []byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	conn.send(false, []byte("HTTP/1.1 204 No Content\r\n\r\n"))
+
+	conn.close()
+	assembler.ProcessPacket("10.0.0.1", "10.0.0.2", 40000, 80, &layers.TCP{ACK: true, Seq: conn.clientSeq + 1, Ack: conn.serverSeq + 1, Window: 65535}, conn.now, nil)
+	// The response retransmitted after the teardown
+	assembler.ProcessPacket("10.0.0.2", "10.0.0.1", 80, 40000, &layers.TCP{ACK: true, Seq: conn.serverSeq - 10, Window: 65535}, conn.now, gopacket.Payload("No Content"))
+
+	if len(sent) != 1 || sent[0].Status != protocol.StatusClosed {
+		t.Fatalf("got %d flows, want one CLOSED", len(sent))
+	}
+	if len(assembler.flows) != 0 {
+		t.Errorf("%d flows tracked after the teardown, want 0", len(assembler.flows))
+	}
+
+	// A new connection reusing the ports is a flow of its own
+	assembler.ProcessPacket("10.0.0.1", "10.0.0.2", 40000, 80, &layers.TCP{SYN: true, Seq: 9000, Window: 65535}, conn.now.Add(time.Second), nil)
+	if len(assembler.flows) != 1 {
+		t.Errorf("%d flows tracked after a new SYN, want 1", len(assembler.flows))
+	}
+}
+
+func TestProcessPacket_DataAfterFirstFINStaysInFlow(t *testing.T) {
+	var sent []*protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { sent = append(sent, f) },
+	}
+	conn := newTestConn(t, assembler)
+
+	// The client half-closes after its request, the server answers after
+	conn.send(true, []byte("GET / HTTP/1.0\r\nHost: x\r\n\r\n"))
+	assembler.ProcessPacket("10.0.0.1", "10.0.0.2", 40000, 80, &layers.TCP{FIN: true, ACK: true, Seq: conn.clientSeq, Window: 65535}, conn.now, nil)
+	conn.clientSeq++
+	conn.send(false, []byte("HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+	if len(sent) != 0 {
+		t.Fatalf("flow completed on the first FIN")
+	}
+	assembler.ProcessPacket("10.0.0.2", "10.0.0.1", 80, 40000, &layers.TCP{FIN: true, ACK: true, Seq: conn.serverSeq, Window: 65535}, conn.now, nil)
+
+	if len(sent) != 1 {
+		t.Fatalf("got %d flows, want 1", len(sent))
+	}
+	if f := sent[0]; f.HTTP == nil || f.HTTP.StatusCode != 200 || f.Status != protocol.StatusClosed {
+		t.Errorf("flow = %s with HTTP %+v, want CLOSED with the 200 response", f.Status, f.HTTP)
+	}
+
+	// One side's FIN alone ends the flow once it goes quiet
+	conn = newTestConn(t, assembler)
+	conn.send(true, []byte("GET / HTTP/1.0\r\nHost: x\r\n\r\n"))
+	conn.now = conn.now.Add(time.Minute)
+	assembler.ProcessPacket("10.0.0.1", "10.0.0.2", 40000, 80, &layers.TCP{FIN: true, ACK: true, Seq: conn.clientSeq, Window: 65535}, conn.now, nil)
+	assembler.expire(conn.now.Add(FlowTimeout + time.Second))
+	if len(sent) != 2 || sent[1].Status != protocol.StatusClosed {
+		t.Errorf("half-closed flow was not reported closed once quiet")
+	}
+}
+
+func TestSnapshot_ReportsActiveFlows(t *testing.T) {
+	var sent []*protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { sent = append(sent, f) },
+	}
+	conn := newTestConn(t, assembler)
+	start := conn.now
+	conn.send(true, []byte("GET /stream HTTP/1.1\r\nHost: feed\r\n\r\n"))
+
+	// Too young to report
+	assembler.snapshot(start.Add(SnapshotInterval / 2))
+	if len(sent) != 0 {
+		t.Fatalf("got %d snapshots for a new flow, want 0", len(sent))
+	}
+
+	assembler.snapshot(start.Add(SnapshotInterval))
+	if len(sent) != 1 {
+		t.Fatalf("got %d snapshots, want 1", len(sent))
+	}
+	first := sent[0]
+	if first.Status != protocol.StatusOpen || first.ID != conn.flow().ID {
+		t.Errorf("snapshot = %s %s, want OPEN for the flow", first.ID, first.Status)
+	}
+	if first.HTTP == nil || first.HTTP.URL != "/stream" || first.HTTP.StatusCode != 0 {
+		t.Errorf("snapshot HTTP = %+v, want the pending request", first.HTTP)
+	}
+
+	// Nothing new since the last report
+	assembler.snapshot(start.Add(2 * SnapshotInterval))
+	if len(sent) != 1 {
+		t.Fatalf("got %d snapshots for an unchanged flow, want 1", len(sent))
+	}
+
+	conn.now = start.Add(2*SnapshotInterval + time.Second)
+	conn.send(false, []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+	assembler.snapshot(start.Add(3 * SnapshotInterval))
+	if len(sent) != 2 {
+		t.Fatalf("got %d snapshots, want 2", len(sent))
+	}
+	if sent[1].HTTP.StatusCode != 200 || sent[1].BytesReceived == 0 {
+		t.Errorf("second snapshot = %d status, %d bytes received", sent[1].HTTP.StatusCode, sent[1].BytesReceived)
+	}
+	if first.HTTP.StatusCode != 0 {
+		t.Error("earlier snapshot was changed by later packets")
+	}
+}
+
+func TestSnapshot_SendsOnlyNewExchanges(t *testing.T) {
+	var sent []*protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { sent = append(sent, f) },
+	}
+	conn := newTestConn(t, assembler)
+	start := conn.now
+	conn.send(true, []byte("GET /a HTTP/1.1\r\nHost: api\r\n\r\n"))
+	conn.send(false, []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	conn.send(true, []byte("GET /b HTTP/1.1\r\nHost: api\r\n\r\n"))
+
+	assembler.snapshot(start.Add(SnapshotInterval))
+	if len(sent) != 1 || len(sent[0].HTTPExchanges) != 2 || sent[0].ExchangeOffset != 0 {
+		t.Fatalf("first snapshot should carry both exchanges from 0")
+	}
+
+	// /a was sent complete, /b is still waiting for its response
+	conn.now = start.Add(SnapshotInterval + time.Second)
+	conn.send(false, []byte("HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"))
+	conn.send(true, []byte("GET /c HTTP/1.1\r\nHost: api\r\n\r\n"))
+	assembler.snapshot(start.Add(2 * SnapshotInterval))
+	if len(sent) != 2 {
+		t.Fatalf("got %d snapshots, want 2", len(sent))
+	}
+	second := sent[1]
+	if second.ExchangeOffset != 1 || len(second.HTTPExchanges) != 2 {
+		t.Fatalf("second snapshot = %d exchanges from %d, want 2 from 1", len(second.HTTPExchanges), second.ExchangeOffset)
+	}
+	if second.HTTPExchanges[0].URL != "/b" || second.HTTPExchanges[0].StatusCode != 404 || second.HTTPExchanges[1].URL != "/c" {
+		t.Errorf("second snapshot exchanges = %+v, %+v", second.HTTPExchanges[0], second.HTTPExchanges[1])
+	}
+	if second.HTTP == nil || second.HTTP.URL != "/a" {
+		t.Errorf("HTTP = %+v, want the first exchange", second.HTTP)
+	}
+
+	// The response to /c still pairs with it
+	conn.send(false, []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	conn.close()
+	final := sent[len(sent)-1]
+	if final.Status == protocol.StatusOpen || final.ExchangeOffset != 2 || len(final.HTTPExchanges) != 1 {
+		t.Fatalf("final flow = %s with %d exchanges from %d, want /c alone from 2", final.Status, len(final.HTTPExchanges), final.ExchangeOffset)
+	}
+	if ex := final.HTTPExchanges[0]; ex.URL != "/c" || ex.StatusCode != 200 {
+		t.Errorf("final exchange = %s %d, want /c 200", ex.URL, ex.StatusCode)
+	}
+}
+
+func TestExpire_IdleEstablishedFlowTimesOut(t *testing.T) {
+	var sent []*protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { sent = append(sent, f) },
+	}
+	conn := newTestConn(t, assembler)
+	conn.send(true, []byte("\x00query"))
+
+	assembler.expire(conn.now.Add(10 * FlowTimeout))
+	if len(sent) != 0 || len(assembler.flows) != 1 {
+		t.Fatalf("idle connection was ended: %d flows sent, %d tracked", len(sent), len(assembler.flows))
+	}
+
+	// Dropped from tracking much later with a final report, so the hub
+	// doesn't show it open forever
+	assembler.expire(conn.now.Add(IdleFlowTimeout + time.Second))
+	if len(assembler.flows) != 0 {
+		t.Errorf("%d flows still tracked after IdleFlowTimeout", len(assembler.flows))
+	}
+	if len(sent) != 1 || sent[0].Status != protocol.StatusTimeout {
+		t.Fatalf("got %d flows, want one TIMEOUT", len(sent))
+	}
+
+	// A packet for the dropped flow starts tracking it again
+	conn.send(true, []byte("\x00query"))
+	if len(assembler.flows) != 1 {
+		t.Errorf("%d flows tracked, want 1", len(assembler.flows))
+	}
+}
+
+func TestExpire_StrayAckIsNotReported(t *testing.T) {
+	var sent []*protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { sent = append(sent, f) },
+	}
+	now := time.Now()
+	assembler.ProcessPacket("10.0.0.1", "10.0.0.2", 40000, 80, &layers.TCP{ACK: true, Seq: 1, Ack: 1, Window: 65535}, now, nil)
+
+	assembler.snapshot(now.Add(SnapshotInterval))
+	if len(sent) != 0 {
+		t.Fatalf("got %d snapshots of a flow without handshake or payload, want 0", len(sent))
+	}
+
+	assembler.expire(now.Add(FlowTimeout + time.Second))
+	if len(sent) != 0 {
+		t.Errorf("got %d flows, want none", len(sent))
+	}
+	if len(assembler.flows) != 0 {
+		t.Errorf("%d flows still tracked", len(assembler.flows))
+	}
+}
+
+func TestExpire_UnansweredSYNTimesOut(t *testing.T) {
+	var sent []*protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { sent = append(sent, f) },
+	}
+	now := time.Now()
+	assembler.ProcessPacket("10.0.0.1", "10.0.0.9", 40000, 5432, &layers.TCP{SYN: true, Seq: 1}, now, nil)
+
+	assembler.expire(now.Add(FlowTimeout / 2))
+	if len(sent) != 0 {
+		t.Fatal("connection attempt ended before FlowTimeout")
+	}
+
+	assembler.expire(now.Add(FlowTimeout + time.Second))
+	if len(sent) != 1 || sent[0].Status != protocol.StatusTimeout {
+		t.Fatalf("got %d flows, want one TIMEOUT", len(sent))
+	}
+	if len(assembler.flows) != 0 {
+		t.Errorf("%d flows still tracked", len(assembler.flows))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -43,7 +44,19 @@ type Capturer struct {
 	// TCP stream reassembly
 	assembler *TCPAssembler
 
-	// Stats
+	// DNS query/response pairing
+	dnsTracker *DNSTracker
+
+	// All other UDP traffic
+	udpTracker *UDPTracker
+
+	// Ports the pod listens on
+	listeners *ListeningPorts
+
+	// Owners of the pod's sockets
+	processes *ProcessTable
+
+	// Stats, statsMutex also guards handle against Stats racing its Close
 	stats      CaptureStats
 	statsMutex sync.RWMutex
 }
@@ -56,7 +69,16 @@ type CaptureStats struct {
 	UDPPackets      uint64
 	HTTPRequests    uint64
 	TLSHandshakes   uint64
+	DNSQueries      uint64
+	TruncatedFlows  uint64 // flows whose payload exceeded the buffer budget
+	FlowsDetected   uint64
 	Errors          uint64
+
+	// Filled in by Stats from the capture handle and trackers
+	KernelReceived   uint64 // packets the capture socket saw
+	KernelDropped    uint64 // packets lost because the capture buffer was full
+	InterfaceDropped uint64 // packets the interface dropped
+	ActiveFlows      uint64 // connections still being assembled
 }
 
 // NewCapturer creates a new packet capturer
@@ -69,10 +91,39 @@ func NewCapturer(iface string, agentInfo *protocol.AgentInfo, hubClient *HubClie
 
 	// Initialize TCP assembler with agent info for pod name population
 	c.assembler = NewTCPAssembler(c.onFlowComplete, agentInfo)
+	c.dnsTracker = NewDNSTracker(c.onFlowComplete, agentInfo)
+	c.udpTracker = NewUDPTracker(c.onFlowComplete, agentInfo)
+
+	// Give direction to connections that were open before the agent attached
+	c.listeners = NewListeningPorts(DefaultProcNet)
+	if err := c.listeners.Refresh(); err != nil {
+		log.Printf("Failed to read listening ports: %v", err)
+	}
+	c.assembler.SetListeningPorts(c.listeners)
+
+	// Attribute flows to the processes of the target container
+	c.processes = NewProcessTable(DefaultProcRoot, os.Getenv("TARGET_CONTAINER"))
+	if err := c.processes.Refresh(); err != nil {
+		log.Printf("Failed to read process sockets: %v", err)
+	}
+	c.assembler.SetProcessTable(c.processes)
+	c.dnsTracker.SetProcessTable(c.processes)
+	c.udpTracker.SetProcessTable(c.processes)
+
+	// Name destinations after the hostnames the pod resolved
+	names := NewResolvedNames()
+	c.dnsTracker.SetResolvedNames(names)
+	c.assembler.SetResolvedNames(names)
+	c.udpTracker.SetResolvedNames(names)
 
 	return c
 }
 
+// ListeningPorts returns the TCP ports the pod accepts connections on
+func (c *Capturer) ListeningPorts() []uint16 {
+	return c.listeners.Ports()
+}
+
 // SetBPFFilter sets the BPF filter for capture
 func (c *Capturer) SetBPFFilter(filter string) {
 	c.bpfFilter = filter
@@ -153,7 +204,9 @@ func (c *Capturer) Start(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to open interface %s: %w", c.iface, err)
 	}
+	c.statsMutex.Lock()
 	c.handle = handle
+	c.statsMutex.Unlock()
 
 	// Set BPF filter if specified
 	if c.bpfFilter != "" {
@@ -172,6 +225,7 @@ func (c *Capturer) Start(ctx context.Context) error {
 
 	// Start PCAP flush goroutine
 	go c.flushLoop(ctx)
+	go c.listeners.refreshLoop(ctx)
 
 	// Start packet processing
 	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
@@ -183,7 +237,10 @@ func (c *Capturer) Start(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			log.Println("Stopping capture...")
-			c.handle.Close()
+			c.statsMutex.Lock()
+			c.handle = nil
+			c.statsMutex.Unlock()
+			handle.Close()
 			return nil
 		case packet, ok := <-packetSource.Packets():
 			if !ok {
@@ -232,7 +289,7 @@ func (c *Capturer) processPacket(packet gopacket.Packet) {
 		c.statsMutex.Lock()
 		c.stats.UDPPackets++
 		c.statsMutex.Unlock()
-		// UDP processing can be added later
+		c.processUDPPacket(packet)
 	}
 }
 
@@ -250,7 +307,7 @@ func (c *Capturer) isHubDNSPacket(packet gopacket.Packet, transportLayer gopacke
 		return false
 	}
 
-	if udp.DstPort != 53 && udp.SrcPort != 53 {
+	if udp.DstPort != DNSPort && udp.SrcPort != DNSPort {
 		return false
 	}
 
@@ -280,17 +337,7 @@ func (c *Capturer) isHubDNSPacket(packet gopacket.Packet, transportLayer gopacke
 // processTCPPacket processes a TCP packet
 func (c *Capturer) processTCPPacket(packet gopacket.Packet) {
 	tcp := packet.TransportLayer().(*layers.TCP)
-	networkLayer := packet.NetworkLayer()
-
-	var srcIP, dstIP string
-	switch ip := networkLayer.(type) {
-	case *layers.IPv4:
-		srcIP = ip.SrcIP.String()
-		dstIP = ip.DstIP.String()
-	case *layers.IPv6:
-		srcIP = ip.SrcIP.String()
-		dstIP = ip.DstIP.String()
-	}
+	srcIP, dstIP := packetIPs(packet.NetworkLayer())
 
 	// Feed to TCP assembler for stream reconstruction
 	c.assembler.ProcessPacket(
@@ -301,6 +348,40 @@ func (c *Capturer) processTCPPacket(packet gopacket.Packet) {
 	)
 }
 
+// processUDPPacket processes a UDP packet
+func (c *Capturer) processUDPPacket(packet gopacket.Packet) {
+	udp := packet.TransportLayer().(*layers.UDP)
+	srcIP, dstIP := packetIPs(packet.NetworkLayer())
+
+	if udp.SrcPort == DNSPort || udp.DstPort == DNSPort {
+		if dns, ok := packet.Layer(layers.LayerTypeDNS).(*layers.DNS); ok {
+			c.dnsTracker.ProcessPacket(
+				srcIP, dstIP,
+				uint16(udp.SrcPort), uint16(udp.DstPort),
+				dns, len(udp.Payload), packet.Metadata().Timestamp,
+			)
+			return
+		}
+	}
+
+	c.udpTracker.ProcessPacket(
+		srcIP, dstIP,
+		uint16(udp.SrcPort), uint16(udp.DstPort),
+		len(udp.Payload), packet.Metadata().Timestamp,
+	)
+}
+
+// packetIPs returns the source and destination addresses of a network layer
+func packetIPs(networkLayer gopacket.NetworkLayer) (string, string) {
+	switch ip := networkLayer.(type) {
+	case *layers.IPv4:
+		return ip.SrcIP.String(), ip.DstIP.String()
+	case *layers.IPv6:
+		return ip.SrcIP.String(), ip.DstIP.String()
+	}
+	return "", ""
+}
+
 // writePCAPHeader writes the PCAP global header to the buffer
 func (c *Capturer) writePCAPHeader() {
 	c.pcapMutex.Lock()
@@ -381,7 +462,7 @@ func (c *Capturer) flushPCAP() {
 	}
 }
 
-// onFlowComplete is called when a TCP flow is complete
+// onFlowComplete is called when a TCP flow, DNS transaction or UDP flow is complete
 func (c *Capturer) onFlowComplete(flow *protocol.Flow) {
 	if c.hubClient != nil {
 		if err := c.hubClient.SendFlow(flow); err != nil {
@@ -389,6 +470,11 @@ func (c *Capturer) onFlowComplete(flow *protocol.Flow) {
 		}
 	}
 
+	// Open snapshots are counted once the flow completes
+	if flow.Status == protocol.StatusOpen {
+		return
+	}
+
 	// Update stats
 	c.statsMutex.Lock()
 	if flow.HTTP != nil {
@@ -397,6 +483,13 @@ func (c *Capturer) onFlowComplete(flow *protocol.Flow) {
 	if flow.TLS != nil {
 		c.stats.TLSHandshakes++
 	}
+	if flow.DNS != nil {
+		c.stats.DNSQueries++
+	}
+	if flow.Truncated {
+		c.stats.TruncatedFlows++
+	}
+	c.stats.FlowsDetected++
 	c.statsMutex.Unlock()
 }
 
@@ -404,5 +497,20 @@ func (c *Capturer) onFlowComplete(flow *protocol.Flow) {
 func (c *Capturer) Stats() CaptureStats {
 	c.statsMutex.RLock()
 	defer c.statsMutex.RUnlock()
-	return c.stats
+
+	stats := c.stats
+	if c.handle != nil {
+		if ps, err := c.handle.Stats(); err == nil {
+			stats.KernelReceived = uint64(ps.PacketsReceived)
+			stats.KernelDropped = uint64(ps.PacketsDropped)
+			stats.InterfaceDropped = uint64(ps.PacketsIfDropped)
+		}
+	}
+	if c.assembler != nil {
+		stats.ActiveFlows += uint64(c.assembler.ActiveFlows())
+	}
+	if c.udpTracker != nil {
+		stats.ActiveFlows += uint64(c.udpTracker.ActiveFlows())
+	}
+	return stats
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/gopacket"
+	"github.com/podscope/podscope/pkg/protocol"
 )
 
 // mockPacket implements gopacket.Packet for testing
@@ -590,3 +591,26 @@ func TestBuildCombinedFilter_PreservesHubExclusion(t *testing.T) {
 func containsSubstring(s, substr string) bool {
 	return bytes.Contains([]byte(s), []byte(substr))
 }
+
+func TestOnFlowComplete_CountsTruncatedFlows(t *testing.T) {
+	c := &Capturer{}
+	c.onFlowComplete(&protocol.Flow{Protocol: protocol.ProtocolHTTP, Truncated: true})
+	c.onFlowComplete(&protocol.Flow{Protocol: protocol.ProtocolTCP})
+
+	if got := c.Stats().TruncatedFlows; got != 1 {
+		t.Errorf("TruncatedFlows = %d, want 1", got)
+	}
+}
+
+func TestOnFlowComplete_SkipsOpenSnapshots(t *testing.T) {
+	c := &Capturer{}
+	open := &protocol.Flow{ID: "a", Status: protocol.StatusOpen, HTTP: &protocol.HTTPInfo{}}
+	c.onFlowComplete(open)
+	closed := *open
+	closed.Status = protocol.StatusClosed
+	c.onFlowComplete(&closed)
+
+	if got := c.Stats().HTTPRequests; got != 1 {
+		t.Errorf("HTTPRequests = %d, want 1", got)
+	}
+}
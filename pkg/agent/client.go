@@ -1,25 +1,27 @@
 package agent
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/podscope/podscope/pkg/protocol"
+	"github.com/podscope/podscope/pkg/protocol/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
-// HubClient manages connection to the Hub via HTTP
+// HubClient manages connection to the Hub via gRPC
 type HubClient struct {
-	hubURL    string
-	agentInfo *protocol.AgentInfo
-	client    *http.Client
-	ctx       context.Context
-	cancel    context.CancelFunc
+	hubAddress string
+	agentInfo  *protocol.AgentInfo
+	conn       *grpc.ClientConn
+	rpc        pb.AgentServiceClient
+	ctx        context.Context
+	cancel     context.CancelFunc
 
 	// Flow streaming
 	flowChan chan *protocol.Flow
@@ -28,6 +30,9 @@ type HubClient struct {
 	// PCAP streaming
 	pcapChan chan []byte
 	pcapWg   sync.WaitGroup
+	pcapSeq  uint64 // Number of the last chunk spooled, owned by the PCAP streamer
+
+	heartbeatWg sync.WaitGroup
 
 	// Connection state
 	connected bool
@@ -39,35 +44,62 @@ type HubClient struct {
 	bpfFilterMutex sync.RWMutex
 
 	// Connection health tracking
-	consecutiveFailures int
-	maxFailures         int
-	onDisconnect        func() // Called when hub becomes unreachable
+	gracePeriod      time.Duration // how long the hub may be unreachable before giving up
+	unreachableSince time.Time     // zero while the hub answers heartbeats
+	onDisconnect     func()        // Called when hub stays unreachable past the grace period
+
+	// What was delivered and what was dropped on the way to the hub
+	delivery deliveryCounters
+}
+
+// DeliveryStats counts flows and PCAP data confirmed by the hub, and those
+// dropped because the queue was full, the spool overflowed while the hub was
+// unreachable, or they could not be delivered before the client closed
+type DeliveryStats struct {
+	FlowsSent           uint64
+	FlowsQueueFull      uint64
+	FlowsSpoolFull      uint64
+	FlowsSendFailed     uint64
+	PCAPBytesSent       uint64
+	PCAPBytesQueueFull  uint64
+	PCAPBytesSpoolFull  uint64
+	PCAPBytesSendFailed uint64
 }
 
-// NewHubClient creates a new Hub client
+type deliveryCounters struct {
+	flowsSent, flowsQueueFull, flowsSpoolFull, flowsSendFailed                 atomic.Uint64
+	pcapBytesSent, pcapBytesQueueFull, pcapBytesSpoolFull, pcapBytesSendFailed atomic.Uint64
+}
+
+const (
+	// rpcTimeout bounds unary calls (registration, heartbeat)
+	rpcTimeout = 10 * time.Second
+	// DefaultGracePeriod is how long the hub may be unreachable, e.g. while
+	// it restarts, before the agent gives up
+	DefaultGracePeriod = 2 * time.Minute
+)
+
+// NewHubClient creates a new Hub client for the Hub's gRPC address (host:9090)
 func NewHubClient(address string, agentInfo *protocol.AgentInfo) *HubClient {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Convert gRPC address to HTTP (port 9090 -> 8080)
-	// The Hub runs HTTP on 8080 and gRPC on 9090
-	hubURL := fmt.Sprintf("http://%s", address)
-	// Replace port 9090 with 8080 for HTTP
-	hubURL = hubURL[:len(hubURL)-4] + "8080"
-
 	return &HubClient{
-		hubURL:    hubURL,
-		agentInfo: agentInfo,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		hubAddress:  address,
+		agentInfo:   agentInfo,
 		ctx:         ctx,
 		cancel:      cancel,
 		flowChan:    make(chan *protocol.Flow, 1000),
 		pcapChan:    make(chan []byte, 100),
-		maxFailures: 3, // Exit after 3 consecutive heartbeat failures (15 seconds)
+		gracePeriod: DefaultGracePeriod,
 	}
 }
 
+// SetGracePeriod sets how long the hub may be unreachable before the agent
+// gives up. Flows and PCAP data are spooled meanwhile.
+func (c *HubClient) SetGracePeriod(d time.Duration) {
+	c.gracePeriod = d
+}
+
 // SetOnDisconnect sets the callback for when hub becomes unreachable
 func (c *HubClient) SetOnDisconnect(callback func()) {
 	c.onDisconnect = callback
@@ -80,27 +112,28 @@ func (c *HubClient) SetCapturer(capturer *Capturer) {
 
 // Connect establishes connection to the Hub
 func (c *HubClient) Connect() error {
-	// Test connection with health check
-	resp, err := c.client.Get(c.hubURL + "/api/health")
-	if err != nil {
-		return fmt.Errorf("failed to connect to hub: %w", err)
+	// Dial is lazy; the registration call below is what proves the hub is reachable.
+	// Reuse the connection across retries so we don't leak one per attempt.
+	if c.conn == nil {
+		conn, err := grpc.DialContext(c.ctx, c.hubAddress,
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return fmt.Errorf("failed to dial hub: %w", err)
+		}
+		c.conn = conn
+		c.rpc = pb.NewAgentServiceClient(conn)
 	}
-	resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("hub health check failed: %d", resp.StatusCode)
+	// Register agent
+	if err := c.registerAgent(); err != nil {
+		return fmt.Errorf("failed to register agent: %w", err)
 	}
 
 	c.connMutex.Lock()
 	c.connected = true
 	c.connMutex.Unlock()
 
-	log.Printf("Connected to Hub at %s", c.hubURL)
-
-	// Register agent
-	if err := c.registerAgent(); err != nil {
-		return fmt.Errorf("failed to register agent: %w", err)
-	}
+	log.Printf("Connected to Hub at %s", c.hubAddress)
 
 	// Start background workers
 	c.startFlowStreamer()
@@ -112,17 +145,15 @@ func (c *HubClient) Connect() error {
 
 // registerAgent registers this agent with the Hub
 func (c *HubClient) registerAgent() error {
-	data, err := json.Marshal(c.agentInfo)
+	ctx, cancel := context.WithTimeout(c.ctx, rpcTimeout)
+	defer cancel()
+
+	resp, err := c.rpc.RegisterAgent(ctx, pb.FromAgentInfo(c.agentInfo))
 	if err != nil {
 		return err
 	}
-
-	resp, err := c.client.Post(c.hubURL+"/api/agents", "application/json", bytes.NewReader(data))
-	if err != nil {
-		// Non-fatal for MVP - just log
-		log.Printf("Agent registration request failed: %v", err)
-	} else {
-		resp.Body.Close()
+	if !resp.GetSuccess() {
+		return fmt.Errorf("hub rejected registration: %s", resp.GetMessage())
 	}
 
 	log.Printf("Agent registered: %s (%s/%s)",
@@ -139,44 +170,116 @@ func (c *HubClient) startFlowStreamer() {
 	}()
 }
 
-// flowStreamLoop handles flow streaming
+// flowStreamLoop delivers flows to the hub on one stream at a time. Flows
+// wait in a spool until the hub confirms it received them, so they are
+// replayed in order after the hub was unreachable or a stream broke.
 func (c *HubClient) flowStreamLoop() {
+	pending := newSpool(DefaultFlowSpoolSize, func(*protocol.Flow) int64 { return 1 })
+	stream := c.newFlowStream()
+	retry := time.NewTicker(spoolRetryInterval)
+	defer retry.Stop()
+
 	for {
 		select {
 		case <-c.ctx.Done():
+			stream.abort(pending) // its context ended with the client's
+			c.flushFlows(stream, pending)
 			return
 		case flow := <-c.flowChan:
-			c.sendFlowToHub(flow)
+			c.spoolFlow(pending, flow)
+		case <-stream.confirmDue():
+			if err := stream.confirm(pending); err != nil {
+				log.Printf("Failed to send flows to hub, %d flows spooled: %v", pending.len(), err)
+			}
+		case <-retry.C:
+		}
+
+		// Whatever else is queued goes out right behind it
+	drain:
+		for i := 0; i < spoolBatchSize; i++ {
+			select {
+			case flow := <-c.flowChan:
+				c.spoolFlow(pending, flow)
+			default:
+				break drain
+			}
+		}
+
+		if !c.IsConnected() {
+			stream.abort(pending)
+			continue
+		}
+		if err := stream.deliver(c.ctx, pending); err != nil {
+			log.Printf("Failed to send flows to hub, %d flows spooled: %v", pending.len(), err)
 		}
 	}
 }
 
-// sendFlowToHub sends a flow event to the Hub via HTTP POST
-func (c *HubClient) sendFlowToHub(flow *protocol.Flow) {
-	c.connMutex.RLock()
-	connected := c.connected
-	c.connMutex.RUnlock()
+// newFlowStream creates the stream flows are delivered on. Unconfirmed
+// flows are sent again; the hub drops anything about a flow that has
+// already ended, and snapshots of an open one only count what they add.
+func (c *HubClient) newFlowStream() *hubStream[*protocol.Flow, pb.AgentService_StreamFlowsClient] {
+	return &hubStream[*protocol.Flow, pb.AgentService_StreamFlowsClient]{
+		name: "flow",
+		open: func(ctx context.Context) (pb.AgentService_StreamFlowsClient, error) {
+			return c.rpc.StreamFlows(ctx)
+		},
+		send: c.sendFlowToHub,
+		confirmed: func(flows []*protocol.Flow) {
+			c.delivery.flowsSent.Add(uint64(len(flows)))
+		},
+	}
+}
 
-	if !connected {
-		log.Printf("Not connected, dropping flow: %s", flow.ID)
-		return
+// spoolFlow adds a flow to the spool, dropping the oldest when it is full
+func (c *HubClient) spoolFlow(pending *spool[*protocol.Flow], flow *protocol.Flow) {
+	for _, dropped := range pending.push(flow) {
+		log.Printf("Flow spool full, dropping flow: %s", dropped.ID)
+		c.delivery.flowsSpoolFull.Add(1)
 	}
+}
 
-	data, err := json.Marshal(flow)
-	if err != nil {
-		log.Printf("Failed to marshal flow: %v", err)
-		return
+// flushFlows delivers what is still queued or spooled when the client
+// closes. Flows the hub does not confirm within rpcTimeout are dropped.
+func (c *HubClient) flushFlows(stream *hubStream[*protocol.Flow, pb.AgentService_StreamFlowsClient], pending *spool[*protocol.Flow]) {
+	for queued := true; queued; {
+		select {
+		case flow := <-c.flowChan:
+			c.spoolFlow(pending, flow)
+		default:
+			queued = false
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	for pending.len() > 0 {
+		err := stream.deliver(ctx, pending)
+		if err == nil {
+			err = stream.confirm(pending)
+		}
+		if err != nil {
+			log.Printf("Failed to flush flows to hub, dropping %d flows: %v", pending.len(), err)
+			c.delivery.flowsSendFailed.Add(uint64(pending.len()))
+			stream.abort(pending)
+			return
+		}
 	}
+}
 
-	resp, err := c.client.Post(c.hubURL+"/api/flows", "application/json", bytes.NewReader(data))
+// sendFlowToHub sends a flow event on the open stream
+func (c *HubClient) sendFlowToHub(stream pb.AgentService_StreamFlowsClient, flow *protocol.Flow) error {
+	err := stream.Send(&pb.FlowEvent{
+		AgentId: c.agentInfo.ID,
+		Flow:    pb.FromFlow(flow),
+	})
 	if err != nil {
-		log.Printf("Failed to send flow to hub: %v", err)
-		return
+		return err
 	}
-	resp.Body.Close()
 
 	log.Printf("Flow: %s %s:%d -> %s:%d [%s]",
 		flow.Protocol, flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort, flow.Status)
+	return nil
 }
 
 // startPCAPStreamer starts the PCAP streaming goroutine
@@ -188,49 +291,135 @@ func (c *HubClient) startPCAPStreamer() {
 	}()
 }
 
-// pcapStreamLoop handles PCAP data streaming
+// pcapStreamLoop delivers PCAP data to the hub on one stream at a time.
+// Chunks are spooled until the hub confirms them and replayed in order like
+// flows.
 func (c *HubClient) pcapStreamLoop() {
+	pending := newSpool(DefaultPCAPSpoolBytes, func(chunk pcapChunk) int64 { return int64(len(chunk.data)) })
+	stream := c.newPCAPStream()
+	retry := time.NewTicker(spoolRetryInterval)
+	defer retry.Stop()
+
 	for {
 		select {
 		case <-c.ctx.Done():
+			stream.abort(pending) // its context ended with the client's
+			c.flushPCAP(stream, pending)
 			return
 		case data := <-c.pcapChan:
-			c.sendPCAPToHub(data)
+			c.spoolPCAP(pending, data)
+		case <-stream.confirmDue():
+			if err := stream.confirm(pending); err != nil {
+				log.Printf("Failed to send PCAP to hub, %d chunks spooled: %v", pending.len(), err)
+			}
+		case <-retry.C:
+		}
+
+		// Whatever else is queued goes out right behind it
+	drain:
+		for i := 0; i < spoolBatchSize; i++ {
+			select {
+			case data := <-c.pcapChan:
+				c.spoolPCAP(pending, data)
+			default:
+				break drain
+			}
+		}
+
+		if !c.IsConnected() {
+			stream.abort(pending)
+			continue
+		}
+		if err := stream.deliver(c.ctx, pending); err != nil {
+			log.Printf("Failed to send PCAP to hub, %d chunks spooled: %v", pending.len(), err)
 		}
 	}
 }
 
-// sendPCAPToHub sends PCAP data to the Hub via HTTP POST
-func (c *HubClient) sendPCAPToHub(data []byte) {
-	c.connMutex.RLock()
-	connected := c.connected
-	c.connMutex.RUnlock()
+// newPCAPStream creates the stream PCAP data is delivered on. Unconfirmed
+// chunks are sent again; the hub skips those it already wrote by their
+// number.
+func (c *HubClient) newPCAPStream() *hubStream[pcapChunk, pb.AgentService_StreamPCAPClient] {
+	return &hubStream[pcapChunk, pb.AgentService_StreamPCAPClient]{
+		name: "PCAP",
+		open: func(ctx context.Context) (pb.AgentService_StreamPCAPClient, error) {
+			return c.rpc.StreamPCAP(ctx)
+		},
+		send: c.sendPCAPToHub,
+		confirmed: func(chunks []pcapChunk) {
+			for _, chunk := range chunks {
+				c.delivery.pcapBytesSent.Add(uint64(len(chunk.data)))
+			}
+		},
+	}
+}
 
-	if !connected {
-		return
+// pcapChunk is spooled PCAP data and the number it is sent under, which
+// lets the hub tell a replayed chunk from a new one
+type pcapChunk struct {
+	seq  uint64
+	data []byte
+}
+
+// spoolPCAP numbers a chunk and adds it to the spool, dropping the oldest
+// when it is full
+func (c *HubClient) spoolPCAP(pending *spool[pcapChunk], data []byte) {
+	c.pcapSeq++
+	for _, dropped := range pending.push(pcapChunk{seq: c.pcapSeq, data: data}) {
+		log.Printf("PCAP spool full, dropping %d bytes", len(dropped.data))
+		c.delivery.pcapBytesSpoolFull.Add(uint64(len(dropped.data)))
 	}
+}
 
-	req, err := http.NewRequest("POST", c.hubURL+"/api/pcap/upload", bytes.NewReader(data))
-	if err != nil {
-		log.Printf("Failed to create PCAP upload request: %v", err)
-		return
+// flushPCAP delivers what is still queued or spooled when the client
+// closes. Chunks the hub does not confirm within rpcTimeout are dropped.
+func (c *HubClient) flushPCAP(stream *hubStream[pcapChunk, pb.AgentService_StreamPCAPClient], pending *spool[pcapChunk]) {
+	for queued := true; queued; {
+		select {
+		case data := <-c.pcapChan:
+			c.spoolPCAP(pending, data)
+		default:
+			queued = false
+		}
 	}
-	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("X-Agent-ID", c.agentInfo.ID)
 
-	resp, err := c.client.Do(req)
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	for pending.len() > 0 {
+		err := stream.deliver(ctx, pending)
+		if err == nil {
+			err = stream.confirm(pending)
+		}
+		if err != nil {
+			log.Printf("Failed to flush PCAP to hub, dropping %d bytes: %v", pending.size, err)
+			c.delivery.pcapBytesSendFailed.Add(uint64(pending.size))
+			stream.abort(pending)
+			return
+		}
+	}
+}
+
+// sendPCAPToHub sends a PCAP chunk on the open stream
+func (c *HubClient) sendPCAPToHub(stream pb.AgentService_StreamPCAPClient, chunk pcapChunk) error {
+	err := stream.Send(&pb.PCAPChunk{
+		AgentId:   c.agentInfo.ID,
+		Timestamp: time.Now().UnixNano(),
+		Data:      chunk.data,
+		Seq:       chunk.seq,
+	})
 	if err != nil {
-		log.Printf("Failed to send PCAP to hub: %v", err)
-		return
+		return err
 	}
-	resp.Body.Close()
 
-	log.Printf("Sent %d bytes of PCAP data to Hub", len(data))
+	log.Printf("Sent %d bytes of PCAP data to Hub", len(chunk.data))
+	return nil
 }
 
 // startHeartbeat starts the heartbeat goroutine
 func (c *HubClient) startHeartbeat() {
+	c.heartbeatWg.Add(1)
 	go func() {
+		defer c.heartbeatWg.Done()
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
@@ -239,82 +428,145 @@ func (c *HubClient) startHeartbeat() {
 			case <-c.ctx.Done():
 				return
 			case <-ticker.C:
-				c.sendHeartbeat()
+				if !c.sendHeartbeat() {
+					return
+				}
 			}
 		}
 	}()
 }
 
-// sendHeartbeat sends a heartbeat to the Hub
-func (c *HubClient) sendHeartbeat() {
-	c.connMutex.RLock()
-	connected := c.connected
-	c.connMutex.RUnlock()
+// sendHeartbeat sends a heartbeat to the Hub. While the hub is unreachable
+// the client is marked disconnected so data is spooled; when it answers
+// again, or says it does not know the agent, the agent registers anew,
+// since a restarted hub has forgotten it.
+// Returns false once the hub has been unreachable past the grace period.
+func (c *HubClient) sendHeartbeat() bool {
+	if c.rpc == nil {
+		return true // not connected yet
+	}
 
-	if !connected {
-		return
+	// Heartbeat RPC - the response carries BPF filter updates
+	ctx, cancel := context.WithTimeout(c.ctx, rpcTimeout)
+	defer cancel()
+
+	req := &pb.HeartbeatRequest{
+		AgentId:   c.agentInfo.ID,
+		Timestamp: time.Now().UnixNano(),
+	}
+	var capture CaptureStats
+	if c.capturer != nil {
+		capture = c.capturer.Stats()
 	}
+	req.Stats = heartbeatStats(capture, c.DeliveryStats())
 
-	// GET request as heartbeat - check for BPF filter updates
-	resp, err := c.client.Get(c.hubURL + "/api/health")
+	resp, err := c.rpc.Heartbeat(ctx, req)
 	if err != nil {
-		c.consecutiveFailures++
-		log.Printf("Heartbeat failed (%d/%d): %v", c.consecutiveFailures, c.maxFailures, err)
+		return c.hubUnreachable(err)
+	}
 
-		if c.consecutiveFailures >= c.maxFailures {
-			log.Printf("Hub unreachable after %d attempts, triggering shutdown", c.maxFailures)
-			c.connMutex.Lock()
-			c.connected = false
-			c.connMutex.Unlock()
+	if resp.GetUnknownAgent() && c.unreachableSince.IsZero() {
+		// The hub restarted between two heartbeats
+		log.Printf("Hub does not know this agent, registering again")
+		if err := c.registerAgent(); err != nil {
+			log.Printf("Failed to register again, retrying with the next heartbeat: %v", err)
+		}
+	}
 
-			if c.onDisconnect != nil {
-				c.onDisconnect()
-			}
+	if !c.unreachableSince.IsZero() {
+		if err := c.registerAgent(); err != nil {
+			return c.hubUnreachable(err)
 		}
-		return
+		log.Printf("Hub reachable again after %v, replaying spooled data", time.Since(c.unreachableSince).Round(time.Second))
+		c.unreachableSince = time.Time{}
+
+		c.connMutex.Lock()
+		c.connected = true
+		c.connMutex.Unlock()
 	}
-	defer resp.Body.Close()
 
-	// Reset failure counter on success
-	c.consecutiveFailures = 0
+	c.applyBPFFilter(resp.GetBpfFilter())
+	return true
+}
 
-	// Parse response to check for BPF filter updates
-	var healthResp struct {
-		Status    string `json:"status"`
-		SessionID string `json:"sessionId"`
-		BPFFilter string `json:"bpfFilter"`
+// hubUnreachable records a failed heartbeat. It returns false, after
+// calling onDisconnect, once the grace period has run out.
+func (c *HubClient) hubUnreachable(err error) bool {
+	if c.unreachableSince.IsZero() {
+		c.unreachableSince = time.Now()
+		c.connMutex.Lock()
+		c.connected = false
+		c.connMutex.Unlock()
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&healthResp); err != nil {
-		log.Printf("Failed to parse heartbeat response: %v", err)
-		return
+	down := time.Since(c.unreachableSince)
+	log.Printf("Heartbeat failed, hub unreachable for %v of %v grace period: %v", down.Round(time.Second), c.gracePeriod, err)
+	if down < c.gracePeriod {
+		return true
+	}
+
+	log.Printf("Hub unreachable for longer than %v, triggering shutdown", c.gracePeriod)
+	if c.onDisconnect != nil {
+		c.onDisconnect()
 	}
+	return false
+}
+
+// heartbeatStats converts capture and delivery statistics to what a
+// heartbeat reports
+func heartbeatStats(stats CaptureStats, delivery DeliveryStats) *pb.AgentStats {
+	return &pb.AgentStats{
+		PacketsCaptured:         stats.PacketsCaptured,
+		BytesCaptured:           stats.BytesCaptured,
+		FlowsDetected:           stats.FlowsDetected,
+		Errors:                  stats.Errors,
+		KernelPacketsReceived:   stats.KernelReceived,
+		KernelPacketsDropped:    stats.KernelDropped,
+		InterfacePacketsDropped: stats.InterfaceDropped,
+		ActiveFlows:             stats.ActiveFlows,
+
+		FlowsSent:                  delivery.FlowsSent,
+		FlowsDroppedQueueFull:      delivery.FlowsQueueFull,
+		FlowsDroppedSendFailed:     delivery.FlowsSendFailed,
+		FlowsDroppedSpoolFull:      delivery.FlowsSpoolFull,
+		PcapBytesSent:              delivery.PCAPBytesSent,
+		PcapBytesDroppedQueueFull:  delivery.PCAPBytesQueueFull,
+		PcapBytesDroppedSendFailed: delivery.PCAPBytesSendFailed,
+		PcapBytesDroppedSpoolFull:  delivery.PCAPBytesSpoolFull,
+	}
+}
 
+// applyBPFFilter applies a BPF filter received from the hub if it changed
+func (c *HubClient) applyBPFFilter(filter string) {
 	// Check if BPF filter has changed (including empty string to reset)
 	c.bpfFilterMutex.Lock()
 	lastFilter := c.lastBPFFilter
 	c.bpfFilterMutex.Unlock()
 
-	if healthResp.BPFFilter != lastFilter {
-		if healthResp.BPFFilter == "" {
-			log.Printf("BPF filter cleared by hub - will reset to default on next capture")
-		} else {
-			log.Printf("BPF filter update detected from hub: %s", healthResp.BPFFilter)
-		}
+	if filter == lastFilter {
+		return
+	}
 
-		// Apply the new filter if we have a capturer reference
-		if c.capturer != nil {
-			if err := c.capturer.UpdateBPFFilter(healthResp.BPFFilter); err != nil {
-				log.Printf("Failed to update BPF filter: %v", err)
-			} else {
-				c.bpfFilterMutex.Lock()
-				c.lastBPFFilter = healthResp.BPFFilter
-				c.bpfFilterMutex.Unlock()
-			}
-		} else {
-			log.Printf("WARNING: Cannot update BPF filter - no capturer reference")
-		}
+	if filter == "" {
+		log.Printf("BPF filter cleared by hub - will reset to default on next capture")
+	} else {
+		log.Printf("BPF filter update detected from hub: %s", filter)
+	}
+
+	// Apply the new filter if we have a capturer reference
+	if c.capturer == nil {
+		log.Printf("WARNING: Cannot update BPF filter - no capturer reference")
+		return
+	}
+
+	if err := c.capturer.UpdateBPFFilter(filter); err != nil {
+		log.Printf("Failed to update BPF filter: %v", err)
+		return
 	}
+
+	c.bpfFilterMutex.Lock()
+	c.lastBPFFilter = filter
+	c.bpfFilterMutex.Unlock()
 }
 
 // SendFlow queues a flow for sending to the Hub
@@ -323,6 +575,7 @@ func (c *HubClient) SendFlow(flow *protocol.Flow) error {
 	case c.flowChan <- flow:
 		return nil
 	default:
+		c.delivery.flowsQueueFull.Add(1)
 		return fmt.Errorf("flow channel full")
 	}
 }
@@ -336,10 +589,25 @@ func (c *HubClient) SendPCAPChunk(data []byte) error {
 	case c.pcapChan <- dataCopy:
 		return nil
 	default:
+		c.delivery.pcapBytesQueueFull.Add(uint64(len(data)))
 		return fmt.Errorf("pcap channel full")
 	}
 }
 
+// DeliveryStats returns what has been sent to the hub and what was dropped
+func (c *HubClient) DeliveryStats() DeliveryStats {
+	return DeliveryStats{
+		FlowsSent:           c.delivery.flowsSent.Load(),
+		FlowsQueueFull:      c.delivery.flowsQueueFull.Load(),
+		FlowsSpoolFull:      c.delivery.flowsSpoolFull.Load(),
+		FlowsSendFailed:     c.delivery.flowsSendFailed.Load(),
+		PCAPBytesSent:       c.delivery.pcapBytesSent.Load(),
+		PCAPBytesQueueFull:  c.delivery.pcapBytesQueueFull.Load(),
+		PCAPBytesSpoolFull:  c.delivery.pcapBytesSpoolFull.Load(),
+		PCAPBytesSendFailed: c.delivery.pcapBytesSendFailed.Load(),
+	}
+}
+
 // Close closes the connection to the Hub
 func (c *HubClient) Close() error {
 	c.cancel()
@@ -348,9 +616,15 @@ func (c *HubClient) Close() error {
 	c.connected = false
 	c.connMutex.Unlock()
 
-	// Wait for streamers to finish
+	// Wait for streamers and heartbeats to finish
 	c.flowWg.Wait()
 	c.pcapWg.Wait()
+	c.heartbeatWg.Wait()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
 
 	return nil
 }
@@ -3,15 +3,19 @@ package agent
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"net/http/httptest"
+	"io"
+	"net"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/podscope/podscope/pkg/protocol"
+	"github.com/podscope/podscope/pkg/protocol/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Helper to create test AgentInfo
@@ -25,54 +29,23 @@ func createTestAgentInfo() *protocol.AgentInfo {
 	}
 }
 
-// TestNewHubClient_PortTranslation tests that gRPC port 9090 is translated to HTTP port 8080
-func TestNewHubClient_PortTranslation(t *testing.T) {
-	agentInfo := createTestAgentInfo()
-	client := NewHubClient("hub.podscope.svc.cluster.local:9090", agentInfo)
-	defer client.Close()
-
-	if !strings.HasSuffix(client.hubURL, ":8080") {
-		t.Errorf("Expected URL to end with :8080, got %s", client.hubURL)
-	}
-
-	expected := "http://hub.podscope.svc.cluster.local:8080"
-	if client.hubURL != expected {
-		t.Errorf("Expected %s, got %s", expected, client.hubURL)
-	}
-}
-
-// TestNewHubClient_HTTPScheme tests that URL scheme is HTTP
-func TestNewHubClient_HTTPScheme(t *testing.T) {
-	agentInfo := createTestAgentInfo()
-	client := NewHubClient("hub.test:9090", agentInfo)
-	defer client.Close()
-
-	if !strings.HasPrefix(client.hubURL, "http://") {
-		t.Errorf("Expected URL to start with http://, got %s", client.hubURL)
-	}
-}
-
-// TestNewHubClient_BaseURLConstruction tests that base URL is constructed correctly
-func TestNewHubClient_BaseURLConstruction(t *testing.T) {
+// TestNewHubClient_AddressStored tests that the gRPC address is used as-is
+func TestNewHubClient_AddressStored(t *testing.T) {
 	tests := []struct {
-		name     string
-		address  string
-		expected string
+		name    string
+		address string
 	}{
 		{
-			name:     "simple hostname with gRPC port",
-			address:  "hub:9090",
-			expected: "http://hub:8080",
+			name:    "simple hostname with gRPC port",
+			address: "hub:9090",
 		},
 		{
-			name:     "FQDN with gRPC port",
-			address:  "hub.podscope-abc123.svc.cluster.local:9090",
-			expected: "http://hub.podscope-abc123.svc.cluster.local:8080",
+			name:    "FQDN with gRPC port",
+			address: "hub.podscope-abc123.svc.cluster.local:9090",
 		},
 		{
-			name:     "IP address with gRPC port",
-			address:  "10.0.0.100:9090",
-			expected: "http://10.0.0.100:8080",
+			name:    "IP address with gRPC port",
+			address: "10.0.0.100:9090",
 		},
 	}
 
@@ -82,8 +55,8 @@ func TestNewHubClient_BaseURLConstruction(t *testing.T) {
 			client := NewHubClient(tt.address, agentInfo)
 			defer client.Close()
 
-			if client.hubURL != tt.expected {
-				t.Errorf("Expected %s, got %s", tt.expected, client.hubURL)
+			if client.hubAddress != tt.address {
+				t.Errorf("Expected %s, got %s", tt.address, client.hubAddress)
 			}
 		})
 	}
@@ -127,18 +100,18 @@ func TestNewHubClient_AgentInfoStored(t *testing.T) {
 	}
 }
 
-// TestNewHubClient_HTTPClientCreated tests that HTTP client is created with timeout
-func TestNewHubClient_HTTPClientCreated(t *testing.T) {
+// TestNewHubClient_NotDialedUntilConnect tests that no gRPC connection is opened by the constructor
+func TestNewHubClient_NotDialedUntilConnect(t *testing.T) {
 	agentInfo := createTestAgentInfo()
 	client := NewHubClient("hub:9090", agentInfo)
 	defer client.Close()
 
-	if client.client == nil {
-		t.Fatal("Expected HTTP client to be created")
+	if client.conn != nil {
+		t.Error("Expected no gRPC connection before Connect()")
 	}
 
-	if client.client.Timeout == 0 {
-		t.Error("Expected HTTP client to have non-zero timeout")
+	if client.rpc != nil {
+		t.Error("Expected no gRPC client before Connect()")
 	}
 }
 
@@ -199,275 +172,238 @@ func TestNewHubClient_ContextInitialized(t *testing.T) {
 	}
 }
 
-// Helper to create a test Hub client that connects to a test server
-// We bypass NewHubClient's port translation by setting hubURL directly
-func createClientForTestServer(t *testing.T, serverURL string) *HubClient {
-	t.Helper()
-	agentInfo := createTestAgentInfo()
-	return &HubClient{
-		hubURL:    serverURL,
-		agentInfo: agentInfo,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		flowChan:    make(chan *protocol.Flow, 1000),
-		pcapChan:    make(chan []byte, 100),
-		maxFailures: 3,
-	}
+// fakeHub is an in-process AgentService that records what agents send
+type fakeHub struct {
+	pb.UnimplementedAgentServiceServer
+
+	mu          sync.Mutex
+	registered  []*pb.AgentInfo
+	heartbeats  int
+	lastStats   *pb.AgentStats
+	bpfFilter   string
+	reject      bool
+	forgotten   bool // answer heartbeats as a hub that just restarted
+	breakFlows  int  // streams to fail, unconfirmed, after their first flow
+	flowStreams int  // StreamFlows calls
+
+	flows  chan *pb.FlowEvent
+	chunks chan *pb.PCAPChunk
 }
 
-// TestConnect_SuccessfulHealthCheck tests that successful health check marks client as connected
-func TestConnect_SuccessfulHealthCheck(t *testing.T) {
-	healthCalled := false
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			healthCalled = true
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":    "healthy",
-				"sessionId": "test-session",
-				"bpfFilter": "",
-			})
-		case "/api/agents":
-			w.WriteHeader(http.StatusOK)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
-
-	client := createClientForTestServer(t, server.URL)
-	// Initialize context since we're bypassing NewHubClient
-	client.ctx, client.cancel = nil, nil
-
-	// Create a custom connect that uses our test server URL
-	// We'll test the individual steps that Connect() performs
-	resp, err := client.client.Get(client.hubURL + "/api/health")
-	if err != nil {
-		t.Fatalf("Health check failed: %v", err)
+func (h *fakeHub) RegisterAgent(ctx context.Context, info *pb.AgentInfo) (*pb.RegisterResponse, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.reject {
+		return &pb.RegisterResponse{Success: false, Message: "rejected"}, nil
 	}
-	resp.Body.Close()
+	h.registered = append(h.registered, info)
+	return &pb.RegisterResponse{Success: true}, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", resp.StatusCode)
-	}
+func (h *fakeHub) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heartbeats++
+	h.lastStats = req.GetStats()
+	return &pb.HeartbeatResponse{ContinueCapture: true, BpfFilter: h.bpfFilter, UnknownAgent: h.forgotten}, nil
+}
 
-	if !healthCalled {
-		t.Error("Expected health endpoint to be called")
-	}
+func (h *fakeHub) StreamFlows(stream pb.AgentService_StreamFlowsServer) error {
+	h.mu.Lock()
+	h.flowStreams++
+	h.mu.Unlock()
 
-	// Simulate what Connect() does after health check
-	client.connected = true
+	var received int64
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.StreamResponse{Success: true, ReceivedCount: received})
+		}
+		if err != nil {
+			return err
+		}
+		h.flows <- event
+		received++
 
-	if !client.IsConnected() {
-		t.Error("Expected client to be marked as connected after successful health check")
+		h.mu.Lock()
+		broken := h.breakFlows > 0
+		if broken {
+			h.breakFlows--
+		}
+		h.mu.Unlock()
+		if broken {
+			return status.Error(codes.Unavailable, "hub went away")
+		}
 	}
 }
 
-// TestConnect_HealthCheckReturns200_MarksConnected tests connected state is set on 200 OK
-func TestConnect_HealthCheckReturns200_MarksConnected(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/api/health" {
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-		} else if r.URL.Path == "/api/agents" {
-			w.WriteHeader(http.StatusOK)
+func (h *fakeHub) StreamPCAP(stream pb.AgentService_StreamPCAPServer) error {
+	var received int64
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.StreamResponse{Success: true, ReceivedCount: received})
 		}
-	}))
-	defer server.Close()
+		if err != nil {
+			return err
+		}
+		h.chunks <- chunk
+		received++
+	}
+}
 
-	client := createClientForTestServer(t, server.URL)
-	client.ctx, client.cancel = nil, nil
+// startFakeHub starts a gRPC server on a random local port and returns its address
+func startFakeHub(t *testing.T) (*fakeHub, string) {
+	t.Helper()
 
-	// Test health check succeeds
-	resp, err := client.client.Get(client.hubURL + "/api/health")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		t.Fatalf("Health check failed: %v", err)
+		t.Fatalf("Failed to listen: %v", err)
 	}
-	resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	hub := &fakeHub{
+		flows:  make(chan *pb.FlowEvent, 100),
+		chunks: make(chan *pb.PCAPChunk, 100),
 	}
+	server := grpc.NewServer()
+	pb.RegisterAgentServiceServer(server, hub)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
 
-	// Mark as connected (what Connect() does)
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
+	return hub, lis.Addr().String()
+}
 
-	if !client.IsConnected() {
-		t.Error("Expected IsConnected() to return true after setting connected")
+// Helper to create a test Hub client that is connected to a fake hub.
+// Streamers are started by the caller so each test controls what runs.
+func createClientForTestServer(t *testing.T, address string) *HubClient {
+	t.Helper()
+	client := NewHubClient(address, createTestAgentInfo())
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
 	}
+	return client
 }
 
-// TestConnect_HealthCheckFails500_ReturnsError tests that 500 status returns error
-func TestConnect_HealthCheckFails500_ReturnsError(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/api/health" {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-	}))
-	defer server.Close()
+// TestConnect_SuccessfulRegistration tests that successful registration marks client as connected
+func TestConnect_SuccessfulRegistration(t *testing.T) {
+	hub, addr := startFakeHub(t)
 
-	client := createClientForTestServer(t, server.URL)
+	client := NewHubClient(addr, createTestAgentInfo())
+	defer client.Close()
 
-	// Test health check returns 500
-	resp, err := client.client.Get(client.hubURL + "/api/health")
-	if err != nil {
-		t.Fatalf("HTTP request failed: %v", err)
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
 	}
-	resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		t.Error("Expected non-200 status code")
+	if !client.IsConnected() {
+		t.Error("Expected client to be marked as connected after successful registration")
 	}
 
-	// Connect() would return error for non-200 status
-	if resp.StatusCode != http.StatusInternalServerError {
-		t.Errorf("Expected status 500, got %d", resp.StatusCode)
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if len(hub.registered) != 1 {
+		t.Errorf("Expected 1 registration, got %d", len(hub.registered))
 	}
 }
 
-// TestConnect_HealthCheckTimeout_ReturnsError tests that connection timeout returns error
-func TestConnect_HealthCheckTimeout_ReturnsError(t *testing.T) {
-	// Create a server that delays response longer than client timeout
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Sleep longer than client timeout to trigger timeout
-		time.Sleep(200 * time.Millisecond)
-		w.WriteHeader(http.StatusOK)
-	}))
-	defer server.Close()
-
-	client := createClientForTestServer(t, server.URL)
-	// Set a very short timeout to trigger timeout error
-	client.client.Timeout = 50 * time.Millisecond
-
-	// Test health check times out
-	_, err := client.client.Get(client.hubURL + "/api/health")
+// TestConnect_RegistrationRejected_ReturnsError tests that a rejected registration returns error
+func TestConnect_RegistrationRejected_ReturnsError(t *testing.T) {
+	hub, addr := startFakeHub(t)
+	hub.reject = true
+
+	client := NewHubClient(addr, createTestAgentInfo())
+	defer client.Close()
+
+	err := client.Connect()
 	if err == nil {
-		t.Error("Expected timeout error, got nil")
+		t.Fatal("Expected error when hub rejects registration, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("Expected rejection in error message, got: %v", err)
 	}
 
-	// Verify client is not connected when health check fails
 	if client.IsConnected() {
-		t.Error("Expected IsConnected() to return false when health check fails")
+		t.Error("Expected IsConnected() to return false when registration is rejected")
 	}
 }
 
-// TestConnect_AgentRegistrationCalledAfterHealthCheck tests that agent registration happens after health check
-func TestConnect_AgentRegistrationCalledAfterHealthCheck(t *testing.T) {
-	callOrder := []string{}
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			callOrder = append(callOrder, "health")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-		case "/api/agents":
-			callOrder = append(callOrder, "agents")
-			if r.Method != "POST" {
-				t.Errorf("Expected POST method for /api/agents, got %s", r.Method)
-			}
-			w.WriteHeader(http.StatusOK)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
-
-	client := createClientForTestServer(t, server.URL)
+// TestConnect_ReusesConnectionAcrossRetries tests that a failed attempt doesn't leak a connection
+func TestConnect_ReusesConnectionAcrossRetries(t *testing.T) {
+	hub, addr := startFakeHub(t)
+	hub.reject = true
 
-	// Simulate Connect() flow: health check first, then agent registration
-	// Step 1: Health check
-	resp, err := client.client.Get(client.hubURL + "/api/health")
-	if err != nil {
-		t.Fatalf("Health check failed: %v", err)
-	}
-	resp.Body.Close()
-
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
+	client := NewHubClient(addr, createTestAgentInfo())
+	defer client.Close()
 
-	// Step 2: Agent registration (simulating registerAgent())
-	data, _ := json.Marshal(client.agentInfo)
-	resp, err = client.client.Post(client.hubURL+"/api/agents", "application/json", strings.NewReader(string(data)))
-	if err != nil {
-		t.Fatalf("Agent registration failed: %v", err)
+	if err := client.Connect(); err == nil {
+		t.Fatal("Expected first Connect() to fail")
 	}
-	resp.Body.Close()
+	conn := client.conn
 
-	// Verify order
-	if len(callOrder) != 2 {
-		t.Fatalf("Expected 2 calls, got %d", len(callOrder))
-	}
+	hub.mu.Lock()
+	hub.reject = false
+	hub.mu.Unlock()
 
-	if callOrder[0] != "health" {
-		t.Errorf("Expected first call to be 'health', got '%s'", callOrder[0])
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Expected second Connect() to succeed, got: %v", err)
 	}
 
-	if callOrder[1] != "agents" {
-		t.Errorf("Expected second call to be 'agents', got '%s'", callOrder[1])
+	if client.conn != conn {
+		t.Error("Expected the gRPC connection to be reused across Connect() attempts")
 	}
 }
 
-// TestConnect_AgentRegistrationPayload tests that agent registration sends correct JSON payload
+// TestConnect_AgentRegistrationPayload tests that agent registration sends the agent's identity
 func TestConnect_AgentRegistrationPayload(t *testing.T) {
-	var receivedAgent protocol.AgentInfo
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-		case "/api/agents":
-			if r.Method == "POST" {
-				json.NewDecoder(r.Body).Decode(&receivedAgent)
-			}
-			w.WriteHeader(http.StatusOK)
-		}
-	}))
-	defer server.Close()
+	hub, addr := startFakeHub(t)
 
-	client := createClientForTestServer(t, server.URL)
+	client := createClientForTestServer(t, addr)
+	defer client.Close()
 
-	// Register agent
-	data, _ := json.Marshal(client.agentInfo)
-	resp, err := client.client.Post(client.hubURL+"/api/agents", "application/json", strings.NewReader(string(data)))
-	if err != nil {
-		t.Fatalf("Agent registration failed: %v", err)
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if len(hub.registered) != 1 {
+		t.Fatalf("Expected 1 registration, got %d", len(hub.registered))
 	}
-	resp.Body.Close()
+	receivedAgent := hub.registered[0]
 
 	// Verify received payload
-	if receivedAgent.ID != client.agentInfo.ID {
-		t.Errorf("Expected agent ID '%s', got '%s'", client.agentInfo.ID, receivedAgent.ID)
+	if receivedAgent.GetId() != client.agentInfo.ID {
+		t.Errorf("Expected agent ID '%s', got '%s'", client.agentInfo.ID, receivedAgent.GetId())
+	}
+
+	if receivedAgent.GetPodName() != client.agentInfo.PodName {
+		t.Errorf("Expected pod name '%s', got '%s'", client.agentInfo.PodName, receivedAgent.GetPodName())
 	}
 
-	if receivedAgent.PodName != client.agentInfo.PodName {
-		t.Errorf("Expected pod name '%s', got '%s'", client.agentInfo.PodName, receivedAgent.PodName)
+	if receivedAgent.GetNamespace() != client.agentInfo.Namespace {
+		t.Errorf("Expected namespace '%s', got '%s'", client.agentInfo.Namespace, receivedAgent.GetNamespace())
 	}
 
-	if receivedAgent.Namespace != client.agentInfo.Namespace {
-		t.Errorf("Expected namespace '%s', got '%s'", client.agentInfo.Namespace, receivedAgent.Namespace)
+	if receivedAgent.GetPodIp() != client.agentInfo.PodIP {
+		t.Errorf("Expected pod IP '%s', got '%s'", client.agentInfo.PodIP, receivedAgent.GetPodIp())
 	}
 
-	if receivedAgent.PodIP != client.agentInfo.PodIP {
-		t.Errorf("Expected pod IP '%s', got '%s'", client.agentInfo.PodIP, receivedAgent.PodIP)
+	if receivedAgent.GetNodeName() != client.agentInfo.NodeName {
+		t.Errorf("Expected node name '%s', got '%s'", client.agentInfo.NodeName, receivedAgent.GetNodeName())
 	}
 }
 
-// TestConnect_HealthCheckConnectionRefused_ReturnsError tests connection refused scenario
-func TestConnect_HealthCheckConnectionRefused_ReturnsError(t *testing.T) {
-	// Create client pointing to a closed port (no server)
-	client := createClientForTestServer(t, "http://127.0.0.1:59999")
+// TestConnect_ConnectionRefused_ReturnsError tests connection refused scenario
+func TestConnect_ConnectionRefused_ReturnsError(t *testing.T) {
+	// Grab a free port and close it so nothing is listening
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
 
-	// Test health check fails with connection error
-	_, err := client.client.Get(client.hubURL + "/api/health")
-	if err == nil {
+	client := NewHubClient(addr, createTestAgentInfo())
+	defer client.Close()
+
+	if err := client.Connect(); err == nil {
 		t.Error("Expected connection error, got nil")
 	}
 
@@ -554,14 +490,10 @@ func TestSendFlow_ChannelFullReturnsError(t *testing.T) {
 	// Create a client with small channel capacity for testing
 	agentInfo := createTestAgentInfo()
 	client := &HubClient{
-		hubURL:    "http://hub:8080",
-		agentInfo: agentInfo,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		flowChan:    make(chan *protocol.Flow, 2), // Small capacity
-		pcapChan:    make(chan []byte, 100),
-		maxFailures: 3,
+		hubAddress: "hub:9090",
+		agentInfo:  agentInfo,
+		flowChan:   make(chan *protocol.Flow, 2), // Small capacity
+		pcapChan:   make(chan []byte, 100),
 	}
 	client.ctx, client.cancel = context.WithCancel(context.Background())
 	defer client.Close()
@@ -581,47 +513,16 @@ func TestSendFlow_ChannelFullReturnsError(t *testing.T) {
 	}
 }
 
-// TestSendFlow_FlowSentToHubViaHTTP tests that queued flow is sent to Hub via POST /api/flows
-func TestSendFlow_FlowSentToHubViaHTTP(t *testing.T) {
-	var receivedFlow protocol.Flow
-	flowReceived := make(chan bool, 1)
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":    "healthy",
-				"sessionId": "test-session",
-				"bpfFilter": "",
-			})
-		case "/api/agents":
-			w.WriteHeader(http.StatusOK)
-		case "/api/flows":
-			if r.Method == "POST" {
-				json.NewDecoder(r.Body).Decode(&receivedFlow)
-				flowReceived <- true
-			}
-			w.WriteHeader(http.StatusCreated)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
+// TestSendFlow_FlowSentToHubViaGRPC tests that queued flow is sent to Hub on the StreamFlows stream
+func TestSendFlow_FlowSentToHubViaGRPC(t *testing.T) {
+	hub, addr := startFakeHub(t)
 
-	client := createClientForTestServer(t, server.URL)
-	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client := createClientForTestServer(t, addr)
 	defer client.Close()
 
-	// Mark as connected and start the flow streamer
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
-	client.startFlowStreamer()
-
 	// Send a flow
 	flow := &protocol.Flow{
-		ID:       "test-flow-http",
+		ID:       "test-flow-grpc",
 		SrcIP:    "192.168.1.10",
 		DstIP:    "10.0.0.5",
 		SrcPort:  45678,
@@ -636,14 +537,15 @@ func TestSendFlow_FlowSentToHubViaHTTP(t *testing.T) {
 	}
 
 	// Wait for flow to be received by server
+	var event *pb.FlowEvent
 	select {
-	case <-flowReceived:
-		// Flow was received
+	case event = <-hub.flows:
 	case <-time.After(2 * time.Second):
 		t.Fatal("Timeout waiting for flow to be sent to Hub")
 	}
 
 	// Verify the flow data
+	receivedFlow := pb.ToFlow(event.GetFlow())
 	if receivedFlow.ID != flow.ID {
 		t.Errorf("Expected flow ID '%s', got '%s'", flow.ID, receivedFlow.ID)
 	}
@@ -664,127 +566,50 @@ func TestSendFlow_FlowSentToHubViaHTTP(t *testing.T) {
 	}
 }
 
-// TestSendFlow_JSONCorrectlyFormatted tests that flow is sent with correct JSON formatting
-func TestSendFlow_JSONCorrectlyFormatted(t *testing.T) {
-	var receivedBody []byte
-	bodyReceived := make(chan bool, 1)
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":    "healthy",
-				"sessionId": "test-session",
-				"bpfFilter": "",
-			})
-		case "/api/agents":
-			w.WriteHeader(http.StatusOK)
-		case "/api/flows":
-			if r.Method == "POST" {
-				buf := new(bytes.Buffer)
-				buf.ReadFrom(r.Body)
-				receivedBody = buf.Bytes()
-				bodyReceived <- true
-			}
-			w.WriteHeader(http.StatusCreated)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
+// TestSendFlow_AgentIDSet tests that flow events carry the sending agent's ID
+func TestSendFlow_AgentIDSet(t *testing.T) {
+	hub, addr := startFakeHub(t)
 
-	client := createClientForTestServer(t, server.URL)
-	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client := createClientForTestServer(t, addr)
 	defer client.Close()
 
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
-	client.startFlowStreamer()
-
-	flow := &protocol.Flow{
-		ID:       "json-test-flow",
-		SrcIP:    "10.0.0.1",
-		DstIP:    "10.0.0.2",
-		SrcPort:  1234,
-		DstPort:  443,
-		Protocol: "HTTPS",
-		Status:   "closed",
-	}
-
-	err := client.SendFlow(flow)
-	if err != nil {
+	if err := client.SendFlow(createTestFlow("agent-id-test")); err != nil {
 		t.Fatalf("Failed to send flow: %v", err)
 	}
 
 	select {
-	case <-bodyReceived:
+	case event := <-hub.flows:
+		if event.GetAgentId() != client.agentInfo.ID {
+			t.Errorf("Expected agent ID '%s', got '%s'", client.agentInfo.ID, event.GetAgentId())
+		}
 	case <-time.After(2 * time.Second):
 		t.Fatal("Timeout waiting for flow to be sent to Hub")
 	}
-
-	// Verify JSON is valid
-	var parsedFlow protocol.Flow
-	err = json.Unmarshal(receivedBody, &parsedFlow)
-	if err != nil {
-		t.Errorf("Received body is not valid JSON: %v", err)
-	}
-
-	// Verify key fields
-	if parsedFlow.ID != "json-test-flow" {
-		t.Errorf("Expected ID 'json-test-flow', got '%s'", parsedFlow.ID)
-	}
 }
 
-// TestSendFlow_PostMethodUsed tests that POST method is used for /api/flows
-func TestSendFlow_PostMethodUsed(t *testing.T) {
-	methodUsed := ""
-	methodReceived := make(chan bool, 1)
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":    "healthy",
-				"sessionId": "test-session",
-				"bpfFilter": "",
-			})
-		case "/api/agents":
-			w.WriteHeader(http.StatusOK)
-		case "/api/flows":
-			methodUsed = r.Method
-			methodReceived <- true
-			w.WriteHeader(http.StatusCreated)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
+// TestSendFlow_MultipleFlowsArriveInOrder tests that consecutive flows arrive in order
+func TestSendFlow_MultipleFlowsArriveInOrder(t *testing.T) {
+	hub, addr := startFakeHub(t)
 
-	client := createClientForTestServer(t, server.URL)
-	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client := createClientForTestServer(t, addr)
 	defer client.Close()
 
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
-	client.startFlowStreamer()
-
-	err := client.SendFlow(createTestFlow("method-test"))
-	if err != nil {
-		t.Fatalf("Failed to send flow: %v", err)
-	}
-
-	select {
-	case <-methodReceived:
-	case <-time.After(2 * time.Second):
-		t.Fatal("Timeout waiting for flow to be sent to Hub")
+	for i := 0; i < 5; i++ {
+		if err := client.SendFlow(createTestFlow(fmt.Sprintf("flow-%03d", i))); err != nil {
+			t.Fatalf("Failed to send flow %d: %v", i, err)
+		}
 	}
 
-	if methodUsed != "POST" {
-		t.Errorf("Expected POST method, got '%s'", methodUsed)
+	for i := 0; i < 5; i++ {
+		select {
+		case event := <-hub.flows:
+			expected := fmt.Sprintf("flow-%03d", i)
+			if event.GetFlow().GetId() != expected {
+				t.Errorf("Expected flow '%s', got '%s'", expected, event.GetFlow().GetId())
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout waiting for flow %d", i)
+		}
 	}
 }
 
@@ -840,14 +665,10 @@ func TestSendPCAPChunk_ChannelFullReturnsError(t *testing.T) {
 	// Create a client with small pcap channel capacity for testing
 	agentInfo := createTestAgentInfo()
 	client := &HubClient{
-		hubURL:    "http://hub:8080",
-		agentInfo: agentInfo,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		flowChan:    make(chan *protocol.Flow, 1000),
-		pcapChan:    make(chan []byte, 2), // Small capacity
-		maxFailures: 3,
+		hubAddress: "hub:9090",
+		agentInfo:  agentInfo,
+		flowChan:   make(chan *protocol.Flow, 1000),
+		pcapChan:   make(chan []byte, 2), // Small capacity
 	}
 	client.ctx, client.cancel = context.WithCancel(context.Background())
 	defer client.Close()
@@ -888,46 +709,13 @@ func TestSendPCAPChunk_MultipleChunksQueued(t *testing.T) {
 	}
 }
 
-// TestSendPCAPChunk_SentToHubViaHTTP tests that queued PCAP data is sent to Hub via POST /api/pcap/upload
-func TestSendPCAPChunk_SentToHubViaHTTP(t *testing.T) {
-	var receivedData []byte
-	dataReceived := make(chan bool, 1)
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":    "healthy",
-				"sessionId": "test-session",
-				"bpfFilter": "",
-			})
-		case "/api/agents":
-			w.WriteHeader(http.StatusOK)
-		case "/api/pcap/upload":
-			if r.Method == "POST" {
-				buf := new(bytes.Buffer)
-				buf.ReadFrom(r.Body)
-				receivedData = buf.Bytes()
-				dataReceived <- true
-			}
-			w.WriteHeader(http.StatusOK)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
+// TestSendPCAPChunk_SentToHubViaGRPC tests that queued PCAP data is sent to Hub on the StreamPCAP stream
+func TestSendPCAPChunk_SentToHubViaGRPC(t *testing.T) {
+	hub, addr := startFakeHub(t)
 
-	client := createClientForTestServer(t, server.URL)
-	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client := createClientForTestServer(t, addr)
 	defer client.Close()
 
-	// Mark as connected and start the PCAP streamer
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
-	client.startPCAPStreamer()
-
 	// Send PCAP data
 	testData := []byte{0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00}
 
@@ -937,14 +725,15 @@ func TestSendPCAPChunk_SentToHubViaHTTP(t *testing.T) {
 	}
 
 	// Wait for data to be received by server
+	var chunk *pb.PCAPChunk
 	select {
-	case <-dataReceived:
-		// Data was received
+	case chunk = <-hub.chunks:
 	case <-time.After(2 * time.Second):
 		t.Fatal("Timeout waiting for PCAP data to be sent to Hub")
 	}
 
 	// Verify the data
+	receivedData := chunk.GetData()
 	if len(receivedData) != len(testData) {
 		t.Errorf("Expected data length %d, got %d", len(testData), len(receivedData))
 	}
@@ -957,110 +746,31 @@ func TestSendPCAPChunk_SentToHubViaHTTP(t *testing.T) {
 	}
 }
 
-// TestSendPCAPChunk_XAgentIDHeaderSet tests that X-Agent-ID header is set when sending PCAP data
-func TestSendPCAPChunk_XAgentIDHeaderSet(t *testing.T) {
-	var receivedAgentID string
-	headerReceived := make(chan bool, 1)
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":    "healthy",
-				"sessionId": "test-session",
-				"bpfFilter": "",
-			})
-		case "/api/agents":
-			w.WriteHeader(http.StatusOK)
-		case "/api/pcap/upload":
-			if r.Method == "POST" {
-				receivedAgentID = r.Header.Get("X-Agent-ID")
-				headerReceived <- true
-			}
-			w.WriteHeader(http.StatusOK)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
+// TestSendPCAPChunk_AgentIDSet tests that PCAP chunks carry the sending agent's ID
+func TestSendPCAPChunk_AgentIDSet(t *testing.T) {
+	hub, addr := startFakeHub(t)
 
-	client := createClientForTestServer(t, server.URL)
-	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client := createClientForTestServer(t, addr)
 	defer client.Close()
 
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
-	client.startPCAPStreamer()
-
 	err := client.SendPCAPChunk([]byte{0x01, 0x02, 0x03})
 	if err != nil {
 		t.Fatalf("Failed to send PCAP chunk: %v", err)
 	}
 
 	select {
-	case <-headerReceived:
-	case <-time.After(2 * time.Second):
-		t.Fatal("Timeout waiting for PCAP data to be sent to Hub")
-	}
-
-	// Verify X-Agent-ID header matches agent info
-	expectedAgentID := client.agentInfo.ID
-	if receivedAgentID != expectedAgentID {
-		t.Errorf("Expected X-Agent-ID '%s', got '%s'", expectedAgentID, receivedAgentID)
-	}
-}
-
-// TestSendPCAPChunk_PostMethodUsed tests that POST method is used for /api/pcap/upload
-func TestSendPCAPChunk_PostMethodUsed(t *testing.T) {
-	methodUsed := ""
-	methodReceived := make(chan bool, 1)
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":    "healthy",
-				"sessionId": "test-session",
-				"bpfFilter": "",
-			})
-		case "/api/agents":
-			w.WriteHeader(http.StatusOK)
-		case "/api/pcap/upload":
-			methodUsed = r.Method
-			methodReceived <- true
-			w.WriteHeader(http.StatusOK)
-		default:
-			w.WriteHeader(http.StatusNotFound)
+	case chunk := <-hub.chunks:
+		// Verify agent ID matches agent info
+		expectedAgentID := client.agentInfo.ID
+		if chunk.GetAgentId() != expectedAgentID {
+			t.Errorf("Expected agent ID '%s', got '%s'", expectedAgentID, chunk.GetAgentId())
+		}
+		if chunk.GetTimestamp() == 0 {
+			t.Error("Expected chunk timestamp to be set")
 		}
-	}))
-	defer server.Close()
-
-	client := createClientForTestServer(t, server.URL)
-	client.ctx, client.cancel = context.WithCancel(context.Background())
-	defer client.Close()
-
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
-	client.startPCAPStreamer()
-
-	err := client.SendPCAPChunk([]byte{0x01, 0x02})
-	if err != nil {
-		t.Fatalf("Failed to send PCAP chunk: %v", err)
-	}
-
-	select {
-	case <-methodReceived:
 	case <-time.After(2 * time.Second):
 		t.Fatal("Timeout waiting for PCAP data to be sent to Hub")
 	}
-
-	if methodUsed != "POST" {
-		t.Errorf("Expected POST method, got '%s'", methodUsed)
-	}
 }
 
 // TestSendPCAPChunk_EmptyData tests that empty PCAP data can be queued
@@ -1280,36 +990,9 @@ func TestClose_CanBeCalledMultipleTimes(t *testing.T) {
 
 // TestClose_WaitsForStreamersToFinish tests that Close() waits for goroutines to finish
 func TestClose_WaitsForStreamersToFinish(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/api/health":
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":    "healthy",
-				"sessionId": "test-session",
-				"bpfFilter": "",
-			})
-		case "/api/agents":
-			w.WriteHeader(http.StatusOK)
-		case "/api/flows":
-			w.WriteHeader(http.StatusCreated)
-		case "/api/pcap/upload":
-			w.WriteHeader(http.StatusOK)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
+	_, addr := startFakeHub(t)
 
-	client := createClientForTestServer(t, server.URL)
-	client.ctx, client.cancel = context.WithCancel(context.Background())
-
-	// Mark as connected and start streamers
-	client.connMutex.Lock()
-	client.connected = true
-	client.connMutex.Unlock()
-	client.startFlowStreamer()
-	client.startPCAPStreamer()
+	client := createClientForTestServer(t, addr)
 
 	// Queue some data
 	client.SendFlow(createTestFlow("test-flow"))
@@ -1324,10 +1007,13 @@ func TestClose_WaitsForStreamersToFinish(t *testing.T) {
 		t.Errorf("Expected Close() to return nil, got: %v", err)
 	}
 
-	// After Close(), streamers should be done
+	// After Close(), streamers should be done and the connection released
 	if client.IsConnected() {
 		t.Error("Expected IsConnected() to return false after Close()")
 	}
+	if client.conn != nil {
+		t.Error("Expected gRPC connection to be released after Close()")
+	}
 }
 
 // TestClose_AfterNeverConnected tests that Close() works even if Connect() was never called
@@ -1345,3 +1031,333 @@ func TestClose_AfterNeverConnected(t *testing.T) {
 		t.Error("Expected IsConnected() to return false")
 	}
 }
+
+// TestSendHeartbeat_ReportsCaptureStats tests that heartbeats carry the capturer's counters
+func TestSendHeartbeat_ReportsCaptureStats(t *testing.T) {
+	hub, address := startFakeHub(t)
+	client := createClientForTestServer(t, address)
+	defer client.Close()
+
+	capturer := &Capturer{
+		assembler:  NewTCPAssembler(nil, createTestAgentInfo()),
+		udpTracker: NewUDPTracker(nil, createTestAgentInfo()),
+	}
+	capturer.stats = CaptureStats{PacketsCaptured: 42, BytesCaptured: 4200, FlowsDetected: 3, Errors: 1}
+	capturer.assembler.flows["10.0.0.1:1234-10.0.0.2:80"] = &TCPFlow{}
+	client.SetCapturer(capturer)
+
+	client.sendHeartbeat()
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.heartbeats != 1 {
+		t.Fatalf("heartbeats = %d, want 1", hub.heartbeats)
+	}
+	stats := hub.lastStats
+	if stats == nil {
+		t.Fatal("heartbeat carried no stats")
+	}
+	if stats.GetPacketsCaptured() != 42 || stats.GetBytesCaptured() != 4200 || stats.GetFlowsDetected() != 3 || stats.GetErrors() != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if stats.GetActiveFlows() != 1 {
+		t.Errorf("active flows = %d, want 1", stats.GetActiveFlows())
+	}
+}
+
+// TestSendHeartbeat_WithoutCapturer tests that a heartbeat still reports delivery before capture is wired up
+func TestSendHeartbeat_WithoutCapturer(t *testing.T) {
+	hub, address := startFakeHub(t)
+	client := createClientForTestServer(t, address)
+	defer client.Close()
+
+	client.delivery.flowsQueueFull.Add(2)
+	client.sendHeartbeat()
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.heartbeats != 1 {
+		t.Fatalf("heartbeats = %d, want 1", hub.heartbeats)
+	}
+	if hub.lastStats.GetPacketsCaptured() != 0 || hub.lastStats.GetFlowsDroppedQueueFull() != 2 {
+		t.Errorf("stats = %+v, want only the delivery counters", hub.lastStats)
+	}
+}
+
+// TestDeliveryStats_QueueFull tests that flows and PCAP data turned away by full queues are counted
+func TestDeliveryStats_QueueFull(t *testing.T) {
+	client := &HubClient{
+		agentInfo: createTestAgentInfo(),
+		flowChan:  make(chan *protocol.Flow, 1),
+		pcapChan:  make(chan []byte, 1),
+	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	defer client.Close()
+
+	client.SendFlow(createTestFlow("flow-001"))
+	client.SendFlow(createTestFlow("flow-002"))
+	client.SendPCAPChunk(make([]byte, 100))
+	client.SendPCAPChunk(make([]byte, 300))
+
+	stats := client.DeliveryStats()
+	if stats.FlowsQueueFull != 1 || stats.PCAPBytesQueueFull != 300 {
+		t.Errorf("stats = %+v, want 1 flow and 300 PCAP bytes dropped", stats)
+	}
+	if stats.FlowsSent != 0 || stats.FlowsSendFailed != 0 {
+		t.Errorf("stats = %+v, want nothing sent or failed", stats)
+	}
+}
+
+// TestDeliveryStats_SpoolFull tests that data evicted from a full spool is
+// counted apart from data that failed to send
+func TestDeliveryStats_SpoolFull(t *testing.T) {
+	client := &HubClient{agentInfo: createTestAgentInfo()}
+
+	flows := newSpool(1, func(*protocol.Flow) int64 { return 1 })
+	client.spoolFlow(flows, createTestFlow("flow-001"))
+	client.spoolFlow(flows, createTestFlow("flow-002"))
+	chunks := newSpool(100, func(chunk pcapChunk) int64 { return int64(len(chunk.data)) })
+	client.spoolPCAP(chunks, make([]byte, 60))
+	client.spoolPCAP(chunks, make([]byte, 60))
+
+	stats := client.DeliveryStats()
+	if stats.FlowsSpoolFull != 1 || stats.PCAPBytesSpoolFull != 60 {
+		t.Errorf("stats = %+v, want 1 flow and 60 PCAP bytes dropped from the spool", stats)
+	}
+	if stats.FlowsSendFailed != 0 || stats.PCAPBytesSendFailed != 0 {
+		t.Errorf("stats = %+v, want nothing counted as failed to send", stats)
+	}
+}
+
+// TestDeliveryStats_Sent tests that flows and PCAP data are counted once sent
+func TestDeliveryStats_Sent(t *testing.T) {
+	hub, address := startFakeHub(t)
+	client := createClientForTestServer(t, address)
+	defer client.Close()
+
+	client.SendFlow(createTestFlow("flow-001"))
+	client.SendPCAPChunk(make([]byte, 64))
+	<-hub.flows
+	<-hub.chunks
+	waitForDelivery(t, client, func(s DeliveryStats) bool { return s.FlowsSent == 1 && s.PCAPBytesSent == 64 })
+}
+
+// TestStreamers_ReplaySpooledDataInOrder tests that data queued while the hub is unreachable arrives in order once it is back
+func TestStreamers_ReplaySpooledDataInOrder(t *testing.T) {
+	hub, address := startFakeHub(t)
+	client := createClientForTestServer(t, address)
+	defer client.Close()
+
+	client.connMutex.Lock()
+	client.connected = false
+	client.connMutex.Unlock()
+
+	for i := 0; i < 3; i++ {
+		client.SendFlow(createTestFlow(fmt.Sprintf("flow-%03d", i)))
+		client.SendPCAPChunk([]byte{byte(i)})
+	}
+
+	select {
+	case event := <-hub.flows:
+		t.Fatalf("flow %s sent while the hub was unreachable", event.GetFlow().GetId())
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	client.connMutex.Lock()
+	client.connected = true
+	client.connMutex.Unlock()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case event := <-hub.flows:
+			if want := fmt.Sprintf("flow-%03d", i); event.GetFlow().GetId() != want {
+				t.Errorf("flow %d = %s, want %s", i, event.GetFlow().GetId(), want)
+			}
+		case <-time.After(3 * spoolRetryInterval):
+			t.Fatalf("timeout waiting for spooled flow %d", i)
+		}
+		select {
+		case chunk := <-hub.chunks:
+			if !bytes.Equal(chunk.GetData(), []byte{byte(i)}) {
+				t.Errorf("chunk %d = %v, want [%d]", i, chunk.GetData(), i)
+			}
+			if chunk.GetSeq() != uint64(i+1) {
+				t.Errorf("chunk %d numbered %d, want %d", i, chunk.GetSeq(), i+1)
+			}
+		case <-time.After(3 * spoolRetryInterval):
+			t.Fatalf("timeout waiting for spooled chunk %d", i)
+		}
+	}
+
+	waitForDelivery(t, client, func(s DeliveryStats) bool { return s.FlowsSent == 3 && s.PCAPBytesSent == 3 })
+	if stats := client.DeliveryStats(); stats.FlowsSendFailed != 0 || stats.PCAPBytesSendFailed != 0 {
+		t.Errorf("stats = %+v, want nothing dropped", stats)
+	}
+}
+
+// TestFlowStreamer_KeepsOneStreamOpen tests that flows trickling in are
+// sent on one stream, confirmed once it has been open a while, rather than
+// on a stream each
+func TestFlowStreamer_KeepsOneStreamOpen(t *testing.T) {
+	hub, address := startFakeHub(t)
+	client := createClientForTestServer(t, address)
+	defer client.Close()
+
+	for i := 0; i < 5; i++ {
+		client.SendFlow(createTestFlow(fmt.Sprintf("flow-%03d", i)))
+		time.Sleep(streamConfirmInterval / 10)
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-hub.flows:
+		case <-time.After(3 * spoolRetryInterval):
+			t.Fatalf("timeout waiting for flow %d", i)
+		}
+	}
+
+	waitForDelivery(t, client, func(s DeliveryStats) bool { return s.FlowsSent == 5 })
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.flowStreams != 1 {
+		t.Errorf("flows sent on %d streams, want 1", hub.flowStreams)
+	}
+}
+
+// TestStreamers_KeepFlowsUntilConfirmed tests that flows on a stream that
+// breaks before the hub confirms them are sent again
+func TestStreamers_KeepFlowsUntilConfirmed(t *testing.T) {
+	hub, address := startFakeHub(t)
+	hub.breakFlows = 1
+	client := createClientForTestServer(t, address)
+	defer client.Close()
+
+	client.SendFlow(createTestFlow("flow-001"))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		select {
+		case event := <-hub.flows:
+			if event.GetFlow().GetId() != "flow-001" {
+				t.Errorf("attempt %d sent %s, want flow-001", attempt, event.GetFlow().GetId())
+			}
+		case <-time.After(3 * spoolRetryInterval):
+			t.Fatalf("timeout waiting for attempt %d", attempt)
+		}
+	}
+
+	waitForDelivery(t, client, func(s DeliveryStats) bool { return s.FlowsSent == 1 })
+	if stats := client.DeliveryStats(); stats.FlowsSendFailed != 0 {
+		t.Errorf("stats = %+v, want nothing dropped", stats)
+	}
+}
+
+// TestClose_FlushesSpooledData tests that data still spooled when the client
+// closes is delivered rather than dropped
+func TestClose_FlushesSpooledData(t *testing.T) {
+	hub, address := startFakeHub(t)
+	client := createClientForTestServer(t, address)
+
+	client.connMutex.Lock()
+	client.connected = false
+	client.connMutex.Unlock()
+
+	for i := 0; i < 3; i++ {
+		client.SendFlow(createTestFlow(fmt.Sprintf("flow-%03d", i)))
+	}
+	client.SendPCAPChunk([]byte{0x01, 0x02})
+	client.Close()
+
+	if len(hub.flows) != 3 || len(hub.chunks) != 1 {
+		t.Fatalf("hub received %d flows and %d chunks, want 3 and 1", len(hub.flows), len(hub.chunks))
+	}
+	stats := client.DeliveryStats()
+	if stats.FlowsSent != 3 || stats.PCAPBytesSent != 2 {
+		t.Errorf("stats = %+v, want 3 flows and 2 PCAP bytes sent", stats)
+	}
+}
+
+// TestSendHeartbeat_GracePeriod tests that an unreachable hub is waited for until the grace period runs out
+func TestSendHeartbeat_GracePeriod(t *testing.T) {
+	// Nothing listens here, so every heartbeat fails
+	client := NewHubClient("127.0.0.1:1", createTestAgentInfo())
+	defer client.Close()
+	if err := client.Connect(); err == nil {
+		t.Fatal("Expected Connect to fail without a hub")
+	}
+	client.connected = true
+
+	var gaveUp bool
+	client.SetOnDisconnect(func() { gaveUp = true })
+	client.SetGracePeriod(time.Hour)
+
+	if !client.sendHeartbeat() || gaveUp {
+		t.Fatal("gave up within the grace period")
+	}
+	if client.IsConnected() {
+		t.Error("Expected IsConnected() to be false while the hub is unreachable")
+	}
+
+	client.unreachableSince = time.Now().Add(-time.Hour)
+	if client.sendHeartbeat() || !gaveUp {
+		t.Error("Expected to give up once the grace period ran out")
+	}
+}
+
+// TestSendHeartbeat_ReregistersWhenHubIsBack tests that a hub answering again is registered with anew
+func TestSendHeartbeat_ReregistersWhenHubIsBack(t *testing.T) {
+	hub, address := startFakeHub(t)
+	client := createClientForTestServer(t, address)
+	defer client.Close()
+
+	client.connMutex.Lock()
+	client.connected = false
+	client.connMutex.Unlock()
+	client.unreachableSince = time.Now().Add(-30 * time.Second)
+
+	if !client.sendHeartbeat() {
+		t.Fatal("sendHeartbeat gave up on a reachable hub")
+	}
+	if !client.IsConnected() || !client.unreachableSince.IsZero() {
+		t.Error("Expected the client to be connected again")
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if len(hub.registered) != 2 {
+		t.Errorf("registrations = %d, want 2", len(hub.registered))
+	}
+}
+
+func TestSendHeartbeat_ReregistersWithRestartedHub(t *testing.T) {
+	hub, address := startFakeHub(t)
+	client := createClientForTestServer(t, address)
+	defer client.Close()
+
+	hub.mu.Lock()
+	hub.forgotten = true
+	hub.mu.Unlock()
+
+	if !client.sendHeartbeat() {
+		t.Fatal("sendHeartbeat gave up on a reachable hub")
+	}
+	if !client.IsConnected() {
+		t.Error("Expected the client to stay connected")
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if len(hub.registered) != 2 {
+		t.Errorf("registrations = %d, want 2", len(hub.registered))
+	}
+}
+
+// waitForDelivery waits for the streamers to account for what was queued
+func waitForDelivery(t *testing.T, client *HubClient, done func(DeliveryStats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * streamConfirmInterval)
+	for !done(client.DeliveryStats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery stats = %+v", client.DeliveryStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
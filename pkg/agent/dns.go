@@ -0,0 +1,276 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const (
+	// DNSPort is the well-known DNS port
+	DNSPort = 53
+	// DNSTimeout is how long a query waits for a response. Resolvers
+	// (glibc, musl, Go) retry after 5s by default.
+	DNSTimeout = 5 * time.Second
+)
+
+// DNSTracker pairs DNS queries with their responses and emits one flow per
+// transaction
+type DNSTracker struct {
+	queries        map[string]*dnsQuery
+	mutex          sync.Mutex
+	onFlowComplete func(*protocol.Flow)
+
+	// Agent info for populating pod names
+	agentPodName   string
+	agentNamespace string
+	agentPodIP     string
+
+	// Sockets of the pod's processes, for attributing flows
+	processes *ProcessTable
+
+	// Addresses from answers, for naming the flows that follow
+	names *ResolvedNames
+}
+
+// dnsQuery is a query waiting for its response
+type dnsQuery struct {
+	flow *protocol.Flow
+	sent time.Time
+}
+
+// NewDNSTracker creates a new DNS transaction tracker
+func NewDNSTracker(onComplete func(*protocol.Flow), agentInfo *protocol.AgentInfo) *DNSTracker {
+	t := &DNSTracker{
+		queries:        make(map[string]*dnsQuery),
+		onFlowComplete: onComplete,
+	}
+
+	if agentInfo != nil {
+		t.agentPodName = agentInfo.PodName
+		t.agentNamespace = agentInfo.Namespace
+		t.agentPodIP = agentInfo.PodIP
+	}
+
+	go t.cleanupLoop()
+
+	return t
+}
+
+// dnsKey identifies a transaction by client, server and DNS message ID
+func dnsKey(clientIP string, clientPort uint16, serverIP string, serverPort uint16, id uint16) string {
+	return fmt.Sprintf("%s:%d-%s:%d#%d", clientIP, clientPort, serverIP, serverPort, id)
+}
+
+// ProcessPacket processes a DNS message carried over UDP
+func (t *DNSTracker) ProcessPacket(srcIP, dstIP string, srcPort, dstPort uint16, dns *layers.DNS, size int, timestamp time.Time) {
+	if !dns.QR {
+		t.processQuery(srcIP, dstIP, srcPort, dstPort, dns, size, timestamp)
+		return
+	}
+
+	// Remember the addresses so connections to them can be named, even
+	// when the query itself was missed
+	t.recordNames(dns, timestamp)
+
+	key := dnsKey(dstIP, dstPort, srcIP, srcPort, dns.ID)
+
+	t.mutex.Lock()
+	q, ok := t.queries[key]
+	if ok {
+		delete(t.queries, key)
+	}
+	t.mutex.Unlock()
+
+	// Responses to queries sent before capture started can't be timed
+	if !ok {
+		return
+	}
+
+	f := q.flow
+	f.PacketsRecv++
+	f.BytesReceived += uint64(size)
+	f.Duration = timestamp.Sub(f.Timestamp).Milliseconds()
+	f.Status = protocol.StatusClosed
+
+	latency := timestamp.Sub(q.sent).Seconds() * 1000
+	f.DNS.LatencyMs = latency
+	f.TimeToFirstByte = latency
+	f.DNS.RCode = dnsRCodeName(dns.ResponseCode)
+	for _, rr := range dns.Answers {
+		f.DNS.Answers = append(f.DNS.Answers, protocol.DNSAnswer{
+			Name:  string(rr.Name),
+			Type:  rr.Type.String(),
+			Value: dnsRecordValue(rr),
+			TTL:   rr.TTL,
+		})
+	}
+
+	t.complete(f)
+}
+
+// processQuery records a query, or counts a retransmission of one in flight
+func (t *DNSTracker) processQuery(srcIP, dstIP string, srcPort, dstPort uint16, dns *layers.DNS, size int, timestamp time.Time) {
+	key := dnsKey(srcIP, srcPort, dstIP, dstPort, dns.ID)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if q, ok := t.queries[key]; ok {
+		q.flow.PacketsSent++
+		q.flow.BytesSent += uint64(size)
+		q.sent = timestamp
+		return
+	}
+
+	info := &protocol.DNSInfo{ID: dns.ID}
+	if len(dns.Questions) > 0 {
+		info.Name = string(dns.Questions[0].Name)
+		info.Type = dns.Questions[0].Type.String()
+	}
+
+	t.queries[key] = &dnsQuery{
+		flow: &protocol.Flow{
+			ID:          uuid.New().String()[:8],
+			Timestamp:   timestamp,
+			SrcIP:       srcIP,
+			SrcPort:     srcPort,
+			DstIP:       dstIP,
+			DstPort:     dstPort,
+			Protocol:    protocol.ProtocolDNS,
+			BytesSent:   uint64(size),
+			PacketsSent: 1,
+			DNS:         info,
+			Process:     t.lookupProcess(srcIP, srcPort, dstIP, dstPort),
+		},
+		sent: timestamp,
+	}
+}
+
+// SetProcessTable sets the table used to find the process that sent each
+// query
+func (t *DNSTracker) SetProcessTable(processes *ProcessTable) {
+	t.processes = processes
+}
+
+// SetResolvedNames sets the cache that answered addresses are recorded in
+func (t *DNSTracker) SetResolvedNames(names *ResolvedNames) {
+	t.names = names
+}
+
+// recordNames remembers the name the pod asked for against each address in
+// a successful answer. CNAME chains are skipped over, since the app knows
+// the destination by the name it looked up.
+func (t *DNSTracker) recordNames(dns *layers.DNS, timestamp time.Time) {
+	if t.names == nil || dns.ResponseCode != layers.DNSResponseCodeNoErr || len(dns.Questions) == 0 {
+		return
+	}
+
+	name := string(dns.Questions[0].Name)
+	for _, rr := range dns.Answers {
+		if (rr.Type == layers.DNSTypeA || rr.Type == layers.DNSTypeAAAA) && rr.IP != nil {
+			t.names.Add(rr.IP.String(), name, rr.TTL, timestamp)
+		}
+	}
+}
+
+// lookupProcess finds the owner of the querying socket. Resolvers close it
+// once answered, so this is done when the query is seen.
+func (t *DNSTracker) lookupProcess(srcIP string, srcPort uint16, dstIP string, dstPort uint16) *protocol.ProcessInfo {
+	if t.processes == nil {
+		return nil
+	}
+	return t.processes.Lookup("udp", srcIP, srcPort, dstIP, dstPort)
+}
+
+// expire completes queries that have waited longer than DNSTimeout
+func (t *DNSTracker) expire(now time.Time) {
+	var expired []*protocol.Flow
+
+	t.mutex.Lock()
+	for key, q := range t.queries {
+		if now.Sub(q.sent) > DNSTimeout {
+			delete(t.queries, key)
+			expired = append(expired, q.flow)
+		}
+	}
+	t.mutex.Unlock()
+
+	for _, f := range expired {
+		f.Status = protocol.StatusTimeout
+		f.DNS.TimedOut = true
+		f.Duration = DNSTimeout.Milliseconds()
+		t.complete(f)
+	}
+}
+
+// complete attributes the flow to the agent's pod and sends it
+func (t *DNSTracker) complete(f *protocol.Flow) {
+	assignPods(f, t.agentPodName, t.agentNamespace, t.agentPodIP, nil)
+
+	if t.onFlowComplete != nil {
+		t.onFlowComplete(f)
+	}
+}
+
+// cleanupLoop times out unanswered queries
+func (t *DNSTracker) cleanupLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		t.expire(time.Now())
+	}
+}
+
+// dnsRCodeName returns the RFC 1035 mnemonic for a response code
+func dnsRCodeName(code layers.DNSResponseCode) string {
+	switch code {
+	case layers.DNSResponseCodeNoErr:
+		return "NOERROR"
+	case layers.DNSResponseCodeFormErr:
+		return "FORMERR"
+	case layers.DNSResponseCodeServFail:
+		return "SERVFAIL"
+	case layers.DNSResponseCodeNXDomain:
+		return "NXDOMAIN"
+	case layers.DNSResponseCodeNotImp:
+		return "NOTIMP"
+	case layers.DNSResponseCodeRefused:
+		return "REFUSED"
+	default:
+		return fmt.Sprintf("RCODE%d", code)
+	}
+}
+
+// dnsRecordValue formats the data of a resource record
+func dnsRecordValue(rr layers.DNSResourceRecord) string {
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		return net.IP(rr.IP).String()
+	case layers.DNSTypeCNAME:
+		return string(rr.CNAME)
+	case layers.DNSTypeNS:
+		return string(rr.NS)
+	case layers.DNSTypePTR:
+		return string(rr.PTR)
+	case layers.DNSTypeMX:
+		return fmt.Sprintf("%d %s", rr.MX.Preference, rr.MX.Name)
+	case layers.DNSTypeSRV:
+		return fmt.Sprintf("%d %d %d %s", rr.SRV.Priority, rr.SRV.Weight, rr.SRV.Port, rr.SRV.Name)
+	case layers.DNSTypeTXT:
+		txt := make([]string, len(rr.TXTs))
+		for i, b := range rr.TXTs {
+			txt[i] = string(b)
+		}
+		return strings.Join(txt, " ")
+	default:
+		return fmt.Sprintf("%d bytes", len(rr.Data))
+	}
+}
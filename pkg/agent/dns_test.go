@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// newTestDNSTracker creates a tracker that collects completed flows
+func newTestDNSTracker(agentInfo *protocol.AgentInfo) (*DNSTracker, *[]*protocol.Flow) {
+	var flows []*protocol.Flow
+	t := &DNSTracker{
+		queries:        make(map[string]*dnsQuery),
+		onFlowComplete: func(f *protocol.Flow) { flows = append(flows, f) },
+	}
+	if agentInfo != nil {
+		t.agentPodName = agentInfo.PodName
+		t.agentNamespace = agentInfo.Namespace
+		t.agentPodIP = agentInfo.PodIP
+	}
+	return t, &flows
+}
+
+func dnsQueryMsg(id uint16, name string, qtype layers.DNSType) *layers.DNS {
+	return &layers.DNS{
+		ID:        id,
+		RD:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte(name), Type: qtype, Class: layers.DNSClassIN}},
+	}
+}
+
+func dnsResponseMsg(id uint16, name string, rcode layers.DNSResponseCode, answers ...layers.DNSResourceRecord) *layers.DNS {
+	msg := dnsQueryMsg(id, name, layers.DNSTypeA)
+	msg.QR = true
+	msg.ResponseCode = rcode
+	msg.Answers = answers
+	return msg
+}
+
+// buildUDPPacket serializes an Ethernet/IPv4/UDP packet carrying payload
+func buildUDPPacket(t *testing.T, src, dst string, sport, dport layers.UDPPort, payload gopacket.SerializableLayer) gopacket.Packet {
+	t.Helper()
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+	udp := &layers.UDP{SrcPort: sport, DstPort: dport}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, payload); err != nil {
+		t.Fatalf("SerializeLayers: %v", err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestDNSTracker_PairsQueryAndResponse(t *testing.T) {
+	tracker, flows := newTestDNSTracker(&protocol.AgentInfo{PodName: "web", Namespace: "prod", PodIP: "10.0.0.5"})
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.ProcessPacket("10.0.0.5", "10.96.0.10", 40000, 53, dnsQueryMsg(7, "api.prod.svc.cluster.local", layers.DNSTypeA), 60, base)
+	if len(*flows) != 0 {
+		t.Fatal("query alone should not complete a flow")
+	}
+
+	answer := layers.DNSResourceRecord{
+		Name: []byte("api.prod.svc.cluster.local"), Type: layers.DNSTypeA, Class: layers.DNSClassIN,
+		TTL: 30, IP: net.ParseIP("10.96.4.2").To4(),
+	}
+	tracker.ProcessPacket("10.96.0.10", "10.0.0.5", 53, 40000, dnsResponseMsg(7, "api.prod.svc.cluster.local", layers.DNSResponseCodeNoErr, answer), 90, base.Add(3*time.Millisecond))
+
+	if len(*flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(*flows))
+	}
+	f := (*flows)[0]
+	if f.Protocol != protocol.ProtocolDNS || f.Status != protocol.StatusClosed {
+		t.Errorf("Protocol/Status = %s/%s, want DNS/CLOSED", f.Protocol, f.Status)
+	}
+	if f.SrcPod != "web" || f.SrcNamespace != "prod" {
+		t.Errorf("SrcPod = %s/%s, want prod/web", f.SrcNamespace, f.SrcPod)
+	}
+	if f.BytesSent != 60 || f.BytesReceived != 90 || f.PacketsSent != 1 || f.PacketsRecv != 1 {
+		t.Errorf("counters = %d/%d bytes %d/%d packets", f.BytesSent, f.BytesReceived, f.PacketsSent, f.PacketsRecv)
+	}
+
+	d := f.DNS
+	if d.Name != "api.prod.svc.cluster.local" || d.Type != "A" || d.RCode != "NOERROR" || d.ID != 7 {
+		t.Errorf("DNS = %+v", d)
+	}
+	if d.LatencyMs != 3 || f.TimeToFirstByte != 3 {
+		t.Errorf("LatencyMs = %v, TimeToFirstByte = %v, want 3", d.LatencyMs, f.TimeToFirstByte)
+	}
+	want := protocol.DNSAnswer{Name: "api.prod.svc.cluster.local", Type: "A", Value: "10.96.4.2", TTL: 30}
+	if len(d.Answers) != 1 || d.Answers[0] != want {
+		t.Errorf("Answers = %+v, want [%+v]", d.Answers, want)
+	}
+	if len(tracker.queries) != 0 {
+		t.Errorf("answered query should be removed, %d left", len(tracker.queries))
+	}
+}
+
+func TestDNSTracker_NXDomain(t *testing.T) {
+	tracker, flows := newTestDNSTracker(nil)
+	now := time.Now()
+
+	tracker.ProcessPacket("10.0.0.5", "10.96.0.10", 40000, 53, dnsQueryMsg(9, "missing.svc", layers.DNSTypeAAAA), 50, now)
+	tracker.ProcessPacket("10.96.0.10", "10.0.0.5", 53, 40000, dnsResponseMsg(9, "missing.svc", layers.DNSResponseCodeNXDomain), 50, now)
+
+	if len(*flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(*flows))
+	}
+	if got := (*flows)[0].DNS; got.RCode != "NXDOMAIN" || got.Type != "AAAA" || len(got.Answers) != 0 {
+		t.Errorf("DNS = %+v, want NXDOMAIN for AAAA with no answers", got)
+	}
+}
+
+func TestDNSTracker_MatchesByIDAndPort(t *testing.T) {
+	tracker, flows := newTestDNSTracker(nil)
+	now := time.Now()
+
+	// A and AAAA lookups are usually sent together from the same socket
+	tracker.ProcessPacket("10.0.0.5", "10.96.0.10", 40000, 53, dnsQueryMsg(1, "api", layers.DNSTypeA), 40, now)
+	tracker.ProcessPacket("10.0.0.5", "10.96.0.10", 40000, 53, dnsQueryMsg(2, "api", layers.DNSTypeAAAA), 40, now)
+	// Response with an unknown ID is ignored
+	tracker.ProcessPacket("10.96.0.10", "10.0.0.5", 53, 40000, dnsResponseMsg(3, "api", layers.DNSResponseCodeNoErr), 40, now)
+	tracker.ProcessPacket("10.96.0.10", "10.0.0.5", 53, 40000, dnsResponseMsg(2, "api", layers.DNSResponseCodeNoErr), 40, now)
+
+	if len(*flows) != 1 || (*flows)[0].DNS.Type != "AAAA" {
+		t.Fatalf("expected only the AAAA query to complete, got %d flows", len(*flows))
+	}
+	if len(tracker.queries) != 1 {
+		t.Errorf("A query should still be pending, %d pending", len(tracker.queries))
+	}
+}
+
+func TestDNSTracker_TimeoutAndRetransmit(t *testing.T) {
+	tracker, flows := newTestDNSTracker(nil)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.ProcessPacket("10.0.0.5", "10.96.0.10", 40000, 53, dnsQueryMsg(4, "slow.example.com", layers.DNSTypeA), 45, start)
+	tracker.ProcessPacket("10.0.0.5", "10.96.0.10", 40000, 53, dnsQueryMsg(4, "slow.example.com", layers.DNSTypeA), 45, start.Add(2*time.Second))
+
+	// The retransmission restarts the wait
+	tracker.expire(start.Add(DNSTimeout + time.Second))
+	if len(*flows) != 0 {
+		t.Fatal("query should not time out before DNSTimeout after the last retransmission")
+	}
+
+	tracker.expire(start.Add(2*time.Second + DNSTimeout + time.Millisecond))
+	if len(*flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(*flows))
+	}
+	f := (*flows)[0]
+	if f.Status != protocol.StatusTimeout || !f.DNS.TimedOut || f.DNS.RCode != "" {
+		t.Errorf("Status = %s, DNS = %+v, want a timed out query", f.Status, f.DNS)
+	}
+	if f.PacketsSent != 2 || f.BytesSent != 90 {
+		t.Errorf("PacketsSent = %d, BytesSent = %d, want 2 and 90", f.PacketsSent, f.BytesSent)
+	}
+}
+
+func TestDNSRecordValue(t *testing.T) {
+	tests := []struct {
+		rr   layers.DNSResourceRecord
+		want string
+	}{
+		{layers.DNSResourceRecord{Type: layers.DNSTypeAAAA, IP: net.ParseIP("fd00::1")}, "fd00::1"},
+		{layers.DNSResourceRecord{Type: layers.DNSTypeCNAME, CNAME: []byte("lb.example.com")}, "lb.example.com"},
+		{layers.DNSResourceRecord{Type: layers.DNSTypeSRV, SRV: layers.DNSSRV{Priority: 0, Weight: 10, Port: 5432, Name: []byte("db-0.db")}}, "0 10 5432 db-0.db"},
+		{layers.DNSResourceRecord{Type: layers.DNSTypeTXT, TXTs: [][]byte{[]byte("v=1"), []byte("x")}}, "v=1 x"},
+	}
+	for _, tt := range tests {
+		if got := dnsRecordValue(tt.rr); got != tt.want {
+			t.Errorf("dnsRecordValue(%s) = %q, want %q", tt.rr.Type, got, tt.want)
+		}
+	}
+}
+
+func TestCapturer_DNSPacketBecomesFlow(t *testing.T) {
+	tracker, flows := newTestDNSTracker(nil)
+	c := &Capturer{dnsTracker: tracker}
+
+	send := func(src, dst string, sport, dport layers.UDPPort, msg *layers.DNS) {
+		c.processPacket(buildUDPPacket(t, src, dst, sport, dport, msg))
+	}
+
+	send("10.0.0.5", "10.96.0.10", 40000, 53, dnsQueryMsg(11, "db.prod", layers.DNSTypeA))
+	send("10.96.0.10", "10.0.0.5", 53, 40000, dnsResponseMsg(11, "db.prod", layers.DNSResponseCodeServFail))
+
+	if len(*flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(*flows))
+	}
+	if got := (*flows)[0].DNS; got.Name != "db.prod" || got.RCode != "SERVFAIL" {
+		t.Errorf("DNS = %+v, want SERVFAIL for db.prod", got)
+	}
+	if stats := c.Stats(); stats.UDPPackets != 2 {
+		t.Errorf("UDPPackets = %d, want 2", stats.UDPPackets)
+	}
+}
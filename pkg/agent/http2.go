@@ -0,0 +1,440 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// http2FrameHeaderLen is the fixed frame header size (RFC 9113 section 4.1)
+	http2FrameHeaderLen = 9
+	// http2MaxFrameSize is the largest frame a peer may negotiate
+	http2MaxFrameSize = 1<<24 - 1
+	// http2MaxHeaderTableSize bounds HPACK dynamic table size updates. The
+	// SETTINGS that allow larger tables may be processed after the header
+	// blocks that use them, so be generous rather than track them.
+	http2MaxHeaderTableSize = 1 << 20
+)
+
+// http2Conn holds HTTP/2 decoding state for one TCP connection
+type http2Conn struct {
+	prefaceSeen bool
+	client      *http2Side
+	server      *http2Side
+	streams     map[uint32]*http2Stream
+}
+
+// http2Side decodes the frames sent in one direction. HPACK state is per
+// direction, so each side keeps its own decoder.
+type http2Side struct {
+	src     bytes.Reader
+	framer  *http2.Framer
+	decoder *hpack.Decoder
+	failed  bool
+
+	// Header block being assembled from HEADERS or PUSH_PROMISE +
+	// CONTINUATION frames
+	block        []byte
+	blockStream  uint32
+	blockEnd     bool
+	blockTime    time.Time
+	blockPromise bool   // a pushed request, decoded only to keep HPACK in step
+	blockOpen    uint32 // stream whose CONTINUATION frames must come next, if any
+}
+
+// http2Stream tracks one request/response stream
+type http2Stream struct {
+	ex         *protocol.HTTPExchange
+	reqMsgs    grpcMessages
+	respMsgs   grpcMessages
+	clientDone bool
+	serverDone bool
+}
+
+// grpcMessages counts length-prefixed gRPC messages across DATA frames
+type grpcMessages struct {
+	prefix    [5]byte
+	prefixLen int
+	remaining uint32
+	count     int
+	bytes     int64
+}
+
+func newHTTP2Conn() *http2Conn {
+	return &http2Conn{
+		client:  newHTTP2Side(),
+		server:  newHTTP2Side(),
+		streams: make(map[uint32]*http2Stream),
+	}
+}
+
+func newHTTP2Side() *http2Side {
+	s := &http2Side{}
+	s.framer = http2.NewFramer(nil, &s.src)
+	s.framer.SetMaxReadFrameSize(http2MaxFrameSize)
+	// The framer doesn't expect CONTINUATION after PUSH_PROMISE, so
+	// handleHTTP2Frame checks the order of header block frames instead
+	s.framer.AllowIllegalReads = true
+	s.decoder = hpack.NewDecoder(4096, nil)
+	s.decoder.SetAllowedMaxDynamicTableSize(http2MaxHeaderTableSize)
+	return s
+}
+
+// isHTTP2Preface checks if payload starts with the HTTP/2 client connection
+// preface, which h2c clients with prior knowledge (e.g. gRPC) send first
+func isHTTP2Preface(payload []byte) bool {
+	return bytes.HasPrefix(payload, []byte("PRI * HTTP/2.0"))
+}
+
+// parseHTTP2 decodes complete HTTP/2 frames from both directions, creating
+// one exchange per stream
+func (a *TCPAssembler) parseHTTP2(flow *TCPFlow) {
+	if flow.h2 == nil {
+		flow.h2 = newHTTP2Conn()
+	}
+	h := flow.h2
+
+	if !h.prefaceSeen {
+		if flow.ClientData.Len() < len(http2.ClientPreface) {
+			return
+		}
+		if !bytes.HasPrefix(flow.ClientData.Bytes(), []byte(http2.ClientPreface)) {
+			h.client.failed = true
+			h.server.failed = true
+			return
+		}
+		h.prefaceSeen = true
+		flow.ClientData.Next(len(http2.ClientPreface))
+		flow.clientMarks = consumeMarks(flow.clientMarks, len(http2.ClientPreface))
+	}
+
+	readHTTP2Frames(flow, h.client, &flow.ClientData, &flow.clientMarks, true)
+	readHTTP2Frames(flow, h.server, &flow.ServerData, &flow.serverMarks, false)
+}
+
+// readHTTP2Frames handles every complete frame buffered for one direction.
+// A frame that fails to decode stops that direction, since HPACK state can't
+// be recovered once a header block is lost.
+func readHTTP2Frames(flow *TCPFlow, side *http2Side, buf *bytes.Buffer, marks *[]dataMark, fromClient bool) {
+	for !side.failed {
+		data := buf.Bytes()
+		if len(data) < http2FrameHeaderLen {
+			return
+		}
+		n := http2FrameHeaderLen + (int(data[0])<<16 | int(data[1])<<8 | int(data[2]))
+		if len(data) < n {
+			return
+		}
+
+		side.src.Reset(data[:n])
+		frame, err := side.framer.ReadFrame()
+		if err != nil {
+			side.failed = true
+			return
+		}
+		handleHTTP2Frame(flow, side, frame, markTime(*marks), fromClient)
+
+		buf.Next(n)
+		*marks = consumeMarks(*marks, n)
+	}
+}
+
+// handleHTTP2Frame applies one decoded frame to the connection state
+func handleHTTP2Frame(flow *TCPFlow, side *http2Side, frame http2.Frame, ts time.Time, fromClient bool) {
+	// An unfinished header block continues on its stream before any other frame
+	_, continuation := frame.(*http2.ContinuationFrame)
+	if continuation != (side.blockOpen != 0) || continuation && frame.Header().StreamID != side.blockOpen {
+		side.failed = true
+		return
+	}
+
+	switch f := frame.(type) {
+	case *http2.HeadersFrame:
+		side.block = append(side.block[:0], f.HeaderBlockFragment()...)
+		side.blockStream = f.StreamID
+		side.blockEnd = f.StreamEnded()
+		side.blockTime = ts
+		side.blockPromise = false
+		continueHTTP2Headers(flow, side, f.StreamID, f.HeadersEnded(), fromClient)
+
+	case *http2.PushPromiseFrame:
+		side.block = append(side.block[:0], f.HeaderBlockFragment()...)
+		side.blockStream = f.PromiseID
+		side.blockEnd = false
+		side.blockTime = ts
+		side.blockPromise = true
+		continueHTTP2Headers(flow, side, f.StreamID, f.HeadersEnded(), fromClient)
+
+	case *http2.ContinuationFrame:
+		side.block = append(side.block, f.HeaderBlockFragment()...)
+		continueHTTP2Headers(flow, side, f.StreamID, f.HeadersEnded(), fromClient)
+
+	case *http2.DataFrame:
+		st := flow.h2.streams[f.StreamID]
+		if st == nil {
+			return
+		}
+		st.data(f.Data(), fromClient)
+		if f.StreamEnded() {
+			flow.h2.endStream(f.StreamID, fromClient)
+		}
+
+	case *http2.RSTStreamFrame:
+		st := flow.h2.streams[f.StreamID]
+		if st == nil {
+			return
+		}
+		if st.ex.StatusCode == 0 {
+			st.ex.StatusText = "RST_STREAM " + f.ErrCode.String()
+		}
+		delete(flow.h2.streams, f.StreamID)
+	}
+}
+
+// continueHTTP2Headers decodes the header block once its last frame is in,
+// or waits for the CONTINUATION frames on the stream it arrives on
+func continueHTTP2Headers(flow *TCPFlow, side *http2Side, stream uint32, ended bool, fromClient bool) {
+	if !ended {
+		side.blockOpen = stream
+		return
+	}
+	side.blockOpen = 0
+	finishHTTP2Headers(flow, side, fromClient)
+}
+
+// finishHTTP2Headers decodes a complete header block. Pushed requests are
+// decoded too, since they change the dynamic table later headers refer to,
+// but not reported.
+func finishHTTP2Headers(flow *TCPFlow, side *http2Side, fromClient bool) {
+	fields, err := side.decoder.DecodeFull(side.block)
+	if err != nil {
+		side.failed = true
+		return
+	}
+	if side.blockPromise {
+		return
+	}
+
+	if fromClient {
+		http2RequestHeaders(flow, side.blockStream, fields, side.blockTime)
+	} else {
+		http2ResponseHeaders(flow, side.blockStream, fields, side.blockTime)
+	}
+	if side.blockEnd {
+		flow.h2.endStream(side.blockStream, fromClient)
+	}
+}
+
+// http2RequestHeaders starts an exchange for a new client stream
+func http2RequestHeaders(flow *TCPFlow, id uint32, fields []hpack.HeaderField, ts time.Time) {
+	// Headers on a known stream are request trailers
+	if flow.h2.streams[id] != nil {
+		return
+	}
+
+	ex := &protocol.HTTPExchange{
+		HTTPInfo: protocol.HTTPInfo{
+			RequestHeaders: make(map[string]string),
+		},
+		RequestTime: ts,
+		StreamID:    id,
+	}
+	for _, hf := range fields {
+		switch hf.Name {
+		case ":method":
+			ex.Method = hf.Value
+		case ":path":
+			ex.URL = hf.Value
+		case ":authority":
+			ex.Host = hf.Value
+		default:
+			if !strings.HasPrefix(hf.Name, ":") {
+				addHeader(ex.RequestHeaders, hf)
+			}
+		}
+	}
+
+	if strings.HasPrefix(ex.RequestHeaders["Content-Type"], "application/grpc") {
+		ex.GRPC = newGRPCInfo(ex.URL)
+		flow.Protocol = protocol.ProtocolGRPC
+	}
+
+	// A dropped exchange is still updated through its stream, it is just
+	// no longer reported
+	flow.h2.streams[id] = &http2Stream{ex: ex}
+	flow.addExchange(ex)
+}
+
+// http2ResponseHeaders applies response headers or trailers to a stream
+func http2ResponseHeaders(flow *TCPFlow, id uint32, fields []hpack.HeaderField, ts time.Time) {
+	st := flow.h2.streams[id]
+	if st == nil {
+		return
+	}
+	ex := st.ex
+
+	for _, hf := range fields {
+		if hf.Name == ":status" {
+			code, err := strconv.Atoi(hf.Value)
+			// Interim responses such as 100 Continue precede the final one
+			if err != nil || code < 200 {
+				return
+			}
+			ex.StatusCode = code
+			ex.StatusText = fmt.Sprintf("%d %s", code, http.StatusText(code))
+		}
+	}
+
+	if ex.ResponseTime.IsZero() {
+		ex.ResponseTime = ts
+		if !ex.RequestTime.IsZero() && !ts.IsZero() {
+			ex.DurationMs = ts.Sub(ex.RequestTime).Seconds() * 1000
+		}
+	}
+	if ex.ResponseHeaders == nil {
+		ex.ResponseHeaders = make(map[string]string)
+	}
+
+	for _, hf := range fields {
+		if strings.HasPrefix(hf.Name, ":") {
+			continue
+		}
+		addHeader(ex.ResponseHeaders, hf)
+
+		switch hf.Name {
+		case "content-type":
+			ex.ContentType = hf.Value
+		case "content-length":
+			if n, err := strconv.ParseInt(hf.Value, 10, 64); err == nil {
+				ex.ContentLength = n
+			}
+		case "grpc-status":
+			if ex.GRPC != nil {
+				if code, err := strconv.Atoi(hf.Value); err == nil {
+					ex.GRPC.StatusCode = code
+					ex.GRPC.Status = codes.Code(code).String()
+				}
+			}
+		case "grpc-message":
+			if ex.GRPC != nil {
+				// grpc-message is percent-encoded
+				msg, err := url.PathUnescape(hf.Value)
+				if err != nil {
+					msg = hf.Value
+				}
+				ex.GRPC.StatusMessage = msg
+			}
+		}
+	}
+}
+
+// endStream records that one side closed a stream, dropping it once both have
+func (h *http2Conn) endStream(id uint32, fromClient bool) {
+	st := h.streams[id]
+	if st == nil {
+		return
+	}
+	if fromClient {
+		st.clientDone = true
+	} else {
+		st.serverDone = true
+	}
+	if st.clientDone && st.serverDone {
+		delete(h.streams, id)
+	}
+}
+
+// data accounts for a DATA frame payload. gRPC bodies are protobuf, so only
+// message counts and sizes are kept; other bodies are captured up to MaxBodySize.
+func (st *http2Stream) data(p []byte, fromClient bool) {
+	ex := st.ex
+	if ex.GRPC != nil {
+		if fromClient {
+			st.reqMsgs.feed(p)
+			ex.GRPC.RequestMessages = st.reqMsgs.count
+			ex.GRPC.RequestBytes = st.reqMsgs.bytes
+		} else {
+			st.respMsgs.feed(p)
+			ex.GRPC.ResponseMessages = st.respMsgs.count
+			ex.GRPC.ResponseBytes = st.respMsgs.bytes
+		}
+		return
+	}
+
+	if fromClient {
+		ex.RequestBody = appendBody(ex.RequestBody, p)
+	} else {
+		ex.ResponseBody = appendBody(ex.ResponseBody, p)
+	}
+}
+
+// feed consumes DATA payload, counting each message whose prefix completes
+func (g *grpcMessages) feed(data []byte) {
+	for len(data) > 0 {
+		if g.remaining > 0 {
+			n := uint32(len(data))
+			if n > g.remaining {
+				n = g.remaining
+			}
+			data = data[n:]
+			g.remaining -= n
+			continue
+		}
+
+		// Each message is prefixed by a compressed flag and a 4-byte length
+		n := copy(g.prefix[g.prefixLen:], data)
+		g.prefixLen += n
+		data = data[n:]
+		if g.prefixLen < len(g.prefix) {
+			return
+		}
+		g.prefixLen = 0
+		g.remaining = binary.BigEndian.Uint32(g.prefix[1:])
+		g.count++
+		g.bytes += int64(g.remaining)
+	}
+}
+
+// newGRPCInfo splits a gRPC path of the form /package.Service/Method
+func newGRPCInfo(path string) *protocol.GRPCInfo {
+	info := &protocol.GRPCInfo{}
+	service, method, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if ok {
+		info.Service = service
+		info.Method = method
+	}
+	return info
+}
+
+// addHeader adds an HTTP/2 header using the HTTP/1 canonical name so both
+// versions look the same in the UI
+func addHeader(headers map[string]string, hf hpack.HeaderField) {
+	key := http.CanonicalHeaderKey(hf.Name)
+	if prev, ok := headers[key]; ok {
+		headers[key] = prev + ", " + hf.Value
+		return
+	}
+	headers[key] = hf.Value
+}
+
+// appendBody appends to a captured body, keeping at most MaxBodySize bytes
+func appendBody(body string, p []byte) string {
+	if room := MaxBodySize - len(body); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		body += string(p)
+	}
+	return body
+}
@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/podscope/podscope/pkg/protocol"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2Writer builds one direction of an HTTP/2 connection for testing
+type h2Writer struct {
+	buf    bytes.Buffer
+	framer *http2.Framer
+	hbuf   bytes.Buffer
+	enc    *hpack.Encoder
+}
+
+func newH2Writer(client bool) *h2Writer {
+	w := &h2Writer{}
+	if client {
+		w.buf.WriteString(http2.ClientPreface)
+	}
+	w.framer = http2.NewFramer(&w.buf, nil)
+	w.enc = hpack.NewEncoder(&w.hbuf)
+	w.framer.WriteSettings()
+	return w
+}
+
+func (w *h2Writer) headers(t *testing.T, stream uint32, endStream bool, fields ...string) {
+	t.Helper()
+	w.hbuf.Reset()
+	for i := 0; i+1 < len(fields); i += 2 {
+		w.enc.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]})
+	}
+	err := w.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      stream,
+		BlockFragment: w.hbuf.Bytes(),
+		EndStream:     endStream,
+		EndHeaders:    true,
+	})
+	if err != nil {
+		t.Fatalf("WriteHeaders: %v", err)
+	}
+}
+
+func (w *h2Writer) data(t *testing.T, stream uint32, endStream bool, p []byte) {
+	t.Helper()
+	if err := w.framer.WriteData(stream, endStream, p); err != nil {
+		t.Fatalf("WriteData: %v", err)
+	}
+}
+
+// grpcMessage frames a message with the gRPC length prefix
+func grpcMessage(size int) []byte {
+	msg := make([]byte, 5+size)
+	binary.BigEndian.PutUint32(msg[1:], uint32(size))
+	return msg
+}
+
+func TestDetectProtocol_HTTP2Preface(t *testing.T) {
+	assembler := newTestAssembler()
+	result := assembler.detectProtocol([]byte(http2.ClientPreface), 50051)
+	if result != protocol.ProtocolHTTP2 {
+		t.Errorf("detectProtocol(preface) = %q, want %q", result, protocol.ProtocolHTTP2)
+	}
+}
+
+func TestParseHTTP2_GRPCUnaryCall(t *testing.T) {
+	client, server := newH2Writer(true), newH2Writer(false)
+	client.headers(t, 1, false,
+		":method", "POST", ":scheme", "http", ":path", "/users.v1.Users/Get",
+		":authority", "users:50051", "content-type", "application/grpc", "te", "trailers")
+	client.data(t, 1, true, grpcMessage(12))
+	server.headers(t, 1, false, ":status", "200", "content-type", "application/grpc")
+	server.data(t, 1, false, grpcMessage(7))
+	server.headers(t, 1, true, "grpc-status", "5", "grpc-message", "no%20such%20user")
+
+	flow := newTestFlowWithHTTPData(client.buf.Bytes(), server.buf.Bytes())
+	flow.Protocol = protocol.ProtocolHTTP2
+	newTestAssembler().parsePayload(flow)
+
+	if flow.Protocol != protocol.ProtocolGRPC {
+		t.Errorf("Protocol = %q, want %q", flow.Protocol, protocol.ProtocolGRPC)
+	}
+	if len(flow.HTTPExchanges) != 1 {
+		t.Fatalf("got %d exchanges, want 1", len(flow.HTTPExchanges))
+	}
+	ex := flow.HTTPExchanges[0]
+	if ex.Method != "POST" || ex.URL != "/users.v1.Users/Get" || ex.Host != "users:50051" || ex.StreamID != 1 {
+		t.Errorf("request = %s %s host=%s stream=%d", ex.Method, ex.URL, ex.Host, ex.StreamID)
+	}
+	if ex.StatusCode != 200 {
+		t.Errorf("StatusCode = %d, want 200", ex.StatusCode)
+	}
+	if ex.GRPC == nil {
+		t.Fatal("GRPC info not set")
+	}
+	want := protocol.GRPCInfo{
+		Service:          "users.v1.Users",
+		Method:           "Get",
+		StatusCode:       5,
+		Status:           "NotFound",
+		StatusMessage:    "no such user",
+		RequestMessages:  1,
+		ResponseMessages: 1,
+		RequestBytes:     12,
+		ResponseBytes:    7,
+	}
+	if *ex.GRPC != want {
+		t.Errorf("GRPC = %+v, want %+v", *ex.GRPC, want)
+	}
+	if ex.RequestBody != "" || ex.ResponseBody != "" {
+		t.Error("gRPC bodies should not be captured")
+	}
+	if flow.HTTP == nil || flow.HTTP.URL != "/users.v1.Users/Get" {
+		t.Errorf("flow.HTTP should be the first exchange, got %+v", flow.HTTP)
+	}
+	if len(flow.h2.streams) != 0 {
+		t.Errorf("finished stream should be dropped, %d left", len(flow.h2.streams))
+	}
+}
+
+func TestParseHTTP2_InterleavedStreamsInSmallChunks(t *testing.T) {
+	client, server := newH2Writer(true), newH2Writer(false)
+	// Reusing the encoder makes the second request use the HPACK dynamic table
+	client.headers(t, 1, true, ":method", "GET", ":scheme", "http", ":path", "/a", ":authority", "api", "x-team", "core")
+	client.headers(t, 3, true, ":method", "GET", ":scheme", "http", ":path", "/b", ":authority", "api", "x-team", "core")
+	server.headers(t, 3, false, ":status", "404", "content-type", "text/plain")
+	server.headers(t, 1, false, ":status", "200", "content-type", "text/plain")
+	server.data(t, 1, false, []byte("hel"))
+	server.data(t, 3, true, []byte("missing"))
+	server.data(t, 1, true, []byte("lo"))
+
+	assembler := newTestAssembler()
+	flow := newTestFlowWithHTTPData(nil, nil)
+	flow.Protocol = protocol.ProtocolHTTP2
+
+	// Deliver the bytes a few at a time, as segments would arrive. Responses
+	// follow the requests they answer.
+	for _, c := range []struct {
+		src []byte
+		dst *bytes.Buffer
+	}{
+		{client.buf.Bytes(), &flow.ClientData},
+		{server.buf.Bytes(), &flow.ServerData},
+	} {
+		for p := c.src; len(p) > 0; {
+			n := min(5, len(p))
+			c.dst.Write(p[:n])
+			p = p[n:]
+			assembler.parsePayload(flow)
+		}
+	}
+
+	if flow.Protocol != protocol.ProtocolHTTP2 {
+		t.Errorf("Protocol = %q, want %q", flow.Protocol, protocol.ProtocolHTTP2)
+	}
+	if len(flow.HTTPExchanges) != 2 {
+		t.Fatalf("got %d exchanges, want 2", len(flow.HTTPExchanges))
+	}
+
+	want := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{"/a", 200, "hello"},
+		{"/b", 404, "missing"},
+	}
+	for i, w := range want {
+		ex := flow.HTTPExchanges[i]
+		if ex.URL != w.url || ex.StatusCode != w.status || ex.ResponseBody != w.body {
+			t.Errorf("exchange %d = %s -> %d %q, want %s -> %d %q",
+				i, ex.URL, ex.StatusCode, ex.ResponseBody, w.url, w.status, w.body)
+		}
+		if ex.RequestHeaders["X-Team"] != "core" {
+			t.Errorf("exchange %d RequestHeaders[X-Team] = %q, want %q", i, ex.RequestHeaders["X-Team"], "core")
+		}
+		if ex.GRPC != nil {
+			t.Errorf("exchange %d should not be gRPC", i)
+		}
+	}
+	if flow.HTTPExchanges[0].StatusText != "200 OK" {
+		t.Errorf("StatusText = %q, want %q", flow.HTTPExchanges[0].StatusText, "200 OK")
+	}
+}
+
+func TestParseHTTP2_LongLivedChannelDropsOldestPastLimit(t *testing.T) {
+	client, server := newH2Writer(true), newH2Writer(false)
+	total := MaxFlowExchanges + 3
+	for i := 0; i < total; i++ {
+		stream := uint32(2*i + 1)
+		client.headers(t, stream, true, ":method", "POST", ":scheme", "http", ":path", "/svc.S/Call",
+			":authority", "svc", "content-type", "application/grpc")
+		server.headers(t, stream, false, ":status", "200", "content-type", "application/grpc")
+		server.headers(t, stream, true, "grpc-status", "0")
+	}
+
+	flow := newTestFlowWithHTTPData(client.buf.Bytes(), server.buf.Bytes())
+	flow.Protocol = protocol.ProtocolHTTP2
+	newTestAssembler().parsePayload(flow)
+
+	if len(flow.HTTPExchanges) != MaxFlowExchanges {
+		t.Fatalf("got %d exchanges, want %d", len(flow.HTTPExchanges), MaxFlowExchanges)
+	}
+	if flow.droppedExchanges != 3 {
+		t.Errorf("droppedExchanges = %d, want 3", flow.droppedExchanges)
+	}
+	if got := flow.HTTPExchanges[0].StreamID; got != 7 {
+		t.Errorf("oldest kept stream = %d, want 7", got)
+	}
+	if flow.HTTP == nil || flow.HTTP.URL != "/svc.S/Call" {
+		t.Errorf("flow.HTTP should stay the first exchange, got %+v", flow.HTTP)
+	}
+}
+
+func TestParseHTTP2_RSTStreamWithoutResponse(t *testing.T) {
+	client := newH2Writer(true)
+	client.headers(t, 1, false, ":method", "POST", ":scheme", "http", ":path", "/svc.S/Stream",
+		":authority", "svc", "content-type", "application/grpc")
+	client.framer.WriteRSTStream(1, http2.ErrCodeCancel)
+
+	flow := newTestFlowWithHTTPData(client.buf.Bytes(), nil)
+	flow.Protocol = protocol.ProtocolHTTP2
+	newTestAssembler().parsePayload(flow)
+
+	if len(flow.HTTPExchanges) != 1 {
+		t.Fatalf("got %d exchanges, want 1", len(flow.HTTPExchanges))
+	}
+	if got := flow.HTTPExchanges[0].StatusText; got != "RST_STREAM CANCEL" {
+		t.Errorf("StatusText = %q, want %q", got, "RST_STREAM CANCEL")
+	}
+	if len(flow.h2.streams) != 0 {
+		t.Errorf("reset stream should be dropped, %d left", len(flow.h2.streams))
+	}
+}
+
+func TestParseHTTP2_PushPromiseKeepsHeaderTableInStep(t *testing.T) {
+	client, server := newH2Writer(true), newH2Writer(false)
+	client.headers(t, 1, false, ":method", "GET", ":scheme", "http", ":path", "/", ":authority", "web")
+	client.headers(t, 3, true, ":method", "GET", ":scheme", "http", ":path", "/next", ":authority", "web")
+
+	// The promise adds x-cache to the server's table, split over a
+	// CONTINUATION; the response after it refers to the entry
+	server.hbuf.Reset()
+	for _, hf := range []hpack.HeaderField{
+		{Name: ":method", Value: "GET"}, {Name: ":path", Value: "/app.css"},
+		{Name: ":authority", Value: "web"}, {Name: "x-cache", Value: "hit"},
+	} {
+		server.enc.WriteField(hf)
+	}
+	block := server.hbuf.Bytes()
+	server.framer.WritePushPromise(http2.PushPromiseParam{StreamID: 1, PromiseID: 2, BlockFragment: block[:4]})
+	server.framer.WriteContinuation(1, true, block[4:])
+	server.headers(t, 2, true, ":status", "200", "content-type", "text/css")
+	server.headers(t, 1, true, ":status", "200", "x-cache", "hit")
+	server.headers(t, 3, true, ":status", "404", "x-cache", "hit")
+
+	flow := newTestFlowWithHTTPData(client.buf.Bytes(), server.buf.Bytes())
+	flow.Protocol = protocol.ProtocolHTTP2
+	newTestAssembler().parsePayload(flow)
+
+	if flow.h2.server.failed {
+		t.Fatal("server side stopped decoding")
+	}
+	if len(flow.HTTPExchanges) != 2 {
+		t.Fatalf("got %d exchanges, want 2 (pushed streams are not reported)", len(flow.HTTPExchanges))
+	}
+	for i, want := range []int{200, 404} {
+		ex := flow.HTTPExchanges[i]
+		if ex.StatusCode != want || ex.ResponseHeaders["X-Cache"] != "hit" {
+			t.Errorf("exchange %d = %d x-cache=%q, want %d hit", i, ex.StatusCode, ex.ResponseHeaders["X-Cache"], want)
+		}
+	}
+}
+
+func TestParseHTTP2_NoPrefaceStopsParsing(t *testing.T) {
+	flow := newTestFlowWithHTTPData([]byte("PRI * HTTP/2.0\r\n\r\nXX\r\n\r\n"), nil)
+	flow.Protocol = protocol.ProtocolHTTP2
+
+	newTestAssembler().parsePayload(flow)
+
+	if !flow.h2.client.failed || len(flow.HTTPExchanges) != 0 {
+		t.Error("malformed preface should stop HTTP/2 parsing")
+	}
+}
+
+func TestGRPCMessages_PrefixSplitAcrossFrames(t *testing.T) {
+	var g grpcMessages
+	stream := append(grpcMessage(3), grpcMessage(0)...)
+	stream = append(stream, grpcMessage(10)...)
+
+	for _, b := range stream {
+		g.feed([]byte{b})
+	}
+
+	if g.count != 3 || g.bytes != 13 {
+		t.Errorf("count=%d bytes=%d, want 3 and 13", g.count, g.bytes)
+	}
+}
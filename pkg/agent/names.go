@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxResolvedNames bounds the addresses remembered from DNS answers
+	MaxResolvedNames = 10000
+	// ResolvedNameGrace keeps a name past its TTL. Applications and local
+	// resolvers cache answers, so connections often open after it expires.
+	ResolvedNameGrace = 5 * time.Minute
+)
+
+// Sources of a flow's destination name, most trusted first
+const (
+	NameSourceDNS  = "dns"  // answer to a query the pod made
+	NameSourceSNI  = "sni"  // TLS ClientHello server name
+	NameSourceHost = "host" // HTTP Host header
+)
+
+// ResolvedNames remembers which hostname the pod resolved each address
+// from, so later connections to the address can be named
+type ResolvedNames struct {
+	mutex sync.Mutex
+	names map[string]resolvedName
+}
+
+// resolvedName is the name an address was resolved from
+type resolvedName struct {
+	name    string
+	expires time.Time
+}
+
+// NewResolvedNames creates an empty cache
+func NewResolvedNames() *ResolvedNames {
+	return &ResolvedNames{names: make(map[string]resolvedName)}
+}
+
+// Add records that name resolved to ip with the answer's TTL. A later
+// answer for the same address replaces the name.
+func (n *ResolvedNames) Add(ip, name string, ttl uint32, now time.Time) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if _, exists := n.names[ip]; !exists && len(n.names) >= MaxResolvedNames {
+		n.evict(now)
+	}
+	n.names[ip] = resolvedName{
+		name:    name,
+		expires: now.Add(time.Duration(ttl)*time.Second + ResolvedNameGrace),
+	}
+}
+
+// Lookup returns the name ip was last resolved from, or "" if none is
+// current
+func (n *ResolvedNames) Lookup(ip string, now time.Time) string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	r, ok := n.names[ip]
+	if !ok || now.After(r.expires) {
+		return ""
+	}
+	return r.name
+}
+
+// evict makes room for one entry, dropping expired names or else the one
+// closest to expiring. The caller holds n.mutex.
+func (n *ResolvedNames) evict(now time.Time) {
+	var oldest string
+	for ip, r := range n.names {
+		if now.After(r.expires) {
+			delete(n.names, ip)
+			continue
+		}
+		if oldest == "" || r.expires.Before(n.names[oldest].expires) {
+			oldest = ip
+		}
+	}
+	if len(n.names) >= MaxResolvedNames {
+		delete(n.names, oldest)
+	}
+}
+
+// hostName strips the port from an HTTP Host header
+func hostName(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
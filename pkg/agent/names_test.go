@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+func TestResolvedNames_ExpiresAfterGrace(t *testing.T) {
+	n := NewResolvedNames()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	n.Add("93.184.216.34", "example.com", 60, base)
+	if got := n.Lookup("93.184.216.34", base.Add(time.Minute+ResolvedNameGrace)); got != "example.com" {
+		t.Errorf("Lookup within TTL and grace = %q, want example.com", got)
+	}
+	if got := n.Lookup("93.184.216.34", base.Add(time.Minute+ResolvedNameGrace+time.Second)); got != "" {
+		t.Errorf("Lookup after expiry = %q, want empty", got)
+	}
+
+	// The latest answer for an address wins
+	n.Add("93.184.216.34", "www.example.com", 60, base)
+	if got := n.Lookup("93.184.216.34", base); got != "www.example.com" {
+		t.Errorf("Lookup = %q, want www.example.com", got)
+	}
+}
+
+func TestResolvedNames_Bounded(t *testing.T) {
+	n := NewResolvedNames()
+	base := time.Now()
+
+	for i := 0; i < MaxResolvedNames; i++ {
+		n.Add(fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff), "host", uint32(60+i), base)
+	}
+	n.Add("192.0.2.1", "new.example.com", 60, base)
+
+	if len(n.names) != MaxResolvedNames {
+		t.Errorf("%d names cached, want %d", len(n.names), MaxResolvedNames)
+	}
+	// The entry closest to expiring makes room
+	if n.Lookup("10.0.0.0", base) != "" || n.Lookup("192.0.2.1", base) != "new.example.com" {
+		t.Error("expected the soonest expiring name to be evicted for the new one")
+	}
+}
+
+func TestHostName(t *testing.T) {
+	for host, want := range map[string]string{
+		"api.example.com":      "api.example.com",
+		"api.example.com:8443": "api.example.com",
+		"[fd00::1]:80":         "fd00::1",
+	} {
+		if got := hostName(host); got != want {
+			t.Errorf("hostName(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestDNSTracker_RecordsResolvedNames(t *testing.T) {
+	tracker, _ := newTestDNSTracker(nil)
+	names := NewResolvedNames()
+	tracker.SetResolvedNames(names)
+	now := time.Now()
+
+	cname := layers.DNSResourceRecord{Name: []byte("shop.example.com"), Type: layers.DNSTypeCNAME, CNAME: []byte("shop.cdn.net"), TTL: 300}
+	a := layers.DNSResourceRecord{Name: []byte("shop.cdn.net"), Type: layers.DNSTypeA, IP: net.ParseIP("203.0.113.7").To4(), TTL: 20}
+	tracker.ProcessPacket("10.96.0.10", "10.0.0.5", 53, 40000, dnsResponseMsg(1, "shop.example.com", layers.DNSResponseCodeNoErr, cname, a), 90, now)
+
+	// The app knows the address by the name it asked for, not the CDN's
+	if got := names.Lookup("203.0.113.7", now); got != "shop.example.com" {
+		t.Errorf("Lookup = %q, want shop.example.com", got)
+	}
+
+	failed := layers.DNSResourceRecord{Type: layers.DNSTypeA, IP: net.ParseIP("203.0.113.8").To4(), TTL: 20}
+	tracker.ProcessPacket("10.96.0.10", "10.0.0.5", 53, 40000, dnsResponseMsg(2, "bad.example.com", layers.DNSResponseCodeServFail, failed), 90, now)
+	if got := names.Lookup("203.0.113.8", now); got != "" {
+		t.Errorf("Lookup = %q, want nothing from a failed answer", got)
+	}
+}
+
+func TestProcessPacket_DestinationName(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolved   string // name 10.0.0.2 was resolved from
+		payload    []byte
+		wantName   string
+		wantSource string
+	}{
+		{"resolved before connecting", "shop.example.com", []byte("GET / HTTP/1.1\r\nHost: other.example.com\r\n\r\n"), "shop.example.com", NameSourceDNS},
+		{"HTTP Host", "", []byte("GET / HTTP/1.1\r\nHost: api.example.com:8080\r\n\r\n"), "api.example.com", NameSourceHost},
+		{"TLS SNI", "", buildClientHelloWithCipherSuites([]uint16{0x1301}, nil, "secure.example.com"), "secure.example.com", NameSourceSNI},
+		{"nothing to go on", "", nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var completed *protocol.Flow
+			names := NewResolvedNames()
+			if tt.resolved != "" {
+				names.Add("10.0.0.2", tt.resolved, 60, time.Now())
+			}
+			assembler := &TCPAssembler{
+				flows:          make(map[string]*TCPFlow),
+				onFlowComplete: func(f *protocol.Flow) { completed = f },
+				names:          names,
+			}
+			conn := newTestConn(t, assembler)
+			if tt.payload != nil {
+				conn.send(true, tt.payload)
+			}
+			conn.close()
+
+			if completed == nil {
+				t.Fatal("flow was not completed")
+			}
+			if completed.DstName != tt.wantName || completed.DstNameSource != tt.wantSource {
+				t.Errorf("DstName = %q from %q, want %q from %q", completed.DstName, completed.DstNameSource, tt.wantName, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package agent
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const (
+	// DefaultProcRoot is the proc filesystem of the agent's PID namespace,
+	// which is shared with the target container
+	DefaultProcRoot = "/proc"
+	// processRefreshInterval is the least time between rescans of /proc when
+	// a lookup finds no owner
+	processRefreshInterval = 500 * time.Millisecond
+	// pauseCommand is the sandbox process that runs as PID 1 when the pod
+	// shares one PID namespace between all its containers
+	pauseCommand = "pause"
+)
+
+// containerIDPattern matches the runtime's container ID in /proc/[pid]/cgroup,
+// e.g. .../cri-containerd-<id>.scope or /kubepods/burstable/pod.../<id>
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// ProcessTable maps the pod's sockets to the processes that own them, so a
+// flow can be attributed to the sidecar or app that made it
+type ProcessTable struct {
+	procRoot        string
+	targetContainer string // container whose PID namespace the agent joined
+
+	mutex     sync.Mutex
+	refreshed time.Time
+	tcp       socketIndex
+	udp       socketIndex
+	owners    map[uint64]*protocol.ProcessInfo // by socket inode
+}
+
+// socketIndex finds socket inodes by address
+type socketIndex struct {
+	connected map[socketPair]uint64
+	bound     map[uint16]uint64 // TCP listeners and unconnected UDP sockets
+}
+
+// socketPair is a connected socket's local and remote address
+type socketPair struct {
+	local  netip.AddrPort
+	remote netip.AddrPort
+}
+
+// NewProcessTable creates a table reading procRoot (usually DefaultProcRoot).
+// targetContainer names the processes found, unless the pod shares its PID
+// namespace between containers and they can't be told apart by name.
+func NewProcessTable(procRoot, targetContainer string) *ProcessTable {
+	return &ProcessTable{
+		procRoot:        procRoot,
+		targetContainer: targetContainer,
+		tcp:             newSocketIndex(),
+		udp:             newSocketIndex(),
+		owners:          make(map[uint64]*protocol.ProcessInfo),
+	}
+}
+
+func newSocketIndex() socketIndex {
+	return socketIndex{
+		connected: make(map[socketPair]uint64),
+		bound:     make(map[uint16]uint64),
+	}
+}
+
+// Refresh rescans the socket tables and the open files of every process
+func (p *ProcessTable) Refresh() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.refresh()
+}
+
+// Lookup returns the process owning the local end of a flow, or nil when it
+// can't be found. network is "tcp" or "udp". The sockets are rescanned on a
+// miss, since new connections are looked up as soon as they are seen.
+func (p *ProcessTable) Lookup(network, srcIP string, srcPort uint16, dstIP string, dstPort uint16) *protocol.ProcessInfo {
+	src, err := netip.ParseAddr(srcIP)
+	if err != nil {
+		return nil
+	}
+	dst, err := netip.ParseAddr(dstIP)
+	if err != nil {
+		return nil
+	}
+	srcAddr := netip.AddrPortFrom(src.Unmap(), srcPort)
+	dstAddr := netip.AddrPortFrom(dst.Unmap(), dstPort)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if info := p.find(network, srcAddr, dstAddr); info != nil {
+		return info
+	}
+	if time.Since(p.refreshed) < processRefreshInterval {
+		return nil
+	}
+	if err := p.refresh(); err != nil {
+		return nil
+	}
+	return p.find(network, srcAddr, dstAddr)
+}
+
+// find looks for a connected socket at either end of the flow, then for a
+// listener or unconnected socket on one of its ports
+func (p *ProcessTable) find(network string, src, dst netip.AddrPort) *protocol.ProcessInfo {
+	idx := p.tcp
+	if network == "udp" {
+		idx = p.udp
+	}
+
+	candidates := []uint64{
+		idx.connected[socketPair{local: src, remote: dst}],
+		idx.connected[socketPair{local: dst, remote: src}],
+		idx.bound[dst.Port()],
+		idx.bound[src.Port()],
+	}
+	for _, inode := range candidates {
+		if info := p.owners[inode]; inode != 0 && info != nil {
+			return info
+		}
+	}
+	return nil
+}
+
+// refresh rebuilds the table. The caller holds p.mutex.
+func (p *ProcessTable) refresh() error {
+	p.refreshed = time.Now()
+
+	tcp, tcpInodes, err := p.readSockets("tcp")
+	if err != nil {
+		return err
+	}
+	udp, udpInodes, err := p.readSockets("udp")
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[uint64]bool, len(tcpInodes)+len(udpInodes))
+	for _, inode := range append(tcpInodes, udpInodes...) {
+		wanted[inode] = true
+	}
+	owners, err := p.readOwners(wanted)
+	if err != nil {
+		return err
+	}
+
+	p.tcp, p.udp, p.owners = tcp, udp, owners
+	return nil
+}
+
+// readSockets indexes the IPv4 and IPv6 sockets of a protocol
+func (p *ProcessTable) readSockets(network string) (socketIndex, []uint64, error) {
+	idx := newSocketIndex()
+	var inodes []uint64
+	read := 0
+
+	for _, name := range []string{network, network + "6"} {
+		f, err := os.Open(filepath.Join(p.procRoot, "net", name))
+		if err != nil {
+			// The IPv6 tables are missing when IPv6 is disabled
+			continue
+		}
+		sockets, err := parseProcNet(f)
+		f.Close()
+		if err != nil {
+			return idx, nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		read++
+
+		for _, s := range sockets {
+			// Sockets in TIME_WAIT no longer belong to a process
+			if s.inode == 0 {
+				continue
+			}
+			inodes = append(inodes, s.inode)
+			switch {
+			case network == "tcp" && s.state == tcpListenState:
+				idx.bound[s.local.Port()] = s.inode
+			case network == "udp" && s.remote.Port() == 0:
+				idx.bound[s.local.Port()] = s.inode
+			default:
+				idx.connected[socketPair{local: s.local, remote: s.remote}] = s.inode
+			}
+		}
+	}
+	if read == 0 {
+		return idx, nil, fmt.Errorf("no %s socket tables in %s", strings.ToUpper(network), filepath.Join(p.procRoot, "net"))
+	}
+	return idx, inodes, nil
+}
+
+// readOwners finds which process holds each wanted socket by walking the
+// file descriptors under /proc/[pid]/fd
+func (p *ProcessTable) readOwners(wanted map[uint64]bool) (map[uint64]*protocol.ProcessInfo, error) {
+	entries, err := os.ReadDir(p.procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// With a shared PID namespace every container's processes are visible,
+	// and only the container ID tells them apart
+	container := p.targetContainer
+	if readComm(filepath.Join(p.procRoot, "1")) == pauseCommand {
+		container = ""
+	}
+
+	self := os.Getpid()
+	owners := make(map[uint64]*protocol.ProcessInfo)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join(p.procRoot, e.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			// Exited, or not readable without CAP_SYS_PTRACE
+			continue
+		}
+
+		var info *protocol.ProcessInfo
+		for _, fd := range fds {
+			inode, ok := socketInode(filepath.Join(dir, "fd", fd.Name()))
+			if !ok || !wanted[inode] {
+				continue
+			}
+			// Sockets shared with a child after fork keep the first owner
+			if _, seen := owners[inode]; seen {
+				continue
+			}
+			if info == nil {
+				info = &protocol.ProcessInfo{
+					PID:         int32(pid),
+					Command:     readComm(dir),
+					Container:   container,
+					ContainerID: readContainerID(dir),
+				}
+			}
+			owners[inode] = info
+		}
+	}
+	return owners, nil
+}
+
+// socketInode reads a file descriptor link such as socket:[12345]
+func socketInode(fdPath string) (uint64, bool) {
+	link, err := os.Readlink(fdPath)
+	if err != nil || !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 64)
+	return inode, err == nil
+}
+
+// readComm returns the command name of the process at dir
+func readComm(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readContainerID returns the runtime's ID for the container of the process
+// at dir. It is empty when the cgroup namespace hides the path.
+func readContainerID(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup"))
+	if err != nil {
+		return ""
+	}
+	ids := containerIDPattern.FindAll(data, -1)
+	if len(ids) == 0 {
+		return ""
+	}
+	return string(ids[len(ids)-1])
+}
@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const procNetUDP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+ 101: 0500000A:A028 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 4001 2 0000000000000000 0
+`
+
+const appContainerID = "4b8c0f2e9d1a7c3b5e6f8a9b0c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d"
+
+// writeProcRoot lays out a fake /proc with the app owning the TCP sockets
+// and envoy the UDP socket. init is the command name of PID 1.
+func writeProcRoot(t *testing.T, init string) string {
+	t.Helper()
+	root := t.TempDir()
+
+	write := func(path, data string) {
+		t.Helper()
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(path, target string) {
+		t.Helper()
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("net/tcp", procNetTCP)
+	write("net/tcp6", procNetTCP6)
+	write("net/udp", procNetUDP)
+
+	write("1/comm", init+"\n")
+	write("100/comm", "app\n")
+	write("100/cgroup", "0::/kubepods.slice/kubepods-burstable.slice/cri-containerd-"+appContainerID+".scope\n")
+	link("100/fd/0", "/dev/null")
+	link("100/fd/3", "socket:[2041]")
+	link("100/fd/4", "socket:[2043]")
+	write("200/comm", "envoy\n")
+	write("200/cgroup", "0::/\n")
+	link("200/fd/7", "socket:[4001]")
+	link("200/fd/8", "socket:[3001]")
+	return root
+}
+
+func TestProcessTable_Lookup(t *testing.T) {
+	p := NewProcessTable(writeProcRoot(t, "app"), "web")
+	if err := p.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		network string
+		srcIP   string
+		srcPort uint16
+		dstIP   string
+		dstPort uint16
+		wantPID int32
+	}{
+		{"outbound connection", "tcp", "10.0.0.5", 40000, "10.96.0.10", 5432, 100},
+		{"outbound seen from the server", "tcp", "10.96.0.10", 5432, "10.0.0.5", 40000, 100},
+		{"inbound to a listener", "tcp", "10.0.0.9", 51000, "10.0.0.5", 8080, 100},
+		{"inbound to an IPv6 listener", "tcp", "fd00::9", 51000, "fd00::5", 80, 200},
+		{"unconnected UDP socket", "udp", "10.0.0.5", 41000, "10.96.0.10", 53, 200},
+		{"unknown socket", "tcp", "10.0.0.5", 40001, "10.96.0.10", 443, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := p.Lookup(tt.network, tt.srcIP, tt.srcPort, tt.dstIP, tt.dstPort)
+			switch {
+			case tt.wantPID == 0 && info != nil:
+				t.Errorf("Lookup = %+v, want nil", info)
+			case tt.wantPID != 0 && (info == nil || info.PID != tt.wantPID):
+				t.Errorf("Lookup = %+v, want PID %d", info, tt.wantPID)
+			}
+		})
+	}
+
+	app := p.Lookup("tcp", "10.0.0.5", 40000, "10.96.0.10", 5432)
+	want := protocol.ProcessInfo{PID: 100, Command: "app", Container: "web", ContainerID: appContainerID}
+	if app == nil || *app != want {
+		t.Errorf("app = %+v, want %+v", app, want)
+	}
+	// The cgroup namespace hides envoy's container ID
+	if envoy := p.Lookup("udp", "10.0.0.5", 41000, "10.96.0.10", 53); envoy == nil || envoy.Command != "envoy" || envoy.ContainerID != "" {
+		t.Errorf("envoy = %+v, want command envoy without a container ID", envoy)
+	}
+}
+
+func TestProcessTable_SharedPIDNamespace(t *testing.T) {
+	p := NewProcessTable(writeProcRoot(t, pauseCommand), "web")
+	if err := p.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Other containers' processes are visible, so the target's name can't
+	// be assumed
+	info := p.Lookup("tcp", "10.0.0.5", 40000, "10.96.0.10", 5432)
+	if info == nil || info.Container != "" || info.ContainerID != appContainerID {
+		t.Errorf("Lookup = %+v, want no container name and the container ID", info)
+	}
+}
+
+func TestProcessTable_RefreshOnMiss(t *testing.T) {
+	root := writeProcRoot(t, "app")
+	p := NewProcessTable(root, "web")
+
+	// Never refreshed, so the first miss scans /proc
+	if info := p.Lookup("tcp", "10.0.0.5", 40000, "10.96.0.10", 5432); info == nil || info.PID != 100 {
+		t.Fatalf("Lookup = %+v, want PID 100", info)
+	}
+
+	// A socket opened right after is not picked up until the interval passes
+	os.Symlink("socket:[2042]", filepath.Join(root, "200", "fd", "9"))
+	if info := p.Lookup("tcp", "127.0.0.1", 50000, "127.0.0.1", 15000); info != nil {
+		t.Errorf("Lookup = %+v, want nil within the refresh interval", info)
+	}
+	p.refreshed = time.Now().Add(-processRefreshInterval)
+	if info := p.Lookup("tcp", "127.0.0.1", 50000, "127.0.0.1", 15000); info == nil || info.PID != 200 {
+		t.Errorf("Lookup = %+v, want PID 200 after a rescan", info)
+	}
+}
+
+func TestProcessTable_RefreshWithoutSocketTables(t *testing.T) {
+	if err := NewProcessTable(t.TempDir(), "").Refresh(); err == nil {
+		t.Error("expected an error without socket tables")
+	}
+}
+
+func TestParseProcNetAddr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0500000A:9C40", "10.0.0.5:40000"},
+		{"0000000000000000FFFF00000500000A:1F90", "10.0.0.5:8080"},
+		{"000000FD000000000000000005000000:0050", "[fd00::5]:80"},
+	}
+	for _, tt := range tests {
+		got, err := parseProcNetAddr(tt.in)
+		if err != nil {
+			t.Errorf("parseProcNetAddr(%q): %v", tt.in, err)
+			continue
+		}
+		if got != netip.MustParseAddrPort(tt.want) {
+			t.Errorf("parseProcNetAddr(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"0500000A", "0500:9C40", "XX00000A:9C40"} {
+		if _, err := parseProcNetAddr(in); err == nil {
+			t.Errorf("parseProcNetAddr(%q) should fail", in)
+		}
+	}
+}
+
+func TestProcessPacket_AttributesProcess(t *testing.T) {
+	var completed *protocol.Flow
+	p := NewProcessTable(writeProcRoot(t, "app"), "web")
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { completed = f },
+		processes:      p,
+	}
+	now := time.Now()
+
+	assembler.ProcessPacket("10.0.0.5", "10.96.0.10", 40000, 5432, &layers.TCP{SYN: true, Seq: 1}, now, nil)
+	assembler.ProcessPacket("10.96.0.10", "10.0.0.5", 5432, 40000, &layers.TCP{RST: true, Seq: 1}, now, nil)
+
+	if completed == nil {
+		t.Fatal("flow was not completed")
+	}
+	if completed.Process == nil || completed.Process.Command != "app" {
+		t.Errorf("Process = %+v, want app", completed.Process)
+	}
+}
+
+func TestDNSTracker_AttributesProcess(t *testing.T) {
+	tracker, flows := newTestDNSTracker(nil)
+	tracker.SetProcessTable(NewProcessTable(writeProcRoot(t, "app"), "web"))
+	now := time.Now()
+
+	tracker.ProcessPacket("10.0.0.5", "10.96.0.10", 41000, 53, dnsQueryMsg(5, "api", layers.DNSTypeA), 40, now)
+	tracker.ProcessPacket("10.96.0.10", "10.0.0.5", 53, 41000, dnsResponseMsg(5, "api", layers.DNSResponseCodeNoErr), 40, now)
+
+	if len(*flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(*flows))
+	}
+	if got := (*flows)[0].Process; got == nil || got.Command != "envoy" {
+		t.Errorf("Process = %+v, want envoy", got)
+	}
+}
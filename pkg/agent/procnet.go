@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProcNet is where the kernel lists sockets of the agent's network
+	// namespace, which is shared with the target pod
+	DefaultProcNet = "/proc/net"
+	// ListenRefreshInterval is how often the listening sockets are re-read
+	ListenRefreshInterval = 30 * time.Second
+
+	// tcpListenState is TCP_LISTEN in the st column of /proc/net/tcp
+	tcpListenState = "0A"
+)
+
+// ListeningPorts tracks the TCP ports the pod accepts connections on, so
+// connections already open when capture started can be given a direction
+type ListeningPorts struct {
+	procNet string
+	mutex   sync.RWMutex
+	ports   map[uint16]bool
+}
+
+// NewListeningPorts creates a tracker reading procNet (usually DefaultProcNet)
+func NewListeningPorts(procNet string) *ListeningPorts {
+	return &ListeningPorts{
+		procNet: procNet,
+		ports:   make(map[uint16]bool),
+	}
+}
+
+// Refresh re-reads the listening sockets for IPv4 and IPv6
+func (l *ListeningPorts) Refresh() error {
+	ports := make(map[uint16]bool)
+	read := 0
+	for _, name := range []string{"tcp", "tcp6"} {
+		f, err := os.Open(filepath.Join(l.procNet, name))
+		if err != nil {
+			// tcp6 is missing when IPv6 is disabled
+			continue
+		}
+		listening, err := parseProcNetTCP(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		for _, port := range listening {
+			ports[port] = true
+		}
+		read++
+	}
+	if read == 0 {
+		return fmt.Errorf("no TCP socket tables in %s", l.procNet)
+	}
+
+	l.mutex.Lock()
+	l.ports = ports
+	l.mutex.Unlock()
+	return nil
+}
+
+// Contains reports whether the pod listens on port
+func (l *ListeningPorts) Contains(port uint16) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.ports[port]
+}
+
+// Ports returns the listening ports in ascending order
+func (l *ListeningPorts) Ports() []uint16 {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	ports := make([]uint16, 0, len(l.ports))
+	for port := range l.ports {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+// refreshLoop keeps the ports current as the pod opens and closes listeners
+func (l *ListeningPorts) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(ListenRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Refresh(); err != nil {
+				log.Printf("Failed to refresh listening ports: %v", err)
+			}
+		}
+	}
+}
+
+// procSocket is one line of /proc/net/{tcp,udp}{,6}
+type procSocket struct {
+	local  netip.AddrPort
+	remote netip.AddrPort
+	state  string
+	inode  uint64
+}
+
+// parseProcNetTCP returns the local ports of sockets in the LISTEN state
+// from /proc/net/tcp or /proc/net/tcp6
+func parseProcNetTCP(r io.Reader) ([]uint16, error) {
+	sockets, err := parseProcNet(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []uint16
+	for _, s := range sockets {
+		if s.state == tcpListenState {
+			ports = append(ports, s.local.Port())
+		}
+	}
+	return ports, nil
+}
+
+// parseProcNet parses the socket tables under /proc/net:
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2041 ...
+func parseProcNet(r io.Reader) ([]procSocket, error) {
+	var sockets []procSocket
+	scanner := bufio.NewScanner(r)
+
+	// Skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		local, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		remote, err := parseProcNetAddr(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		s := procSocket{local: local, remote: remote, state: fields[3]}
+		if len(fields) > 9 {
+			s.inode, _ = strconv.ParseUint(fields[9], 10, 64)
+		}
+		sockets = append(sockets, s)
+	}
+	return sockets, scanner.Err()
+}
+
+// parseProcNetAddr parses an address such as 0500000A:9C40. The kernel
+// prints the address as 32-bit words in host byte order (little endian on
+// the platforms we run on) and the port in network order.
+func parseProcNetAddr(s string) (netip.AddrPort, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return netip.AddrPort{}, fmt.Errorf("malformed address %q", s)
+	}
+	port, err := strconv.ParseUint(s[i+1:], 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("malformed port in %q: %w", s, err)
+	}
+	raw, err := hex.DecodeString(s[:i])
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.AddrPort{}, fmt.Errorf("malformed address %q", s)
+	}
+	for w := 0; w < len(raw); w += 4 {
+		raw[w], raw[w+1], raw[w+2], raw[w+3] = raw[w+3], raw[w+2], raw[w+1], raw[w]
+	}
+	addr, _ := netip.AddrFromSlice(raw)
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), nil
+}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2041 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:3A98 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2042 1 0000000000000000 100 0 0 10 0
+   2: 0500000A:9C40 0A00600A:1538 01 00000000:00000000 00:00000000 00000000     0        0 2043 1 0000000000000000 20 4 30 10 -1
+`
+
+const procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 3001 1 0000000000000000 100 0 0 10 0
+`
+
+func TestParseProcNetTCP_ListenOnly(t *testing.T) {
+	ports, err := parseProcNetTCP(strings.NewReader(procNetTCP))
+	if err != nil {
+		t.Fatalf("parseProcNetTCP: %v", err)
+	}
+	// The established connection from port 40000 is not a listener
+	if want := []uint16{8080, 15000}; !reflect.DeepEqual(ports, want) {
+		t.Errorf("ports = %v, want %v", ports, want)
+	}
+}
+
+func TestParseProcNetTCP_MalformedPort(t *testing.T) {
+	data := "header\n   0: 00000000:ZZZZ 00000000:0000 0A\n"
+	if _, err := parseProcNetTCP(strings.NewReader(data)); err == nil {
+		t.Error("expected an error for a malformed port")
+	}
+}
+
+func TestListeningPorts_Refresh(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "tcp"), []byte(procNetTCP), 0o644)
+	os.WriteFile(filepath.Join(dir, "tcp6"), []byte(procNetTCP6), 0o644)
+
+	l := NewListeningPorts(dir)
+	if err := l.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if want := []uint16{80, 8080, 15000}; !reflect.DeepEqual(l.Ports(), want) {
+		t.Errorf("Ports() = %v, want %v", l.Ports(), want)
+	}
+	if !l.Contains(80) || l.Contains(40000) {
+		t.Error("Contains should only report listening ports")
+	}
+
+	if err := NewListeningPorts(t.TempDir()).Refresh(); err == nil {
+		t.Error("expected an error without socket tables")
+	}
+}
+
+func TestProcessPacket_JoinedLateUsesListeningPorts(t *testing.T) {
+	var completed *protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { completed = f },
+		listeners:      &ListeningPorts{ports: map[uint16]bool{5432: true}},
+	}
+	now := time.Now()
+
+	// The pod's database answers first on a pooled connection
+	assembler.ProcessPacket("10.0.0.5", "10.0.0.9", 5432, 51000, &layers.TCP{ACK: true, PSH: true, Seq: 7000, Window: 512}, now, nil)
+	assembler.ProcessPacket("10.0.0.9", "10.0.0.5", 51000, 5432, &layers.TCP{FIN: true, ACK: true, Seq: 300, Window: 512}, now.Add(time.Second), nil)
+	assembler.ProcessPacket("10.0.0.5", "10.0.0.9", 5432, 51000, &layers.TCP{FIN: true, ACK: true, Seq: 7000, Window: 512}, now.Add(time.Second), nil)
+
+	if completed == nil {
+		t.Fatal("flow was not completed")
+	}
+	if completed.SrcIP != "10.0.0.9" || completed.DstPort != 5432 {
+		t.Errorf("flow = %s:%d -> %s:%d, want the client connecting to 5432",
+			completed.SrcIP, completed.SrcPort, completed.DstIP, completed.DstPort)
+	}
+	if !completed.JoinedLate {
+		t.Error("flow without a handshake should be marked joined late")
+	}
+	if completed.TCPHandshakeMs != 0 || completed.TimeToFirstByte != 0 {
+		t.Errorf("handshake = %v, TTFB = %v, want none for a late flow", completed.TCPHandshakeMs, completed.TimeToFirstByte)
+	}
+}
+
+func TestAssignPods_UsesListeningPorts(t *testing.T) {
+	listeners := &ListeningPorts{ports: map[uint16]bool{40000: true}}
+	tests := []struct {
+		name             string
+		srcPort, dstPort uint16
+		listeners        *ListeningPorts
+		wantDst          bool
+	}{
+		{"to a listener on an ephemeral port", 51000, 40000, listeners, true},
+		{"from a client bound below 1024", 800, 443, listeners, false},
+		{"outgoing without listening ports", 45000, 443, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The pod IP is not known, so only the ports can tell
+			f := &protocol.Flow{SrcIP: "10.0.0.9", SrcPort: tt.srcPort, DstIP: "10.0.0.7", DstPort: tt.dstPort}
+			assignPods(f, "app", "prod", "", tt.listeners)
+			if gotDst := f.DstPod == "app"; gotDst != tt.wantDst || (f.SrcPod == "app") == tt.wantDst {
+				t.Errorf("SrcPod/DstPod = %q/%q, want the pod as destination %v", f.SrcPod, f.DstPod, tt.wantDst)
+			}
+		})
+	}
+}
+
+func TestProcessPacket_FirstPacketDirection(t *testing.T) {
+	tests := []struct {
+		name       string
+		tcp        *layers.TCP
+		srcPort    uint16
+		dstPort    uint16
+		listening  uint16
+		wantClient uint16
+		wantLate   bool
+	}{
+		{"SYN", &layers.TCP{SYN: true}, 51000, 80, 0, 51000, false},
+		{"SYN-ACK", &layers.TCP{SYN: true, ACK: true}, 80, 51000, 0, 51000, false},
+		{"data to listener", &layers.TCP{ACK: true}, 51000, 8080, 8080, 51000, true},
+		{"data from listener", &layers.TCP{ACK: true}, 8080, 51000, 8080, 51000, true},
+		{"data from remote service", &layers.TCP{ACK: true}, 443, 40000, 0, 40000, true},
+		{"data to remote service", &layers.TCP{ACK: true}, 40000, 443, 0, 40000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assembler := newTestAssembler()
+			assembler.listeners = &ListeningPorts{ports: map[uint16]bool{tt.listening: tt.listening != 0}}
+			assembler.ProcessPacket("10.0.0.1", "10.0.0.2", tt.srcPort, tt.dstPort, tt.tcp, time.Now(), nil)
+
+			flow := assembler.flows[flowKey("10.0.0.1", "10.0.0.2", tt.srcPort, tt.dstPort)]
+			if flow.SrcPort != tt.wantClient {
+				t.Errorf("client port = %d, want %d", flow.SrcPort, tt.wantClient)
+			}
+			if flow.JoinedLate != tt.wantLate {
+				t.Errorf("JoinedLate = %v, want %v", flow.JoinedLate, tt.wantLate)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"time"
+)
+
+// MaxOutOfOrderBytes is how much data one direction buffers while waiting
+// for a missing segment. Beyond it the capture is assumed to have lost the
+// segment and the gap is skipped.
+const MaxOutOfOrderBytes = 64 * 1024
+
+// maxRTTSamples bounds the segments per direction waiting to be acknowledged
+const maxRTTSamples = 64
+
+// segmentKind classifies a segment relative to the data already delivered
+type segmentKind int
+
+const (
+	segmentInOrder segmentKind = iota
+	segmentRetransmit
+	segmentOutOfOrder
+)
+
+// tcpStream reassembles one direction of a TCP connection by sequence number
+type tcpStream struct {
+	started      bool
+	nextSeq      uint32       // sequence number of the next byte to deliver
+	pending      []tcpSegment // out-of-order segments, sorted by seq
+	pendingBytes int
+	zeroWindow   bool // last segment from this side advertised a zero window
+	finished     bool // this side sent a FIN
+
+	// Round trip estimation for data sent by this side, acked by the other
+	hasSent  bool
+	sndMax   uint32      // end of the highest segment sent
+	inFlight []rttSample // unacknowledged segments, by end sequence
+	srtt     time.Duration
+
+	// ACKs sent by this side, for duplicate detection
+	ackSeen    bool
+	lastAck    uint32
+	lastWindow uint16
+}
+
+// rttSample is when the segment ending at end was first sent
+type rttSample struct {
+	end uint32
+	ts  time.Time
+}
+
+// tcpSegment is payload starting at seq
+type tcpSegment struct {
+	seq  uint32
+	data []byte
+	ts   time.Time
+}
+
+// seqDiff returns a-b in sequence space, handling wraparound
+func seqDiff(a, b uint32) int {
+	return int(int32(a - b))
+}
+
+// syn starts the stream at the initial sequence number. It reports whether
+// the SYN is a retransmission of one already seen.
+func (s *tcpStream) syn(seq uint32) bool {
+	if s.started && s.nextSeq == seq+1 {
+		return true
+	}
+	s.started = true
+	s.nextSeq = seq + 1
+	s.pending = nil
+	s.pendingBytes = 0
+	return false
+}
+
+// add accepts a segment and returns the data that is now in order. Streams
+// joined mid-connection start at the first segment seen.
+func (s *tcpStream) add(seq uint32, data []byte, ts time.Time) (segmentKind, []tcpSegment) {
+	if !s.started {
+		s.started = true
+		s.nextSeq = seq
+	}
+
+	kind := segmentInOrder
+	switch d := seqDiff(seq, s.nextSeq); {
+	case d < 0:
+		// Starts before data already delivered, but may carry new bytes
+		kind = segmentRetransmit
+		if -d >= len(data) {
+			return kind, nil
+		}
+		data = data[-d:]
+		seq = s.nextSeq
+
+	case d > 0:
+		if s.isPending(seq) {
+			return segmentRetransmit, nil
+		}
+		s.buffer(seq, data, ts)
+		if s.pendingBytes <= MaxOutOfOrderBytes {
+			return segmentOutOfOrder, nil
+		}
+		// The missing bytes never arrived, give up on them
+		s.nextSeq = s.pending[0].seq
+		return segmentOutOfOrder, s.drain(nil)
+	}
+
+	s.nextSeq = seq + uint32(len(data))
+	return kind, s.drain([]tcpSegment{{seq: seq, data: data, ts: ts}})
+}
+
+// isPending reports whether a segment starting at seq is already buffered
+func (s *tcpStream) isPending(seq uint32) bool {
+	for _, seg := range s.pending {
+		if seg.seq == seq {
+			return true
+		}
+	}
+	return false
+}
+
+// buffer stores a copy of an out-of-order segment. Packet data is reused
+// by the capture source, so it can't be kept as is.
+func (s *tcpStream) buffer(seq uint32, data []byte, ts time.Time) {
+	seg := tcpSegment{seq: seq, data: append([]byte(nil), data...), ts: ts}
+
+	i := len(s.pending)
+	for i > 0 && seqDiff(s.pending[i-1].seq, seq) > 0 {
+		i--
+	}
+	s.pending = append(s.pending, tcpSegment{})
+	copy(s.pending[i+1:], s.pending[i:])
+	s.pending[i] = seg
+	s.pendingBytes += len(data)
+}
+
+// drain appends buffered segments that have become contiguous to out
+func (s *tcpStream) drain(out []tcpSegment) []tcpSegment {
+	for len(s.pending) > 0 {
+		seg := s.pending[0]
+		d := seqDiff(seg.seq, s.nextSeq)
+		if d > 0 {
+			break
+		}
+		s.pending = s.pending[1:]
+		s.pendingBytes -= len(seg.data)
+
+		// Skip bytes already delivered by an overlapping segment
+		if -d >= len(seg.data) {
+			continue
+		}
+		seg.data = seg.data[-d:]
+		seg.seq = s.nextSeq
+		s.nextSeq += uint32(len(seg.data))
+		out = append(out, seg)
+	}
+	return out
+}
+
+// sent records a segment ending at end for round trip timing. Only
+// segments past everything sent so far are timed.
+func (s *tcpStream) sent(end uint32, ts time.Time) {
+	if s.hasSent && seqDiff(end, s.sndMax) <= 0 {
+		return
+	}
+	s.hasSent = true
+	s.sndMax = end
+	if len(s.inFlight) == maxRTTSamples {
+		s.inFlight = s.inFlight[1:]
+	}
+	s.inFlight = append(s.inFlight, rttSample{end: end, ts: ts})
+}
+
+// retransmitted drops pending samples, since an ACK can no longer be tied
+// to one transmission (Karn's algorithm)
+func (s *tcpStream) retransmitted() {
+	s.inFlight = s.inFlight[:0]
+}
+
+// acked takes an ACK from the other side and updates the smoothed round
+// trip time as in RFC 6298
+func (s *tcpStream) acked(ack uint32, ts time.Time) {
+	var sample *rttSample
+	i := 0
+	for ; i < len(s.inFlight) && seqDiff(ack, s.inFlight[i].end) >= 0; i++ {
+		sample = &s.inFlight[i]
+	}
+	if sample == nil {
+		return
+	}
+	rtt := ts.Sub(sample.ts)
+	s.inFlight = s.inFlight[i:]
+	if rtt < 0 {
+		return
+	}
+
+	if s.srtt == 0 {
+		s.srtt = rtt
+	} else {
+		s.srtt = s.srtt - s.srtt/8 + rtt/8
+	}
+}
+
+// duplicateAck records an ACK sent by this side and reports whether it
+// repeats the previous one while the other side has data outstanding
+func (s *tcpStream) duplicateAck(ack uint32, window uint16, peer *tcpStream) bool {
+	dup := s.ackSeen && ack == s.lastAck && window == s.lastWindow &&
+		peer.hasSent && seqDiff(peer.sndMax, ack) > 0
+	s.ackSeen = true
+	s.lastAck = ack
+	s.lastWindow = window
+	return dup
+}
@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// streamData concatenates delivered segments
+func streamData(segments []tcpSegment) string {
+	var s string
+	for _, seg := range segments {
+		s += string(seg.data)
+	}
+	return s
+}
+
+func TestTCPStream_InOrder(t *testing.T) {
+	var s tcpStream
+	s.syn(99)
+
+	kind, out := s.add(100, []byte("hello "), time.Time{})
+	if kind != segmentInOrder || streamData(out) != "hello " {
+		t.Errorf("add = %v %q, want in order %q", kind, streamData(out), "hello ")
+	}
+	kind, out = s.add(106, []byte("world"), time.Time{})
+	if kind != segmentInOrder || streamData(out) != "world" {
+		t.Errorf("add = %v %q, want in order %q", kind, streamData(out), "world")
+	}
+}
+
+func TestTCPStream_OutOfOrderIsHeldBack(t *testing.T) {
+	var s tcpStream
+	s.syn(0)
+
+	kind, out := s.add(7, []byte("world"), time.Time{})
+	if kind != segmentOutOfOrder || len(out) != 0 {
+		t.Fatalf("add = %v with %d segments, want out of order and nothing delivered", kind, len(out))
+	}
+
+	// Filling the gap delivers both segments in sequence order
+	kind, out = s.add(1, []byte("hello "), time.Time{})
+	if kind != segmentInOrder || streamData(out) != "hello world" {
+		t.Errorf("add = %v %q, want %q", kind, streamData(out), "hello world")
+	}
+	if len(s.pending) != 0 || s.pendingBytes != 0 {
+		t.Errorf("pending = %d segments, %d bytes, want empty", len(s.pending), s.pendingBytes)
+	}
+}
+
+func TestTCPStream_Retransmits(t *testing.T) {
+	var s tcpStream
+	s.syn(0)
+	s.add(1, []byte("abcdef"), time.Time{})
+
+	// Full duplicate
+	kind, out := s.add(1, []byte("abcdef"), time.Time{})
+	if kind != segmentRetransmit || len(out) != 0 {
+		t.Errorf("duplicate = %v %q, want retransmit with nothing delivered", kind, streamData(out))
+	}
+
+	// Overlap carrying new bytes delivers only the new part
+	kind, out = s.add(4, []byte("defgh"), time.Time{})
+	if kind != segmentRetransmit || streamData(out) != "gh" {
+		t.Errorf("overlap = %v %q, want retransmit delivering %q", kind, streamData(out), "gh")
+	}
+
+	// Duplicate of a segment still waiting for a gap
+	s.add(20, []byte("xyz"), time.Time{})
+	if kind, _ := s.add(20, []byte("xyz"), time.Time{}); kind != segmentRetransmit {
+		t.Errorf("duplicate pending segment = %v, want retransmit", kind)
+	}
+	if s.pendingBytes != 3 {
+		t.Errorf("pendingBytes = %d, want 3", s.pendingBytes)
+	}
+}
+
+func TestTCPStream_SequenceWraparound(t *testing.T) {
+	var s tcpStream
+	s.syn(0xfffffffd)
+
+	s.add(0, []byte("cd"), time.Time{})
+	kind, out := s.add(0xfffffffe, []byte("ab"), time.Time{})
+	if kind != segmentInOrder || streamData(out) != "abcd" {
+		t.Errorf("add = %v %q, want %q across the wrap", kind, streamData(out), "abcd")
+	}
+}
+
+func TestTCPStream_GapSkippedWhenBufferFull(t *testing.T) {
+	var s tcpStream
+	s.syn(0)
+
+	chunk := make([]byte, MaxOutOfOrderBytes/2)
+	// Byte 1 is never captured
+	s.add(2, chunk, time.Time{})
+	s.add(2+uint32(len(chunk)), chunk, time.Time{})
+	_, out := s.add(2+2*uint32(len(chunk)), []byte("x"), time.Time{})
+
+	if got, want := len(streamData(out)), 2*len(chunk)+1; got != want {
+		t.Errorf("delivered %d bytes after the gap, want %d", got, want)
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("%d segments still pending", len(s.pending))
+	}
+}
+
+func TestProcessPacket_ReassemblesHTTPRequest(t *testing.T) {
+	var completed *protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { completed = f },
+	}
+
+	client, server := "10.0.0.1", "10.0.0.2"
+	now := time.Now()
+	send := func(fromClient bool, tcp *layers.TCP, payload string) {
+		var app gopacket.ApplicationLayer
+		if payload != "" {
+			app = gopacket.Payload(payload)
+		}
+		if fromClient {
+			assembler.ProcessPacket(client, server, 40000, 80, tcp, now, app)
+		} else {
+			assembler.ProcessPacket(server, client, 80, 40000, tcp, now, app)
+		}
+	}
+
+	part1 := "POST /orders HTTP/1.1\r\nHost: shop\r\n"
+	part2 := "Content-Length: 5\r\n\r\n"
+	body := "hello"
+	resp := "HTTP/1.1 201 Created\r\nContent-Length: 0\r\n\r\n"
+
+	send(true, &layers.TCP{SYN: true, Seq: 100, Window: 65535}, "")
+	send(false, &layers.TCP{SYN: true, ACK: true, Seq: 900, Window: 65535}, "")
+	// The body overtakes the headers, and the first segment is retransmitted
+	send(true, &layers.TCP{ACK: true, Seq: 101, Window: 65535}, part1)
+	send(true, &layers.TCP{ACK: true, Seq: 101 + uint32(len(part1+part2)), Window: 65535}, body)
+	send(true, &layers.TCP{ACK: true, Seq: 101, Window: 65535}, part1)
+	send(true, &layers.TCP{ACK: true, Seq: 101 + uint32(len(part1)), Window: 65535}, part2)
+	// The client stalls the response twice
+	send(true, &layers.TCP{ACK: true, Seq: 101 + uint32(len(part1+part2+body)), Window: 0}, "")
+	send(true, &layers.TCP{ACK: true, Seq: 101 + uint32(len(part1+part2+body)), Window: 0}, "")
+	send(true, &layers.TCP{ACK: true, Seq: 101 + uint32(len(part1+part2+body)), Window: 4096}, "")
+	send(true, &layers.TCP{ACK: true, Seq: 101 + uint32(len(part1+part2+body)), Window: 0}, "")
+	send(false, &layers.TCP{ACK: true, Seq: 901, Window: 65535}, resp)
+	send(true, &layers.TCP{FIN: true, ACK: true, Seq: 101 + uint32(len(part1+part2+body)), Window: 65535}, "")
+	send(false, &layers.TCP{FIN: true, ACK: true, Seq: 901 + uint32(len(resp)), Window: 65535}, "")
+
+	if completed == nil {
+		t.Fatal("flow was not completed")
+	}
+	if completed.HTTP == nil {
+		t.Fatal("HTTP info not parsed")
+	}
+	if completed.HTTP.Method != "POST" || completed.HTTP.RequestBody != body || completed.HTTP.StatusCode != 201 {
+		t.Errorf("HTTP = %s body=%q status=%d, want POST body=%q status=201",
+			completed.HTTP.Method, completed.HTTP.RequestBody, completed.HTTP.StatusCode, body)
+	}
+	if len(completed.HTTPExchanges) != 1 {
+		t.Errorf("got %d exchanges, want 1", len(completed.HTTPExchanges))
+	}
+	if completed.Retransmits != 1 || completed.OutOfOrder != 1 || completed.ZeroWindows != 2 {
+		t.Errorf("Retransmits/OutOfOrder/ZeroWindows = %d/%d/%d, want 1/1/2",
+			completed.Retransmits, completed.OutOfOrder, completed.ZeroWindows)
+	}
+	// Wire counters include the retransmitted bytes
+	if want := uint64(len(part1+part2+body) + len(part1)); completed.BytesSent != want {
+		t.Errorf("BytesSent = %d, want %d", completed.BytesSent, want)
+	}
+}
+
+func TestTCPStream_SmoothedRTT(t *testing.T) {
+	var s tcpStream
+	base := time.Now()
+
+	s.sent(100, base)
+	s.acked(100, base.Add(10*time.Millisecond))
+	if s.srtt != 10*time.Millisecond {
+		t.Fatalf("srtt = %v after first sample, want 10ms", s.srtt)
+	}
+
+	// Two segments acked at once time the later one
+	s.sent(200, base.Add(20*time.Millisecond))
+	s.sent(300, base.Add(22*time.Millisecond))
+	s.acked(300, base.Add(40*time.Millisecond))
+	if want := 10*time.Millisecond - 10*time.Millisecond/8 + 18*time.Millisecond/8; s.srtt != want {
+		t.Errorf("srtt = %v, want %v", s.srtt, want)
+	}
+	if len(s.inFlight) != 0 {
+		t.Errorf("%d samples left after a cumulative ACK", len(s.inFlight))
+	}
+}
+
+func TestTCPStream_RetransmitIsNotTimed(t *testing.T) {
+	var s tcpStream
+	base := time.Now()
+
+	s.sent(100, base)
+	s.retransmitted()
+	s.sent(100, base.Add(time.Second))
+	s.acked(100, base.Add(time.Second+time.Millisecond))
+
+	if s.srtt != 0 {
+		t.Errorf("srtt = %v, want no sample from a retransmitted segment", s.srtt)
+	}
+}
+
+func TestProcessPacket_TCPHealth(t *testing.T) {
+	var completed *protocol.Flow
+	assembler := &TCPAssembler{
+		flows:          make(map[string]*TCPFlow),
+		onFlowComplete: func(f *protocol.Flow) { completed = f },
+	}
+
+	client, server := "10.0.0.1", "10.0.0.2"
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	send := func(fromClient bool, offset time.Duration, tcp *layers.TCP, payload string) {
+		var app gopacket.ApplicationLayer
+		if payload != "" {
+			app = gopacket.Payload(payload)
+		}
+		tcp.Window = 65535
+		if fromClient {
+			assembler.ProcessPacket(client, server, 40000, 80, tcp, base.Add(offset), app)
+		} else {
+			assembler.ProcessPacket(server, client, 80, 40000, tcp, base.Add(offset), app)
+		}
+	}
+
+	// Captured at the client: the server is 20ms away and the client acks at once
+	send(true, 0, &layers.TCP{SYN: true, Seq: 100}, "")
+	send(false, 20*time.Millisecond, &layers.TCP{SYN: true, ACK: true, Seq: 900, Ack: 101}, "")
+	send(true, 20*time.Millisecond, &layers.TCP{ACK: true, Seq: 101, Ack: 901}, "")
+	send(false, 30*time.Millisecond, &layers.TCP{ACK: true, Seq: 901, Ack: 101}, "aaaa")
+	send(false, 30*time.Millisecond, &layers.TCP{ACK: true, Seq: 905, Ack: 101}, "bbbb")
+	// The first segment is lost further on, so the client keeps acking 905
+	send(true, 31*time.Millisecond, &layers.TCP{ACK: true, Seq: 101, Ack: 905}, "")
+	send(true, 32*time.Millisecond, &layers.TCP{ACK: true, Seq: 101, Ack: 905}, "")
+	send(true, 33*time.Millisecond, &layers.TCP{ACK: true, Seq: 101, Ack: 905}, "")
+	send(false, 60*time.Millisecond, &layers.TCP{RST: true, Seq: 909}, "")
+
+	if completed == nil {
+		t.Fatal("flow was not completed")
+	}
+	if completed.Status != protocol.StatusReset || completed.ResetBy != "server" {
+		t.Errorf("Status = %s, ResetBy = %q, want RESET by server", completed.Status, completed.ResetBy)
+	}
+	if completed.DupAcks != 2 {
+		t.Errorf("DupAcks = %d, want 2", completed.DupAcks)
+	}
+	if completed.SmoothedRTTMs != 20 {
+		t.Errorf("SmoothedRTTMs = %v, want 20", completed.SmoothedRTTMs)
+	}
+}
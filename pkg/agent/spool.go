@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol/pb"
+)
+
+const (
+	// DefaultFlowSpoolSize is how many flows are held while the hub is
+	// unreachable
+	DefaultFlowSpoolSize = 10000
+	// DefaultPCAPSpoolBytes is how much PCAP data is held while the hub is
+	// unreachable
+	DefaultPCAPSpoolBytes = 32 * 1024 * 1024
+	// spoolRetryInterval is how often spooled data is retried when nothing
+	// new arrives
+	spoolRetryInterval = time.Second
+	// spoolBatchSize is how many entries are sent on one stream before the
+	// hub is asked to confirm them
+	spoolBatchSize = 256
+	// streamConfirmInterval is how long a stream stays open before the hub
+	// is asked to confirm what was sent on it, however little that is
+	streamConfirmInterval = time.Second
+)
+
+// spool is a bounded FIFO of data waiting to reach the hub. When it is full
+// the oldest entries make room, so what is replayed is the most recent data
+// without gaps. It is owned by a single streamer goroutine.
+type spool[T any] struct {
+	entries []T
+	size    int64
+	maxSize int64
+	sizeOf  func(T) int64
+
+	sent int // entries at the front sent on the open stream, not yet confirmed
+	lost int // entries evicted after they were sent, before the hub confirmed them
+}
+
+// newSpool creates a spool holding up to maxSize, as measured by sizeOf
+func newSpool[T any](maxSize int64, sizeOf func(T) int64) *spool[T] {
+	return &spool[T]{maxSize: maxSize, sizeOf: sizeOf}
+}
+
+// push appends an entry and returns the entries evicted to make room for
+// it. An entry larger than the whole spool is returned as evicted itself.
+func (s *spool[T]) push(entry T) []T {
+	n := s.sizeOf(entry)
+	if n > s.maxSize {
+		return []T{entry}
+	}
+
+	var evicted []T
+	for s.size+n > s.maxSize {
+		if s.sent > 0 {
+			s.sent--
+			s.lost++
+		}
+		evicted = append(evicted, s.pop())
+	}
+	s.entries = append(s.entries, entry)
+	s.size += n
+	return evicted
+}
+
+// at returns the i-th oldest entry without removing it
+func (s *spool[T]) at(i int) T {
+	return s.entries[i]
+}
+
+// pop removes and returns the oldest entry
+func (s *spool[T]) pop() T {
+	entry := s.entries[0]
+	var zero T
+	s.entries[0] = zero // let it be collected
+	s.entries = s.entries[1:]
+	s.size -= s.sizeOf(entry)
+	return entry
+}
+
+// len returns the number of entries waiting
+func (s *spool[T]) len() int {
+	return len(s.entries)
+}
+
+// confirm removes the entries the hub confirmed, the first n sent on the
+// stream, and returns those that were still spooled. The rest of what was
+// sent is sent again on the next stream.
+func (s *spool[T]) confirm(n int) []T {
+	n = min(n-min(n, s.lost), s.sent)
+	confirmed := make([]T, 0, n)
+	for i := 0; i < n; i++ {
+		confirmed = append(confirmed, s.pop())
+	}
+	s.resend()
+	return confirmed
+}
+
+// resend marks every entry as not sent, after a stream was lost
+func (s *spool[T]) resend() {
+	s.sent, s.lost = 0, 0
+}
+
+// clientStream is a client-streaming call to the hub, which confirms what
+// it received when the stream is closed
+type clientStream interface {
+	CloseAndRecv() (*pb.StreamResponse, error)
+}
+
+// hubStream keeps one stream to the hub open for the entries of a spool.
+// The hub only confirms what it received when a stream is closed, so the
+// stream is closed and replaced every spoolBatchSize entries or
+// streamConfirmInterval. Entries stay spooled until they are confirmed.
+type hubStream[T any, S clientStream] struct {
+	name      string // what is streamed, for errors
+	open      func(ctx context.Context) (S, error)
+	send      func(stream S, entry T) error
+	confirmed func(entries []T)
+
+	stream S
+	cancel context.CancelFunc // nil while no stream is open
+	due    *time.Timer
+}
+
+// deliver sends the spooled entries not sent yet, asking the hub to confirm
+// them each time spoolBatchSize are on the stream
+func (h *hubStream[T, S]) deliver(ctx context.Context, pending *spool[T]) error {
+	for pending.sent < pending.len() {
+		if h.cancel == nil {
+			if err := h.openStream(ctx); err != nil {
+				return err
+			}
+		}
+		if err := h.send(h.stream, pending.at(pending.sent)); err != nil {
+			return h.confirm(pending) // reports why the stream failed
+		}
+		pending.sent++
+
+		if pending.sent+pending.lost >= spoolBatchSize {
+			if err := h.confirm(pending); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// confirm closes the stream and removes what the hub confirms from the
+// spool. Entries it did not confirm are sent again on the next stream.
+func (h *hubStream[T, S]) confirm(pending *spool[T]) error {
+	if h.cancel == nil {
+		return nil
+	}
+	resp, err := h.stream.CloseAndRecv()
+	h.close()
+	if err != nil {
+		pending.resend()
+		return fmt.Errorf("%s stream failed: %w", h.name, err)
+	}
+
+	sent := pending.sent + pending.lost
+	confirmed := pending.confirm(int(resp.GetReceivedCount()))
+	if resp.GetReceivedCount() == 0 && sent > 0 {
+		return fmt.Errorf("hub confirmed none of %d %s entries", sent, h.name)
+	}
+	if h.confirmed != nil {
+		h.confirmed(confirmed)
+	}
+	return nil
+}
+
+// abort drops the stream without waiting for the hub to confirm it, e.g.
+// when the hub is unreachable. What was sent on it is sent again.
+func (h *hubStream[T, S]) abort(pending *spool[T]) {
+	if h.cancel != nil {
+		h.close()
+		pending.resend()
+	}
+}
+
+// confirmDue fires when the open stream is due to be confirmed. It never
+// fires while no stream is open.
+func (h *hubStream[T, S]) confirmDue() <-chan time.Time {
+	if h.cancel == nil {
+		return nil
+	}
+	return h.due.C
+}
+
+// openStream opens a stream, bounded so a hub that stops reading can't
+// hold it forever
+func (h *hubStream[T, S]) openStream(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, streamConfirmInterval+rpcTimeout)
+	stream, err := h.open(ctx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to open %s stream: %w", h.name, err)
+	}
+	h.stream, h.cancel = stream, cancel
+	h.due = time.NewTimer(streamConfirmInterval)
+	return nil
+}
+
+// close releases the open stream
+func (h *hubStream[T, S]) close() {
+	h.cancel()
+	h.cancel = nil
+	h.due.Stop()
+	var zero S
+	h.stream = zero
+}
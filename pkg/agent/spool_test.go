@@ -0,0 +1,69 @@
+package agent
+
+import "testing"
+
+func TestSpool_FIFO(t *testing.T) {
+	s := newSpool(10, func(n int) int64 { return 1 })
+	for i := 0; i < 3; i++ {
+		if evicted := s.push(i); len(evicted) != 0 {
+			t.Fatalf("push(%d) evicted %v", i, evicted)
+		}
+	}
+
+	for want := 0; want < 3; want++ {
+		if got := s.at(0); got != want {
+			t.Fatalf("at(0) = %d, want %d", got, want)
+		}
+		if got := s.pop(); got != want {
+			t.Fatalf("pop() = %d, want %d", got, want)
+		}
+	}
+	if s.len() != 0 || s.size != 0 {
+		t.Errorf("spool not empty: %d entries, %d bytes", s.len(), s.size)
+	}
+}
+
+func TestSpool_EvictsOldest(t *testing.T) {
+	s := newSpool(10, func(b []byte) int64 { return int64(len(b)) })
+	s.push([]byte("aaaa"))
+	s.push([]byte("bbbb"))
+
+	evicted := s.push([]byte("ccccccc"))
+	if len(evicted) != 2 || string(evicted[0]) != "aaaa" || string(evicted[1]) != "bbbb" {
+		t.Errorf("evicted = %q, want the two oldest", evicted)
+	}
+	if s.len() != 1 || s.size != 7 {
+		t.Errorf("spool = %d entries, %d bytes, want 1 and 7", s.len(), s.size)
+	}
+
+	// Too big to ever fit: turned away without emptying the spool
+	if evicted := s.push(make([]byte, 11)); len(evicted) != 1 || len(evicted[0]) != 11 {
+		t.Errorf("oversized push evicted %d entries", len(evicted))
+	}
+	if s.len() != 1 {
+		t.Errorf("spool lost entries to an oversized push: %d left", s.len())
+	}
+}
+
+func TestSpool_ConfirmRemovesWhatTheHubReceived(t *testing.T) {
+	s := newSpool(3, func(n int) int64 { return 1 })
+	for i := 0; i < 3; i++ {
+		s.push(i)
+	}
+	s.sent = 2
+
+	// The oldest is evicted while it waits for confirmation
+	s.push(3)
+	if got := s.confirm(2); len(got) != 1 || got[0] != 1 {
+		t.Errorf("confirm(2) = %v, want [1]", got)
+	}
+	if s.len() != 2 || s.at(0) != 2 || s.sent != 0 || s.lost != 0 {
+		t.Errorf("spool = %v sent %d lost %d, want [2 3] with nothing sent", s.entries, s.sent, s.lost)
+	}
+
+	// What the hub did not confirm is sent again
+	s.sent = 2
+	if got := s.confirm(1); len(got) != 1 || got[0] != 2 || s.sent != 0 {
+		t.Errorf("confirm(1) = %v, sent %d, want [2] and the rest to send again", got, s.sent)
+	}
+}
@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const (
+	// UDPFlowTimeout is how long a UDP flow may stay idle before it is
+	// emitted. UDP has no connection teardown, so going idle is how a flow ends.
+	UDPFlowTimeout = 30 * time.Second
+	// MaxUDPFlows bounds the flows tracked at once, e.g. during a port scan;
+	// the least recently active one is emitted as timed out to make room
+	MaxUDPFlows = 10000
+)
+
+// UDPTracker groups UDP datagrams into flows by address/port pair
+type UDPTracker struct {
+	flows          map[string]*list.Element // of *udpFlow, by flow key
+	active         *list.List               // least recently active first
+	mutex          sync.Mutex
+	onFlowComplete func(*protocol.Flow)
+
+	// Agent info for populating pod names
+	agentPodName   string
+	agentNamespace string
+	agentPodIP     string
+
+	// Sockets of the pod's processes, for attributing flows
+	processes *ProcessTable
+
+	// Addresses the pod resolved, for naming destinations
+	names *ResolvedNames
+}
+
+// udpFlow is a tracked flow with when its last datagram was seen
+type udpFlow struct {
+	key      string
+	flow     *protocol.Flow
+	lastSeen time.Time
+}
+
+// NewUDPTracker creates a new UDP flow tracker
+func NewUDPTracker(onComplete func(*protocol.Flow), agentInfo *protocol.AgentInfo) *UDPTracker {
+	t := &UDPTracker{
+		flows:          make(map[string]*list.Element),
+		active:         list.New(),
+		onFlowComplete: onComplete,
+	}
+
+	if agentInfo != nil {
+		t.agentPodName = agentInfo.PodName
+		t.agentNamespace = agentInfo.Namespace
+		t.agentPodIP = agentInfo.PodIP
+	}
+
+	go t.cleanupLoop()
+
+	return t
+}
+
+// SetProcessTable sets the table used to find the process that owns each
+// flow
+func (t *UDPTracker) SetProcessTable(processes *ProcessTable) {
+	t.processes = processes
+}
+
+// SetResolvedNames sets the cache of addresses from DNS answers, used to
+// name destinations
+func (t *UDPTracker) SetResolvedNames(names *ResolvedNames) {
+	t.names = names
+}
+
+// ActiveFlows returns the number of UDP flows not yet expired
+func (t *UDPTracker) ActiveFlows() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.flows)
+}
+
+// ProcessPacket accounts a UDP datagram. The sender of the first datagram
+// seen is treated as the client.
+func (t *UDPTracker) ProcessPacket(srcIP, dstIP string, srcPort, dstPort uint16, size int, timestamp time.Time) {
+	key := flowKey(srcIP, dstIP, srcPort, dstPort)
+	var evicted *protocol.Flow
+
+	t.mutex.Lock()
+	elem, exists := t.flows[key]
+	if !exists {
+		if len(t.flows) >= MaxUDPFlows {
+			evicted = t.evictOldest()
+		}
+		f := &protocol.Flow{
+			ID:        uuid.New().String()[:8],
+			Timestamp: timestamp,
+			SrcIP:     srcIP,
+			SrcPort:   srcPort,
+			DstIP:     dstIP,
+			DstPort:   dstPort,
+			Protocol:  protocol.ProtocolUDP,
+		}
+		if t.processes != nil {
+			f.Process = t.processes.Lookup("udp", srcIP, srcPort, dstIP, dstPort)
+		}
+		if t.names != nil {
+			if f.DstName = t.names.Lookup(dstIP, timestamp); f.DstName != "" {
+				f.DstNameSource = NameSourceDNS
+			}
+		}
+		elem = t.active.PushBack(&udpFlow{key: key, flow: f})
+		t.flows[key] = elem
+	} else {
+		t.active.MoveToBack(elem)
+	}
+	entry := elem.Value.(*udpFlow)
+	f := entry.flow
+
+	if srcIP == f.SrcIP && srcPort == f.SrcPort {
+		f.PacketsSent++
+		f.BytesSent += uint64(size)
+	} else {
+		f.PacketsRecv++
+		f.BytesReceived += uint64(size)
+	}
+	f.Duration = timestamp.Sub(f.Timestamp).Milliseconds()
+	entry.lastSeen = timestamp
+	t.mutex.Unlock()
+
+	if evicted != nil {
+		t.emit(evicted, protocol.StatusTimeout)
+	}
+}
+
+// evictOldest stops tracking the least recently active flow and returns
+// it. The caller holds t.mutex.
+func (t *UDPTracker) evictOldest() *protocol.Flow {
+	entry := t.active.Remove(t.active.Front()).(*udpFlow)
+	delete(t.flows, entry.key)
+	return entry.flow
+}
+
+// expire emits flows that have been idle longer than UDPFlowTimeout. They
+// are at the front of the list, so it stops at the first one still active.
+func (t *UDPTracker) expire(now time.Time) {
+	var expired []*protocol.Flow
+
+	t.mutex.Lock()
+	for elem := t.active.Front(); elem != nil; elem = t.active.Front() {
+		entry := elem.Value.(*udpFlow)
+		if now.Sub(entry.lastSeen) <= UDPFlowTimeout {
+			break
+		}
+		t.active.Remove(elem)
+		delete(t.flows, entry.key)
+		expired = append(expired, entry.flow)
+	}
+	t.mutex.Unlock()
+
+	for _, f := range expired {
+		t.emit(f, protocol.StatusClosed)
+	}
+}
+
+// emit reports a flow that is no longer tracked
+func (t *UDPTracker) emit(f *protocol.Flow, status protocol.FlowStatus) {
+	f.Status = status
+	assignPods(f, t.agentPodName, t.agentNamespace, t.agentPodIP, nil)
+
+	if t.onFlowComplete != nil {
+		t.onFlowComplete(f)
+	}
+}
+
+// cleanupLoop emits idle flows
+func (t *UDPTracker) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		t.expire(time.Now())
+	}
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// newTestUDPTracker creates a tracker that collects completed flows
+func newTestUDPTracker(agentInfo *protocol.AgentInfo) (*UDPTracker, *[]*protocol.Flow) {
+	var flows []*protocol.Flow
+	t := &UDPTracker{
+		flows:          make(map[string]*list.Element),
+		active:         list.New(),
+		onFlowComplete: func(f *protocol.Flow) { flows = append(flows, f) },
+	}
+	if agentInfo != nil {
+		t.agentPodName = agentInfo.PodName
+		t.agentNamespace = agentInfo.Namespace
+		t.agentPodIP = agentInfo.PodIP
+	}
+	return t, &flows
+}
+
+func TestUDPTracker_CountsPerDirection(t *testing.T) {
+	tracker, flows := newTestUDPTracker(&protocol.AgentInfo{PodName: "app", Namespace: "prod", PodIP: "10.0.0.5"})
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.ProcessPacket("10.0.0.5", "10.0.0.9", 41000, 8125, 100, start)
+	tracker.ProcessPacket("10.0.0.5", "10.0.0.9", 41000, 8125, 50, start.Add(time.Second))
+	tracker.ProcessPacket("10.0.0.9", "10.0.0.5", 8125, 41000, 20, start.Add(2*time.Second))
+
+	if len(tracker.flows) != 1 {
+		t.Fatalf("both directions should share one flow, got %d", len(tracker.flows))
+	}
+
+	tracker.expire(start.Add(2*time.Second + UDPFlowTimeout + time.Millisecond))
+
+	if len(*flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(*flows))
+	}
+	f := (*flows)[0]
+	if f.Protocol != protocol.ProtocolUDP || f.Status != protocol.StatusClosed {
+		t.Errorf("Protocol/Status = %s/%s, want UDP/CLOSED", f.Protocol, f.Status)
+	}
+	if f.SrcIP != "10.0.0.5" || f.SrcPort != 41000 || f.DstIP != "10.0.0.9" || f.DstPort != 8125 {
+		t.Errorf("endpoints = %s:%d -> %s:%d", f.SrcIP, f.SrcPort, f.DstIP, f.DstPort)
+	}
+	if f.PacketsSent != 2 || f.BytesSent != 150 || f.PacketsRecv != 1 || f.BytesReceived != 20 {
+		t.Errorf("counters = sent %d/%d recv %d/%d", f.PacketsSent, f.BytesSent, f.PacketsRecv, f.BytesReceived)
+	}
+	if f.Duration != 2000 {
+		t.Errorf("Duration = %d, want 2000", f.Duration)
+	}
+	if f.SrcPod != "app" || f.SrcNamespace != "prod" {
+		t.Errorf("SrcPod = %s/%s, want prod/app", f.SrcNamespace, f.SrcPod)
+	}
+}
+
+func TestUDPTracker_IdleTimeout(t *testing.T) {
+	tracker, flows := newTestUDPTracker(nil)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.ProcessPacket("10.0.0.5", "10.0.0.9", 41000, 514, 80, start)
+	tracker.ProcessPacket("10.0.0.5", "10.0.0.7", 41001, 514, 80, start.Add(20*time.Second))
+
+	tracker.expire(start.Add(UDPFlowTimeout + time.Second))
+
+	if len(*flows) != 1 || (*flows)[0].DstIP != "10.0.0.9" {
+		t.Fatalf("only the idle flow should be emitted, got %d", len(*flows))
+	}
+	if len(tracker.flows) != 1 {
+		t.Errorf("active flow should remain, %d tracked", len(tracker.flows))
+	}
+}
+
+func TestUDPTracker_FullEvictsLeastRecentlyActive(t *testing.T) {
+	tracker, flows := newTestUDPTracker(nil)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < MaxUDPFlows; i++ {
+		tracker.ProcessPacket("10.0.0.5", "10.0.0.9", uint16(20000+i), 514, 80, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	// The first flow is active again, so the second is now the oldest
+	tracker.ProcessPacket("10.0.0.5", "10.0.0.9", 20000, 514, 80, start.Add(time.Minute))
+	if len(*flows) != 0 {
+		t.Fatalf("nothing should be emitted below the cap, got %d", len(*flows))
+	}
+
+	tracker.ProcessPacket("10.0.0.5", "10.0.0.9", 60000, 514, 80, start.Add(time.Minute))
+
+	if len(tracker.flows) != MaxUDPFlows {
+		t.Errorf("tracked %d flows, want %d", len(tracker.flows), MaxUDPFlows)
+	}
+	if len(*flows) != 1 {
+		t.Fatalf("got %d flows emitted, want 1", len(*flows))
+	}
+	if f := (*flows)[0]; f.SrcPort != 20001 || f.Status != protocol.StatusTimeout {
+		t.Errorf("emitted port %d with %s, want 20001 with TIMEOUT", f.SrcPort, f.Status)
+	}
+}
+
+func TestCapturer_UDPPacketBecomesFlow(t *testing.T) {
+	udpTracker, udpFlows := newTestUDPTracker(nil)
+	dnsTracker, dnsFlows := newTestDNSTracker(nil)
+	c := &Capturer{udpTracker: udpTracker, dnsTracker: dnsTracker}
+
+	c.processPacket(buildUDPPacket(t, "10.0.0.5", "10.0.0.9", 41000, 8125, gopacket.Payload("requests:1|c")))
+	c.processPacket(buildUDPPacket(t, "10.0.0.5", "10.96.0.10", 40000, 53, dnsQueryMsg(1, "api", 1)))
+
+	if len(udpTracker.flows) != 1 {
+		t.Errorf("statsd datagram should start a UDP flow, %d tracked", len(udpTracker.flows))
+	}
+	if len(dnsTracker.queries) != 1 {
+		t.Errorf("DNS query should go to the DNS tracker, %d pending", len(dnsTracker.queries))
+	}
+
+	udpTracker.expire(time.Now().Add(UDPFlowTimeout + time.Hour))
+	if len(*udpFlows) != 1 || (*udpFlows)[0].BytesSent != uint64(len("requests:1|c")) {
+		t.Errorf("expected one UDP flow with the payload size counted")
+	}
+	if len(*dnsFlows) != 0 {
+		t.Errorf("DNS query without response should still be pending")
+	}
+}
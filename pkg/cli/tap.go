@@ -27,6 +27,9 @@ var (
 	uiPort           int
 	targetContainer  string
 	anthropicAPIKey  string
+	hubGracePeriod   time.Duration
+	hubPVC           bool
+	hubStorageClass  string
 )
 
 var tapCmd = &cobra.Command{
@@ -56,6 +59,9 @@ func init() {
 	tapCmd.Flags().IntVar(&uiPort, "ui-port", 8899, "Local port for the UI (via port-forward)")
 	tapCmd.Flags().StringVarP(&targetContainer, "target", "t", "", "Container to share process namespace with (defaults to first container)")
 	tapCmd.Flags().StringVar(&anthropicAPIKey, "anthropic-api-key", "", "Anthropic API key for AI features (can also use ANTHROPIC_API_KEY env var)")
+	tapCmd.Flags().DurationVar(&hubGracePeriod, "hub-grace-period", 2*time.Minute, "How long agents keep spooling traffic while the Hub is unreachable before giving up")
+	tapCmd.Flags().BoolVar(&hubPVC, "hub-pvc", false, "Keep Hub flows and PCAPs on a PersistentVolumeClaim so they survive the Hub pod being rescheduled")
+	tapCmd.Flags().StringVar(&hubStorageClass, "hub-storage-class", "", "Storage class for --hub-pvc (defaults to the cluster default)")
 }
 
 func runTap(cmd *cobra.Command, args []string) error {
@@ -109,6 +115,10 @@ func runTap(cmd *cobra.Command, args []string) error {
 	// Create session manager with options
 	sessionOpts := k8s.SessionOptions{
 		AnthropicAPIKey: apiKey,
+		HubGracePeriod:  hubGracePeriod,
+
+		HubPersistentVolume: hubPVC,
+		HubStorageClass:     hubStorageClass,
 	}
 	session, err := k8s.NewSession(k8sClient, sessionOpts)
 	if err != nil {
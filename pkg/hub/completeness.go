@@ -0,0 +1,71 @@
+package hub
+
+import "math"
+
+// CaptureCompleteness is the share of traffic that made it through every
+// stage of the pipeline, so a missing request can be told apart from one
+// that was dropped along the way. Each ratio is 1 when nothing was lost.
+type CaptureCompleteness struct {
+	Overall float64      `json:"overall"` // the lowest of the ratios below
+	Packets float64      `json:"packets"` // packets the capture socket kept
+	Flows   float64      `json:"flows"`   // flow events that left the agent
+	PCAP    float64      `json:"pcap"`    // PCAP bytes that reached storage
+	Drops   CaptureDrops `json:"drops"`
+}
+
+// CaptureDrops counts what was lost at each drop point
+type CaptureDrops struct {
+	KernelPackets       uint64 `json:"kernelPackets"`       // capture buffer overflowed
+	InterfacePackets    uint64 `json:"interfacePackets"`    // dropped by the network interface
+	FlowsQueueFull      uint64 `json:"flowsQueueFull"`      // agent's flow queue was full
+	FlowsSpoolFull      uint64 `json:"flowsSpoolFull"`      // hub unreachable for too long
+	FlowsSendFailed     uint64 `json:"flowsSendFailed"`     // not delivered before the agent stopped
+	PCAPBytesQueueFull  uint64 `json:"pcapBytesQueueFull"`  // agent's PCAP queue was full
+	PCAPBytesSpoolFull  uint64 `json:"pcapBytesSpoolFull"`  // hub unreachable for too long
+	PCAPBytesSendFailed uint64 `json:"pcapBytesSendFailed"` // not delivered before the agent stopped
+	PCAPBytesBufferFull uint64 `json:"pcapBytesBufferFull"` // hub's PCAP buffer was full
+}
+
+// captureCompleteness adds up the drops of the given agents. Agent counters
+// come from their last heartbeat, so the ratios lag by a few seconds.
+func captureCompleteness(agents []AgentConnection) CaptureCompleteness {
+	var drops CaptureDrops
+	var packets, flows, pcapBytes uint64
+	for _, a := range agents {
+		s := a.Stats
+		drops.KernelPackets += s.KernelPacketsDropped
+		drops.InterfacePackets += s.InterfacePacketsDropped
+		drops.FlowsQueueFull += s.FlowsDroppedQueueFull
+		drops.FlowsSpoolFull += s.FlowsDroppedSpoolFull
+		drops.FlowsSendFailed += s.FlowsDroppedSendFailed
+		drops.PCAPBytesQueueFull += s.PCAPBytesDroppedQueueFull
+		drops.PCAPBytesSpoolFull += s.PCAPBytesDroppedSpoolFull
+		drops.PCAPBytesSendFailed += s.PCAPBytesDroppedSendFailed
+		drops.PCAPBytesBufferFull += a.PCAPBytesDropped
+
+		// The kernel's received count includes what it dropped
+		packets += s.KernelPacketsReceived + s.InterfacePacketsDropped
+		flows += s.FlowsSent + s.FlowsDroppedQueueFull + s.FlowsDroppedSpoolFull + s.FlowsDroppedSendFailed
+		pcapBytes += s.PCAPBytesSent + s.PCAPBytesDroppedQueueFull + s.PCAPBytesDroppedSpoolFull + s.PCAPBytesDroppedSendFailed
+	}
+
+	c := CaptureCompleteness{
+		Packets: keptShare(drops.KernelPackets+drops.InterfacePackets, packets),
+		Flows:   keptShare(drops.FlowsQueueFull+drops.FlowsSpoolFull+drops.FlowsSendFailed, flows),
+		PCAP:    keptShare(drops.PCAPBytesQueueFull+drops.PCAPBytesSpoolFull+drops.PCAPBytesSendFailed+drops.PCAPBytesBufferFull, pcapBytes),
+		Drops:   drops,
+	}
+	c.Overall = math.Min(c.Packets, math.Min(c.Flows, c.PCAP))
+	return c
+}
+
+// keptShare is the fraction of total that was not lost
+func keptShare(lost, total uint64) float64 {
+	if total == 0 || lost == 0 {
+		return 1
+	}
+	if lost >= total {
+		return 0
+	}
+	return 1 - float64(lost)/float64(total)
+}
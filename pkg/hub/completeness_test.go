@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol/pb"
+)
+
+func TestCaptureCompleteness_NothingLost(t *testing.T) {
+	c := captureCompleteness(nil)
+	if c.Overall != 1 || c.Packets != 1 || c.Flows != 1 || c.PCAP != 1 {
+		t.Errorf("completeness = %+v, want 1 everywhere without agents", c)
+	}
+
+	c = captureCompleteness([]AgentConnection{{Stats: AgentStats{KernelPacketsReceived: 500, FlowsSent: 20, PCAPBytesSent: 4096}}})
+	if c.Overall != 1 {
+		t.Errorf("Overall = %v, want 1", c.Overall)
+	}
+}
+
+func TestCaptureCompleteness_DropPoints(t *testing.T) {
+	agents := []AgentConnection{
+		{
+			Stats: AgentStats{
+				KernelPacketsReceived: 1000, KernelPacketsDropped: 100,
+				FlowsSent: 90, FlowsDroppedQueueFull: 10,
+				PCAPBytesSent: 800, PCAPBytesDroppedSendFailed: 200,
+			},
+			PCAPBytesDropped: 300,
+		},
+		{
+			Stats: AgentStats{
+				KernelPacketsReceived: 900, InterfacePacketsDropped: 100,
+				FlowsSent: 90, FlowsDroppedSpoolFull: 5, FlowsDroppedSendFailed: 5,
+				PCAPBytesSent: 900, PCAPBytesDroppedSpoolFull: 100,
+			},
+		},
+	}
+
+	c := captureCompleteness(agents)
+	want := CaptureDrops{
+		KernelPackets: 100, InterfacePackets: 100,
+		FlowsQueueFull: 10, FlowsSpoolFull: 5, FlowsSendFailed: 5,
+		PCAPBytesSpoolFull: 100, PCAPBytesSendFailed: 200, PCAPBytesBufferFull: 300,
+	}
+	if c.Drops != want {
+		t.Errorf("Drops = %+v, want %+v", c.Drops, want)
+	}
+
+	// 200 of 2000 packets, 20 of 200 flows, 600 of 2000 PCAP bytes
+	for name, got := range map[string][2]float64{
+		"packets": {c.Packets, 0.9},
+		"flows":   {c.Flows, 0.9},
+		"pcap":    {c.PCAP, 0.7},
+		"overall": {c.Overall, 0.7},
+	} {
+		if math.Abs(got[0]-got[1]) > 1e-9 {
+			t.Errorf("%s = %v, want %v", name, got[0], got[1])
+		}
+	}
+}
+
+func TestKeptShare(t *testing.T) {
+	tests := []struct {
+		lost, total uint64
+		want        float64
+	}{
+		{0, 0, 1},
+		{5, 0, 1},
+		{0, 10, 1},
+		{1, 4, 0.75},
+		{10, 10, 0},
+		{12, 10, 0}, // heartbeat counters lag the hub's own
+	}
+	for _, tt := range tests {
+		if got := keptShare(tt.lost, tt.total); got != tt.want {
+			t.Errorf("keptShare(%d, %d) = %v, want %v", tt.lost, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestAgentStatuses_IncludeHubDrops(t *testing.T) {
+	s := setupTestServer(t)
+	s.pcapBuffer.Close()
+	s.pcapBuffer = NewPCAPBuffer(t.TempDir(), 10)
+	defer s.pcapBuffer.Close()
+
+	gs := &GRPCServer{server: s, agents: make(map[string]*AgentConnection)}
+	s.agents = gs
+	gs.RegisterAgent(context.Background(), &pb.AgentInfo{Id: "agent-1", PodName: "api-0", Namespace: "prod"})
+	gs.Heartbeat(context.Background(), &pb.HeartbeatRequest{AgentId: "agent-1", Stats: &pb.AgentStats{PcapBytesSent: 200}})
+	s.AddPCAPData("agent-1", make([]byte, 50))
+
+	statuses := gs.AgentStatuses(time.Now())
+	if len(statuses) != 1 {
+		t.Fatalf("got %d agents, want 1", len(statuses))
+	}
+	if statuses[0].PCAPBytesDropped != 50 || statuses[0].Completeness.PCAP != 0.75 {
+		t.Errorf("agent = %+v, want 50 of 200 PCAP bytes dropped by the hub", statuses[0])
+	}
+
+	w := httptest.NewRecorder()
+	s.handleStats(w, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	var stats struct {
+		Completeness CaptureCompleteness `json:"completeness"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if stats.Completeness.Overall != 0.75 || stats.Completeness.Drops.PCAPBytesBufferFull != 50 {
+		t.Errorf("/api/stats completeness = %+v", stats.Completeness)
+	}
+}
@@ -0,0 +1,361 @@
+package hub
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const (
+	// MaxEndpoints bounds the endpoints tracked; the least recently called
+	// one makes room for a new one
+	MaxEndpoints = 2000
+	// endpointBucketWidth is the resolution the windows slide at
+	endpointBucketWidth = 10 * time.Second
+	// latencyGamma is the ratio between latency histogram bins, so
+	// percentiles are within about 2.5% of the true value
+	latencyGamma = 1.05
+)
+
+// EndpointWindows are the sliding windows RED metrics are reported over
+var EndpointWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// endpointBuckets covers the longest window
+var endpointBuckets = int(EndpointWindows[len(EndpointWindows)-1] / endpointBucketWidth)
+
+// EndpointMetrics keeps rate, errors and duration (RED) for each endpoint,
+// grouped by service, method and path template
+type EndpointMetrics struct {
+	mutex     sync.Mutex
+	endpoints map[endpointKey]*endpointSeries
+}
+
+// EndpointStats is one endpoint's metrics over each window
+type EndpointStats struct {
+	Service string                 `json:"service"`
+	Method  string                 `json:"method"`
+	Path    string                 `json:"path"`
+	Windows map[string]WindowStats `json:"windows"`
+}
+
+// WindowStats is what one endpoint did within a window
+type WindowStats struct {
+	Requests   uint64               `json:"requests"`
+	Rate       float64              `json:"rate"` // requests per second
+	Errors     uint64               `json:"errors"`
+	ErrorRatio float64              `json:"errorRatio"`
+	LatencyMs  *EndpointPercentiles `json:"latencyMs,omitempty"`
+}
+
+// EndpointPercentiles summarizes request latency within a window
+type EndpointPercentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+type endpointKey struct {
+	service, method, path string
+}
+
+// endpointSeries is a ring of time buckets for one endpoint
+type endpointSeries struct {
+	buckets  []endpointBucket
+	lastSeen time.Time
+}
+
+type endpointBucket struct {
+	slot      int64 // bucket number since the epoch, tells stale buckets apart
+	requests  uint64
+	errors    uint64
+	latencies map[int]uint64 // latency histogram, see latencyBin
+}
+
+// NewEndpointMetrics creates an empty set of endpoint metrics
+func NewEndpointMetrics() *EndpointMetrics {
+	return &EndpointMetrics{
+		endpoints: make(map[endpointKey]*endpointSeries),
+	}
+}
+
+// add counts the requests an update brings
+func (m *EndpointMetrics) add(u *flowUpdate, now time.Time) {
+	if len(u.exchanges) == 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	service := endpointService(u.flow)
+	for _, ex := range u.exchanges {
+		if ex.Method == "" {
+			continue
+		}
+		key := endpointKey{service: service, method: ex.Method, path: TemplatePath(ex.URL)}
+		m.seriesFor(key).add(now, ex.DurationMs, exchangeFailed(ex))
+	}
+}
+
+// seriesFor returns an endpoint's series, creating it as needed. The
+// caller holds m.mutex.
+func (m *EndpointMetrics) seriesFor(key endpointKey) *endpointSeries {
+	if s, ok := m.endpoints[key]; ok {
+		return s
+	}
+	if len(m.endpoints) >= MaxEndpoints {
+		var oldest endpointKey
+		var found bool
+		for k, s := range m.endpoints {
+			if !found || s.lastSeen.Before(m.endpoints[oldest].lastSeen) {
+				oldest, found = k, true
+			}
+		}
+		delete(m.endpoints, oldest)
+	}
+
+	s := &endpointSeries{buckets: make([]endpointBucket, endpointBuckets)}
+	m.endpoints[key] = s
+	return s
+}
+
+// add counts one request in the bucket for now
+func (s *endpointSeries) add(now time.Time, latencyMs float64, failed bool) {
+	slot := now.UnixNano() / int64(endpointBucketWidth)
+	b := &s.buckets[slot%int64(len(s.buckets))]
+	if b.slot > slot {
+		// Older than the longest window, e.g. a flow restored after a restart
+		return
+	}
+	if b.slot != slot {
+		*b = endpointBucket{slot: slot}
+	}
+
+	b.requests++
+	if failed {
+		b.errors++
+	}
+	if latencyMs > 0 {
+		if b.latencies == nil {
+			b.latencies = make(map[int]uint64)
+		}
+		b.latencies[latencyBin(latencyMs)]++
+	}
+	if now.After(s.lastSeen) {
+		s.lastSeen = now
+	}
+}
+
+// window sums the buckets that fall within window of now
+func (s *endpointSeries) window(now time.Time, window time.Duration) WindowStats {
+	slot := now.UnixNano() / int64(endpointBucketWidth)
+	oldest := slot - int64(window/endpointBucketWidth) + 1
+
+	var stats WindowStats
+	latencies := make(map[int]uint64)
+	for _, b := range s.buckets {
+		if b.slot < oldest || b.slot > slot {
+			continue
+		}
+		stats.Requests += b.requests
+		stats.Errors += b.errors
+		for bin, n := range b.latencies {
+			latencies[bin] += n
+		}
+	}
+
+	stats.Rate = float64(stats.Requests) / window.Seconds()
+	if stats.Requests > 0 {
+		stats.ErrorRatio = float64(stats.Errors) / float64(stats.Requests)
+	}
+	if len(latencies) > 0 {
+		stats.LatencyMs = &EndpointPercentiles{
+			P50: histogramPercentile(latencies, 50),
+			P90: histogramPercentile(latencies, 90),
+			P99: histogramPercentile(latencies, 99),
+		}
+	}
+	return stats
+}
+
+// Snapshot returns the endpoints called within the longest window, ordered
+// by service, path and method
+func (m *EndpointMetrics) Snapshot(now time.Time) []EndpointStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	longest := EndpointWindows[len(EndpointWindows)-1]
+	out := make([]EndpointStats, 0, len(m.endpoints))
+	for key, s := range m.endpoints {
+		if now.Sub(s.lastSeen) >= longest {
+			continue
+		}
+		stats := EndpointStats{
+			Service: key.service,
+			Method:  key.method,
+			Path:    key.path,
+			Windows: make(map[string]WindowStats, len(EndpointWindows)),
+		}
+		for _, w := range EndpointWindows {
+			stats.Windows[windowLabel(w)] = s.window(now, w)
+		}
+		out = append(out, stats)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Method < b.Method
+	})
+	return out
+}
+
+// windowLabel names a window the way the API reports it, e.g. "5m"
+func windowLabel(w time.Duration) string {
+	return fmt.Sprintf("%dm", int(w.Minutes()))
+}
+
+// latencyBin places a latency in a log-scale histogram bin. Bin i holds
+// values in (gamma^(i-1), gamma^i].
+func latencyBin(ms float64) int {
+	return int(math.Ceil(math.Log(ms) / math.Log(latencyGamma)))
+}
+
+// histogramPercentile returns the nearest-rank percentile of a latency
+// histogram, as the midpoint of its bin
+func histogramPercentile(hist map[int]uint64, p int) float64 {
+	bins := make([]int, 0, len(hist))
+	var total uint64
+	for bin, n := range hist {
+		bins = append(bins, bin)
+		total += n
+	}
+	sort.Ints(bins)
+
+	rank := (uint64(p)*total + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for _, bin := range bins {
+		seen += hist[bin]
+		if seen >= rank {
+			return 2 * math.Pow(latencyGamma, float64(bin)) / (latencyGamma + 1)
+		}
+	}
+	return 0
+}
+
+// endpointService names what a request was sent to: its service, else the
+// workload or host behind the address
+func endpointService(f *protocol.Flow) string {
+	switch {
+	case f.DstService != "":
+		return f.DstService
+	case f.DstWorkload != "":
+		return f.DstNamespace + "/" + f.DstWorkload
+	case f.DstName != "":
+		return f.DstName
+	case len(f.HTTPExchanges) > 0 && f.HTTPExchanges[0].Host != "":
+		return hostWithoutPort(f.HTTPExchanges[0].Host)
+	default:
+		return net.JoinHostPort(f.DstIP, strconv.Itoa(int(f.DstPort)))
+	}
+}
+
+// hostWithoutPort strips the port from an HTTP Host header
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// TemplatePath drops the query from a request path and replaces segments
+// that look like identifiers with {id}, so /users/123?full=1 and
+// /users/456 are the same endpoint
+func TemplatePath(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	if url == "" {
+		return "/"
+	}
+
+	segments := strings.Split(url, "/")
+	for i, seg := range segments {
+		if isIdentifier(seg) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIdentifier reports whether a path segment is a number, a UUID, or a
+// long token mixing digits with letters, such as a hash or object ID
+func isIdentifier(seg string) bool {
+	if seg == "" {
+		return false
+	}
+
+	var digits, letters, dashes, other int
+	hex := true
+	for _, c := range seg {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F':
+			letters++
+		case c >= 'g' && c <= 'z' || c >= 'G' && c <= 'Z':
+			letters++
+			hex = false
+		case c == '-' || c == '_':
+			dashes++
+			hex = false
+		default:
+			other++
+		}
+	}
+
+	switch {
+	case other > 0:
+		return false
+	case digits == len(seg):
+		return true
+	case len(seg) == 36 && dashes == 4 && isUUID(seg):
+		return true
+	case hex && digits > 0 && len(seg) >= 12:
+		return true
+	default:
+		return digits > 0 && letters > 0 && len(seg) >= 20
+	}
+}
+
+// isUUID reports whether s is in the 8-4-4-4-12 hex form
+func isUUID(s string) bool {
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package hub
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+func request(method, url string, status int, durationMs float64) *protocol.HTTPExchange {
+	return &protocol.HTTPExchange{
+		HTTPInfo:   protocol.HTTPInfo{Method: method, URL: url, StatusCode: status},
+		DurationMs: durationMs,
+	}
+}
+
+// findEndpoint returns the stats for one endpoint, failing if it is missing
+func findEndpoint(t *testing.T, endpoints []EndpointStats, method, path string) EndpointStats {
+	t.Helper()
+	for _, e := range endpoints {
+		if e.Method == method && e.Path == path {
+			return e
+		}
+	}
+	t.Fatalf("no %s %s in %+v", method, path, endpoints)
+	return EndpointStats{}
+}
+
+func TestTemplatePath(t *testing.T) {
+	for url, want := range map[string]string{
+		"/users/123":                                        "/users/{id}",
+		"/users/123/orders/456?expand=items":                "/users/{id}/orders/{id}",
+		"/orders/3f2b8c1e-9a4d-4e6f-8b2a-1c3d5e7f9a0b":      "/orders/{id}",
+		"/commits/9fceb02d0ae598e95dc970b74767f19372d61af8": "/commits/{id}",
+		"/objects/507f1f77bcf86cd799439011":                 "/objects/{id}",
+		"/files/aB3dE5fG7hJ9kL1mN3pQ5r":                     "/files/{id}",
+		"/api/v1/users":                                     "/api/v1/users",
+		"/reports/2024-01-15":                               "/reports/2024-01-15",
+		"/static/app.3f2b8c1e.js":                           "/static/app.3f2b8c1e.js",
+		"/pkg.Greeter/SayHello":                             "/pkg.Greeter/SayHello",
+		"/":                                                 "/",
+		"":                                                  "/",
+		"?q=1":                                              "/",
+	} {
+		if got := TemplatePath(url); got != want {
+			t.Errorf("TemplatePath(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestEndpointMetrics_GroupsByTemplate(t *testing.T) {
+	m := NewEndpointMetrics()
+	flows := newFlowTracker(m)
+	now := time.Now()
+
+	flows.add(webToAPI("f1", protocol.StatusClosed,
+		request("GET", "/users/1", 200, 10),
+		request("GET", "/users/2?full=1", 200, 20),
+		request("POST", "/users", 201, 30),
+		request("GET", "/users/3", 500, 40),
+	), now)
+
+	endpoints := m.Snapshot(now)
+	if len(endpoints) != 2 {
+		t.Fatalf("got %d endpoints, want 2: %+v", len(endpoints), endpoints)
+	}
+
+	get := findEndpoint(t, endpoints, "GET", "/users/{id}")
+	if get.Service != "api.prod.svc" {
+		t.Errorf("Service = %q, want api.prod.svc", get.Service)
+	}
+	minute := get.Windows["1m"]
+	if minute.Requests != 3 || minute.Errors != 1 || math.Abs(minute.ErrorRatio-1.0/3) > 1e-9 {
+		t.Errorf("1m = %+v, want 3 requests with 1 error", minute)
+	}
+	if math.Abs(minute.Rate-3.0/60) > 1e-9 {
+		t.Errorf("Rate = %v, want %v", minute.Rate, 3.0/60)
+	}
+	if findEndpoint(t, endpoints, "POST", "/users").Windows["15m"].Requests != 1 {
+		t.Error("POST /users should have one request")
+	}
+}
+
+func TestEndpointMetrics_SlidingWindows(t *testing.T) {
+	m := NewEndpointMetrics()
+	flows := newFlowTracker(m)
+	now := time.Now()
+
+	flows.add(webToAPI("old", protocol.StatusClosed, request("GET", "/health", 200, 1)), now.Add(-10*time.Minute))
+	flows.add(webToAPI("mid", protocol.StatusClosed, request("GET", "/health", 200, 1)), now.Add(-3*time.Minute))
+	flows.add(webToAPI("new", protocol.StatusClosed, request("GET", "/health", 200, 1)), now)
+
+	windows := findEndpoint(t, m.Snapshot(now), "GET", "/health").Windows
+	for label, want := range map[string]uint64{"1m": 1, "5m": 2, "15m": 3} {
+		if windows[label].Requests != want {
+			t.Errorf("%s requests = %d, want %d", label, windows[label].Requests, want)
+		}
+	}
+
+	// Once nothing is left in the longest window the endpoint is not listed
+	if got := m.Snapshot(now.Add(16 * time.Minute)); len(got) != 0 {
+		t.Errorf("Snapshot after 16m = %+v, want none", got)
+	}
+}
+
+func TestEndpointMetrics_LatencyPercentiles(t *testing.T) {
+	m := NewEndpointMetrics()
+	flows := newFlowTracker(m)
+	now := time.Now()
+
+	var exchanges []*protocol.HTTPExchange
+	for i := 1; i <= 100; i++ {
+		exchanges = append(exchanges, request("GET", "/items/7", 200, float64(i)))
+	}
+	flows.add(webToAPI("f1", protocol.StatusClosed, exchanges...), now)
+
+	latency := findEndpoint(t, m.Snapshot(now), "GET", "/items/{id}").Windows["5m"].LatencyMs
+	if latency == nil {
+		t.Fatal("no latency percentiles")
+	}
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{{"p50", latency.P50, 50}, {"p90", latency.P90, 90}, {"p99", latency.P99, 99}} {
+		if math.Abs(c.got-c.want)/c.want > 0.03 {
+			t.Errorf("%s = %v, want %v within 3%%", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestEndpointMetrics_CountsOpenFlowsOnce(t *testing.T) {
+	m := NewEndpointMetrics()
+	flows := newFlowTracker(m)
+	now := time.Now()
+
+	flows.add(webToAPI("f1", protocol.StatusOpen, request("GET", "/a", 200, 5), request("GET", "/a", 0, 0)), now)
+	flows.add(webToAPI("f1", protocol.StatusOpen, request("GET", "/a", 200, 5), request("GET", "/a", 502, 9)), now)
+	flows.add(webToAPI("f1", protocol.StatusClosed, request("GET", "/a", 200, 5), request("GET", "/a", 502, 9)), now)
+
+	stats := findEndpoint(t, m.Snapshot(now), "GET", "/a").Windows["1m"]
+	if stats.Requests != 2 || stats.Errors != 1 {
+		t.Errorf("requests/errors = %d/%d, want 2/1", stats.Requests, stats.Errors)
+	}
+	if len(flows.open) != 0 {
+		t.Errorf("%d flows still tracked as open", len(flows.open))
+	}
+}
+
+func TestEndpointService(t *testing.T) {
+	tests := []struct {
+		name string
+		flow *protocol.Flow
+		want string
+	}{
+		{"service", &protocol.Flow{DstService: "api.prod.svc", DstWorkload: "Deployment/api"}, "api.prod.svc"},
+		{"workload", &protocol.Flow{DstNamespace: "prod", DstWorkload: "StatefulSet/db"}, "prod/StatefulSet/db"},
+		{"resolved name", &protocol.Flow{DstName: "example.com"}, "example.com"},
+		{"Host header", &protocol.Flow{HTTPExchanges: []*protocol.HTTPExchange{{HTTPInfo: protocol.HTTPInfo{Host: "example.org:8080"}}}}, "example.org"},
+		{"address", &protocol.Flow{DstIP: "10.0.0.9", DstPort: 8080}, "10.0.0.9:8080"},
+	}
+	for _, tt := range tests {
+		if got := endpointService(tt.flow); got != tt.want {
+			t.Errorf("%s: endpointService = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleEndpointMetrics(t *testing.T) {
+	s := setupTestServer(t)
+	s.AddFlow(webToAPI("f1", protocol.StatusClosed, request("GET", "/users/42", 200, 8)))
+	other := webToAPI("f2", protocol.StatusClosed, request("GET", "/", 200, 3))
+	other.DstService = "web.prod.svc"
+	s.AddFlow(other)
+
+	w := httptest.NewRecorder()
+	s.handleEndpointMetrics(w, httptest.NewRequest(http.MethodGet, "/api/metrics/endpoints?service=api.prod.svc", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp struct {
+		Windows   []string        `json:"windows"`
+		Endpoints []EndpointStats `json:"endpoints"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Windows) != 3 || resp.Windows[0] != "1m" || resp.Windows[2] != "15m" {
+		t.Errorf("windows = %v, want 1m, 5m, 15m", resp.Windows)
+	}
+	if len(resp.Endpoints) != 1 || resp.Endpoints[0].Path != "/users/{id}" || resp.Endpoints[0].Windows["1m"].Requests != 1 {
+		t.Errorf("endpoints = %+v, want GET /users/{id} on api only", resp.Endpoints)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleEndpointMetrics(w, httptest.NewRequest(http.MethodDelete, "/api/metrics/endpoints", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE status = %d, want 405", w.Code)
+	}
+}
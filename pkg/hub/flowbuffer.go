@@ -8,6 +8,10 @@ import (
 	"github.com/podscope/podscope/pkg/protocol"
 )
 
+// MaxStoredExchanges bounds the HTTP exchanges kept for one flow as its
+// snapshots are merged; the oldest make room for new ones
+const MaxStoredExchanges = 256
+
 // FlowRingBuffer is a fixed-size circular buffer for storing flows.
 // It provides O(1) insertion with automatic eviction of oldest flows when full.
 type FlowRingBuffer struct {
@@ -17,6 +21,7 @@ type FlowRingBuffer struct {
 	size     int // Current number of elements
 	mutex    sync.RWMutex
 	index    map[string]int // flow.ID -> position for O(1) updates
+	evicted  uint64         // flows dropped to make room, kept across Clear
 }
 
 // NewFlowRingBuffer creates a new ring buffer with the specified capacity.
@@ -51,6 +56,7 @@ func (r *FlowRingBuffer) Add(flow *protocol.Flow) bool {
 		evicted := r.flows[r.head]
 		if evicted != nil {
 			delete(r.index, evicted.ID)
+			r.evicted++
 		}
 	}
 
@@ -123,6 +129,13 @@ func (r *FlowRingBuffer) Capacity() int {
 	return r.capacity
 }
 
+// Evicted returns how many flows have been dropped to make room for newer ones.
+func (r *FlowRingBuffer) Evicted() uint64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.evicted
+}
+
 // Get retrieves a flow by ID. Returns nil if not found.
 func (r *FlowRingBuffer) Get(id string) *protocol.Flow {
 	r.mutex.RLock()
@@ -134,6 +147,29 @@ func (r *FlowRingBuffer) Get(id string) *protocol.Flow {
 	return nil
 }
 
+// mergeExchanges completes a snapshot of an open flow, which only lists the
+// exchanges new since the last one, with those already stored in prev
+func mergeExchanges(f, prev *protocol.Flow) {
+	if prev == nil || f.ExchangeOffset <= prev.ExchangeOffset {
+		return
+	}
+	// Exchanges the agent dropped in between leave a gap, start over after it
+	keep := f.ExchangeOffset - prev.ExchangeOffset
+	if keep > len(prev.HTTPExchanges) {
+		return
+	}
+
+	merged := make([]*protocol.HTTPExchange, 0, keep+len(f.HTTPExchanges))
+	merged = append(merged, prev.HTTPExchanges[:keep]...)
+	merged = append(merged, f.HTTPExchanges...)
+	offset := prev.ExchangeOffset
+	if excess := len(merged) - MaxStoredExchanges; excess > 0 {
+		merged = merged[excess:]
+		offset += excess
+	}
+	f.HTTPExchanges, f.ExchangeOffset = merged, offset
+}
+
 // Clear removes all flows from the buffer.
 func (r *FlowRingBuffer) Clear() {
 	r.mutex.Lock()
@@ -1,6 +1,7 @@
 package hub
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
@@ -275,6 +276,10 @@ func TestAdd_MultipleEvictions(t *testing.T) {
 			t.Errorf("unexpected flow ID %s in buffer", f.ID)
 		}
 	}
+
+	if rb.Evicted() != 7 {
+		t.Errorf("expected 7 evictions, got %d", rb.Evicted())
+	}
 }
 
 // Tests for US-003: FlowRingBuffer retrieval methods
@@ -711,3 +716,53 @@ func TestClear_AfterWrapAround(t *testing.T) {
 		t.Error("expected to retrieve flow added after Clear()")
 	}
 }
+
+// TestMergeExchanges tests that a snapshot listing only new exchanges is
+// completed with the stored ones
+func TestMergeExchanges(t *testing.T) {
+	urls := func(f *protocol.Flow) []string {
+		var out []string
+		for _, ex := range f.HTTPExchanges {
+			out = append(out, ex.URL)
+		}
+		return out
+	}
+	withExchanges := func(offset int, urls ...string) *protocol.Flow {
+		f := &protocol.Flow{ID: "f1", Status: protocol.StatusOpen, ExchangeOffset: offset}
+		for _, url := range urls {
+			f.HTTPExchanges = append(f.HTTPExchanges, &protocol.HTTPExchange{HTTPInfo: protocol.HTTPInfo{URL: url}})
+		}
+		return f
+	}
+
+	tests := []struct {
+		name       string
+		prev, next *protocol.Flow
+		want       []string
+		wantOffset int
+	}{
+		{"first snapshot", nil, withExchanges(0, "/a"), []string{"/a"}, 0},
+		{"new exchanges appended", withExchanges(0, "/a", "/b"), withExchanges(1, "/b", "/c"), []string{"/a", "/b", "/c"}, 0},
+		{"full listing", withExchanges(0, "/a"), withExchanges(0, "/a", "/b"), []string{"/a", "/b"}, 0},
+		{"gap from dropped exchanges", withExchanges(0, "/a"), withExchanges(5, "/f"), []string{"/f"}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergeExchanges(tt.next, tt.prev)
+			if got := urls(tt.next); fmt.Sprint(got) != fmt.Sprint(tt.want) || tt.next.ExchangeOffset != tt.wantOffset {
+				t.Errorf("merged = %v from %d, want %v from %d", got, tt.next.ExchangeOffset, tt.want, tt.wantOffset)
+			}
+		})
+	}
+
+	// The oldest go once a flow has more than the hub keeps
+	prev := withExchanges(0)
+	for i := 0; i < MaxStoredExchanges; i++ {
+		prev.HTTPExchanges = append(prev.HTTPExchanges, &protocol.HTTPExchange{})
+	}
+	next := withExchanges(MaxStoredExchanges, "/new")
+	mergeExchanges(next, prev)
+	if len(next.HTTPExchanges) != MaxStoredExchanges || next.ExchangeOffset != 1 || next.HTTPExchanges[MaxStoredExchanges-1].URL != "/new" {
+		t.Errorf("merged %d exchanges from %d, want %d from 1 ending in /new", len(next.HTTPExchanges), next.ExchangeOffset, MaxStoredExchanges)
+	}
+}
@@ -0,0 +1,228 @@
+package hub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const (
+	// flowStoreFile is the name of the flow store within the PCAP directory
+	flowStoreFile = "flows.jsonl"
+	// flowStoreCompactFactor bounds the store: once it holds this many lines
+	// per flow the buffer can keep, it is rewritten from the buffer
+	flowStoreCompactFactor = 4
+	// flowStoreQueueSize is how many flows may wait to be written. A flow
+	// that finds the queue full is not waited for: the store is compacted
+	// once the queue drains, which writes it from the buffer.
+	flowStoreQueueSize = 4096
+)
+
+// FlowStore persists flows as JSON Lines next to the PCAP files, so a hub
+// restart does not lose what was captured so far. Every snapshot of a flow
+// is appended and the last one wins when the store is read back. Writes
+// and compaction happen on a goroutine of their own, so adding a flow never
+// waits for the disk.
+type FlowStore struct {
+	path     string
+	flows    *FlowRingBuffer
+	maxLines int
+
+	queue     chan []byte
+	skipped   atomic.Bool // a flow found the queue full
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan error // the writer's last error, once it has stopped
+
+	// Owned by the writer
+	file  *os.File
+	lines int // lines in the file, including superseded snapshots
+}
+
+// OpenFlowStore loads the flows stored at path into flows, then keeps
+// appending to it. The file is compacted on open, which also drops a line
+// left half-written by a crash.
+func OpenFlowStore(path string, flows *FlowRingBuffer) (*FlowStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create flow store directory: %w", err)
+	}
+
+	s := &FlowStore{
+		path:     path,
+		flows:    flows,
+		maxLines: flowStoreCompactFactor * flows.Capacity(),
+		queue:    make(chan []byte, flowStoreQueueSize),
+		closing:  make(chan struct{}),
+		done:     make(chan error, 1),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	go s.writeLoop()
+	return s, nil
+}
+
+// load adds the stored flows to the buffer, oldest first
+func (s *FlowStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open flow store: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	skipped := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var flow protocol.Flow
+			if jsonErr := json.Unmarshal(line, &flow); jsonErr != nil || flow.ID == "" {
+				skipped++
+			} else {
+				s.flows.Add(&flow)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read flow store: %w", err)
+		}
+	}
+
+	if skipped > 0 {
+		log.Printf("Skipped %d unreadable lines in %s", skipped, s.path)
+	}
+	return nil
+}
+
+// Append queues a flow to be written. The flow must already be in the
+// buffer, so a compaction that runs first includes it.
+func (s *FlowStore) Append(flow *protocol.Flow) error {
+	line, err := json.Marshal(flow)
+	if err != nil {
+		return fmt.Errorf("failed to encode flow: %w", err)
+	}
+	line = append(line, '\n')
+
+	select {
+	case <-s.closing:
+		return fmt.Errorf("flow store is closed")
+	default:
+	}
+	select {
+	case s.queue <- line:
+	default:
+		s.skipped.Store(true)
+	}
+	return nil
+}
+
+// writeLoop writes queued flows until the store is closed, compacting it
+// when it has grown too large or a flow was skipped
+func (s *FlowStore) writeLoop() {
+	for {
+		select {
+		case line := <-s.queue:
+			if err := s.write(line); err != nil {
+				log.Printf("Failed to persist flows: %v", err)
+			}
+		case <-s.closing:
+			var err error
+			for len(s.queue) > 0 && err == nil {
+				err = s.write(<-s.queue)
+			}
+			if closeErr := s.file.Close(); err == nil {
+				err = closeErr
+			}
+			s.done <- err
+			return
+		}
+	}
+}
+
+// write appends one line, then compacts if due
+func (s *FlowStore) write(line []byte) error {
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write flow store: %w", err)
+	}
+	s.lines++
+
+	if s.lines > s.maxLines || len(s.queue) == 0 && s.skipped.Swap(false) {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact rewrites the store with the flows still in the buffer. Flows are
+// queued after they are added to the buffer, so one added concurrently is
+// either in the rewrite or appended after it.
+func (s *FlowStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create flow store: %w", err)
+	}
+
+	flows := s.flows.GetAll()
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, flow := range flows {
+		if err = enc.Encode(flow); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write flow store: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace flow store: %w", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open flow store: %w", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.lines = len(flows)
+	return nil
+}
+
+// Close writes the flows still queued and closes the store; later appends
+// fail
+func (s *FlowStore) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		err = <-s.done
+	})
+	return err
+}
@@ -0,0 +1,272 @@
+package hub
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// countLines returns the number of lines in a file
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	n := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestFlowStore_RestoresFlowsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), flowStoreFile)
+
+	flows := NewFlowRingBuffer(10)
+	store, err := OpenFlowStore(path, flows)
+	if err != nil {
+		t.Fatalf("OpenFlowStore: %v", err)
+	}
+	for _, f := range []*protocol.Flow{
+		{ID: "a", Status: protocol.StatusOpen, BytesSent: 10},
+		{ID: "b", Status: protocol.StatusClosed},
+		{ID: "a", Status: protocol.StatusClosed, BytesSent: 50},
+	} {
+		flows.Add(f)
+		if err := store.Append(f); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	store.Close()
+
+	restored := NewFlowRingBuffer(10)
+	store, err = OpenFlowStore(path, restored)
+	if err != nil {
+		t.Fatalf("OpenFlowStore after restart: %v", err)
+	}
+	defer store.Close()
+
+	got := restored.GetAll()
+	if len(got) != 2 || got[0].ID != "a" || got[1].ID != "b" {
+		t.Fatalf("restored %+v, want flows a and b in order", got)
+	}
+	if got[0].Status != protocol.StatusClosed || got[0].BytesSent != 50 {
+		t.Errorf("flow a = %+v, want its last snapshot", got[0])
+	}
+	if n := countLines(t, path); n != 2 {
+		t.Errorf("store has %d lines after open, want 2", n)
+	}
+}
+
+func TestFlowStore_SkipsTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), flowStoreFile)
+	data := `{"id":"a","status":"CLOSED"}` + "\n" + `{"id":"b","sta`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	flows := NewFlowRingBuffer(10)
+	store, err := OpenFlowStore(path, flows)
+	if err != nil {
+		t.Fatalf("OpenFlowStore: %v", err)
+	}
+	defer store.Close()
+
+	if flows.Size() != 1 || flows.Get("a") == nil {
+		t.Fatalf("restored %+v, want only flow a", flows.GetAll())
+	}
+
+	// The half-written line is gone, so new flows start on a line of their own
+	c := &protocol.Flow{ID: "c"}
+	flows.Add(c)
+	if err := store.Append(c); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	store.Close()
+
+	reopened := NewFlowRingBuffer(10)
+	store2, err := OpenFlowStore(path, reopened)
+	if err != nil {
+		t.Fatalf("OpenFlowStore: %v", err)
+	}
+	defer store2.Close()
+	if reopened.Size() != 2 || reopened.Get("c") == nil {
+		t.Errorf("restored %+v, want flows a and c", reopened.GetAll())
+	}
+}
+
+func TestFlowStore_CompactsToBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), flowStoreFile)
+
+	flows := NewFlowRingBuffer(2)
+	store, err := OpenFlowStore(path, flows)
+	if err != nil {
+		t.Fatalf("OpenFlowStore: %v", err)
+	}
+	defer store.Close()
+
+	// Snapshots of one flow, then flows that evict it from the buffer
+	for i := 0; i < flowStoreCompactFactor*2; i++ {
+		f := &protocol.Flow{ID: "a"}
+		flows.Add(f)
+		store.Append(f)
+	}
+	for _, id := range []string{"b", "c"} {
+		f := &protocol.Flow{ID: id}
+		flows.Add(f)
+		store.Append(f)
+	}
+
+	store.Close()
+
+	if n := countLines(t, path); n > flowStoreCompactFactor*flows.Capacity() {
+		t.Errorf("store has %d lines, want it compacted", n)
+	}
+
+	restored := NewFlowRingBuffer(2)
+	store2, err := OpenFlowStore(path, restored)
+	if err != nil {
+		t.Fatalf("OpenFlowStore: %v", err)
+	}
+	defer store2.Close()
+	if restored.Get("a") != nil || restored.Get("b") == nil || restored.Get("c") == nil {
+		t.Errorf("restored %+v, want flows b and c", restored.GetAll())
+	}
+}
+
+func TestFlowStore_WritesSkippedFlowsOnceQueueDrains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), flowStoreFile)
+
+	flows := NewFlowRingBuffer(10)
+	store, err := OpenFlowStore(path, flows)
+	if err != nil {
+		t.Fatalf("OpenFlowStore: %v", err)
+	}
+
+	// Flow a found the queue full, flow b was queued after it
+	flows.Add(&protocol.Flow{ID: "a"})
+	store.skipped.Store(true)
+	b := &protocol.Flow{ID: "b"}
+	flows.Add(b)
+	store.Append(b)
+	store.Close()
+
+	restored := NewFlowRingBuffer(10)
+	store2, err := OpenFlowStore(path, restored)
+	if err != nil {
+		t.Fatalf("OpenFlowStore: %v", err)
+	}
+	defer store2.Close()
+	if restored.Get("a") == nil || restored.Get("b") == nil {
+		t.Errorf("restored %+v, want flows a and b", restored.GetAll())
+	}
+}
+
+func TestFlowStore_AddFlowPersists(t *testing.T) {
+	s := setupTestServer(t)
+	defer s.pcapBuffer.Close()
+
+	path := filepath.Join(s.pcapDir, flowStoreFile)
+	store, err := OpenFlowStore(path, s.flowBuffer)
+	if err != nil {
+		t.Fatalf("OpenFlowStore: %v", err)
+	}
+	s.flowStore = store
+
+	s.AddFlow(&protocol.Flow{ID: "a", Status: protocol.StatusClosed})
+	store.Close()
+
+	if n := countLines(t, path); n != 1 {
+		t.Errorf("store has %d lines, want 1", n)
+	}
+}
+
+// TestServer_RestartKeepsFlowPCAP tests that a flow restored after a restart
+// can still be downloaded with its packets, including ones written since
+func TestServer_RestartKeepsFlowPCAP(t *testing.T) {
+	s := setupTestServer(t)
+	s.openFlowStore()
+
+	start := time.Now().Truncate(time.Millisecond)
+	s.AddFlow(&protocol.Flow{
+		ID:        "flow-1",
+		Timestamp: start,
+		SrcIP:     "10.0.0.1",
+		SrcPort:   40000,
+		DstIP:     "10.0.0.2",
+		DstPort:   80,
+		Status:    protocol.StatusOpen,
+	})
+	writeAgentPacket(t, s.pcapBuffer, "agent-a", buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80), start)
+	writeAgentPacket(t, s.pcapBuffer, "agent-a", buildTCPPacket(t, "10.0.0.2", 80, "10.0.0.1", 40000), start.Add(time.Millisecond))
+	s.flowStore.Close()
+	s.pcapBuffer.Close()
+
+	restarted := setupTestServer(t)
+	restarted.pcapBuffer.Close()
+	restarted.pcapDir = s.pcapDir
+	restarted.pcapBuffer = NewPCAPBuffer(s.pcapDir, 1024*1024)
+	defer restarted.pcapBuffer.Close()
+	restarted.openFlowStore()
+	defer restarted.flowStore.Close()
+
+	// The agent re-registers with the same ID and keeps streaming
+	writeAgentPacket(t, restarted.pcapBuffer, "agent-a", buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80), start.Add(2*time.Millisecond))
+
+	w := httptest.NewRecorder()
+	restarted.handleDownloadStreamPCAP(w, httptest.NewRequest(http.MethodGet, "/api/pcap/flow-1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := countPCAPRecords(t, w.Body.Bytes()); got != 3 {
+		t.Errorf("record count = %d, want 3", got)
+	}
+}
+
+// TestServer_RestartSeedsAggregators tests that flows restored after a
+// restart are placed at their own time and not counted again when their
+// snapshots resume
+func TestServer_RestartSeedsAggregators(t *testing.T) {
+	s := setupTestServer(t)
+	s.openFlowStore()
+
+	open := webToAPI("f1", protocol.StatusOpen, request("GET", "/a", 200, 5), request("GET", "/a", 500, 9))
+	open.Timestamp = time.Now().Add(-10 * time.Minute)
+	open.Duration = 1000
+	s.AddFlow(open)
+	s.flowStore.Close()
+
+	restarted := setupTestServer(t)
+	restarted.pcapDir = s.pcapDir
+	restarted.openFlowStore()
+	defer restarted.flowStore.Close()
+
+	windows := findEndpoint(t, restarted.endpoints.Snapshot(time.Now()), "GET", "/a").Windows
+	if windows["1m"].Requests != 0 || windows["15m"].Requests != 2 {
+		t.Errorf("restored requests in 1m/15m = %d/%d, want 0/2", windows["1m"].Requests, windows["15m"].Requests)
+	}
+
+	next := webToAPI("f1", protocol.StatusOpen, request("GET", "/a", 200, 7))
+	next.ExchangeOffset = 2
+	restarted.AddFlow(next)
+
+	windows = findEndpoint(t, restarted.endpoints.Snapshot(time.Now()), "GET", "/a").Windows
+	if windows["1m"].Requests != 1 || windows["15m"].Requests != 3 {
+		t.Errorf("requests in 1m/15m = %d/%d, want 1/3", windows["1m"].Requests, windows["15m"].Requests)
+	}
+	if edge := onlyEdge(t, restarted.graph); edge.Requests != 3 {
+		t.Errorf("graph requests = %d, want 3", edge.Requests)
+	}
+	if got := restarted.metrics.requests; got[200] != 1 || got[500] != 0 {
+		t.Errorf("request counters = %v, want only the new 200", got)
+	}
+}
@@ -0,0 +1,183 @@
+package hub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const (
+	// openFlowTTL forgets an open flow that stopped sending snapshots, e.g.
+	// because its agent went away
+	openFlowTTL = 30 * time.Minute
+	// finishedFlowMemory is how many ended flows are remembered, so one an
+	// agent sends again after its delivery went unconfirmed is recognised.
+	// Agents replay at most a batch of their most recent flows.
+	finishedFlowMemory = 10000
+)
+
+// flowTracker follows flows across the snapshots agents send while they
+// are open, and hands each snapshot to the aggregators as what it adds to
+// the last one, so every exchange and byte is counted once
+type flowTracker struct {
+	mutex     sync.Mutex
+	consumers []flowConsumer
+	open      map[string]*flowProgress // flows still receiving snapshots, by ID
+	pruned    time.Time
+
+	finished      map[string]bool // recently ended flows, by ID
+	finishedOrder []string        // ring of the IDs in finished, oldest at nextFinished
+	nextFinished  int
+}
+
+// flowConsumer aggregates what flows add as they are tracked
+type flowConsumer interface {
+	add(u *flowUpdate, now time.Time)
+}
+
+// flowProgress is how much of an open flow has been handed on
+type flowProgress struct {
+	exchanges     int // position of the first exchange not yet handed on
+	bytesSent     uint64
+	bytesReceived uint64
+	tls           bool
+	lastSeen      time.Time
+
+	// Kept for the graph: the edge the flow was first counted on and the
+	// requests counted on it
+	edge     edgeKey
+	requests int
+}
+
+// flowUpdate is what one snapshot of a flow adds to the ones before it
+type flowUpdate struct {
+	flow  *protocol.Flow
+	first bool // no earlier snapshot was seen
+	final bool // the flow has ended
+
+	// Exchanges finished since the last snapshot. Once the flow has ended
+	// all that are left, finished or not.
+	exchanges     []*protocol.HTTPExchange
+	bytesSent     uint64
+	bytesReceived uint64
+	tls           bool // the TLS handshake was first seen in this snapshot
+
+	progress *flowProgress
+}
+
+// newFlowTracker creates a tracker that feeds the given aggregators
+func newFlowTracker(consumers ...flowConsumer) *flowTracker {
+	return &flowTracker{
+		consumers: consumers,
+		open:      make(map[string]*flowProgress),
+		finished:  make(map[string]bool),
+	}
+}
+
+// add hands a flow, or what is new in a later snapshot of an open one, to
+// every consumer. Updates are handed on one at a time. It reports false
+// for a flow that has already ended, which is a replay and left alone.
+func (t *flowTracker) add(f *protocol.Flow, now time.Time) bool {
+	return t.addTo(f, now, t.consumers...)
+}
+
+// addTo tracks a flow like add but only hands it to the given consumers
+func (t *flowTracker) addTo(f *protocol.Flow, now time.Time, consumers ...flowConsumer) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.finished[f.ID] {
+		return false
+	}
+	if f.Status != protocol.StatusOpen {
+		t.rememberFinished(f.ID)
+	}
+	if f.IsAgentTraffic {
+		return true
+	}
+
+	if now.Sub(t.pruned) > time.Minute {
+		t.pruneOpen(now)
+	}
+
+	progress, seen := t.open[f.ID]
+	if !seen {
+		progress = &flowProgress{}
+	}
+	u := &flowUpdate{
+		flow:     f,
+		first:    !seen,
+		final:    f.Status != protocol.StatusOpen,
+		progress: progress,
+	}
+
+	// Flows recorded before exchanges were kept only carry HTTP
+	exchanges := f.HTTPExchanges
+	if len(exchanges) == 0 && f.ExchangeOffset == 0 && f.HTTP != nil {
+		exchanges = []*protocol.HTTPExchange{{HTTPInfo: *f.HTTP, DurationMs: f.TimeToFirstByte}}
+	}
+	// Open flows only hand on exchanges that have finished, so their
+	// outcome is known. Positions count from the start of the connection,
+	// exchanges before the offset are no longer listed.
+	offset := f.ExchangeOffset
+	start := max(progress.exchanges, offset)
+	end := start
+	for ; end-offset < len(exchanges); end++ {
+		if !u.final && !exchangeDone(exchanges[end-offset]) {
+			break
+		}
+	}
+	if start < end {
+		u.exchanges = exchanges[start-offset : end-offset]
+	}
+	progress.exchanges = end
+
+	if f.BytesSent > progress.bytesSent {
+		u.bytesSent = f.BytesSent - progress.bytesSent
+		progress.bytesSent = f.BytesSent
+	}
+	if f.BytesReceived > progress.bytesReceived {
+		u.bytesReceived = f.BytesReceived - progress.bytesReceived
+		progress.bytesReceived = f.BytesReceived
+	}
+	if !progress.tls && f.TLS != nil && f.TLS.Version != "" {
+		u.tls = true
+		progress.tls = true
+	}
+
+	for _, c := range consumers {
+		c.add(u, now)
+	}
+
+	if u.final {
+		delete(t.open, f.ID)
+	} else {
+		progress.lastSeen = now
+		t.open[f.ID] = progress
+	}
+	return true
+}
+
+// rememberFinished records that a flow has ended, forgetting the one that
+// ended longest ago once finishedFlowMemory are remembered
+func (t *flowTracker) rememberFinished(id string) {
+	if len(t.finishedOrder) < finishedFlowMemory {
+		t.finishedOrder = append(t.finishedOrder, id)
+	} else {
+		delete(t.finished, t.finishedOrder[t.nextFinished])
+		t.finishedOrder[t.nextFinished] = id
+		t.nextFinished = (t.nextFinished + 1) % finishedFlowMemory
+	}
+	t.finished[id] = true
+}
+
+// pruneOpen forgets open flows that have not been updated in a while
+func (t *flowTracker) pruneOpen(now time.Time) {
+	for id, progress := range t.open {
+		if now.Sub(progress.lastSeen) > openFlowTTL {
+			delete(t.open, id)
+		}
+	}
+	t.pruned = now
+}
@@ -0,0 +1,140 @@
+package hub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// recordedUpdates is a consumer that keeps what it is handed
+type recordedUpdates []flowUpdate
+
+func (r *recordedUpdates) add(u *flowUpdate, now time.Time) {
+	*r = append(*r, *u)
+}
+
+func TestFlowTracker_HandsOnWhatIsNew(t *testing.T) {
+	var got recordedUpdates
+	flows := newFlowTracker(&got)
+	now := time.Now()
+
+	first := webToAPI("f1", protocol.StatusOpen, exchange(200, 10), exchange(0, 0))
+	first.BytesSent, first.BytesReceived = 100, 1000
+	flows.add(first, now)
+
+	second := webToAPI("f1", protocol.StatusOpen, exchange(200, 10), exchange(503, 30))
+	second.BytesSent, second.BytesReceived = 200, 1500
+	second.TLS = &protocol.TLSInfo{Version: "TLS 1.3"}
+	flows.add(second, now)
+
+	final := webToAPI("f1", protocol.StatusClosed, exchange(200, 10), exchange(503, 30), exchange(0, 0))
+	final.BytesSent, final.BytesReceived = 200, 1500
+	final.TLS = second.TLS
+	flows.add(final, now)
+
+	want := []struct {
+		first, final, tls bool
+		exchanges         int
+		sent, received    uint64
+	}{
+		{first: true, exchanges: 1, sent: 100, received: 1000},
+		{tls: true, exchanges: 1, sent: 100, received: 500},
+		// An unfinished exchange is still handed on once the flow ends
+		{final: true, exchanges: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d updates, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		u := got[i]
+		if u.first != w.first || u.final != w.final || u.tls != w.tls {
+			t.Errorf("update %d first/final/tls = %v/%v/%v, want %v/%v/%v", i, u.first, u.final, u.tls, w.first, w.final, w.tls)
+		}
+		if len(u.exchanges) != w.exchanges || u.bytesSent != w.sent || u.bytesReceived != w.received {
+			t.Errorf("update %d = %d exchanges %d/%d bytes, want %d exchanges %d/%d bytes",
+				i, len(u.exchanges), u.bytesSent, u.bytesReceived, w.exchanges, w.sent, w.received)
+		}
+	}
+	if len(flows.open) != 0 {
+		t.Errorf("%d flows still tracked as open", len(flows.open))
+	}
+}
+
+func TestFlowTracker_CountsByPosition(t *testing.T) {
+	var got recordedUpdates
+	flows := newFlowTracker(&got)
+	now := time.Now()
+
+	// Later snapshots only list what the earlier ones didn't settle
+	flows.add(webToAPI("f1", protocol.StatusOpen, exchange(200, 1), exchange(0, 0)), now)
+	second := webToAPI("f1", protocol.StatusOpen, exchange(500, 2), exchange(200, 3))
+	second.ExchangeOffset = 1
+	flows.add(second, now)
+	final := webToAPI("f1", protocol.StatusClosed, exchange(200, 4))
+	final.ExchangeOffset = 3
+	flows.add(final, now)
+
+	var durations []float64
+	for _, u := range got {
+		for _, ex := range u.exchanges {
+			durations = append(durations, ex.DurationMs)
+		}
+	}
+	if fmt.Sprint(durations) != "[1 2 3 4]" {
+		t.Errorf("handed on exchanges %v, want each of [1 2 3 4] once", durations)
+	}
+}
+
+func TestFlowTracker_IgnoresReplayedFlows(t *testing.T) {
+	var got recordedUpdates
+	flows := newFlowTracker(&got)
+	now := time.Now()
+
+	// A batch confirmed too late is sent again, snapshot and final alike
+	open := webToAPI("f1", protocol.StatusOpen, exchange(200, 1))
+	final := webToAPI("f1", protocol.StatusClosed, exchange(200, 1), exchange(200, 2))
+	for i, f := range []*protocol.Flow{open, final, open, final} {
+		if ok := flows.add(f, now); ok != (i < 2) {
+			t.Errorf("add %d = %v, want %v", i, ok, i < 2)
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("handed on %d updates, want 2", len(got))
+	}
+
+	// The longest ended are forgotten first
+	for i := 0; i < finishedFlowMemory; i++ {
+		flows.add(webToAPI(fmt.Sprint(i), protocol.StatusClosed), now)
+	}
+	if len(flows.finished) != finishedFlowMemory || flows.finished["f1"] || !flows.finished["0"] {
+		t.Errorf("remembering %d ended flows, f1 %v", len(flows.finished), flows.finished["f1"])
+	}
+}
+
+func TestFlowTracker_SkipsAgentTraffic(t *testing.T) {
+	var got recordedUpdates
+	flows := newFlowTracker(&got)
+
+	flows.add(&protocol.Flow{ID: "f1", IsAgentTraffic: true, Status: protocol.StatusClosed}, time.Now())
+
+	if len(got) != 0 {
+		t.Errorf("agent traffic was handed on: %+v", got)
+	}
+}
+
+func TestFlowTracker_ForgetsAbandonedOpenFlows(t *testing.T) {
+	flows := newFlowTracker()
+	base := time.Now()
+
+	flows.add(webToAPI("f1", protocol.StatusOpen), base)
+	flows.add(webToAPI("f2", protocol.StatusOpen), base.Add(openFlowTTL+2*time.Minute))
+
+	if _, ok := flows.open["f1"]; ok {
+		t.Error("f1 should have been forgotten")
+	}
+	if _, ok := flows.open["f2"]; !ok {
+		t.Error("f2 should still be tracked")
+	}
+}
@@ -0,0 +1,372 @@
+package hub
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const (
+	// MaxGraphEdges bounds the edges kept; the least recently active one
+	// makes room for a new one
+	MaxGraphEdges = 5000
+	// latencySamples is how many recent request latencies each edge keeps
+	// for its percentiles
+	latencySamples = 512
+	// graphBroadcastInterval is how often WebSocket clients are sent the
+	// graph when it has changed
+	graphBroadcastInterval = time.Second
+)
+
+// Kinds of graph node
+const (
+	NodePod      = "pod"
+	NodeService  = "service"  // reached through a ClusterIP with no known backend
+	NodeExternal = "external" // outside the cluster, named by hostname or address
+)
+
+// ServiceGraph aggregates flows into who calls whom. It is updated as each
+// flow arrives, so reading it never walks the flow buffer.
+type ServiceGraph struct {
+	mutex     sync.Mutex
+	nodes     map[string]*graphNode
+	edges     map[edgeKey]*graphEdge
+	version   uint64
+	updatedAt time.Time
+}
+
+// Graph is a snapshot of the service graph
+type Graph struct {
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// GraphNode is a pod, service or external host
+type GraphNode struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Workload  string `json:"workload,omitempty"`
+	Service   string `json:"service,omitempty"` // for pods, the service they were reached through
+}
+
+// GraphEdge is the traffic from one node to another. Requests are HTTP
+// exchanges, gRPC calls and DNS queries; a connection that carried none
+// counts as one request when it ends.
+type GraphEdge struct {
+	Source        string              `json:"source"`
+	Target        string              `json:"target"`
+	Protocols     []string            `json:"protocols"`
+	Flows         uint64              `json:"flows"`
+	Requests      uint64              `json:"requests"`
+	Errors        uint64              `json:"errors"`
+	ErrorRate     float64             `json:"errorRate"`
+	BytesSent     uint64              `json:"bytesSent"`
+	BytesReceived uint64              `json:"bytesReceived"`
+	LatencyMs     *LatencyPercentiles `json:"latencyMs,omitempty"`
+	LastSeen      time.Time           `json:"lastSeen"`
+}
+
+// LatencyPercentiles summarizes recent request latencies
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+type edgeKey struct {
+	source, target string
+}
+
+type graphNode struct {
+	GraphNode
+	edges int // edges touching the node, it is dropped with its last one
+}
+
+type graphEdge struct {
+	flows, requests, errors  uint64
+	bytesSent, bytesReceived uint64
+	protocols                map[protocol.Protocol]bool
+	latencies                []float64 // ring of recent samples
+	next                     int
+	lastSeen                 time.Time
+}
+
+// NewServiceGraph creates an empty graph
+func NewServiceGraph() *ServiceGraph {
+	return &ServiceGraph{
+		nodes: make(map[string]*graphNode),
+		edges: make(map[edgeKey]*graphEdge),
+	}
+}
+
+// add counts a flow, or what is new in a later snapshot of an open one
+func (g *ServiceGraph) add(u *flowUpdate, now time.Time) {
+	f, progress := u.flow, u.progress
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if u.first {
+		src, dst := sourceNode(f), destinationNode(f)
+		progress.edge = edgeKey{src.ID, dst.ID}
+		g.edgeFor(src, dst).flows++
+	}
+	// Endpoints can be named better in later snapshots, e.g. once the TLS
+	// server name is seen, but the flow stays on the edge it started on
+	edge := g.edges[progress.edge]
+	if edge == nil {
+		// Evicted while the flow was open
+		src, dst := sourceNode(f), destinationNode(f)
+		progress.edge = edgeKey{src.ID, dst.ID}
+		edge = g.edgeFor(src, dst)
+	}
+
+	edge.protocols[f.Protocol] = true
+	edge.bytesSent += u.bytesSent
+	edge.bytesReceived += u.bytesReceived
+
+	g.countRequests(edge, u)
+
+	// Flows restored after a restart are added in no particular order
+	if now.After(edge.lastSeen) {
+		edge.lastSeen = now
+	}
+	if now.After(g.updatedAt) {
+		g.updatedAt = now
+	}
+	g.version++
+}
+
+// countRequests adds the requests an update brings
+func (g *ServiceGraph) countRequests(edge *graphEdge, u *flowUpdate) {
+	f, progress := u.flow, u.progress
+	for _, ex := range u.exchanges {
+		edge.addRequest(ex.DurationMs, exchangeFailed(ex))
+		progress.requests++
+	}
+
+	if f.DNS != nil && progress.requests == 0 && (u.final || f.DNS.RCode != "" || f.DNS.TimedOut) {
+		edge.addRequest(f.DNS.LatencyMs, dnsFailed(f.DNS))
+		progress.requests++
+	}
+
+	// A connection torn down after its requests succeeded didn't fail
+	// anything, the requests carry the outcome
+	if u.final && progress.requests == 0 {
+		failed := f.Status == protocol.StatusReset || f.Status == protocol.StatusTimeout
+		edge.addRequest(f.TimeToFirstByte, failed)
+		progress.requests++
+	}
+}
+
+// addRequest counts one request. Zero latency means it wasn't measured.
+func (e *graphEdge) addRequest(latencyMs float64, failed bool) {
+	e.requests++
+	if failed {
+		e.errors++
+	}
+	if latencyMs <= 0 {
+		return
+	}
+	if len(e.latencies) < latencySamples {
+		e.latencies = append(e.latencies, latencyMs)
+		return
+	}
+	e.latencies[e.next] = latencyMs
+	e.next = (e.next + 1) % latencySamples
+}
+
+// exchangeDone reports whether a request has its outcome. gRPC calls end
+// with the status in the trailers, after the response headers.
+func exchangeDone(ex *protocol.HTTPExchange) bool {
+	if ex.GRPC != nil {
+		return ex.GRPC.Status != ""
+	}
+	return ex.StatusCode != 0
+}
+
+// exchangeFailed reports server errors and failed gRPC calls
+func exchangeFailed(ex *protocol.HTTPExchange) bool {
+	if ex.GRPC != nil && ex.GRPC.Status != "" && ex.GRPC.StatusCode != 0 {
+		return true
+	}
+	return ex.StatusCode >= 500
+}
+
+// dnsFailed reports queries that got no usable answer. NXDOMAIN is an
+// answer, and search domain expansion produces plenty of them.
+func dnsFailed(d *protocol.DNSInfo) bool {
+	return d.TimedOut || (d.RCode != "" && d.RCode != "NOERROR" && d.RCode != "NXDOMAIN")
+}
+
+// edgeFor returns the edge between two nodes, creating both as needed.
+// The caller holds g.mutex.
+func (g *ServiceGraph) edgeFor(src, dst GraphNode) *graphEdge {
+	key := edgeKey{src.ID, dst.ID}
+	if e, ok := g.edges[key]; ok {
+		return e
+	}
+	if len(g.edges) >= MaxGraphEdges {
+		g.evictEdge()
+	}
+
+	g.addNode(src)
+	g.addNode(dst)
+	e := &graphEdge{protocols: make(map[protocol.Protocol]bool)}
+	g.edges[key] = e
+	return e
+}
+
+// addNode references a node, creating it on first use
+func (g *ServiceGraph) addNode(n GraphNode) {
+	if existing, ok := g.nodes[n.ID]; ok {
+		existing.edges++
+		// Later flows may know more about a pod than the first did
+		if existing.Workload == "" {
+			existing.Workload = n.Workload
+		}
+		if existing.Service == "" {
+			existing.Service = n.Service
+		}
+		return
+	}
+	g.nodes[n.ID] = &graphNode{GraphNode: n, edges: 1}
+}
+
+// evictEdge drops the least recently active edge and any nodes left
+// without edges
+func (g *ServiceGraph) evictEdge() {
+	var oldest edgeKey
+	var found bool
+	for key, e := range g.edges {
+		if !found || e.lastSeen.Before(g.edges[oldest].lastSeen) {
+			oldest, found = key, true
+		}
+	}
+	if !found {
+		return
+	}
+	delete(g.edges, oldest)
+	for _, id := range []string{oldest.source, oldest.target} {
+		if n := g.nodes[id]; n != nil {
+			if n.edges--; n.edges <= 0 {
+				delete(g.nodes, id)
+			}
+		}
+	}
+}
+
+// Version changes whenever the graph does
+func (g *ServiceGraph) Version() uint64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.version
+}
+
+// Snapshot returns the graph with nodes and edges in a stable order
+func (g *ServiceGraph) Snapshot() Graph {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	graph := Graph{
+		Nodes:     make([]GraphNode, 0, len(g.nodes)),
+		Edges:     make([]GraphEdge, 0, len(g.edges)),
+		UpdatedAt: g.updatedAt,
+	}
+	for _, n := range g.nodes {
+		graph.Nodes = append(graph.Nodes, n.GraphNode)
+	}
+	for key, e := range g.edges {
+		graph.Edges = append(graph.Edges, e.snapshot(key))
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Source != graph.Edges[j].Source {
+			return graph.Edges[i].Source < graph.Edges[j].Source
+		}
+		return graph.Edges[i].Target < graph.Edges[j].Target
+	})
+	return graph
+}
+
+// snapshot copies an edge out for serving
+func (e *graphEdge) snapshot(key edgeKey) GraphEdge {
+	out := GraphEdge{
+		Source:        key.source,
+		Target:        key.target,
+		Flows:         e.flows,
+		Requests:      e.requests,
+		Errors:        e.errors,
+		BytesSent:     e.bytesSent,
+		BytesReceived: e.bytesReceived,
+		LastSeen:      e.lastSeen,
+	}
+	if e.requests > 0 {
+		out.ErrorRate = float64(e.errors) / float64(e.requests)
+	}
+	for p := range e.protocols {
+		out.Protocols = append(out.Protocols, string(p))
+	}
+	sort.Strings(out.Protocols)
+
+	if len(e.latencies) > 0 {
+		sorted := append([]float64(nil), e.latencies...)
+		sort.Float64s(sorted)
+		out.LatencyMs = &LatencyPercentiles{
+			P50: percentile(sorted, 50),
+			P95: percentile(sorted, 95),
+			P99: percentile(sorted, 99),
+		}
+	}
+	return out
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// sourceNode is the client end of a flow
+func sourceNode(f *protocol.Flow) GraphNode {
+	if f.SrcPod != "" {
+		return podNode(f.SrcNamespace, f.SrcPod, f.SrcWorkload, f.SrcService)
+	}
+	return GraphNode{ID: NodeExternal + ":" + f.SrcIP, Kind: NodeExternal, Name: f.SrcIP}
+}
+
+// destinationNode is the server end of a flow: its pod when known, else
+// the service it was addressed to, else the host by the name it was
+// reached by
+func destinationNode(f *protocol.Flow) GraphNode {
+	switch {
+	case f.DstPod != "":
+		return podNode(f.DstNamespace, f.DstPod, f.DstWorkload, f.DstService)
+	case f.DstService != "":
+		return GraphNode{ID: NodeService + ":" + f.DstService, Kind: NodeService, Name: f.DstService, Namespace: f.DstNamespace}
+	case f.DstName != "":
+		return GraphNode{ID: NodeExternal + ":" + f.DstName, Kind: NodeExternal, Name: f.DstName}
+	default:
+		return GraphNode{ID: NodeExternal + ":" + f.DstIP, Kind: NodeExternal, Name: f.DstIP}
+	}
+}
+
+func podNode(namespace, pod, workload, service string) GraphNode {
+	return GraphNode{
+		ID:        NodePod + ":" + namespace + "/" + pod,
+		Kind:      NodePod,
+		Name:      pod,
+		Namespace: namespace,
+		Workload:  workload,
+		Service:   service,
+	}
+}
@@ -0,0 +1,222 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// webToAPI is a keep-alive connection from a web pod to an api pod
+func webToAPI(id string, status protocol.FlowStatus, exchanges ...*protocol.HTTPExchange) *protocol.Flow {
+	return &protocol.Flow{
+		ID:            id,
+		SrcIP:         "10.1.0.5",
+		SrcPod:        "web-7d9f-x2x4q",
+		SrcNamespace:  "prod",
+		SrcWorkload:   "Deployment/web",
+		DstIP:         "10.1.0.7",
+		DstPort:       8080,
+		DstPod:        "api-0",
+		DstNamespace:  "prod",
+		DstService:    "api.prod.svc",
+		Protocol:      protocol.ProtocolHTTP,
+		Status:        status,
+		HTTPExchanges: exchanges,
+	}
+}
+
+func exchange(status int, durationMs float64) *protocol.HTTPExchange {
+	return &protocol.HTTPExchange{HTTPInfo: protocol.HTTPInfo{Method: "GET", URL: "/", StatusCode: status}, DurationMs: durationMs}
+}
+
+func onlyEdge(t *testing.T, g *ServiceGraph) GraphEdge {
+	t.Helper()
+	graph := g.Snapshot()
+	if len(graph.Edges) != 1 {
+		t.Fatalf("got %d edges, want 1: %+v", len(graph.Edges), graph.Edges)
+	}
+	return graph.Edges[0]
+}
+
+func TestServiceGraph_Nodes(t *testing.T) {
+	g := NewServiceGraph()
+	flows := newFlowTracker(g)
+	now := time.Now()
+
+	flows.add(webToAPI("f1", protocol.StatusClosed, exchange(200, 5)), now)
+	flows.add(&protocol.Flow{ID: "f2", SrcIP: "10.1.0.5", SrcPod: "web-7d9f-x2x4q", SrcNamespace: "prod",
+		DstIP: "10.96.0.30", DstService: "db.prod.svc", DstNamespace: "prod", Status: protocol.StatusClosed}, now)
+	flows.add(&protocol.Flow{ID: "f3", SrcIP: "10.1.0.5", SrcPod: "web-7d9f-x2x4q", SrcNamespace: "prod",
+		DstIP: "93.184.216.34", DstName: "example.com", Status: protocol.StatusClosed}, now)
+	flows.add(&protocol.Flow{ID: "f4", SrcIP: "192.168.1.10", DstIP: "10.1.0.7", DstPod: "api-0", DstNamespace: "prod", Status: protocol.StatusClosed}, now)
+	flows.add(&protocol.Flow{ID: "f5", SrcIP: "10.1.0.5", DstIP: "10.1.0.3", IsAgentTraffic: true, Status: protocol.StatusClosed}, now)
+
+	graph := g.Snapshot()
+	want := []GraphNode{
+		{ID: "external:192.168.1.10", Kind: NodeExternal, Name: "192.168.1.10"},
+		{ID: "external:example.com", Kind: NodeExternal, Name: "example.com"},
+		{ID: "pod:prod/api-0", Kind: NodePod, Name: "api-0", Namespace: "prod", Service: "api.prod.svc"},
+		{ID: "pod:prod/web-7d9f-x2x4q", Kind: NodePod, Name: "web-7d9f-x2x4q", Namespace: "prod", Workload: "Deployment/web"},
+		{ID: "service:db.prod.svc", Kind: NodeService, Name: "db.prod.svc", Namespace: "prod"},
+	}
+	if len(graph.Nodes) != len(want) {
+		t.Fatalf("nodes = %+v, want %+v", graph.Nodes, want)
+	}
+	for i := range want {
+		if graph.Nodes[i] != want[i] {
+			t.Errorf("node %d = %+v, want %+v", i, graph.Nodes[i], want[i])
+		}
+	}
+	if len(graph.Edges) != 4 {
+		t.Errorf("got %d edges, want 4 without agent traffic", len(graph.Edges))
+	}
+}
+
+func TestServiceGraph_CountsOpenFlowsOnce(t *testing.T) {
+	g := NewServiceGraph()
+	flows := newFlowTracker(g)
+	now := time.Now()
+
+	// Snapshots of one connection repeat what was already reported
+	pending := exchange(0, 0)
+	first := webToAPI("f1", protocol.StatusOpen, exchange(200, 10), pending)
+	first.BytesSent, first.BytesReceived = 100, 1000
+	flows.add(first, now)
+
+	second := webToAPI("f1", protocol.StatusOpen, exchange(200, 10), exchange(503, 30))
+	second.BytesSent, second.BytesReceived = 200, 1500
+	flows.add(second, now)
+
+	final := webToAPI("f1", protocol.StatusReset, exchange(200, 10), exchange(503, 30), exchange(200, 20))
+	final.BytesSent, final.BytesReceived = 300, 2000
+	flows.add(final, now)
+
+	edge := onlyEdge(t, g)
+	if edge.Flows != 1 || edge.Requests != 3 || edge.Errors != 1 {
+		t.Errorf("flows/requests/errors = %d/%d/%d, want 1/3/1", edge.Flows, edge.Requests, edge.Errors)
+	}
+	if edge.BytesSent != 300 || edge.BytesReceived != 2000 {
+		t.Errorf("bytes = %d/%d, want 300/2000", edge.BytesSent, edge.BytesReceived)
+	}
+	if edge.LatencyMs == nil || edge.LatencyMs.P50 != 20 || edge.LatencyMs.P99 != 30 {
+		t.Errorf("latency = %+v, want p50 20 and p99 30", edge.LatencyMs)
+	}
+	if len(flows.open) != 0 {
+		t.Errorf("%d flows still tracked as open", len(flows.open))
+	}
+}
+
+func TestServiceGraph_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		flow       *protocol.Flow
+		wantErrors uint64
+	}{
+		{"server error", webToAPI("f", protocol.StatusClosed, exchange(500, 1)), 1},
+		{"client error", webToAPI("f", protocol.StatusClosed, exchange(404, 1)), 0},
+		{"failed gRPC call", webToAPI("f", protocol.StatusClosed, &protocol.HTTPExchange{
+			HTTPInfo: protocol.HTTPInfo{StatusCode: 200},
+			GRPC:     &protocol.GRPCInfo{Status: "UNAVAILABLE", StatusCode: 14},
+		}), 1},
+		{"reset after a good request", webToAPI("f", protocol.StatusReset, exchange(200, 1)), 0},
+		{"reset without requests", webToAPI("f", protocol.StatusReset), 1},
+		{"connect timeout", webToAPI("f", protocol.StatusTimeout), 1},
+		{"DNS SERVFAIL", &protocol.Flow{ID: "f", Status: protocol.StatusClosed, DNS: &protocol.DNSInfo{RCode: "SERVFAIL"}}, 1},
+		{"DNS NXDOMAIN", &protocol.Flow{ID: "f", Status: protocol.StatusClosed, DNS: &protocol.DNSInfo{RCode: "NXDOMAIN"}}, 0},
+		{"DNS timeout", &protocol.Flow{ID: "f", Status: protocol.StatusTimeout, DNS: &protocol.DNSInfo{TimedOut: true}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewServiceGraph()
+			flows := newFlowTracker(g)
+			flows.add(tt.flow, time.Now())
+
+			edge := onlyEdge(t, g)
+			if edge.Requests != 1 || edge.Errors != tt.wantErrors {
+				t.Errorf("requests/errors = %d/%d, want 1/%d", edge.Requests, edge.Errors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestServiceGraph_LatencyPercentiles(t *testing.T) {
+	g := NewServiceGraph()
+	flows := newFlowTracker(g)
+	now := time.Now()
+
+	for i := 1; i <= 100; i++ {
+		flows.add(webToAPI(fmt.Sprint(i), protocol.StatusClosed, exchange(200, float64(i))), now)
+	}
+
+	edge := onlyEdge(t, g)
+	want := LatencyPercentiles{P50: 50, P95: 95, P99: 99}
+	if edge.LatencyMs == nil || *edge.LatencyMs != want {
+		t.Errorf("latency = %+v, want %+v", edge.LatencyMs, want)
+	}
+	if edge.ErrorRate != 0 || edge.Requests != 100 {
+		t.Errorf("requests = %d at error rate %v, want 100 at 0", edge.Requests, edge.ErrorRate)
+	}
+}
+
+func TestServiceGraph_EvictsIdleEdges(t *testing.T) {
+	g := NewServiceGraph()
+	flows := newFlowTracker(g)
+	base := time.Now()
+
+	for i := 0; i <= MaxGraphEdges; i++ {
+		ip := fmt.Sprintf("203.0.%d.%d", i/256, i%256)
+		flows.add(&protocol.Flow{ID: ip, SrcIP: "10.1.0.5", DstIP: ip, Status: protocol.StatusClosed}, base.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	graph := g.Snapshot()
+	if len(graph.Edges) != MaxGraphEdges {
+		t.Errorf("got %d edges, want %d", len(graph.Edges), MaxGraphEdges)
+	}
+	// The first destination went with its edge, the shared source stayed
+	if len(graph.Nodes) != MaxGraphEdges+1 {
+		t.Errorf("got %d nodes, want %d", len(graph.Nodes), MaxGraphEdges+1)
+	}
+	for _, n := range graph.Nodes {
+		if n.ID == "external:203.0.0.0" {
+			t.Error("the least recently active destination was kept")
+		}
+	}
+}
+
+func TestHandleGraph(t *testing.T) {
+	s := setupTestServer(t)
+	s.AddFlow(webToAPI("f1", protocol.StatusClosed, exchange(200, 12)))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/graph", nil)
+	w := httptest.NewRecorder()
+	s.handleGraph(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var graph Graph
+	if err := json.NewDecoder(w.Body).Decode(&graph); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(graph.Nodes) != 2 || len(graph.Edges) != 1 {
+		t.Fatalf("graph = %+v, want web calling api", graph)
+	}
+	edge := graph.Edges[0]
+	if edge.Source != "pod:prod/web-7d9f-x2x4q" || edge.Target != "pod:prod/api-0" || edge.Requests != 1 {
+		t.Errorf("edge = %+v", edge)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleGraph(w, httptest.NewRequest(http.MethodPost, "/api/graph", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", w.Code)
+	}
+}
@@ -6,37 +6,100 @@ import (
 	"io"
 	"log"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/podscope/podscope/pkg/protocol"
+	"github.com/podscope/podscope/pkg/protocol/pb"
 	"google.golang.org/grpc"
 )
 
+// maxGRPCMessageSize bounds a single PCAP chunk; agents flush every 500ms,
+// which on a busy pod easily exceeds gRPC's 4MB default
+const maxGRPCMessageSize = 64 * 1024 * 1024
+
 // GRPCServer handles agent connections
 type GRPCServer struct {
+	pb.UnimplementedAgentServiceServer
+
 	server    *Server
 	agents    map[string]*AgentConnection
 	agentsMux sync.RWMutex
+
+	// Number of the last PCAP chunk written per agent ID, kept when an
+	// agent registers again. Guarded by agentsMux.
+	pcapSeq map[string]uint64
 }
 
 // AgentConnection represents a connected agent
 type AgentConnection struct {
-	ID            string
-	PodName       string
-	Namespace     string
-	PodIP         string
-	ConnectedAt   time.Time
-	LastHeartbeat time.Time
-	Stats         AgentStats
+	ID             string     `json:"id"`
+	PodName        string     `json:"podName"`
+	Namespace      string     `json:"namespace"`
+	PodIP          string     `json:"podIP"`
+	NodeName       string     `json:"nodeName"`
+	ListeningPorts []uint16   `json:"listeningPorts,omitempty"`
+	ConnectedAt    time.Time  `json:"connectedAt"`
+	LastHeartbeat  time.Time  `json:"lastHeartbeat"`
+	Stats          AgentStats `json:"stats"` // as last reported by the agent
+
+	// Counted by the hub as data arrives
+	FlowsReceived     uint64 `json:"flowsReceived"`
+	PCAPBytesReceived uint64 `json:"pcapBytesReceived"`
+	PCAPBytesDropped  uint64 `json:"pcapBytesDropped"` // not stored, the buffer was full
 }
 
-// AgentStats holds agent statistics
+// AgentStats holds the capture counters an agent reports with its heartbeat
 type AgentStats struct {
-	PacketsCaptured uint64
-	BytesCaptured   uint64
-	FlowsDetected   uint64
-	Errors          uint64
+	PacketsCaptured         uint64 `json:"packetsCaptured"`
+	BytesCaptured           uint64 `json:"bytesCaptured"`
+	FlowsDetected           uint64 `json:"flowsDetected"`
+	Errors                  uint64 `json:"errors"`
+	KernelPacketsReceived   uint64 `json:"kernelPacketsReceived"`
+	KernelPacketsDropped    uint64 `json:"kernelPacketsDropped"`
+	InterfacePacketsDropped uint64 `json:"interfacePacketsDropped"`
+	ActiveFlows             uint64 `json:"activeFlows"`
+
+	// Delivery to the hub
+	FlowsSent                  uint64 `json:"flowsSent"`
+	FlowsDroppedQueueFull      uint64 `json:"flowsDroppedQueueFull"`
+	FlowsDroppedSpoolFull      uint64 `json:"flowsDroppedSpoolFull"`
+	FlowsDroppedSendFailed     uint64 `json:"flowsDroppedSendFailed"`
+	PCAPBytesSent              uint64 `json:"pcapBytesSent"`
+	PCAPBytesDroppedQueueFull  uint64 `json:"pcapBytesDroppedQueueFull"`
+	PCAPBytesDroppedSpoolFull  uint64 `json:"pcapBytesDroppedSpoolFull"`
+	PCAPBytesDroppedSendFailed uint64 `json:"pcapBytesDroppedSendFailed"`
+}
+
+// Agent health, judged by how long ago the last heartbeat arrived. Agents
+// send one every 5 seconds.
+const (
+	AgentHealthy = "healthy"
+	AgentStale   = "stale" // missed a few heartbeats
+	AgentLost    = "lost"  // gone quiet, most likely no longer capturing
+
+	agentStaleAfter = 15 * time.Second
+	agentLostAfter  = 60 * time.Second
+)
+
+// AgentStatus is an agent as listed by the agents API
+type AgentStatus struct {
+	AgentConnection
+	Health       string              `json:"health"`
+	Completeness CaptureCompleteness `json:"completeness"`
+}
+
+// agentHealth judges an agent by its last heartbeat
+func agentHealth(lastHeartbeat, now time.Time) string {
+	switch since := now.Sub(lastHeartbeat); {
+	case since < agentStaleAfter:
+		return AgentHealthy
+	case since < agentLostAfter:
+		return AgentStale
+	default:
+		return AgentLost
+	}
 }
 
 // startGRPCServer starts the gRPC server
@@ -46,14 +109,15 @@ func (s *Server) startGRPCServer() (*grpc.Server, error) {
 		return nil, fmt.Errorf("failed to listen: %w", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.MaxRecvMsgSize(maxGRPCMessageSize))
 
 	// Register our service
 	gs := &GRPCServer{
 		server: s,
 		agents: make(map[string]*AgentConnection),
 	}
-	registerAgentService(grpcServer, gs)
+	pb.RegisterAgentServiceServer(grpcServer, gs)
+	s.agents = gs
 
 	go func() {
 		log.Printf("gRPC server listening on port %d", s.grpcPort)
@@ -65,201 +129,207 @@ func (s *Server) startGRPCServer() (*grpc.Server, error) {
 	return grpcServer, nil
 }
 
-// Message types for gRPC (simplified without protobuf generation)
-type FlowEventMsg struct {
-	AgentID string
-	Flow    *protocol.Flow
-}
-
-type PCAPChunkMsg struct {
-	AgentID   string
-	Timestamp int64
-	Data      []byte
-}
+// RegisterAgent records a newly connected agent
+func (gs *GRPCServer) RegisterAgent(ctx context.Context, info *pb.AgentInfo) (*pb.RegisterResponse, error) {
+	agent := pb.ToAgentInfo(info)
+	gs.register(agent)
 
-type AgentInfoMsg struct {
-	ID        string
-	PodName   string
-	Namespace string
-	PodIP     string
-	NodeName  string
-	SessionID string
-}
+	gs.server.pcapBuffer.SetAgentName(agent.ID, agentDisplayName(agent))
 
-type RegisterResponseMsg struct {
-	Success bool
-	Message string
-}
+	log.Printf("Agent registered: %s (%s/%s on %s), listening on %v", agent.ID, agent.Namespace, agent.PodName, agent.NodeName, agent.ListeningPorts)
 
-type HeartbeatRequestMsg struct {
-	AgentID   string
-	Timestamp int64
+	return &pb.RegisterResponse{
+		Success: true,
+		Message: "Agent registered successfully",
+	}, nil
 }
 
-type HeartbeatResponseMsg struct {
-	ContinueCapture bool
-	Message         string
-	BPFFilter       string // If set, agent should update its BPF filter
-}
-
-// registerAgentService registers the gRPC service with proper handler signatures
-func registerAgentService(s *grpc.Server, gs *GRPCServer) {
-	s.RegisterService(&grpc.ServiceDesc{
-		ServiceName: "podscope.AgentService",
-		HandlerType: (*interface{})(nil),
-		Methods: []grpc.MethodDesc{
-			{
-				MethodName: "RegisterAgent",
-				Handler:    gs.registerAgentHandler,
-			},
-			{
-				MethodName: "Heartbeat",
-				Handler:    gs.heartbeatHandler,
-			},
-		},
-		Streams: []grpc.StreamDesc{
-			{
-				StreamName:    "StreamFlows",
-				Handler:       gs.streamFlowsHandler,
-				ClientStreams: true,
-			},
-			{
-				StreamName:    "StreamPCAP",
-				Handler:       gs.streamPCAPHandler,
-				ClientStreams: true,
-			},
-		},
-		Metadata: "podscope.proto",
-	}, gs)
-}
-
-func (gs *GRPCServer) registerAgentHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	var info AgentInfoMsg
-	if err := dec(&info); err != nil {
-		return nil, err
+// register adds an agent to the roster. An agent registering again, e.g.
+// after losing its connection for a moment, keeps its connection time and
+// the counters for what it has delivered.
+func (gs *GRPCServer) register(agent *protocol.AgentInfo) {
+	now := time.Now()
+
+	gs.agentsMux.Lock()
+	defer gs.agentsMux.Unlock()
+	conn, ok := gs.agents[agent.ID]
+	if !ok {
+		conn = &AgentConnection{ID: agent.ID, ConnectedAt: now}
+		gs.agents[agent.ID] = conn
 	}
-
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		i := req.(*AgentInfoMsg)
-		gs.agentsMux.Lock()
-		gs.agents[i.ID] = &AgentConnection{
-			ID:            i.ID,
-			PodName:       i.PodName,
-			Namespace:     i.Namespace,
-			PodIP:         i.PodIP,
-			ConnectedAt:   time.Now(),
-			LastHeartbeat: time.Now(),
-		}
-		gs.agentsMux.Unlock()
-
-		log.Printf("Agent registered: %s (%s/%s)", i.ID, i.Namespace, i.PodName)
-
-		return &RegisterResponseMsg{
-			Success: true,
-			Message: "Agent registered successfully",
-		}, nil
-	}
-
-	if interceptor == nil {
-		return handler(ctx, &info)
-	}
-	return interceptor(ctx, &info, &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/podscope.AgentService/RegisterAgent",
-	}, handler)
+	conn.PodName = agent.PodName
+	conn.Namespace = agent.Namespace
+	conn.PodIP = agent.PodIP
+	conn.NodeName = agent.NodeName
+	conn.ListeningPorts = agent.ListeningPorts
+	conn.LastHeartbeat = now
 }
 
-func (gs *GRPCServer) heartbeatHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	var req HeartbeatRequestMsg
-	if err := dec(&req); err != nil {
-		return nil, err
-	}
-
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		r := req.(*HeartbeatRequestMsg)
-		gs.agentsMux.Lock()
-		if agent, ok := gs.agents[r.AgentID]; ok {
-			agent.LastHeartbeat = time.Now()
+// Heartbeat updates agent liveness and hands back the current BPF filter
+func (gs *GRPCServer) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	gs.agentsMux.Lock()
+	agent, known := gs.agents[req.GetAgentId()]
+	if known {
+		agent.LastHeartbeat = time.Now()
+		if stats := req.GetStats(); stats != nil {
+			agent.Stats = AgentStats{
+				PacketsCaptured: stats.GetPacketsCaptured(),
+				BytesCaptured:   stats.GetBytesCaptured(),
+				FlowsDetected:   stats.GetFlowsDetected(),
+				Errors:          stats.GetErrors(),
+
+				KernelPacketsReceived:   stats.GetKernelPacketsReceived(),
+				KernelPacketsDropped:    stats.GetKernelPacketsDropped(),
+				InterfacePacketsDropped: stats.GetInterfacePacketsDropped(),
+				ActiveFlows:             stats.GetActiveFlows(),
+
+				FlowsSent:                  stats.GetFlowsSent(),
+				FlowsDroppedQueueFull:      stats.GetFlowsDroppedQueueFull(),
+				FlowsDroppedSpoolFull:      stats.GetFlowsDroppedSpoolFull(),
+				FlowsDroppedSendFailed:     stats.GetFlowsDroppedSendFailed(),
+				PCAPBytesSent:              stats.GetPcapBytesSent(),
+				PCAPBytesDroppedQueueFull:  stats.GetPcapBytesDroppedQueueFull(),
+				PCAPBytesDroppedSpoolFull:  stats.GetPcapBytesDroppedSpoolFull(),
+				PCAPBytesDroppedSendFailed: stats.GetPcapBytesDroppedSendFailed(),
+			}
 		}
-		gs.agentsMux.Unlock()
-
-		// Get current BPF filter from server
-		gs.server.bpfFilterMutex.RLock()
-		currentFilter := gs.server.bpfFilter
-		gs.server.bpfFilterMutex.RUnlock()
-
-		return &HeartbeatResponseMsg{
-			ContinueCapture: true,
-			Message:         "OK",
-			BPFFilter:       currentFilter,
-		}, nil
-	}
-
-	if interceptor == nil {
-		return handler(ctx, &req)
 	}
-	return interceptor(ctx, &req, &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/podscope.AgentService/Heartbeat",
-	}, handler)
+	gs.agentsMux.Unlock()
+
+	// Get current BPF filter from server
+	gs.server.bpfFilterMutex.RLock()
+	currentFilter := gs.server.bpfFilter
+	gs.server.bpfFilterMutex.RUnlock()
+
+	return &pb.HeartbeatResponse{
+		ContinueCapture: true,
+		Message:         "OK",
+		BpfFilter:       currentFilter,
+		UnknownAgent:    !known, // e.g. the hub restarted; the agent registers again
+	}, nil
 }
 
-func (gs *GRPCServer) streamFlowsHandler(srv interface{}, stream grpc.ServerStream) error {
+// StreamFlows receives flow events from an agent until it closes the stream
+func (gs *GRPCServer) StreamFlows(stream pb.AgentService_StreamFlowsServer) error {
+	var received int64
 	for {
-		var event FlowEventMsg
-		if err := stream.RecvMsg(&event); err != nil {
+		event, err := stream.Recv()
+		if err != nil {
 			if err == io.EOF {
-				return nil
+				return stream.SendAndClose(&pb.StreamResponse{
+					Success:       true,
+					ReceivedCount: received,
+				})
 			}
 			return err
 		}
+		received++
 
 		// Add flow to server
-		if event.Flow != nil {
-			gs.server.AddFlow(event.Flow)
+		if event.GetFlow() != nil {
+			gs.server.AddFlow(pb.ToFlow(event.GetFlow()))
 		}
 
 		// Update agent stats
 		gs.agentsMux.Lock()
-		if agent, ok := gs.agents[event.AgentID]; ok {
-			agent.Stats.FlowsDetected++
+		if agent, ok := gs.agents[event.GetAgentId()]; ok {
+			agent.FlowsReceived++
 		}
 		gs.agentsMux.Unlock()
 	}
 }
 
-func (gs *GRPCServer) streamPCAPHandler(srv interface{}, stream grpc.ServerStream) error {
+// StreamPCAP receives raw PCAP chunks from an agent until it closes the stream
+func (gs *GRPCServer) StreamPCAP(stream pb.AgentService_StreamPCAPServer) error {
+	var received int64
 	for {
-		var chunk PCAPChunkMsg
-		if err := stream.RecvMsg(&chunk); err != nil {
+		chunk, err := stream.Recv()
+		if err != nil {
 			if err == io.EOF {
-				return nil
+				return stream.SendAndClose(&pb.StreamResponse{
+					Success:       true,
+					ReceivedCount: received,
+				})
 			}
 			return err
 		}
-
-		// Write PCAP data
-		if err := gs.server.AddPCAPData(chunk.AgentID, chunk.Data); err != nil {
-			log.Printf("Failed to write PCAP data: %v", err)
-		}
+		received++
 
 		// Update agent stats
 		gs.agentsMux.Lock()
-		if agent, ok := gs.agents[chunk.AgentID]; ok {
-			agent.Stats.BytesCaptured += uint64(len(chunk.Data))
+		replayed := gs.replayedPCAP(chunk)
+		if agent, ok := gs.agents[chunk.GetAgentId()]; ok && !replayed {
+			agent.PCAPBytesReceived += uint64(len(chunk.GetData()))
 		}
 		gs.agentsMux.Unlock()
+
+		// A chunk sent again after its confirmation was lost is already written
+		if replayed {
+			continue
+		}
+
+		// Write PCAP data
+		if err := gs.server.AddPCAPData(chunk.GetAgentId(), chunk.GetData()); err != nil {
+			log.Printf("Failed to write PCAP data: %v", err)
+		}
+	}
+}
+
+// replayedPCAP reports whether a chunk was already received, and records it
+// as its agent's latest otherwise. Chunks without a number are always new.
+// The caller holds agentsMux.
+func (gs *GRPCServer) replayedPCAP(chunk *pb.PCAPChunk) bool {
+	seq := chunk.GetSeq()
+	if seq == 0 {
+		return false
 	}
+	if seq <= gs.pcapSeq[chunk.GetAgentId()] {
+		return true
+	}
+	if gs.pcapSeq == nil {
+		gs.pcapSeq = make(map[string]uint64)
+	}
+	gs.pcapSeq[chunk.GetAgentId()] = seq
+	return false
 }
 
 // GetConnectedAgents returns a list of connected agents
 func (gs *GRPCServer) GetConnectedAgents() []AgentConnection {
 	gs.agentsMux.RLock()
-	defer gs.agentsMux.RUnlock()
-
 	agents := make([]AgentConnection, 0, len(gs.agents))
 	for _, agent := range gs.agents {
 		agents = append(agents, *agent)
 	}
+	gs.agentsMux.RUnlock()
+
+	for i := range agents {
+		agents[i].PCAPBytesDropped = uint64(gs.server.pcapBuffer.DroppedBytes(agents[i].ID))
+	}
 	return agents
 }
+
+// AgentStatuses returns every registered agent with its health, ordered by
+// namespace, pod and ID
+func (gs *GRPCServer) AgentStatuses(now time.Time) []AgentStatus {
+	agents := gs.GetConnectedAgents()
+	statuses := make([]AgentStatus, 0, len(agents))
+	for _, agent := range agents {
+		statuses = append(statuses, AgentStatus{
+			AgentConnection: agent,
+			Health:          agentHealth(agent.LastHeartbeat, now),
+			Completeness:    captureCompleteness([]AgentConnection{agent}),
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.PodName != b.PodName {
+			return a.PodName < b.PodName
+		}
+		return a.ID < b.ID
+	})
+	return statuses
+}
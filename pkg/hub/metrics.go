@@ -0,0 +1,295 @@
+package hub
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// flowDurationBuckets are the upper bounds, in seconds, of the flow
+// duration histogram. Flows range from sub-millisecond DNS lookups to
+// connections held open for the whole session.
+var flowDurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 1800}
+
+// HubMetrics counts what the hub has received, for the Prometheus endpoint.
+// Gauges such as buffer sizes are read from their owners when scraped.
+type HubMetrics struct {
+	flowsReceived     atomic.Uint64
+	broadcastsDropped atomic.Uint64 // WebSocket messages a client failed to take
+
+	mutex         sync.Mutex
+	requests      map[int]uint64    // HTTP responses by status code
+	tlsVersions   map[string]uint64 // TLS connections by negotiated version
+	flowDurations map[protocol.Protocol]*histogram
+}
+
+// NewHubMetrics creates zeroed metrics
+func NewHubMetrics() *HubMetrics {
+	return &HubMetrics{
+		requests:      make(map[int]uint64),
+		tlsVersions:   make(map[string]uint64),
+		flowDurations: make(map[protocol.Protocol]*histogram),
+	}
+}
+
+// add counts the traffic an update brings. Durations are only known once
+// a flow has ended.
+func (m *HubMetrics) add(u *flowUpdate, now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, ex := range u.exchanges {
+		if ex.StatusCode != 0 {
+			m.requests[ex.StatusCode]++
+		}
+	}
+
+	if u.tls {
+		m.tlsVersions[u.flow.TLS.Version]++
+	}
+
+	if u.final {
+		h := m.flowDurations[u.flow.Protocol]
+		if h == nil {
+			h = newHistogram(flowDurationBuckets)
+			m.flowDurations[u.flow.Protocol] = h
+		}
+		h.observe(float64(u.flow.Duration) / 1000)
+	}
+}
+
+// handleMetrics serves hub, agent and traffic metrics in the Prometheus
+// text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p := &promWriter{w: bufio.NewWriter(w)}
+	defer p.w.Flush()
+
+	s.writeHubMetrics(p)
+	s.writeAgentMetrics(p)
+	s.metrics.write(p)
+}
+
+// writeHubMetrics reports the hub's own buffers and clients
+func (s *Server) writeHubMetrics(p *promWriter) {
+	s.wsMutex.Lock()
+	clients := len(s.wsClients)
+	s.wsMutex.Unlock()
+
+	s.pausedMutex.RLock()
+	paused := s.paused
+	s.pausedMutex.RUnlock()
+
+	pcap := s.pcapBuffer.Stats()
+
+	p.family("podscope_hub_flows_received_total", "counter", "Flow events received from agents, including snapshots of open flows.")
+	p.sample("podscope_hub_flows_received_total", float64(s.metrics.flowsReceived.Load()))
+	p.family("podscope_hub_flows_stored", "gauge", "Flows held in the ring buffer.")
+	p.sample("podscope_hub_flows_stored", float64(s.flowBuffer.Size()))
+	p.family("podscope_hub_flow_buffer_capacity", "gauge", "Flows the ring buffer can hold.")
+	p.sample("podscope_hub_flow_buffer_capacity", float64(s.flowBuffer.Capacity()))
+	p.family("podscope_hub_flow_buffer_evictions_total", "counter", "Flows dropped from the ring buffer to make room for newer ones.")
+	p.sample("podscope_hub_flow_buffer_evictions_total", float64(s.flowBuffer.Evicted()))
+
+	p.family("podscope_hub_pcap_bytes_stored", "gauge", "PCAP bytes on disk.")
+	p.sample("podscope_hub_pcap_bytes_stored", float64(s.pcapBuffer.Size()))
+	p.family("podscope_hub_pcap_bytes_max", "gauge", "PCAP storage limit in bytes.")
+	p.sample("podscope_hub_pcap_bytes_max", float64(pcap.MaxSize))
+	p.family("podscope_hub_pcap_evicted_bytes_total", "counter", "PCAP bytes deleted by ring retention.")
+	p.sample("podscope_hub_pcap_evicted_bytes_total", float64(pcap.EvictedBytes))
+	p.family("podscope_hub_pcap_dropped_bytes_total", "counter", "PCAP bytes not stored because storage was full.")
+	p.sample("podscope_hub_pcap_dropped_bytes_total", float64(pcap.DroppedBytes))
+	p.family("podscope_hub_pcap_full", "gauge", "1 when PCAP storage is full and new data is dropped.")
+	p.sample("podscope_hub_pcap_full", boolValue(s.pcapBuffer.IsFull()))
+	p.family("podscope_hub_paused", "gauge", "1 while PCAP capture is paused.")
+	p.sample("podscope_hub_paused", boolValue(paused))
+
+	p.family("podscope_hub_websocket_clients", "gauge", "Connected UI WebSocket clients.")
+	p.sample("podscope_hub_websocket_clients", float64(clients))
+	p.family("podscope_hub_websocket_dropped_broadcasts_total", "counter", "WebSocket messages that could not be written to a client.")
+	p.sample("podscope_hub_websocket_dropped_broadcasts_total", float64(s.metrics.broadcastsDropped.Load()))
+}
+
+// writeAgentMetrics reports each connected agent's counters
+func (s *Server) writeAgentMetrics(p *promWriter) {
+	var agents []AgentConnection
+	if s.agents != nil {
+		agents = s.agents.GetConnectedAgents()
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+
+	p.family("podscope_agents_connected", "gauge", "Agents registered with the hub.")
+	p.sample("podscope_agents_connected", float64(len(agents)))
+
+	families := []struct {
+		name, typ, help string
+		value           func(a *AgentConnection) float64
+	}{
+		{"podscope_agent_last_heartbeat_timestamp_seconds", "gauge", "Unix time of the agent's last heartbeat.",
+			func(a *AgentConnection) float64 { return float64(a.LastHeartbeat.UnixNano()) / 1e9 }},
+		{"podscope_agent_packets_captured_total", "counter", "Packets captured, as reported by the agent.",
+			func(a *AgentConnection) float64 { return float64(a.Stats.PacketsCaptured) }},
+		{"podscope_agent_bytes_captured_total", "counter", "Bytes captured, as reported by the agent.",
+			func(a *AgentConnection) float64 { return float64(a.Stats.BytesCaptured) }},
+		{"podscope_agent_flows_detected_total", "counter", "Flows detected, as reported by the agent.",
+			func(a *AgentConnection) float64 { return float64(a.Stats.FlowsDetected) }},
+		{"podscope_agent_errors_total", "counter", "Capture errors, as reported by the agent.",
+			func(a *AgentConnection) float64 { return float64(a.Stats.Errors) }},
+		{"podscope_agent_kernel_packets_dropped_total", "counter", "Packets the capture buffer dropped, as reported by the agent.",
+			func(a *AgentConnection) float64 { return float64(a.Stats.KernelPacketsDropped) }},
+		{"podscope_agent_interface_packets_dropped_total", "counter", "Packets the network interface dropped, as reported by the agent.",
+			func(a *AgentConnection) float64 { return float64(a.Stats.InterfacePacketsDropped) }},
+		{"podscope_agent_active_flows", "gauge", "Connections the agent is assembling.",
+			func(a *AgentConnection) float64 { return float64(a.Stats.ActiveFlows) }},
+		{"podscope_agent_flows_dropped_total", "counter", "Flow events dropped before reaching the hub, as reported by the agent.",
+			func(a *AgentConnection) float64 {
+				return float64(a.Stats.FlowsDroppedQueueFull + a.Stats.FlowsDroppedSpoolFull + a.Stats.FlowsDroppedSendFailed)
+			}},
+		{"podscope_agent_pcap_bytes_dropped_total", "counter", "PCAP bytes dropped by the agent or not stored by the hub.",
+			func(a *AgentConnection) float64 {
+				return float64(a.Stats.PCAPBytesDroppedQueueFull + a.Stats.PCAPBytesDroppedSpoolFull + a.Stats.PCAPBytesDroppedSendFailed + a.PCAPBytesDropped)
+			}},
+		{"podscope_agent_capture_completeness_ratio", "gauge", "Share of the agent's traffic that survived every drop point.",
+			func(a *AgentConnection) float64 { return captureCompleteness([]AgentConnection{*a}).Overall }},
+		{"podscope_agent_flows_received_total", "counter", "Flow events the hub received from the agent.",
+			func(a *AgentConnection) float64 { return float64(a.FlowsReceived) }},
+		{"podscope_agent_pcap_bytes_received_total", "counter", "PCAP bytes the hub received from the agent.",
+			func(a *AgentConnection) float64 { return float64(a.PCAPBytesReceived) }},
+	}
+	for _, f := range families {
+		p.family(f.name, f.typ, f.help)
+		for i := range agents {
+			a := &agents[i]
+			p.sample(f.name, f.value(a), "agent", a.ID, "namespace", a.Namespace, "pod", a.PodName)
+		}
+	}
+}
+
+// write reports the traffic seen in flows
+func (m *HubMetrics) write(p *promWriter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	p.family("podscope_http_requests_total", "counter", "HTTP responses seen, by status code.")
+	codes := make([]int, 0, len(m.requests))
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		p.sample("podscope_http_requests_total", float64(m.requests[code]), "code", strconv.Itoa(code))
+	}
+
+	p.family("podscope_tls_connections_total", "counter", "TLS connections seen, by negotiated version.")
+	versions := make([]string, 0, len(m.tlsVersions))
+	for v := range m.tlsVersions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	for _, v := range versions {
+		p.sample("podscope_tls_connections_total", float64(m.tlsVersions[v]), "version", v)
+	}
+
+	p.family("podscope_flow_duration_seconds", "histogram", "Duration of finished flows, by protocol.")
+	protocols := make([]string, 0, len(m.flowDurations))
+	for proto := range m.flowDurations {
+		protocols = append(protocols, string(proto))
+	}
+	sort.Strings(protocols)
+	for _, proto := range protocols {
+		p.histogram("podscope_flow_duration_seconds", m.flowDurations[protocol.Protocol(proto)], "protocol", proto)
+	}
+}
+
+// histogram counts observations into fixed buckets
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// promWriter writes the Prometheus text exposition format
+type promWriter struct {
+	w *bufio.Writer
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// family writes the HELP and TYPE lines that precede a metric's samples
+func (p *promWriter) family(name, typ, help string) {
+	p.w.WriteString("# HELP " + name + " " + help + "\n")
+	p.w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes one value. labels are name, value pairs.
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	p.w.WriteString(name)
+	if len(labels) > 0 {
+		p.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.w.WriteByte(',')
+			}
+			p.w.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		p.w.WriteByte('}')
+	}
+	p.w.WriteByte(' ')
+	p.w.WriteString(formatValue(value))
+	p.w.WriteByte('\n')
+}
+
+// histogram writes cumulative buckets, then the sum and count
+func (p *promWriter) histogram(name string, h *histogram, labels ...string) {
+	var cumulative uint64
+	for i, n := range h.counts {
+		cumulative += n
+		le := math.Inf(1)
+		if i < len(h.bounds) {
+			le = h.bounds[i]
+		}
+		bucket := append(append([]string(nil), labels...), "le", formatValue(le))
+		p.sample(name+"_bucket", float64(cumulative), bucket...)
+	}
+	p.sample(name+"_sum", h.sum, labels...)
+	p.sample(name+"_count", float64(h.count), labels...)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,166 @@
+package hub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+	"github.com/podscope/podscope/pkg/protocol/pb"
+)
+
+// scrape fetches /metrics and returns its sample lines
+func scrape(t *testing.T, s *Server) map[string]bool {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.handleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines[line] = true
+		}
+	}
+	return lines
+}
+
+func TestHandleMetrics_Hub(t *testing.T) {
+	s := setupTestServer(t)
+	s.flowBuffer = NewFlowRingBuffer(2)
+	for _, id := range []string{"f1", "f2", "f3"} {
+		s.AddFlow(&protocol.Flow{ID: id, Protocol: protocol.ProtocolTCP, Status: protocol.StatusClosed})
+	}
+	s.AddPCAPData("agent-1", make([]byte, 100))
+
+	if s.pcapBuffer.Size() == 0 {
+		t.Fatal("PCAP data was not stored")
+	}
+
+	lines := scrape(t, s)
+	for _, want := range []string{
+		fmt.Sprintf("podscope_hub_pcap_bytes_stored %d", s.pcapBuffer.Size()),
+		"podscope_hub_flows_received_total 3",
+		"podscope_hub_flows_stored 2",
+		"podscope_hub_flow_buffer_capacity 2",
+		"podscope_hub_flow_buffer_evictions_total 1",
+		"podscope_hub_websocket_clients 0",
+		"podscope_hub_websocket_dropped_broadcasts_total 0",
+		"podscope_agents_connected 0",
+	} {
+		if !lines[want] {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+func TestHandleMetrics_Agents(t *testing.T) {
+	s := setupTestServer(t)
+	s.agents = &GRPCServer{server: s, agents: make(map[string]*AgentConnection)}
+
+	if _, err := s.agents.RegisterAgent(context.Background(), &pb.AgentInfo{Id: "agent-1", PodName: "web", Namespace: "prod"}); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	if _, err := s.agents.Heartbeat(context.Background(), &pb.HeartbeatRequest{
+		AgentId: "agent-1",
+		Stats:   &pb.AgentStats{PacketsCaptured: 1500, BytesCaptured: 900000, FlowsDetected: 12, Errors: 2},
+	}); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	s.agents.agents["agent-1"].FlowsReceived = 10
+
+	lines := scrape(t, s)
+	for _, want := range []string{
+		"podscope_agents_connected 1",
+		`podscope_agent_packets_captured_total{agent="agent-1",namespace="prod",pod="web"} 1500`,
+		`podscope_agent_bytes_captured_total{agent="agent-1",namespace="prod",pod="web"} 900000`,
+		`podscope_agent_flows_detected_total{agent="agent-1",namespace="prod",pod="web"} 12`,
+		`podscope_agent_errors_total{agent="agent-1",namespace="prod",pod="web"} 2`,
+		`podscope_agent_flows_received_total{agent="agent-1",namespace="prod",pod="web"} 10`,
+	} {
+		if !lines[want] {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+func TestHandleMetrics_Traffic(t *testing.T) {
+	s := setupTestServer(t)
+
+	// Snapshots of an open connection count each response once
+	open := webToAPI("f1", protocol.StatusOpen, exchange(200, 5))
+	s.AddFlow(open)
+	closed := webToAPI("f1", protocol.StatusClosed, exchange(200, 5), exchange(503, 5))
+	closed.Duration = 250
+	s.AddFlow(closed)
+
+	tls := &protocol.Flow{ID: "f2", Protocol: protocol.ProtocolTLS, Status: protocol.StatusOpen, TLS: &protocol.TLSInfo{Version: "TLS 1.3"}}
+	s.AddFlow(tls)
+	s.AddFlow(tls)
+
+	lines := scrape(t, s)
+	for _, want := range []string{
+		`podscope_http_requests_total{code="200"} 1`,
+		`podscope_http_requests_total{code="503"} 1`,
+		`podscope_tls_connections_total{version="TLS 1.3"} 1`,
+		`podscope_flow_duration_seconds_bucket{protocol="HTTP",le="0.1"} 0`,
+		`podscope_flow_duration_seconds_bucket{protocol="HTTP",le="0.5"} 1`,
+		`podscope_flow_duration_seconds_bucket{protocol="HTTP",le="+Inf"} 1`,
+		`podscope_flow_duration_seconds_sum{protocol="HTTP"} 0.25`,
+		`podscope_flow_duration_seconds_count{protocol="HTTP"} 1`,
+	} {
+		if !lines[want] {
+			t.Errorf("missing %q", want)
+		}
+	}
+	// The TLS flow is still open, so it has no duration yet
+	for line := range lines {
+		if strings.Contains(line, `protocol="TLS"`) {
+			t.Errorf("unexpected %q", line)
+		}
+	}
+}
+
+func TestPromWriter_EscapesLabels(t *testing.T) {
+	var b strings.Builder
+	p := &promWriter{w: bufio.NewWriter(&b)}
+	p.sample("m", 1.5, "pod", "a\"b\\c\nd")
+	p.w.Flush()
+
+	if want := `m{pod="a\"b\\c\nd"} 1.5` + "\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestHeartbeat_KeepsHubCounters(t *testing.T) {
+	s := setupTestServer(t)
+	gs := &GRPCServer{server: s, agents: map[string]*AgentConnection{
+		"agent-1": {ID: "agent-1", FlowsReceived: 4, PCAPBytesReceived: 2048},
+	}}
+	before := time.Now()
+
+	gs.Heartbeat(context.Background(), &pb.HeartbeatRequest{AgentId: "agent-1", Stats: &pb.AgentStats{
+		PacketsCaptured: 7, KernelPacketsDropped: 2, ActiveFlows: 5,
+	}})
+
+	agent := gs.agents["agent-1"]
+	if agent.Stats.PacketsCaptured != 7 || agent.FlowsReceived != 4 || agent.PCAPBytesReceived != 2048 {
+		t.Errorf("agent = %+v, want reported stats alongside the hub's counts", agent)
+	}
+	if agent.Stats.KernelPacketsDropped != 2 || agent.Stats.ActiveFlows != 5 {
+		t.Errorf("agent.Stats = %+v, want kernel drops and active flows", agent.Stats)
+	}
+	if agent.LastHeartbeat.Before(before) {
+		t.Error("LastHeartbeat was not updated")
+	}
+}
@@ -1,12 +1,17 @@
 package hub
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -23,30 +28,220 @@ const (
 	pcapSnaplen = 65535
 )
 
+// PCAPRetention selects what happens once the buffer reaches its max size
+type PCAPRetention string
+
+const (
+	// PCAPRetentionRing deletes the oldest segments to make room for new data
+	PCAPRetentionRing PCAPRetention = "ring"
+	// PCAPRetentionStop stops storing data until the buffer is reset
+	PCAPRetentionStop PCAPRetention = "stop"
+)
+
 // PCAPBuffer manages PCAP data storage
 type PCAPBuffer struct {
-	dir        string
-	maxSize    int64
-	mutex      sync.RWMutex
-	agents     map[string]*agentBuffer
-	totalSize  int64
-	bufferFull bool
+	dir         string
+	maxSize     int64
+	retention   PCAPRetention
+	segmentSize int64 // ring mode: rotate agent files once they exceed this
+	mutex       sync.RWMutex
+	agents      map[string]*agentBuffer
+	names       map[string]string // agent ID -> namespace/pod
+	totalSize   int64
+	bufferFull  bool
+	dropped     map[string]int64 // agent ID -> bytes not stored for lack of room
+
+	// Ring mode bookkeeping
+	segmentSeq      uint64 // orders segments across agents by creation
+	evictedSegments uint64
+	evictedBytes    int64
 }
 
-// agentBuffer stores PCAP data from a single agent
+// agentBuffer stores PCAP data from a single agent as one or more segment
+// files. Only the last segment is open for writing.
 type agentBuffer struct {
-	agentID  string
+	agentID   string
+	segments  []*pcapSegment // oldest first
+	nextIndex int            // file name suffix for the next segment
+}
+
+// pcapSegment is a single agent PCAP file on disk
+type pcapSegment struct {
+	seq      uint64
 	filePath string
-	file     *os.File
-	size     int64
+	file     *os.File // nil once rotated out
+	size     int64    // file size including the global header
+	resume   bool     // left by a previous run; reopened for appending on the next write
+}
+
+// PCAPBufferStats describes storage usage and retention
+type PCAPBufferStats struct {
+	Retention       PCAPRetention `json:"retention"`
+	MaxSize         int64         `json:"maxSize"`
+	SegmentSize     int64         `json:"segmentSize"`
+	Segments        int           `json:"segments"`
+	EvictedSegments uint64        `json:"evictedSegments"`
+	EvictedBytes    int64         `json:"evictedBytes"`
+	DroppedBytes    int64         `json:"droppedBytes"`
 }
 
-// NewPCAPBuffer creates a new PCAP buffer
+// NewPCAPBuffer creates a new PCAP buffer that stops capturing when full
 func NewPCAPBuffer(dir string, maxSize int64) *PCAPBuffer {
-	return &PCAPBuffer{
-		dir:     dir,
-		maxSize: maxSize,
-		agents:  make(map[string]*agentBuffer),
+	return NewPCAPBufferWithRetention(dir, maxSize, PCAPRetentionStop, 0)
+}
+
+// NewPCAPBufferWithRetention creates a new PCAP buffer with the given retention
+// mode. In ring mode agent files are rotated into segments of segmentSize bytes
+// and the oldest segments are deleted when maxSize is reached.
+func NewPCAPBufferWithRetention(dir string, maxSize int64, retention PCAPRetention, segmentSize int64) *PCAPBuffer {
+	p := &PCAPBuffer{
+		dir:         dir,
+		maxSize:     maxSize,
+		retention:   retention,
+		segmentSize: segmentSize,
+		agents:      make(map[string]*agentBuffer),
+		names:       make(map[string]string),
+		dropped:     make(map[string]int64),
+	}
+	p.adoptSegments()
+	return p
+}
+
+// adoptSegments picks up the agent files a previous run left in the
+// directory, so a hub restart neither truncates them nor hides them from
+// downloads and retention. A trailing record cut short by the restart is
+// dropped so appending can carry on.
+func (p *PCAPBuffer) adoptSegments() {
+	paths, err := filepath.Glob(filepath.Join(p.dir, "agent-*.pcap"))
+	if err != nil || len(paths) == 0 {
+		return
+	}
+
+	stems := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		stems[segmentStem(path)] = true
+	}
+
+	type adopted struct {
+		agentID string
+		index   int
+		modTime time.Time
+		seg     *pcapSegment
+	}
+	var found []adopted
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		size, err := completePCAPSize(path)
+		if err != nil {
+			log.Printf("Ignoring pcap file %s: %v", path, err)
+			continue
+		}
+		if size < info.Size() {
+			if err := os.Truncate(path, size); err != nil {
+				log.Printf("Ignoring pcap file %s: %v", path, err)
+				continue
+			}
+		}
+
+		agentID, index := segmentOwner(segmentStem(path), stems)
+		found = append(found, adopted{
+			agentID: agentID,
+			index:   index,
+			modTime: info.ModTime(),
+			seg:     &pcapSegment{filePath: path, size: size},
+		})
+	}
+
+	// Segments are evicted across agents in the order they were written
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].modTime.Equal(found[j].modTime) {
+			return found[i].modTime.Before(found[j].modTime)
+		}
+		return found[i].index < found[j].index
+	})
+	for _, f := range found {
+		p.segmentSeq++
+		f.seg.seq = p.segmentSeq
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].agentID != found[j].agentID {
+			return found[i].agentID < found[j].agentID
+		}
+		return found[i].index < found[j].index
+	})
+	for _, f := range found {
+		ab, ok := p.agents[f.agentID]
+		if !ok {
+			ab = &agentBuffer{agentID: f.agentID}
+			p.agents[f.agentID] = ab
+		}
+		ab.segments = append(ab.segments, f.seg)
+		if f.index >= ab.nextIndex {
+			ab.nextIndex = f.index + 1
+		}
+		p.totalSize += f.seg.size - pcapGlobalHeaderSize
+	}
+	for _, ab := range p.agents {
+		ab.segments[len(ab.segments)-1].resume = true
+	}
+
+	if len(found) > 0 {
+		log.Printf("Adopted %d pcap segments (%d bytes) from a previous run", len(found), p.totalSize)
+	}
+}
+
+// segmentStem returns the part of an agent file name between "agent-" and ".pcap"
+func segmentStem(path string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "agent-"), ".pcap")
+}
+
+// segmentOwner splits a file stem into agent ID and segment index. A
+// "<id>-<n>" stem is only taken as segment n of <id> when that agent's
+// first file is there too, so IDs that end in a number still read back
+// whole. Segments whose first file was evicted come back as agents of their
+// own, which keeps their packets but not the agent's name.
+func segmentOwner(stem string, stems map[string]bool) (string, int) {
+	i := strings.LastIndex(stem, "-")
+	if i <= 0 {
+		return stem, 0
+	}
+	n, err := strconv.Atoi(stem[i+1:])
+	if err != nil || n <= 0 || !stems[stem[:i]] {
+		return stem, 0
+	}
+	return stem[:i], n
+}
+
+// completePCAPSize returns the size of an agent file up to its last
+// complete record
+func completePCAPSize(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var header [pcapGlobalHeaderSize]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil {
+		return 0, fmt.Errorf("missing pcap header")
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != pcapMagicNumber {
+		return 0, fmt.Errorf("not a pcap file written by the hub")
+	}
+
+	pr := newPCAPRecordReader(file)
+	pr.header = true
+	size := int64(pcapGlobalHeaderSize)
+	for {
+		rec, err := pr.next()
+		if err != nil {
+			return size, nil
+		}
+		size += pcapRecordHeaderSize + int64(len(rec.data))
 	}
 }
 
@@ -55,39 +250,22 @@ func (p *PCAPBuffer) Write(agentID string, data []byte) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	// If buffer is already full, silently drop new data
+	// If buffer is already full, drop new data
 	if p.bufferFull {
+		p.dropped[agentID] += int64(len(data))
 		return nil
 	}
 
 	// Get or create agent buffer
 	ab, exists := p.agents[agentID]
 	if !exists {
-		filePath := filepath.Join(p.dir, fmt.Sprintf("agent-%s.pcap", agentID))
-		file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to create pcap file: %w", err)
-		}
-
-		// Write PCAP global header for new files
-		var headerBuf bytes.Buffer
-		if err := writePCAPHeader(&headerBuf); err != nil {
-			file.Close()
-			return fmt.Errorf("failed to write pcap header: %w", err)
-		}
-		if _, err := file.Write(headerBuf.Bytes()); err != nil {
-			file.Close()
-			return fmt.Errorf("failed to write pcap header to file: %w", err)
-		}
-
-		ab = &agentBuffer{
-			agentID:  agentID,
-			filePath: filePath,
-			file:     file,
-			size:     int64(headerBuf.Len()), // Account for header size
-		}
+		ab = &agentBuffer{agentID: agentID}
 		p.agents[agentID] = ab
 	}
+	seg, err := p.currentSegment(ab)
+	if err != nil {
+		return err
+	}
 
 	// Strip PCAP header from data if present (agent's first chunk includes header)
 	// PCAP magic number is 0xd4c3b2a1 (little-endian) or 0xa1b2c3d4 (big-endian)
@@ -98,27 +276,145 @@ func (p *PCAPBuffer) Write(agentID string, data []byte) error {
 		// This chunk has a PCAP header, skip it
 		dataToWrite = data[24:]
 	}
+	n := int64(len(dataToWrite))
+
+	if p.retention == PCAPRetentionRing {
+		// Rotate before the segment outgrows its size so segments hold whole chunks
+		if p.segmentSize > 0 && seg.size > pcapGlobalHeaderSize && seg.size-pcapGlobalHeaderSize+n > p.segmentSize {
+			seg.file.Close()
+			seg.file = nil
+			if seg, err = p.currentSegment(ab); err != nil {
+				return err
+			}
+		}
 
-	// Check if adding this data would exceed the max size
-	// If so, mark buffer as full and stop capturing
-	if p.maxSize > 0 && p.totalSize+int64(len(dataToWrite)) > p.maxSize {
+		if p.maxSize > 0 && !p.evict(n, seg) {
+			log.Printf("PCAP chunk of %d bytes from agent %s exceeds ring capacity, dropping", n, agentID)
+			p.dropped[agentID] += n
+			return nil
+		}
+	} else if p.maxSize > 0 && p.totalSize+n > p.maxSize {
+		// Check if adding this data would exceed the max size
+		// If so, mark buffer as full and stop capturing
 		p.bufferFull = true
+		p.dropped[agentID] += n
 		fmt.Printf("PCAP buffer full (%d bytes). Reset to continue capturing.\n", p.totalSize)
 		return nil
 	}
 
 	// Write data
-	n, err := ab.file.Write(dataToWrite)
+	written, err := seg.file.Write(dataToWrite)
 	if err != nil {
 		return fmt.Errorf("failed to write pcap data: %w", err)
 	}
 
-	ab.size += int64(n)
-	p.totalSize += int64(n)
+	seg.size += int64(written)
+	p.totalSize += int64(written)
 
 	return nil
 }
 
+// currentSegment returns the agent's writable segment, opening a new one
+// (with a PCAP global header) if needed. A segment left by a previous run
+// is appended to. Caller must hold the write lock.
+func (p *PCAPBuffer) currentSegment(ab *agentBuffer) (*pcapSegment, error) {
+	if n := len(ab.segments); n > 0 {
+		last := ab.segments[n-1]
+		if last.file != nil {
+			return last, nil
+		}
+		if last.resume {
+			file, err := os.OpenFile(last.filePath, os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to reopen pcap file: %w", err)
+			}
+			last.file = file
+			last.resume = false
+			return last, nil
+		}
+	}
+
+	var filePath string
+	var file *os.File
+	for {
+		name := fmt.Sprintf("agent-%s.pcap", ab.agentID)
+		if ab.nextIndex > 0 {
+			name = fmt.Sprintf("agent-%s-%d.pcap", ab.agentID, ab.nextIndex)
+		}
+		filePath = filepath.Join(p.dir, name)
+
+		var err error
+		file, err = os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if os.IsExist(err) {
+			// Never overwrite a capture, e.g. one a previous run couldn't attribute
+			ab.nextIndex++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pcap file: %w", err)
+		}
+		break
+	}
+
+	// Write PCAP global header for new files
+	var headerBuf bytes.Buffer
+	if err := writePCAPHeader(&headerBuf); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write pcap header: %w", err)
+	}
+	if _, err := file.Write(headerBuf.Bytes()); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write pcap header to file: %w", err)
+	}
+
+	p.segmentSeq++
+	ab.nextIndex++
+	seg := &pcapSegment{
+		seq:      p.segmentSeq,
+		filePath: filePath,
+		file:     file,
+		size:     int64(headerBuf.Len()), // Account for header size
+	}
+	ab.segments = append(ab.segments, seg)
+
+	return seg, nil
+}
+
+// evict deletes the oldest segments, across all agents, until n more bytes
+// fit within maxSize. The segment about to be written is never evicted.
+// Returns false if enough room can't be made. Caller must hold the write lock.
+func (p *PCAPBuffer) evict(n int64, keep *pcapSegment) bool {
+	for p.totalSize+n > p.maxSize {
+		var oldestAgent *agentBuffer
+		for _, ab := range p.agents {
+			if len(ab.segments) == 0 || ab.segments[0] == keep {
+				continue
+			}
+			if oldestAgent == nil || ab.segments[0].seq < oldestAgent.segments[0].seq {
+				oldestAgent = ab
+			}
+		}
+		if oldestAgent == nil {
+			return false
+		}
+
+		seg := oldestAgent.segments[0]
+		oldestAgent.segments = oldestAgent.segments[1:]
+		if seg.file != nil {
+			seg.file.Close()
+		}
+		if err := os.Remove(seg.filePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete pcap segment %s: %v", seg.filePath, err)
+		}
+
+		dataSize := seg.size - pcapGlobalHeaderSize
+		p.totalSize -= dataSize
+		p.evictedSegments++
+		p.evictedBytes += dataSize
+	}
+	return true
+}
+
 // Size returns the total size of PCAP data
 func (p *PCAPBuffer) Size() int64 {
 	p.mutex.RLock()
@@ -135,43 +431,100 @@ func (p *PCAPBuffer) IsFull() bool {
 
 // GetSessionPCAP returns all PCAP data for the session merged into a single file
 func (p *PCAPBuffer) GetSessionPCAP() ([]byte, error) {
-	p.mutex.RLock()
-	defer p.mutex.RUnlock()
-
 	var buf bytes.Buffer
-
-	// Write PCAP global header
-	if err := writePCAPHeader(&buf); err != nil {
+	if err := p.WriteSessionPCAP(&buf, nil); err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	// Merge all agent PCAP files
-	for _, ab := range p.agents {
-		if err := ab.file.Sync(); err != nil {
+// WriteSessionPCAP streams the session's packets to w as a single libpcap
+// file, merging all agent files in timestamp order. When m is non-nil only
+// the records it accepts are written.
+func (p *PCAPBuffer) WriteSessionPCAP(w io.Writer, m recordMatcher) error {
+	return p.writeSession(&libpcapEncoder{w: w}, m)
+}
+
+// WriteSessionPCAPNG streams the session's packets to w as a pcapng file with
+// one interface per agent. comment, when non-nil, supplies per-packet comments.
+func (p *PCAPBuffer) WriteSessionPCAPNG(w io.Writer, m recordMatcher, comment func(rec *pcapRecord) string) error {
+	return p.writeSession(&pcapngEncoder{w: w, comment: comment}, m)
+}
+
+// writeSession merges the agent files through enc. The buffer lock is only
+// held while the agent files are snapshotted, so slow readers don't block agents.
+func (p *PCAPBuffer) writeSession(enc sessionEncoder, m recordMatcher) error {
+	sources := p.snapshot()
+
+	if err := enc.begin(sources); err != nil {
+		return err
+	}
+
+	merger := newPCAPMerger(sources)
+	defer merger.close()
+
+	for {
+		rec, src, ok := merger.next()
+		if !ok {
+			break
+		}
+		if m != nil && !m.matches(rec) {
 			continue
 		}
+		if err := enc.record(src, rec); err != nil {
+			return err
+		}
+	}
 
-		// Read from the file
-		data, err := os.ReadFile(ab.filePath)
-		if err != nil {
+	return enc.end()
+}
+
+// SetAgentName records a human readable name (namespace/pod) for an agent.
+// Names outlive Reset since agents keep streaming after a reset.
+func (p *PCAPBuffer) SetAgentName(agentID, name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.names[agentID] = name
+}
+
+// snapshot syncs every agent file and records how much of it is complete.
+// Readers stop at the recorded size so records appended later are ignored.
+func (p *PCAPBuffer) snapshot() []pcapSource {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	sources := make([]pcapSource, 0, len(p.agents))
+	for _, ab := range p.agents {
+		var segments []segmentSnapshot
+		for _, seg := range ab.segments {
+			if seg.file != nil {
+				if err := seg.file.Sync(); err != nil {
+					continue
+				}
+			}
+			segments = append(segments, segmentSnapshot{filePath: seg.filePath, size: seg.size})
+		}
+		if len(segments) == 0 {
 			continue
 		}
 
-		// Each agent file has a 24-byte PCAP global header at the start
-		// Skip it and append only the packet records
-		if len(data) > 24 {
-			buf.Write(data[24:])
+		name := p.names[ab.agentID]
+		if name == "" {
+			name = ab.agentID
 		}
+		sources = append(sources, pcapSource{
+			agentID:  ab.agentID,
+			name:     name,
+			segments: segments,
+		})
 	}
 
-	return buf.Bytes(), nil
-}
+	// Stable agent order so records with equal timestamps are deterministic
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].agentID < sources[j].agentID
+	})
 
-// GetStreamPCAP returns PCAP data for a specific stream
-func (p *PCAPBuffer) GetStreamPCAP(streamID string) ([]byte, error) {
-	// For MVP, we return all data - stream filtering would require packet parsing
-	// TODO: Implement stream-specific filtering
-	return p.GetSessionPCAP()
+	return sources
 }
 
 // Reset clears all PCAP data and deletes files
@@ -181,14 +534,16 @@ func (p *PCAPBuffer) Reset() error {
 
 	// Close and delete all agent files
 	for _, ab := range p.agents {
-		if ab.file != nil {
-			ab.file.Close()
-		}
-		// Delete the file
-		if err := os.Remove(ab.filePath); err != nil {
-			// Log but don't fail if file doesn't exist
-			if !os.IsNotExist(err) {
-				return fmt.Errorf("failed to delete pcap file: %w", err)
+		for _, seg := range ab.segments {
+			if seg.file != nil {
+				seg.file.Close()
+			}
+			// Delete the file
+			if err := os.Remove(seg.filePath); err != nil {
+				// Log but don't fail if file doesn't exist
+				if !os.IsNotExist(err) {
+					return fmt.Errorf("failed to delete pcap file: %w", err)
+				}
 			}
 		}
 	}
@@ -197,18 +552,56 @@ func (p *PCAPBuffer) Reset() error {
 	p.agents = make(map[string]*agentBuffer)
 	p.totalSize = 0
 	p.bufferFull = false
+	p.evictedSegments = 0
+	p.evictedBytes = 0
 
 	return nil
 }
 
+// Stats returns storage usage and retention counters
+func (p *PCAPBuffer) Stats() PCAPBufferStats {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	segments := 0
+	for _, ab := range p.agents {
+		segments += len(ab.segments)
+	}
+	var dropped int64
+	for _, n := range p.dropped {
+		dropped += n
+	}
+
+	return PCAPBufferStats{
+		Retention:       p.retention,
+		MaxSize:         p.maxSize,
+		SegmentSize:     p.segmentSize,
+		Segments:        segments,
+		EvictedSegments: p.evictedSegments,
+		EvictedBytes:    p.evictedBytes,
+		DroppedBytes:    dropped,
+	}
+}
+
+// DroppedBytes returns how many bytes from an agent were not stored because
+// the buffer was full. Unlike the stored data it survives a Reset, so it
+// adds up with what the agent reports having sent.
+func (p *PCAPBuffer) DroppedBytes(agentID string) int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.dropped[agentID]
+}
+
 // Close closes all open files
 func (p *PCAPBuffer) Close() error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	for _, ab := range p.agents {
-		if ab.file != nil {
-			ab.file.Close()
+		for _, seg := range ab.segments {
+			if seg.file != nil {
+				seg.file.Close()
+			}
 		}
 	}
 
@@ -238,6 +631,25 @@ func writePCAPHeader(w io.Writer) error {
 	return binary.Write(w, binary.LittleEndian, &header)
 }
 
+// libpcapEncoder writes a classic libpcap file; agent identity is not kept
+type libpcapEncoder struct {
+	w  io.Writer
+	bw *bufio.Writer
+}
+
+func (e *libpcapEncoder) begin(sources []pcapSource) error {
+	e.bw = bufio.NewWriterSize(e.w, 64*1024)
+	return writePCAPHeader(e.bw)
+}
+
+func (e *libpcapEncoder) record(src int, rec *pcapRecord) error {
+	return rec.writeTo(e.bw)
+}
+
+func (e *libpcapEncoder) end() error {
+	return e.bw.Flush()
+}
+
 // WritePCAPPacket writes a packet to a PCAP file
 func WritePCAPPacket(w io.Writer, data []byte, timestamp time.Time) error {
 	ts := timestamp.Unix()
@@ -3,9 +3,15 @@ package hub
 import (
 	"bytes"
 	"encoding/binary"
+	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/podscope/podscope/pkg/protocol"
 )
 
 // TestWritePCAPHeader_MagicNumber tests that the PCAP magic number is correct
@@ -797,18 +803,15 @@ func TestGetSessionPCAP_SingleAgent(t *testing.T) {
 	defer pb.Close()
 
 	packetData := []byte("single agent packet")
-	err := pb.Write("agent-single", packetData)
-	if err != nil {
-		t.Fatalf("Write() error = %v", err)
-	}
+	writeAgentPacket(t, pb, "agent-single", packetData, time.Unix(1000, 0))
 
 	merged, err := pb.GetSessionPCAP()
 	if err != nil {
 		t.Fatalf("GetSessionPCAP() error = %v", err)
 	}
 
-	// Should have: header(24) + packetData
-	expectedSize := 24 + len(packetData)
+	// Should have: header(24) + record header(16) + packetData
+	expectedSize := 24 + 16 + len(packetData)
 	if len(merged) != expectedSize {
 		t.Errorf("merged size = %d, want %d", len(merged), expectedSize)
 	}
@@ -820,7 +823,7 @@ func TestGetSessionPCAP_SingleAgent(t *testing.T) {
 	}
 
 	// Verify packet data is present
-	if !bytes.Equal(merged[24:], packetData) {
+	if !bytes.Equal(merged[40:], packetData) {
 		t.Errorf("packet data mismatch")
 	}
 }
@@ -834,23 +837,16 @@ func TestGetSessionPCAP_MergesMultipleAgents(t *testing.T) {
 	packet1 := []byte("agent1-packet")
 	packet2 := []byte("agent2-packet")
 
-	err := pb.Write("agent-1", packet1)
-	if err != nil {
-		t.Fatalf("Write() agent-1 error = %v", err)
-	}
-
-	err = pb.Write("agent-2", packet2)
-	if err != nil {
-		t.Fatalf("Write() agent-2 error = %v", err)
-	}
+	writeAgentPacket(t, pb, "agent-1", packet1, time.Unix(1000, 0))
+	writeAgentPacket(t, pb, "agent-2", packet2, time.Unix(1001, 0))
 
 	merged, err := pb.GetSessionPCAP()
 	if err != nil {
 		t.Fatalf("GetSessionPCAP() error = %v", err)
 	}
 
-	// Should have: header(24) + packet1 + packet2
-	expectedSize := 24 + len(packet1) + len(packet2)
+	// Should have: header(24) + two records (16-byte header each)
+	expectedSize := 24 + 16 + len(packet1) + 16 + len(packet2)
 	if len(merged) != expectedSize {
 		t.Errorf("merged size = %d, want %d", len(merged), expectedSize)
 	}
@@ -877,18 +873,9 @@ func TestGetSessionPCAP_SingleGlobalHeader(t *testing.T) {
 	defer pb.Close()
 
 	// Write to 3 different agents
-	err := pb.Write("agent-x", []byte("packet-x"))
-	if err != nil {
-		t.Fatalf("Write() error = %v", err)
-	}
-	err = pb.Write("agent-y", []byte("packet-y"))
-	if err != nil {
-		t.Fatalf("Write() error = %v", err)
-	}
-	err = pb.Write("agent-z", []byte("packet-z"))
-	if err != nil {
-		t.Fatalf("Write() error = %v", err)
-	}
+	writeAgentPacket(t, pb, "agent-x", []byte("packet-x"), time.Unix(1000, 0))
+	writeAgentPacket(t, pb, "agent-y", []byte("packet-y"), time.Unix(1000, 0))
+	writeAgentPacket(t, pb, "agent-z", []byte("packet-z"), time.Unix(1000, 0))
 
 	merged, err := pb.GetSessionPCAP()
 	if err != nil {
@@ -921,24 +908,18 @@ func TestGetSessionPCAP_SkipsPerAgentHeaders(t *testing.T) {
 	packet1 := []byte("PACKET_ONE__")  // 12 bytes
 	packet2 := []byte("PACKET_TWO__")  // 12 bytes
 
-	err := pb.Write("agent-p", packet1)
-	if err != nil {
-		t.Fatalf("Write() error = %v", err)
-	}
-	err = pb.Write("agent-q", packet2)
-	if err != nil {
-		t.Fatalf("Write() error = %v", err)
-	}
+	writeAgentPacket(t, pb, "agent-p", packet1, time.Unix(1000, 0))
+	writeAgentPacket(t, pb, "agent-q", packet2, time.Unix(1001, 0))
 
 	// Verify agent files have headers
 	data1, _ := os.ReadFile(dir + "/agent-agent-p.pcap")
 	data2, _ := os.ReadFile(dir + "/agent-agent-q.pcap")
 
-	if len(data1) != 24+len(packet1) {
-		t.Errorf("agent-p file size = %d, want %d", len(data1), 24+len(packet1))
+	if len(data1) != 24+16+len(packet1) {
+		t.Errorf("agent-p file size = %d, want %d", len(data1), 24+16+len(packet1))
 	}
-	if len(data2) != 24+len(packet2) {
-		t.Errorf("agent-q file size = %d, want %d", len(data2), 24+len(packet2))
+	if len(data2) != 24+16+len(packet2) {
+		t.Errorf("agent-q file size = %d, want %d", len(data2), 24+16+len(packet2))
 	}
 
 	// Get merged PCAP
@@ -947,9 +928,9 @@ func TestGetSessionPCAP_SkipsPerAgentHeaders(t *testing.T) {
 		t.Fatalf("GetSessionPCAP() error = %v", err)
 	}
 
-	// Merged should have: global header (24) + packet1 data + packet2 data
+	// Merged should have: global header (24) + packet1 record + packet2 record
 	// NOT: global header (24) + agent1 header (24) + packet1 + agent2 header (24) + packet2
-	expectedSize := 24 + len(packet1) + len(packet2)
+	expectedSize := 24 + 16 + len(packet1) + 16 + len(packet2)
 	if len(merged) != expectedSize {
 		t.Errorf("merged size = %d, want %d (per-agent headers should be skipped)", len(merged), expectedSize)
 	}
@@ -963,3 +944,505 @@ func TestGetSessionPCAP_SkipsPerAgentHeaders(t *testing.T) {
 		t.Error("merged data missing packet2")
 	}
 }
+
+// TestWriteSessionPCAP_OrdersByTimestamp tests that records from different agents are interleaved by time
+func TestWriteSessionPCAP_OrdersByTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	base := time.Unix(1700000000, 0)
+	writeAgentPacket(t, pb, "agent-a", []byte("a1"), base)
+	writeAgentPacket(t, pb, "agent-a", []byte("a2"), base.Add(30*time.Millisecond))
+	writeAgentPacket(t, pb, "agent-a", []byte("a3"), base.Add(2*time.Second))
+	writeAgentPacket(t, pb, "agent-b", []byte("b1"), base.Add(10*time.Millisecond))
+	writeAgentPacket(t, pb, "agent-b", []byte("b2"), base.Add(time.Second))
+	writeAgentPacket(t, pb, "agent-c", []byte("c1"), base.Add(20*time.Millisecond))
+
+	data := filteredPCAP(t, pb, nil)
+
+	var got []string
+	var last time.Time
+	err := readPCAPRecords(bytes.NewReader(data), func(rec *pcapRecord) error {
+		if rec.timestamp().Before(last) {
+			t.Errorf("record %q at %v is before previous record at %v", rec.data, rec.timestamp(), last)
+		}
+		last = rec.timestamp()
+		got = append(got, string(rec.data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readPCAPRecords() error = %v", err)
+	}
+
+	want := []string{"a1", "b1", "c1", "a2", "b2", "a3"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("record order = %v, want %v", got, want)
+	}
+}
+
+// TestWriteSessionPCAP_EqualTimestampsOrderedByAgent tests that ties are broken deterministically
+func TestWriteSessionPCAP_EqualTimestampsOrderedByAgent(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	ts := time.Unix(1700000000, 0)
+	writeAgentPacket(t, pb, "agent-b", []byte("b"), ts)
+	writeAgentPacket(t, pb, "agent-a", []byte("a"), ts)
+
+	data := filteredPCAP(t, pb, nil)
+
+	// header(24) + record header(16) + "a"
+	if len(data) < 41 || data[40] != 'a' {
+		t.Error("expected agent-a record first for equal timestamps")
+	}
+}
+
+// TestWriteSessionPCAP_CorruptAgentDoesNotAbort tests that a corrupt agent file only loses its own records
+func TestWriteSessionPCAP_CorruptAgentDoesNotAbort(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	writeAgentPacket(t, pb, "agent-good", []byte("good"), time.Unix(1000, 0))
+
+	// Record header claiming a length beyond the snaplen
+	corrupt := make([]byte, 16)
+	binary.LittleEndian.PutUint32(corrupt[8:12], pcapSnaplen+1)
+	if err := pb.Write("agent-bad", corrupt); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	data := filteredPCAP(t, pb, nil)
+
+	if got := countPCAPRecords(t, data); got != 1 {
+		t.Errorf("record count = %d, want 1", got)
+	}
+	if !bytes.HasSuffix(data, []byte("good")) {
+		t.Error("merged data missing record from healthy agent")
+	}
+}
+
+// buildTCPPacket serializes an Ethernet/IPv4/TCP frame for the given endpoints
+func buildTCPPacket(t *testing.T, srcIP string, srcPort uint16, dstIP string, dstPort uint16) []byte {
+	t.Helper()
+
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP(srcIP).To4(),
+		DstIP:    net.ParseIP(dstIP).To4(),
+	}
+	tcp := &layers.TCP{
+		SrcPort: layers.TCPPort(srcPort),
+		DstPort: layers.TCPPort(dstPort),
+		ACK:     true,
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload("x")); err != nil {
+		t.Fatalf("SerializeLayers() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// writeAgentPacket appends a single packet record to an agent's PCAP file
+func writeAgentPacket(t *testing.T, pb *PCAPBuffer, agentID string, data []byte, ts time.Time) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WritePCAPPacket(&buf, data, ts); err != nil {
+		t.Fatalf("WritePCAPPacket() error = %v", err)
+	}
+	if err := pb.Write(agentID, buf.Bytes()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+}
+
+// filteredPCAP streams the session PCAP through m into memory
+func filteredPCAP(t *testing.T, pb *PCAPBuffer, m recordMatcher) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := pb.WriteSessionPCAP(&buf, m); err != nil {
+		t.Fatalf("WriteSessionPCAP() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// countPCAPRecords returns the number of packet records in a PCAP file
+func countPCAPRecords(t *testing.T, data []byte) int {
+	t.Helper()
+
+	count := 0
+	err := readPCAPRecords(bytes.NewReader(data), func(rec *pcapRecord) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readPCAPRecords() error = %v", err)
+	}
+	return count
+}
+
+// TestWriteSessionPCAP_FlowFilter_OnlyFlowPackets tests that only packets of the flow's 5-tuple are returned
+func TestWriteSessionPCAP_FlowFilter_OnlyFlowPackets(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	start := time.Now().Truncate(time.Millisecond)
+	flow := &protocol.Flow{
+		ID:        "flow-1",
+		Timestamp: start,
+		Duration:  100,
+		SrcIP:     "10.0.0.1",
+		SrcPort:   40000,
+		DstIP:     "10.0.0.2",
+		DstPort:   80,
+		Status:    protocol.StatusClosed,
+	}
+
+	request := buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80)
+	response := buildTCPPacket(t, "10.0.0.2", 80, "10.0.0.1", 40000)
+	otherPort := buildTCPPacket(t, "10.0.0.1", 40001, "10.0.0.2", 80)
+	otherHost := buildTCPPacket(t, "10.0.0.3", 40000, "10.0.0.2", 80)
+
+	writeAgentPacket(t, pb, "agent-a", request, start)
+	writeAgentPacket(t, pb, "agent-a", otherPort, start.Add(10*time.Millisecond))
+	writeAgentPacket(t, pb, "agent-b", response, start.Add(20*time.Millisecond))
+	writeAgentPacket(t, pb, "agent-b", otherHost, start.Add(30*time.Millisecond))
+
+	data := filteredPCAP(t, pb, newFlowFilter(flow))
+
+	if magic := binary.LittleEndian.Uint32(data[0:4]); magic != 0xa1b2c3d4 {
+		t.Errorf("magic = 0x%08x, want 0xa1b2c3d4", magic)
+	}
+	if got := countPCAPRecords(t, data); got != 2 {
+		t.Errorf("record count = %d, want 2", got)
+	}
+	if !bytes.Contains(data, request) {
+		t.Error("stream PCAP missing request packet")
+	}
+	if !bytes.Contains(data, response) {
+		t.Error("stream PCAP missing response packet")
+	}
+}
+
+// TestWriteSessionPCAP_FlowFilter_RespectsTimeWindow tests that a reused 5-tuple outside the flow lifetime is excluded
+func TestWriteSessionPCAP_FlowFilter_RespectsTimeWindow(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	start := time.Now().Truncate(time.Millisecond)
+	flow := &protocol.Flow{
+		ID:        "flow-1",
+		Timestamp: start,
+		Duration:  100,
+		SrcIP:     "10.0.0.1",
+		SrcPort:   40000,
+		DstIP:     "10.0.0.2",
+		DstPort:   80,
+		Status:    protocol.StatusClosed,
+	}
+
+	packet := buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80)
+	writeAgentPacket(t, pb, "agent-a", packet, start.Add(-time.Minute))
+	writeAgentPacket(t, pb, "agent-a", packet, start.Add(50*time.Millisecond))
+	writeAgentPacket(t, pb, "agent-a", packet, start.Add(time.Minute))
+
+	data := filteredPCAP(t, pb, newFlowFilter(flow))
+
+	if got := countPCAPRecords(t, data); got != 1 {
+		t.Errorf("record count = %d, want 1", got)
+	}
+}
+
+// TestWriteSessionPCAP_FlowFilter_OpenFlowHasNoEnd tests that open flows include packets after their reported duration
+func TestWriteSessionPCAP_FlowFilter_OpenFlowHasNoEnd(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	start := time.Now().Truncate(time.Millisecond)
+	flow := &protocol.Flow{
+		ID:        "flow-1",
+		Timestamp: start,
+		SrcIP:     "10.0.0.1",
+		SrcPort:   40000,
+		DstIP:     "10.0.0.2",
+		DstPort:   80,
+		Status:    protocol.StatusOpen,
+	}
+
+	packet := buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80)
+	writeAgentPacket(t, pb, "agent-a", packet, start.Add(time.Minute))
+
+	data := filteredPCAP(t, pb, newFlowFilter(flow))
+
+	if got := countPCAPRecords(t, data); got != 1 {
+		t.Errorf("record count = %d, want 1", got)
+	}
+}
+
+// TestWriteSessionPCAP_FlowFilter_SkipsUndecodablePackets tests that non-IP records are ignored rather than failing
+func TestWriteSessionPCAP_FlowFilter_SkipsUndecodablePackets(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	start := time.Now().Truncate(time.Millisecond)
+	flow := &protocol.Flow{
+		ID:        "flow-1",
+		Timestamp: start,
+		SrcIP:     "10.0.0.1",
+		SrcPort:   40000,
+		DstIP:     "10.0.0.2",
+		DstPort:   80,
+		Status:    protocol.StatusOpen,
+	}
+
+	writeAgentPacket(t, pb, "agent-a", []byte("not a packet"), start)
+	writeAgentPacket(t, pb, "agent-a", buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80), start)
+	// Trailing partial record, as seen while an agent is mid-write
+	if err := pb.Write("agent-a", []byte{0x01, 0x02, 0x03}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	data := filteredPCAP(t, pb, newFlowFilter(flow))
+
+	if got := countPCAPRecords(t, data); got != 1 {
+		t.Errorf("record count = %d, want 1", got)
+	}
+}
+
+// TestWriteSessionPCAP_FlowFilter_EmptyBuffer tests that an empty buffer yields just the global header
+func TestWriteSessionPCAP_FlowFilter_EmptyBuffer(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	data := filteredPCAP(t, pb, newFlowFilter(&protocol.Flow{ID: "flow-1"}))
+
+	if len(data) != pcapGlobalHeaderSize {
+		t.Errorf("stream PCAP size = %d, want %d", len(data), pcapGlobalHeaderSize)
+	}
+}
+
+// ===== Ring retention Tests =====
+
+// TestRingRetention_RotatesSegments tests that agent files are split once they exceed the segment size
+func TestRingRetention_RotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBufferWithRetention(dir, 1024*1024, PCAPRetentionRing, 130)
+	defer pb.Close()
+
+	payload := bytes.Repeat([]byte("x"), 44) // 60-byte record
+	for i := 0; i < 3; i++ {
+		writeAgentPacket(t, pb, "agent-1", payload, time.Unix(int64(1000+i), 0))
+	}
+
+	stats := pb.Stats()
+	if stats.Segments != 2 {
+		t.Errorf("segments = %d, want 2", stats.Segments)
+	}
+	if _, err := os.Stat(dir + "/agent-agent-1.pcap"); err != nil {
+		t.Errorf("first segment missing: %v", err)
+	}
+	if _, err := os.Stat(dir + "/agent-agent-1-1.pcap"); err != nil {
+		t.Errorf("second segment missing: %v", err)
+	}
+
+	// All records still readable across segments, each segment has its own header
+	data := filteredPCAP(t, pb, nil)
+	if got := countPCAPRecords(t, data); got != 3 {
+		t.Errorf("record count = %d, want 3", got)
+	}
+}
+
+// TestRingRetention_EvictsOldestSegments tests that the oldest data is deleted instead of stopping
+func TestRingRetention_EvictsOldestSegments(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBufferWithRetention(dir, 200, PCAPRetentionRing, 60)
+	defer pb.Close()
+
+	payload := bytes.Repeat([]byte("x"), 44) // 60-byte record, one per segment
+	for i := 0; i < 5; i++ {
+		writeAgentPacket(t, pb, "agent-1", payload, time.Unix(int64(1000+i), 0))
+	}
+
+	if pb.IsFull() {
+		t.Error("ring buffer should never report full")
+	}
+	if size := pb.Size(); size > 200 {
+		t.Errorf("Size() = %d, want <= 200", size)
+	}
+
+	stats := pb.Stats()
+	if stats.EvictedSegments != 2 {
+		t.Errorf("evicted segments = %d, want 2", stats.EvictedSegments)
+	}
+	if stats.EvictedBytes != 120 {
+		t.Errorf("evicted bytes = %d, want 120", stats.EvictedBytes)
+	}
+	if _, err := os.Stat(dir + "/agent-agent-1.pcap"); !os.IsNotExist(err) {
+		t.Error("oldest segment should have been deleted")
+	}
+
+	// The newest three records survive, oldest first
+	data := filteredPCAP(t, pb, nil)
+	var secs []uint32
+	readPCAPRecords(bytes.NewReader(data), func(rec *pcapRecord) error {
+		secs = append(secs, rec.tsSec)
+		return nil
+	})
+	if len(secs) != 3 || secs[0] != 1002 || secs[2] != 1004 {
+		t.Errorf("retained timestamps = %v, want [1002 1003 1004]", secs)
+	}
+}
+
+// TestRingRetention_EvictsAcrossAgents tests that the globally oldest segment is evicted first
+func TestRingRetention_EvictsAcrossAgents(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBufferWithRetention(dir, 120, PCAPRetentionRing, 60)
+	defer pb.Close()
+
+	payload := bytes.Repeat([]byte("x"), 44) // 60-byte record
+	writeAgentPacket(t, pb, "agent-old", payload, time.Unix(1000, 0))
+	writeAgentPacket(t, pb, "agent-new", payload, time.Unix(1001, 0))
+	writeAgentPacket(t, pb, "agent-new", payload, time.Unix(1002, 0))
+
+	if _, err := os.Stat(dir + "/agent-agent-old.pcap"); !os.IsNotExist(err) {
+		t.Error("idle agent's segment should have been evicted first")
+	}
+
+	data := filteredPCAP(t, pb, nil)
+	if got := countPCAPRecords(t, data); got != 2 {
+		t.Errorf("record count = %d, want 2", got)
+	}
+}
+
+// TestRingRetention_OversizedChunkDropped tests that a chunk larger than the ring is dropped
+func TestRingRetention_OversizedChunkDropped(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBufferWithRetention(dir, 50, PCAPRetentionRing, 10)
+	defer pb.Close()
+
+	writeAgentPacket(t, pb, "agent-1", bytes.Repeat([]byte("x"), 100), time.Unix(1000, 0))
+
+	if size := pb.Size(); size != 0 {
+		t.Errorf("Size() = %d, want 0", size)
+	}
+	if dropped := pb.DroppedBytes("agent-1"); dropped != 116 {
+		t.Errorf("DroppedBytes() = %d, want 116", dropped)
+	}
+}
+
+// TestStopRetention_StopsWhenFull tests the legacy stop mode
+func TestStopRetention_StopsWhenFull(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 100)
+	defer pb.Close()
+
+	payload := bytes.Repeat([]byte("x"), 44) // 60-byte record
+	writeAgentPacket(t, pb, "agent-1", payload, time.Unix(1000, 0))
+	writeAgentPacket(t, pb, "agent-1", payload, time.Unix(1001, 0))
+
+	if !pb.IsFull() {
+		t.Error("IsFull() = false, want true")
+	}
+	if size := pb.Size(); size != 60 {
+		t.Errorf("Size() = %d, want 60", size)
+	}
+	if stats := pb.Stats(); stats.Retention != PCAPRetentionStop || stats.EvictedSegments != 0 {
+		t.Errorf("stats = %+v, want stop mode without evictions", stats)
+	}
+
+	// Everything after filling up is counted as dropped, across resets
+	writeAgentPacket(t, pb, "agent-1", payload, time.Unix(1002, 0))
+	if dropped := pb.DroppedBytes("agent-1"); dropped != 120 {
+		t.Errorf("DroppedBytes() = %d, want 120", dropped)
+	}
+	pb.Reset()
+	if dropped := pb.Stats().DroppedBytes; dropped != 120 {
+		t.Errorf("Stats().DroppedBytes after Reset = %d, want 120", dropped)
+	}
+}
+
+// ===== Restart Tests =====
+
+// TestAdoptSegments_ResumesPreviousRun tests that agent files left by a
+// previous run are adopted, appended to, and trimmed of a partial record
+func TestAdoptSegments_ResumesPreviousRun(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBufferWithRetention(dir, 1024*1024, PCAPRetentionRing, 130)
+	payload := bytes.Repeat([]byte("x"), 44) // 60-byte record
+	for i := 0; i < 3; i++ {
+		writeAgentPacket(t, pb, "agent-1", payload, time.Unix(int64(1000+i), 0))
+	}
+	writeAgentPacket(t, pb, "agent-2", payload, time.Unix(1003, 0))
+	pb.Close()
+
+	// A record cut short by the restart
+	f, err := os.OpenFile(dir+"/agent-agent-2.pcap", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3})
+	f.Close()
+
+	pb = NewPCAPBufferWithRetention(dir, 1024*1024, PCAPRetentionRing, 130)
+	defer pb.Close()
+
+	if stats := pb.Stats(); stats.Segments != 3 {
+		t.Errorf("segments = %d, want 3", stats.Segments)
+	}
+	if size := pb.Size(); size != 240 {
+		t.Errorf("Size() = %d, want 240", size)
+	}
+
+	writeAgentPacket(t, pb, "agent-2", payload, time.Unix(1004, 0))
+	writeAgentPacket(t, pb, "agent-1", payload, time.Unix(1005, 0))
+
+	// The last segment of each agent is appended to, without a second header
+	for name, want := range map[string]int64{"agent-agent-1-1.pcap": 144, "agent-agent-2.pcap": 144} {
+		if info, err := os.Stat(dir + "/" + name); err != nil || info.Size() != want {
+			t.Errorf("%s: size = %v (%v), want %d", name, info.Size(), err, want)
+		}
+	}
+	data := filteredPCAP(t, pb, nil)
+	if got := countPCAPRecords(t, data); got != 6 {
+		t.Errorf("record count = %d, want 6", got)
+	}
+}
+
+// TestSegmentOwner tests how file names are attributed to agents
+func TestSegmentOwner(t *testing.T) {
+	stems := map[string]bool{"a1b2": true, "a1b2-1": true, "agent-1": true, "agent-2": true, "c3d4-2": true}
+	tests := []struct {
+		stem  string
+		id    string
+		index int
+	}{
+		{"a1b2", "a1b2", 0},
+		{"a1b2-1", "a1b2", 1},
+		{"agent-1", "agent-1", 0},
+		{"agent-2", "agent-2", 0},
+		{"c3d4-2", "c3d4-2", 0}, // first segment already evicted
+	}
+	for _, tt := range tests {
+		if id, index := segmentOwner(tt.stem, stems); id != tt.id || index != tt.index {
+			t.Errorf("segmentOwner(%q) = %q, %d, want %q, %d", tt.stem, id, index, tt.id, tt.index)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+const (
+	// pcapGlobalHeaderSize is the size of the libpcap file header
+	pcapGlobalHeaderSize = 24
+	// pcapRecordHeaderSize is the size of each per-packet record header
+	pcapRecordHeaderSize = 16
+	// flowPCAPSlack widens a flow's time window so the handshake and
+	// trailing FIN/ACKs around the reported start/duration are kept
+	flowPCAPSlack = time.Second
+	// dnsPort is the port DNS packets are recognised by
+	dnsPort = 53
+)
+
+// recordMatcher selects packet records for a PCAP download
+type recordMatcher interface {
+	matches(rec *pcapRecord) bool
+}
+
+// allOf matches records accepted by every matcher it holds
+type allOf []recordMatcher
+
+func (a allOf) matches(rec *pcapRecord) bool {
+	for _, m := range a {
+		if !m.matches(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// pcapRecord is a single packet record read back from an agent file
+type pcapRecord struct {
+	tsSec   uint32
+	tsUsec  uint32
+	origLen uint32
+	data    []byte
+}
+
+// before reports whether r was captured earlier than o
+func (r *pcapRecord) before(o *pcapRecord) bool {
+	if r.tsSec != o.tsSec {
+		return r.tsSec < o.tsSec
+	}
+	return r.tsUsec < o.tsUsec
+}
+
+// timestamp returns the capture time of the record
+func (r *pcapRecord) timestamp() time.Time {
+	return time.Unix(int64(r.tsSec), int64(r.tsUsec)*1000)
+}
+
+// writeTo writes the record (header and data) in little-endian libpcap format
+func (r *pcapRecord) writeTo(w io.Writer) error {
+	var hdr [pcapRecordHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], r.tsSec)
+	binary.LittleEndian.PutUint32(hdr[4:8], r.tsUsec)
+	binary.LittleEndian.PutUint32(hdr[8:12], uint32(len(r.data)))
+	binary.LittleEndian.PutUint32(hdr[12:16], r.origLen)
+
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(r.data)
+	return err
+}
+
+// pcapRecordReader reads little-endian records from an agent PCAP file
+type pcapRecordReader struct {
+	r      *bufio.Reader
+	header bool
+}
+
+// newPCAPRecordReader wraps r, which must be positioned at the file header
+func newPCAPRecordReader(r io.Reader) *pcapRecordReader {
+	return &pcapRecordReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// next returns the following record, or io.EOF once no complete record is
+// left. A truncated trailing record is treated as end of file since agent
+// files are appended to while being read.
+func (pr *pcapRecordReader) next() (*pcapRecord, error) {
+	if !pr.header {
+		if _, err := pr.r.Discard(pcapGlobalHeaderSize); err != nil {
+			return nil, io.EOF
+		}
+		pr.header = true
+	}
+
+	var hdr [pcapRecordHeaderSize]byte
+	if _, err := io.ReadFull(pr.r, hdr[:]); err != nil {
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	inclLen := binary.LittleEndian.Uint32(hdr[8:12])
+	if inclLen > pcapSnaplen {
+		return nil, fmt.Errorf("corrupt pcap record: length %d exceeds snaplen", inclLen)
+	}
+
+	rec := &pcapRecord{
+		tsSec:   binary.LittleEndian.Uint32(hdr[0:4]),
+		tsUsec:  binary.LittleEndian.Uint32(hdr[4:8]),
+		origLen: binary.LittleEndian.Uint32(hdr[12:16]),
+		data:    make([]byte, inclLen),
+	}
+	if _, err := io.ReadFull(pr.r, rec.data); err != nil {
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// readPCAPRecords reads an agent PCAP file (global header followed by
+// little-endian records) and calls fn for every complete record
+func readPCAPRecords(r io.Reader, fn func(rec *pcapRecord) error) error {
+	pr := newPCAPRecordReader(r)
+	for {
+		rec, err := pr.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// packetEndpoints holds the addressing of a decoded packet
+type packetEndpoints struct {
+	srcIP, dstIP     net.IP
+	srcPort, dstPort uint16
+}
+
+// decodeEndpoints extracts IPs and ports from an Ethernet frame.
+// Returns false for frames without an IP network layer.
+func decodeEndpoints(data []byte) (packetEndpoints, bool) {
+	var ep packetEndpoints
+
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.DecodeOptions{
+		Lazy:   true,
+		NoCopy: true,
+	})
+
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		ep.srcIP, ep.dstIP = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		ep.srcIP, ep.dstIP = ip.SrcIP, ip.DstIP
+	default:
+		return ep, false
+	}
+
+	switch t := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		ep.srcPort, ep.dstPort = uint16(t.SrcPort), uint16(t.DstPort)
+	case *layers.UDP:
+		ep.srcPort, ep.dstPort = uint16(t.SrcPort), uint16(t.DstPort)
+	}
+
+	return ep, true
+}
+
+// flowFilter selects the packets belonging to a single flow
+type flowFilter struct {
+	flow             *protocol.Flow
+	srcIP, dstIP     net.IP
+	srcPort, dstPort uint16
+	start, end       time.Time // end is zero for flows still open
+}
+
+// newFlowFilter builds a filter from a flow's 5-tuple and lifetime
+func newFlowFilter(flow *protocol.Flow) *flowFilter {
+	f := &flowFilter{
+		flow:    flow,
+		srcIP:   net.ParseIP(flow.SrcIP),
+		dstIP:   net.ParseIP(flow.DstIP),
+		srcPort: flow.SrcPort,
+		dstPort: flow.DstPort,
+	}
+
+	if !flow.Timestamp.IsZero() {
+		f.start = flow.Timestamp.Add(-flowPCAPSlack)
+		if flow.Status != protocol.StatusOpen {
+			f.end = flow.Timestamp.Add(time.Duration(flow.Duration)*time.Millisecond + flowPCAPSlack)
+		}
+	}
+
+	return f
+}
+
+// matches reports whether a record belongs to the flow, in either direction
+func (f *flowFilter) matches(rec *pcapRecord) bool {
+	if !f.inWindow(rec.timestamp()) {
+		return false
+	}
+
+	ep, ok := decodeEndpoints(rec.data)
+	if !ok {
+		return false
+	}
+
+	forward := ep.srcIP.Equal(f.srcIP) && ep.dstIP.Equal(f.dstIP) &&
+		ep.srcPort == f.srcPort && ep.dstPort == f.dstPort
+	reverse := ep.srcIP.Equal(f.dstIP) && ep.dstIP.Equal(f.srcIP) &&
+		ep.srcPort == f.dstPort && ep.dstPort == f.srcPort
+
+	return forward || reverse
+}
+
+// inWindow reports whether ts falls within the flow's lifetime
+func (f *flowFilter) inWindow(ts time.Time) bool {
+	if f.start.IsZero() {
+		return true
+	}
+	return !ts.Before(f.start) && (f.end.IsZero() || !ts.After(f.end))
+}
+
+// tupleKey identifies a connection independent of direction
+type tupleKey struct {
+	aIP, bIP     string
+	aPort, bPort uint16
+}
+
+// newTupleKey orders the two endpoints so both directions share a key
+func newTupleKey(ipA net.IP, portA uint16, ipB net.IP, portB uint16) tupleKey {
+	a, b := ipA.String(), ipB.String()
+	if a > b || (a == b && portA > portB) {
+		a, b = b, a
+		portA, portB = portB, portA
+	}
+	return tupleKey{aIP: a, bIP: b, aPort: portA, bPort: portB}
+}
+
+// flowSetFilter matches records belonging to any of a set of flows,
+// optionally letting DNS traffic through regardless of flow
+type flowSetFilter struct {
+	flows      map[tupleKey][]*flowFilter
+	includeDNS bool
+}
+
+// newFlowSetFilter indexes the given flows by connection
+func newFlowSetFilter(flows []*protocol.Flow, includeDNS bool) *flowSetFilter {
+	f := &flowSetFilter{
+		flows:      make(map[tupleKey][]*flowFilter, len(flows)),
+		includeDNS: includeDNS,
+	}
+	for _, flow := range flows {
+		ff := newFlowFilter(flow)
+		key := newTupleKey(ff.srcIP, ff.srcPort, ff.dstIP, ff.dstPort)
+		f.flows[key] = append(f.flows[key], ff)
+	}
+	return f
+}
+
+func (f *flowSetFilter) matches(rec *pcapRecord) bool {
+	ep, ok := decodeEndpoints(rec.data)
+	if !ok {
+		return false
+	}
+
+	if f.includeDNS && (ep.srcPort == dnsPort || ep.dstPort == dnsPort) {
+		return true
+	}
+
+	return f.find(ep, rec.timestamp()) != nil
+}
+
+// lookup returns the flow a record belongs to, or nil
+func (f *flowSetFilter) lookup(rec *pcapRecord) *flowFilter {
+	ep, ok := decodeEndpoints(rec.data)
+	if !ok {
+		return nil
+	}
+	return f.find(ep, rec.timestamp())
+}
+
+// find returns the first flow on the connection whose lifetime covers ts
+func (f *flowSetFilter) find(ep packetEndpoints, ts time.Time) *flowFilter {
+	for _, ff := range f.flows[newTupleKey(ep.srcIP, ep.srcPort, ep.dstIP, ep.dstPort)] {
+		if ff.inWindow(ts) {
+			return ff
+		}
+	}
+	return nil
+}
+
+// bpfMatcher matches records against a compiled BPF expression
+type bpfMatcher struct {
+	bpf *pcap.BPF
+}
+
+// newBPFMatcher compiles expr for the Ethernet frames stored by the hub
+func newBPFMatcher(expr string) (*bpfMatcher, error) {
+	bpf, err := pcap.NewBPF(layers.LinkTypeEthernet, pcapSnaplen, expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BPF syntax: %w", err)
+	}
+	return &bpfMatcher{bpf: bpf}, nil
+}
+
+func (b *bpfMatcher) matches(rec *pcapRecord) bool {
+	ci := gopacket.CaptureInfo{
+		Timestamp:     rec.timestamp(),
+		CaptureLength: len(rec.data),
+		Length:        int(rec.origLen),
+	}
+	return b.bpf.Matches(ci, rec.data)
+}
+
+// pcapDownloadOptions mirrors the flow list filters of the UI so a
+// download contains the same traffic the user is looking at
+type pcapDownloadOptions struct {
+	onlyHTTP   bool
+	includeDNS bool
+	allPorts   bool
+	search     string
+	bpf        string
+	format     string // "pcap" (default) or "pcapng"
+}
+
+// parsePCAPDownloadOptions reads download filters from query parameters
+func parsePCAPDownloadOptions(query url.Values) pcapDownloadOptions {
+	return pcapDownloadOptions{
+		onlyHTTP:   query.Get("onlyHTTP") == "true",
+		includeDNS: query.Get("includeDNS") == "true",
+		allPorts:   query.Get("allPorts") == "true",
+		search:     strings.TrimSpace(query.Get("search")),
+		bpf:        strings.TrimSpace(query.Get("bpf")),
+		format:     strings.ToLower(query.Get("format")),
+	}
+}
+
+// filtered reports whether any filter is set
+func (o pcapDownloadOptions) filtered() bool {
+	return o.selectsFlows() || o.bpf != ""
+}
+
+// selectsFlows reports whether packets are restricted to matching flows
+func (o pcapDownloadOptions) selectsFlows() bool {
+	return (o.onlyHTTP && !o.allPorts) || o.search != ""
+}
+
+// includesFlow applies the same rules as the UI flow list
+func (o pcapDownloadOptions) includesFlow(flow *protocol.Flow) bool {
+	if o.onlyHTTP && !o.allPorts {
+		isHTTP := flow.Protocol == protocol.ProtocolHTTP ||
+			flow.Protocol == protocol.ProtocolHTTPS ||
+			flow.Protocol == protocol.ProtocolTLS
+		if !isHTTP && flow.HTTP == nil {
+			return false
+		}
+	}
+
+	if o.search == "" {
+		return true
+	}
+
+	needle := strings.ToLower(o.search)
+	fields := []string{flow.SrcIP, flow.DstIP, flow.SrcPod, flow.DstPod, flow.DstService, flow.DstName, string(flow.Protocol)}
+	if flow.HTTP != nil {
+		fields = append(fields, flow.HTTP.URL, flow.HTTP.Host)
+	}
+	if flow.TLS != nil {
+		fields = append(fields, flow.TLS.SNI)
+	}
+	if flow.DNS != nil {
+		fields = append(fields, flow.DNS.Name)
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), needle) {
+			return true
+		}
+	}
+	return false
+}
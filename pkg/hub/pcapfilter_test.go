@@ -0,0 +1,163 @@
+package hub
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// TestParsePCAPDownloadOptions tests query parameter parsing
+func TestParsePCAPDownloadOptions(t *testing.T) {
+	query := url.Values{}
+	query.Set("onlyHTTP", "true")
+	query.Set("includeDNS", "true")
+	query.Set("search", " api ")
+	query.Set("bpf", "tcp port 80")
+
+	opts := parsePCAPDownloadOptions(query)
+
+	if !opts.onlyHTTP || !opts.includeDNS || opts.allPorts {
+		t.Errorf("flags = %+v, want onlyHTTP and includeDNS only", opts)
+	}
+	if opts.search != "api" {
+		t.Errorf("search = %q, want %q", opts.search, "api")
+	}
+	if opts.bpf != "tcp port 80" {
+		t.Errorf("bpf = %q, want %q", opts.bpf, "tcp port 80")
+	}
+}
+
+// TestPCAPDownloadOptions_Filtered tests when a download needs record-level filtering
+func TestPCAPDownloadOptions_Filtered(t *testing.T) {
+	tests := []struct {
+		name string
+		opts pcapDownloadOptions
+		want bool
+	}{
+		{"no options", pcapDownloadOptions{}, false},
+		{"only HTTP", pcapDownloadOptions{onlyHTTP: true}, true},
+		{"all ports overrides only HTTP", pcapDownloadOptions{onlyHTTP: true, allPorts: true}, false},
+		{"include DNS alone", pcapDownloadOptions{includeDNS: true}, false},
+		{"search", pcapDownloadOptions{allPorts: true, search: "api"}, true},
+		{"bpf", pcapDownloadOptions{bpf: "udp"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.filtered(); got != tt.want {
+				t.Errorf("filtered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPCAPDownloadOptions_IncludesFlow tests that flow selection mirrors the UI list
+func TestPCAPDownloadOptions_IncludesFlow(t *testing.T) {
+	httpFlow := &protocol.Flow{
+		Protocol: protocol.ProtocolHTTP,
+		SrcIP:    "10.0.0.1",
+		DstIP:    "10.0.0.2",
+		HTTP:     &protocol.HTTPInfo{URL: "/Users/42", Host: "api"},
+	}
+	tcpFlow := &protocol.Flow{
+		Protocol: protocol.ProtocolTCP,
+		SrcIP:    "10.0.0.1",
+		DstIP:    "10.0.0.3",
+		DstPod:   "redis-0",
+	}
+	tlsFlow := &protocol.Flow{
+		Protocol: protocol.ProtocolTLS,
+		TLS:      &protocol.TLSInfo{SNI: "example.com"},
+	}
+	dnsFlow := &protocol.Flow{
+		Protocol: protocol.ProtocolDNS,
+		DNS:      &protocol.DNSInfo{Name: "payments.prod.svc.cluster.local"},
+	}
+	namedFlow := &protocol.Flow{
+		Protocol: protocol.ProtocolTCP,
+		DstIP:    "104.18.0.1",
+		DstName:  "api.stripe.com",
+	}
+
+	tests := []struct {
+		name string
+		opts pcapDownloadOptions
+		flow *protocol.Flow
+		want bool
+	}{
+		{"only HTTP keeps HTTP", pcapDownloadOptions{onlyHTTP: true}, httpFlow, true},
+		{"only HTTP keeps TLS", pcapDownloadOptions{onlyHTTP: true}, tlsFlow, true},
+		{"only HTTP drops TCP", pcapDownloadOptions{onlyHTTP: true}, tcpFlow, false},
+		{"all ports keeps TCP", pcapDownloadOptions{onlyHTTP: true, allPorts: true}, tcpFlow, true},
+		{"search is case insensitive", pcapDownloadOptions{search: "users"}, httpFlow, true},
+		{"search matches pod", pcapDownloadOptions{search: "redis"}, tcpFlow, true},
+		{"search matches SNI", pcapDownloadOptions{search: "example"}, tlsFlow, true},
+		{"search matches DNS name", pcapDownloadOptions{search: "payments"}, dnsFlow, true},
+		{"search matches destination name", pcapDownloadOptions{search: "api.stripe.com"}, namedFlow, true},
+		{"search misses", pcapDownloadOptions{search: "postgres"}, httpFlow, false},
+		{"only HTTP and search combine", pcapDownloadOptions{onlyHTTP: true, search: "redis"}, tcpFlow, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.includesFlow(tt.flow); got != tt.want {
+				t.Errorf("includesFlow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFlowSetFilter_Matches tests matching records against a set of flows
+func TestFlowSetFilter_Matches(t *testing.T) {
+	start := time.Now().Truncate(time.Millisecond)
+	flows := []*protocol.Flow{
+		{
+			Timestamp: start,
+			Duration:  100,
+			SrcIP:     "10.0.0.1",
+			SrcPort:   40000,
+			DstIP:     "10.0.0.2",
+			DstPort:   80,
+			Status:    protocol.StatusClosed,
+		},
+	}
+
+	record := func(data []byte, ts time.Time) *pcapRecord {
+		return &pcapRecord{
+			tsSec:  uint32(ts.Unix()),
+			tsUsec: uint32(ts.Nanosecond() / 1000),
+			data:   data,
+		}
+	}
+
+	request := buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80)
+	response := buildTCPPacket(t, "10.0.0.2", 80, "10.0.0.1", 40000)
+	other := buildTCPPacket(t, "10.0.0.1", 40001, "10.0.0.2", 80)
+	dns := buildTCPPacket(t, "10.0.0.1", 40002, "10.0.0.10", 53)
+
+	tests := []struct {
+		name       string
+		includeDNS bool
+		rec        *pcapRecord
+		want       bool
+	}{
+		{"forward direction", false, record(request, start), true},
+		{"reverse direction", false, record(response, start.Add(50*time.Millisecond)), true},
+		{"other connection", false, record(other, start), false},
+		{"outside flow lifetime", false, record(request, start.Add(time.Hour)), false},
+		{"DNS excluded by default", false, record(dns, start), false},
+		{"DNS included on request", true, record(dns, start), true},
+		{"undecodable record", true, record([]byte("garbage"), start), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFlowSetFilter(flows, tt.includeDNS)
+			if got := f.matches(tt.rec); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
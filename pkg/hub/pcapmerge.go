@@ -0,0 +1,165 @@
+package hub
+
+import (
+	"container/heap"
+	"io"
+	"log"
+	"os"
+)
+
+// sessionEncoder writes merged records in a particular capture file format
+type sessionEncoder interface {
+	// begin writes the file preamble for the given sources
+	begin(sources []pcapSource) error
+	// record writes one packet read from sources[src]
+	record(src int, rec *pcapRecord) error
+	// end flushes any buffered output
+	end() error
+}
+
+// pcapSource is a snapshot of one agent's PCAP segments
+type pcapSource struct {
+	agentID  string
+	name     string // namespace/pod when the agent registered, else its ID
+	segments []segmentSnapshot
+}
+
+// segmentSnapshot is one segment file and how much of it was complete
+type segmentSnapshot struct {
+	filePath string
+	size     int64 // bytes of complete records at snapshot time
+}
+
+// mergeCursor is the head record of one agent during a merge. Segments are
+// opened one at a time; a segment deleted by ring retention before it is
+// reached is skipped.
+type mergeCursor struct {
+	agentID  string
+	order    int // position in the source list, breaks timestamp ties
+	segments []segmentSnapshot
+	file     *os.File
+	reader   *pcapRecordReader
+	rec      *pcapRecord
+}
+
+// advance reads the cursor's next record. Returns false when the agent's
+// segments are exhausted or unreadable.
+func (c *mergeCursor) advance() bool {
+	for {
+		if c.reader == nil {
+			if len(c.segments) == 0 {
+				c.rec = nil
+				return false
+			}
+			seg := c.segments[0]
+			c.segments = c.segments[1:]
+
+			f, err := os.Open(seg.filePath)
+			if err != nil {
+				continue
+			}
+			c.file = f
+			c.reader = newPCAPRecordReader(io.LimitReader(f, seg.size))
+		}
+
+		rec, err := c.reader.next()
+		if err == nil {
+			c.rec = rec
+			return true
+		}
+		if err != io.EOF {
+			log.Printf("Skipping rest of pcap segment for agent %s: %v", c.agentID, err)
+		}
+		c.close()
+	}
+}
+
+// close releases the currently open segment, if any
+func (c *mergeCursor) close() {
+	if c.file != nil {
+		c.file.Close()
+	}
+	c.file = nil
+	c.reader = nil
+}
+
+// cursorHeap orders cursors by the timestamp of their head record
+type cursorHeap []*mergeCursor
+
+func (h cursorHeap) Len() int { return len(h) }
+
+func (h cursorHeap) Less(i, j int) bool {
+	if h[i].rec.before(h[j].rec) {
+		return true
+	}
+	if h[j].rec.before(h[i].rec) {
+		return false
+	}
+	return h[i].order < h[j].order
+}
+
+func (h cursorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*mergeCursor)) }
+
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return c
+}
+
+// pcapMerger performs a k-way merge of agent files by packet timestamp.
+// Each file is already in capture order, so only one record per agent is
+// held in memory at a time.
+type pcapMerger struct {
+	heap    cursorHeap
+	cursors []*mergeCursor
+}
+
+// newPCAPMerger primes the heap with the first record of every source
+func newPCAPMerger(sources []pcapSource) *pcapMerger {
+	m := &pcapMerger{}
+
+	for i, src := range sources {
+		c := &mergeCursor{
+			agentID:  src.agentID,
+			order:    i,
+			segments: src.segments,
+		}
+		m.cursors = append(m.cursors, c)
+		if c.advance() {
+			m.heap = append(m.heap, c)
+		}
+	}
+
+	heap.Init(&m.heap)
+	return m
+}
+
+// next returns the earliest remaining record across all agents along with
+// the index of the source it was read from
+func (m *pcapMerger) next() (*pcapRecord, int, bool) {
+	if len(m.heap) == 0 {
+		return nil, 0, false
+	}
+
+	c := m.heap[0]
+	rec, src := c.rec, c.order
+	if c.advance() {
+		heap.Fix(&m.heap, 0)
+	} else {
+		heap.Pop(&m.heap)
+	}
+
+	return rec, src, true
+}
+
+// close releases all open agent files
+func (m *pcapMerger) close() {
+	for _, c := range m.cursors {
+		c.close()
+	}
+}
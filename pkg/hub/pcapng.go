@@ -0,0 +1,204 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// pcapng block types and option codes (draft-ietf-opsawg-pcapng)
+const (
+	pcapngBlockSectionHeader   = 0x0A0D0D0A
+	pcapngBlockInterface       = 0x00000001
+	pcapngBlockEnhancedPacket  = 0x00000006
+	pcapngByteOrderMagic       = 0x1A2B3C4D
+	pcapngOptEndOfOpt          = 0
+	pcapngOptComment           = 1
+	pcapngOptShbUserAppl       = 4
+	pcapngOptIfName            = 2
+	pcapngOptIfDescription     = 3
+	pcapngSectionLengthUnknown = 0xFFFFFFFFFFFFFFFF
+)
+
+// pcapngEncoder writes a little-endian pcapng file with one Interface
+// Description Block per agent, so packets keep the pod they came from.
+// Timestamps use the default microsecond resolution, matching agent records.
+type pcapngEncoder struct {
+	w       io.Writer
+	bw      *bufio.Writer
+	comment func(rec *pcapRecord) string
+}
+
+func (e *pcapngEncoder) begin(sources []pcapSource) error {
+	e.bw = bufio.NewWriterSize(e.w, 64*1024)
+
+	// Section Header Block
+	var shb []byte
+	shb = binary.LittleEndian.AppendUint32(shb, pcapngByteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1) // major version
+	shb = binary.LittleEndian.AppendUint16(shb, 0) // minor version
+	shb = binary.LittleEndian.AppendUint64(shb, pcapngSectionLengthUnknown)
+	shb = appendPCAPNGOption(shb, pcapngOptShbUserAppl, "podscope")
+	shb = appendPCAPNGEndOfOpt(shb)
+	if err := e.writeBlock(pcapngBlockSectionHeader, shb); err != nil {
+		return err
+	}
+
+	// Interface Description Blocks, interface ID == source index
+	for _, src := range sources {
+		var idb []byte
+		idb = binary.LittleEndian.AppendUint16(idb, pcapLinkTypeEthernet)
+		idb = binary.LittleEndian.AppendUint16(idb, 0) // reserved
+		idb = binary.LittleEndian.AppendUint32(idb, pcapSnaplen)
+		idb = appendPCAPNGOption(idb, pcapngOptIfName, src.name)
+		idb = appendPCAPNGOption(idb, pcapngOptIfDescription, fmt.Sprintf("podscope agent %s", src.agentID))
+		idb = appendPCAPNGEndOfOpt(idb)
+		if err := e.writeBlock(pcapngBlockInterface, idb); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *pcapngEncoder) record(src int, rec *pcapRecord) error {
+	ts := uint64(rec.tsSec)*1000000 + uint64(rec.tsUsec)
+
+	epb := make([]byte, 0, 20+len(rec.data)+3)
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(src))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts>>32))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(rec.data)))
+	epb = binary.LittleEndian.AppendUint32(epb, rec.origLen)
+	epb = appendPCAPNGPadded(epb, rec.data)
+
+	if e.comment != nil {
+		if c := e.comment(rec); c != "" {
+			epb = appendPCAPNGOption(epb, pcapngOptComment, c)
+			epb = appendPCAPNGEndOfOpt(epb)
+		}
+	}
+
+	return e.writeBlock(pcapngBlockEnhancedPacket, epb)
+}
+
+func (e *pcapngEncoder) end() error {
+	return e.bw.Flush()
+}
+
+// writeBlock frames body (already 32-bit aligned) with type and lengths
+func (e *pcapngEncoder) writeBlock(blockType uint32, body []byte) error {
+	total := uint32(12 + len(body))
+
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], blockType)
+	binary.LittleEndian.PutUint32(hdr[4:8], total)
+	if _, err := e.bw.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := e.bw.Write(body); err != nil {
+		return err
+	}
+
+	var trailer [4]byte
+	binary.LittleEndian.PutUint32(trailer[:], total)
+	_, err := e.bw.Write(trailer[:])
+	return err
+}
+
+// appendPCAPNGOption appends a string option padded to 32 bits
+func appendPCAPNGOption(b []byte, code uint16, value string) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	return appendPCAPNGPadded(b, []byte(value))
+}
+
+// appendPCAPNGEndOfOpt terminates an option list
+func appendPCAPNGEndOfOpt(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, pcapngOptEndOfOpt)
+	return binary.LittleEndian.AppendUint16(b, 0)
+}
+
+// appendPCAPNGPadded appends data followed by zero padding to 32 bits
+func appendPCAPNGPadded(b, data []byte) []byte {
+	b = append(b, data...)
+	if pad := (4 - len(data)%4) % 4; pad > 0 {
+		b = append(b, make([]byte, pad)...)
+	}
+	return b
+}
+
+// pcapngFlowComments annotates packets with the flow they belong to. The
+// first packet of each HTTP exchange also carries that exchange's summary.
+type pcapngFlowComments struct {
+	flows *flowSetFilter
+	next  map[*flowFilter]int // exchanges already summarized per flow
+}
+
+// newPCAPNGFlowComments indexes flows for packet annotation
+func newPCAPNGFlowComments(flows []*protocol.Flow) *pcapngFlowComments {
+	return &pcapngFlowComments{
+		flows: newFlowSetFilter(flows, false),
+		next:  make(map[*flowFilter]int),
+	}
+}
+
+// comment returns the annotation for rec, or "" if it matches no flow
+func (c *pcapngFlowComments) comment(rec *pcapRecord) string {
+	ff := c.flows.lookup(rec)
+	if ff == nil {
+		return ""
+	}
+
+	text := fmt.Sprintf("podscope flow %s", ff.flow.ID)
+	if summary := c.summary(ff, rec.timestamp()); summary != "" {
+		text += ": " + summary
+	}
+	return text
+}
+
+// summary describes the exchanges that started by ts and were not
+// summarized yet. Pipelined requests sharing a packet are all listed.
+func (c *pcapngFlowComments) summary(ff *flowFilter, ts time.Time) string {
+	exchanges := ff.flow.HTTPExchanges
+	next, seen := c.next[ff]
+	if len(exchanges) == 0 {
+		// Nothing to place in time, so the first packet gets the summary
+		c.next[ff] = 0
+		if seen {
+			return ""
+		}
+		return httpSummary(ff.flow.HTTP)
+	}
+
+	var parts []string
+	for ; next < len(exchanges); next++ {
+		// Packet times only keep microseconds
+		if exchanges[next].RequestTime.Truncate(time.Microsecond).After(ts) {
+			break
+		}
+		if summary := httpSummary(&exchanges[next].HTTPInfo); summary != "" {
+			parts = append(parts, summary)
+		}
+	}
+	c.next[ff] = next
+	return strings.Join(parts, "; ")
+}
+
+// httpSummary renders a one line request/response description
+func httpSummary(h *protocol.HTTPInfo) string {
+	if h == nil || h.Method == "" {
+		return ""
+	}
+
+	summary := fmt.Sprintf("%s %s%s", h.Method, h.Host, h.URL)
+	if h.StatusCode > 0 {
+		summary += fmt.Sprintf(" -> %d", h.StatusCode)
+	}
+	return summary
+}
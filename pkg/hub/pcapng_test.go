@@ -0,0 +1,283 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcapgo"
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// TestWriteSessionPCAPNG_InterfacePerAgent tests that each agent gets its own named interface
+func TestWriteSessionPCAPNG_InterfacePerAgent(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	pb.SetAgentName("agent-a", "default/frontend")
+	pb.SetAgentName("agent-b", "prod/backend")
+
+	base := time.Unix(1700000000, 250000*1000)
+	writeAgentPacket(t, pb, "agent-a", []byte("a1"), base)
+	writeAgentPacket(t, pb, "agent-b", []byte("b1"), base.Add(time.Millisecond))
+	writeAgentPacket(t, pb, "agent-a", []byte("a2"), base.Add(2*time.Millisecond))
+
+	var buf bytes.Buffer
+	if err := pb.WriteSessionPCAPNG(&buf, nil, nil); err != nil {
+		t.Fatalf("WriteSessionPCAPNG() error = %v", err)
+	}
+
+	r, err := pcapgo.NewNgReader(&buf, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatalf("NewNgReader() error = %v", err)
+	}
+
+	var payloads []string
+	var ifaces []int
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadPacketData() error = %v", err)
+		}
+		if len(payloads) == 0 && !ci.Timestamp.Equal(base) {
+			t.Errorf("first timestamp = %v, want %v", ci.Timestamp, base)
+		}
+		payloads = append(payloads, string(data))
+		ifaces = append(ifaces, ci.InterfaceIndex)
+	}
+
+	if got := len(payloads); got != 3 {
+		t.Fatalf("packet count = %d, want 3", got)
+	}
+	wantPayloads := []string{"a1", "b1", "a2"}
+	for i, want := range wantPayloads {
+		if payloads[i] != want {
+			t.Errorf("packet %d = %q, want %q", i, payloads[i], want)
+		}
+	}
+
+	if r.NInterfaces() != 2 {
+		t.Fatalf("interface count = %d, want 2", r.NInterfaces())
+	}
+	wantNames := map[string]string{"a": "default/frontend", "b": "prod/backend"}
+	for i, payload := range payloads {
+		intf, err := r.Interface(ifaces[i])
+		if err != nil {
+			t.Fatalf("Interface(%d) error = %v", ifaces[i], err)
+		}
+		if want := wantNames[payload[:1]]; intf.Name != want {
+			t.Errorf("packet %q interface = %q, want %q", payload, intf.Name, want)
+		}
+	}
+}
+
+// TestWriteSessionPCAPNG_UnnamedAgentUsesID tests the interface name fallback
+func TestWriteSessionPCAPNG_UnnamedAgentUsesID(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	writeAgentPacket(t, pb, "abc123", []byte("x"), time.Unix(1000, 0))
+
+	var buf bytes.Buffer
+	if err := pb.WriteSessionPCAPNG(&buf, nil, nil); err != nil {
+		t.Fatalf("WriteSessionPCAPNG() error = %v", err)
+	}
+
+	r, err := pcapgo.NewNgReader(&buf, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatalf("NewNgReader() error = %v", err)
+	}
+	intf, err := r.Interface(0)
+	if err != nil {
+		t.Fatalf("Interface(0) error = %v", err)
+	}
+	if intf.Name != "abc123" {
+		t.Errorf("interface name = %q, want %q", intf.Name, "abc123")
+	}
+}
+
+// TestWriteSessionPCAPNG_BlocksAligned tests that every block length is a multiple of 4
+func TestWriteSessionPCAPNG_BlocksAligned(t *testing.T) {
+	dir := t.TempDir()
+	pb := NewPCAPBuffer(dir, 1024*1024)
+	defer pb.Close()
+
+	pb.SetAgentName("agent-a", "ns/pod-with-odd-name")
+	writeAgentPacket(t, pb, "agent-a", []byte("odd"), time.Unix(1000, 0))
+
+	var buf bytes.Buffer
+	comment := func(rec *pcapRecord) string { return "c" }
+	if err := pb.WriteSessionPCAPNG(&buf, nil, comment); err != nil {
+		t.Fatalf("WriteSessionPCAPNG() error = %v", err)
+	}
+
+	data := buf.Bytes()
+	blocks := 0
+	for off := 0; off < len(data); {
+		if len(data)-off < 12 {
+			t.Fatalf("trailing %d bytes after block %d", len(data)-off, blocks)
+		}
+		length := int(binary.LittleEndian.Uint32(data[off+4 : off+8]))
+		if length%4 != 0 {
+			t.Errorf("block %d length %d is not 32-bit aligned", blocks, length)
+		}
+		if trailer := int(binary.LittleEndian.Uint32(data[off+length-4 : off+length])); trailer != length {
+			t.Errorf("block %d trailing length = %d, want %d", blocks, trailer, length)
+		}
+		off += length
+		blocks++
+	}
+
+	// SHB + IDB + EPB
+	if blocks != 3 {
+		t.Errorf("block count = %d, want 3", blocks)
+	}
+}
+
+// TestPCAPNGFlowComments tests flow ID and HTTP summary annotations
+func TestPCAPNGFlowComments(t *testing.T) {
+	start := time.Now().Truncate(time.Millisecond)
+	flows := []*protocol.Flow{
+		{
+			ID:        "flow-1",
+			Timestamp: start,
+			SrcIP:     "10.0.0.1",
+			SrcPort:   40000,
+			DstIP:     "10.0.0.2",
+			DstPort:   80,
+			Status:    protocol.StatusOpen,
+			HTTP:      &protocol.HTTPInfo{Method: "GET", Host: "api", URL: "/users", StatusCode: 200},
+		},
+	}
+	c := newPCAPNGFlowComments(flows)
+
+	record := func(data []byte) *pcapRecord {
+		return &pcapRecord{tsSec: uint32(start.Unix()), tsUsec: uint32(start.Nanosecond() / 1000), data: data}
+	}
+
+	first := c.comment(record(buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80)))
+	if first != "podscope flow flow-1: GET api/users -> 200" {
+		t.Errorf("first comment = %q", first)
+	}
+
+	second := c.comment(record(buildTCPPacket(t, "10.0.0.2", 80, "10.0.0.1", 40000)))
+	if second != "podscope flow flow-1" {
+		t.Errorf("second comment = %q", second)
+	}
+
+	if other := c.comment(record(buildTCPPacket(t, "10.0.0.9", 1, "10.0.0.2", 80))); other != "" {
+		t.Errorf("unrelated packet comment = %q, want empty", other)
+	}
+}
+
+// TestPCAPNGFlowComments_PerExchange tests that each exchange on a
+// keep-alive connection is summarized on its own first packet
+func TestPCAPNGFlowComments_PerExchange(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	exchange := func(at time.Duration, url string, status int) *protocol.HTTPExchange {
+		return &protocol.HTTPExchange{
+			HTTPInfo:    protocol.HTTPInfo{Method: "GET", Host: "api", URL: url, StatusCode: status},
+			RequestTime: start.Add(at),
+		}
+	}
+	flows := []*protocol.Flow{
+		{
+			ID:        "flow-1",
+			Timestamp: start,
+			SrcIP:     "10.0.0.1",
+			SrcPort:   40000,
+			DstIP:     "10.0.0.2",
+			DstPort:   80,
+			Duration:  3000,
+			Status:    protocol.StatusClosed,
+			HTTP:      &protocol.HTTPInfo{Method: "GET", Host: "api", URL: "/a", StatusCode: 200},
+			HTTPExchanges: []*protocol.HTTPExchange{
+				exchange(10*time.Millisecond, "/a", 200),
+				exchange(time.Second, "/b", 404),
+				exchange(time.Second+1500*time.Nanosecond, "/c", 200),
+			},
+		},
+	}
+	c := newPCAPNGFlowComments(flows)
+
+	at := func(d time.Duration) *pcapRecord {
+		ts := start.Add(d)
+		return &pcapRecord{
+			tsSec:  uint32(ts.Unix()),
+			tsUsec: uint32(ts.Nanosecond() / 1000),
+			data:   buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80),
+		}
+	}
+
+	want := []struct {
+		at      time.Duration
+		comment string
+	}{
+		{0, "podscope flow flow-1"}, // handshake, before any request
+		{10 * time.Millisecond, "podscope flow flow-1: GET api/a -> 200"},
+		{20 * time.Millisecond, "podscope flow flow-1"},
+		{time.Second + 1*time.Microsecond, "podscope flow flow-1: GET api/b -> 404; GET api/c -> 200"},
+		{2 * time.Second, "podscope flow flow-1"},
+	}
+	for _, w := range want {
+		if got := c.comment(at(w.at)); got != w.comment {
+			t.Errorf("comment at %v = %q, want %q", w.at, got, w.comment)
+		}
+	}
+}
+
+// TestHandleDownloadPCAP_FormatPCAPNG tests the format=pcapng query parameter
+func TestHandleDownloadPCAP_FormatPCAPNG(t *testing.T) {
+	s := setupTestServer(t)
+
+	start := time.Now().Truncate(time.Millisecond)
+	s.flowBuffer.Add(&protocol.Flow{
+		ID: "flow-1", Timestamp: start, SrcIP: "10.0.0.1", SrcPort: 40000,
+		DstIP: "10.0.0.2", DstPort: 80, Status: protocol.StatusOpen,
+	})
+	writeAgentPacket(t, s.pcapBuffer, "agent-1", buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80), start)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pcap?format=pcapng", nil)
+	w := httptest.NewRecorder()
+
+	s.handleDownloadPCAP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-pcapng" {
+		t.Errorf("Content-Type = %q, want application/x-pcapng", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !bytes.HasSuffix([]byte(cd), []byte(".pcapng")) {
+		t.Errorf("Content-Disposition = %q, want .pcapng filename", cd)
+	}
+	if magic := binary.LittleEndian.Uint32(w.Body.Bytes()[0:4]); magic != pcapngBlockSectionHeader {
+		t.Errorf("first block type = 0x%08x, want section header", magic)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("podscope flow flow-1")) {
+		t.Error("pcapng missing flow comment")
+	}
+}
+
+// TestHandleDownloadPCAP_UnknownFormatReturns400 tests rejection of unsupported formats
+func TestHandleDownloadPCAP_UnknownFormatReturns400(t *testing.T) {
+	s := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pcap?format=erf", nil)
+	w := httptest.NewRecorder()
+
+	s.handleDownloadPCAP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
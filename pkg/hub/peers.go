@@ -0,0 +1,324 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/podscope/podscope/pkg/protocol"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	podIPIndex       = "podIP"
+	clusterIPIndex   = "clusterIP"
+	endpointIPIndex  = "endpointIP"
+	sliceOwnerIndex  = "service"
+	podTemplateLabel = "pod-template-hash"
+)
+
+// PeerResolver names the pods and services behind the addresses in flows,
+// from watches on Pods, Services and EndpointSlices across the cluster
+type PeerResolver struct {
+	factory  informers.SharedInformerFactory
+	pods     cache.SharedIndexInformer
+	services cache.SharedIndexInformer
+	slices   cache.SharedIndexInformer
+}
+
+// Peer is what the cluster knows about one end of a flow
+type Peer struct {
+	Pod       string
+	Namespace string
+	Workload  string // owning controller as Kind/name, e.g. Deployment/web
+	Service   string // name.namespace.svc
+}
+
+// NewPeerResolver sets up the watches. They run once Start is called.
+func NewPeerResolver(client kubernetes.Interface) (*PeerResolver, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithTransform(stripManagedFields))
+
+	r := &PeerResolver{
+		factory:  factory,
+		pods:     factory.Core().V1().Pods().Informer(),
+		services: factory.Core().V1().Services().Informer(),
+		slices:   factory.Discovery().V1().EndpointSlices().Informer(),
+	}
+
+	if err := r.pods.AddIndexers(cache.Indexers{podIPIndex: indexPodIPs}); err != nil {
+		return nil, fmt.Errorf("failed to index pods: %w", err)
+	}
+	if err := r.services.AddIndexers(cache.Indexers{clusterIPIndex: indexClusterIPs}); err != nil {
+		return nil, fmt.Errorf("failed to index services: %w", err)
+	}
+	if err := r.slices.AddIndexers(cache.Indexers{
+		endpointIPIndex: indexEndpointIPs,
+		sliceOwnerIndex: indexSliceOwner,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to index endpoint slices: %w", err)
+	}
+	return r, nil
+}
+
+// Start runs the watches until ctx is done
+func (r *PeerResolver) Start(ctx context.Context) {
+	r.factory.Start(ctx.Done())
+}
+
+// WaitForSync blocks until the initial lists are loaded, and reports
+// whether they all were
+func (r *PeerResolver) WaitForSync(ctx context.Context) bool {
+	for _, synced := range r.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve returns the pod or service at ip. port picks the service a pod
+// is reached through when it backs several.
+func (r *PeerResolver) Resolve(ip string, port uint16) (Peer, bool) {
+	if svc := r.serviceByClusterIP(ip); svc != nil {
+		peer := Peer{Namespace: svc.Namespace, Service: serviceName(svc.Namespace, svc.Name)}
+		// Traffic captured in the client pod is still addressed to the
+		// ClusterIP, the backend is picked on the node afterwards. With a
+		// single ready backend there is no choice to make.
+		if pod := r.soleBackend(svc.Namespace, svc.Name); pod != nil {
+			peer.Pod = pod.Name
+			peer.Workload = workloadOf(pod)
+		}
+		return peer, true
+	}
+
+	if pod := r.podByIP(ip); pod != nil {
+		return Peer{
+			Pod:       pod.Name,
+			Namespace: pod.Namespace,
+			Workload:  workloadOf(pod),
+			Service:   r.serviceForEndpoint(ip, port),
+		}, true
+	}
+	return Peer{}, false
+}
+
+// Enrich fills in the names the agent could not know. The agent only sees
+// its own pod, so fields it already set are kept.
+func (r *PeerResolver) Enrich(f *protocol.Flow) {
+	if peer, ok := r.Resolve(f.SrcIP, f.SrcPort); ok {
+		fillPeer(peer, &f.SrcPod, &f.SrcNamespace, &f.SrcWorkload, &f.SrcService)
+	}
+	if peer, ok := r.Resolve(f.DstIP, f.DstPort); ok {
+		fillPeer(peer, &f.DstPod, &f.DstNamespace, &f.DstWorkload, &f.DstService)
+	}
+}
+
+// fillPeer copies peer into one side of a flow, leaving set fields alone
+func fillPeer(peer Peer, pod, namespace, workload, service *string) {
+	if *pod == "" {
+		*pod = peer.Pod
+		*namespace = peer.Namespace
+	}
+	// The agent named a different pod for this address, so the rest of
+	// the peer doesn't describe it
+	if *pod != peer.Pod {
+		return
+	}
+	if *workload == "" {
+		*workload = peer.Workload
+	}
+	if *service == "" {
+		*service = peer.Service
+	}
+}
+
+// serviceByClusterIP returns the service with ip as one of its ClusterIPs
+func (r *PeerResolver) serviceByClusterIP(ip string) *corev1.Service {
+	objs, _ := r.services.GetIndexer().ByIndex(clusterIPIndex, ip)
+	if len(objs) == 0 {
+		return nil
+	}
+	return objs[0].(*corev1.Service)
+}
+
+// podByIP returns the pod using ip. Addresses are reused once a pod is
+// gone, so a running pod wins over one that is still terminating.
+func (r *PeerResolver) podByIP(ip string) *corev1.Pod {
+	objs, _ := r.pods.GetIndexer().ByIndex(podIPIndex, ip)
+
+	var found *corev1.Pod
+	for _, obj := range objs {
+		pod := obj.(*corev1.Pod)
+		if found == nil || (pod.DeletionTimestamp == nil && found.DeletionTimestamp != nil) {
+			found = pod
+		}
+	}
+	return found
+}
+
+// serviceForEndpoint returns the service that lists ip as an endpoint on
+// port. When several do, the first by name is used.
+func (r *PeerResolver) serviceForEndpoint(ip string, port uint16) string {
+	objs, _ := r.slices.GetIndexer().ByIndex(endpointIPIndex, ip)
+
+	var names []string
+	for _, obj := range objs {
+		slice := obj.(*discoveryv1.EndpointSlice)
+		name := slice.Labels[discoveryv1.LabelServiceName]
+		if name != "" && slicePortMatches(slice, port) {
+			names = append(names, serviceName(slice.Namespace, name))
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// soleBackend returns the pod behind a service when it has exactly one
+// ready endpoint
+func (r *PeerResolver) soleBackend(namespace, name string) *corev1.Pod {
+	objs, _ := r.slices.GetIndexer().ByIndex(sliceOwnerIndex, namespace+"/"+name)
+
+	var backend *corev1.ObjectReference
+	for _, obj := range objs {
+		for _, ep := range obj.(*discoveryv1.EndpointSlice).Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+				return nil
+			}
+			if backend != nil && backend.Name != ep.TargetRef.Name {
+				return nil
+			}
+			backend = ep.TargetRef
+		}
+	}
+	if backend == nil {
+		return nil
+	}
+
+	obj, exists, _ := r.pods.GetIndexer().GetByKey(namespace + "/" + backend.Name)
+	if !exists {
+		return nil
+	}
+	return obj.(*corev1.Pod)
+}
+
+// slicePortMatches reports whether a slice serves port. Port 0, or a slice
+// without ports (all ports), always matches.
+func slicePortMatches(slice *discoveryv1.EndpointSlice, port uint16) bool {
+	if port == 0 || len(slice.Ports) == 0 {
+		return true
+	}
+	for _, p := range slice.Ports {
+		if p.Port != nil && uint16(*p.Port) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// workloadOf names the controller that owns a pod. Pods of a Deployment are
+// owned by a ReplicaSet named after it plus the pod template hash.
+func workloadOf(pod *corev1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return ""
+	}
+	if owner.Kind == "ReplicaSet" {
+		if hash := pod.Labels[podTemplateLabel]; hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
+// serviceName formats a service the way its DNS name reads
+func serviceName(namespace, name string) string {
+	return name + "." + namespace + ".svc"
+}
+
+// indexPodIPs indexes pods by address. Host network pods share the node's
+// address and finished pods have given theirs up, so both are left out.
+func indexPodIPs(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.HostNetwork {
+		return nil, nil
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return nil, nil
+	}
+
+	var ips []string
+	for _, ip := range pod.Status.PodIPs {
+		ips = append(ips, ip.IP)
+	}
+	if len(ips) == 0 && pod.Status.PodIP != "" {
+		ips = append(ips, pod.Status.PodIP)
+	}
+	return ips, nil
+}
+
+// indexClusterIPs indexes services by virtual address. Headless services
+// have none; their pods are found through the endpoint slices.
+func indexClusterIPs(obj interface{}) ([]string, error) {
+	svc, ok := obj.(*corev1.Service)
+	if !ok {
+		return nil, nil
+	}
+
+	var ips []string
+	for _, ip := range svc.Spec.ClusterIPs {
+		if ip != "" && ip != corev1.ClusterIPNone {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// indexEndpointIPs indexes slices by the addresses of their endpoints
+func indexEndpointIPs(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil, nil
+	}
+
+	var ips []string
+	for _, ep := range slice.Endpoints {
+		ips = append(ips, ep.Addresses...)
+	}
+	return ips, nil
+}
+
+// indexSliceOwner indexes slices by the namespace/name of their service
+func indexSliceOwner(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil, nil
+	}
+	name := slice.Labels[discoveryv1.LabelServiceName]
+	if name == "" {
+		return nil, nil
+	}
+	return []string{slice.Namespace + "/" + name}, nil
+}
+
+// stripManagedFields drops server-side apply bookkeeping before objects are
+// cached, as it is often the largest part of them
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if m, err := meta.Accessor(obj); err == nil {
+		m.SetManagedFields(nil)
+	}
+	return obj, nil
+}
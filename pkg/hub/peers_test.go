@@ -0,0 +1,181 @@
+package hub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/podscope/podscope/pkg/protocol"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPod(namespace, name, ip string, owner *metav1.OwnerReference, labels map[string]string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Status: corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			PodIP:  ip,
+			PodIPs: []corev1.PodIP{{IP: ip}},
+		},
+	}
+	if owner != nil {
+		controller := true
+		owner.Controller = &controller
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+func testService(namespace, name, clusterIP string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.ServiceSpec{ClusterIP: clusterIP, ClusterIPs: []string{clusterIP}},
+	}
+}
+
+func testSlice(namespace, service string, port int32, backends map[string]string) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      service + "-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Port: &port}},
+	}
+	for pod, ip := range backends {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses: []string{ip},
+			TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: namespace, Name: pod},
+		})
+	}
+	return slice
+}
+
+// newTestPeerResolver starts a resolver over a fake cluster:
+//
+//	prod/web-7d9f-x2x4q  10.1.0.5  Deployment web, behind service api on 8080
+//	prod/db-0, prod/db-1 10.1.0.9, 10.1.0.10  StatefulSet db, behind service db
+//	kube-system/proxy    192.168.1.10  host network
+func newTestPeerResolver(t *testing.T, extra ...runtime.Object) *PeerResolver {
+	t.Helper()
+
+	objects := []runtime.Object{
+		testPod("prod", "web-7d9f-x2x4q", "10.1.0.5",
+			&metav1.OwnerReference{Kind: "ReplicaSet", Name: "web-7d9f"},
+			map[string]string{podTemplateLabel: "7d9f"}),
+		testPod("prod", "db-0", "10.1.0.9", &metav1.OwnerReference{Kind: "StatefulSet", Name: "db"}, nil),
+		testPod("prod", "db-1", "10.1.0.10", &metav1.OwnerReference{Kind: "StatefulSet", Name: "db"}, nil),
+		testService("prod", "api", "10.96.0.20"),
+		testService("prod", "db", "10.96.0.30"),
+		testSlice("prod", "api", 8080, map[string]string{"web-7d9f-x2x4q": "10.1.0.5"}),
+		testSlice("prod", "db", 5432, map[string]string{"db-0": "10.1.0.9", "db-1": "10.1.0.10"}),
+	}
+	hostPod := testPod("kube-system", "proxy", "192.168.1.10", nil, nil)
+	hostPod.Spec.HostNetwork = true
+	objects = append(objects, hostPod)
+
+	r, err := NewPeerResolver(fake.NewSimpleClientset(append(objects, extra...)...))
+	if err != nil {
+		t.Fatalf("NewPeerResolver: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	r.Start(ctx)
+	if !r.WaitForSync(ctx) {
+		t.Fatal("caches did not sync")
+	}
+	return r
+}
+
+func TestPeerResolver_Resolve(t *testing.T) {
+	r := newTestPeerResolver(t)
+
+	tests := []struct {
+		name string
+		ip   string
+		port uint16
+		want Peer
+		ok   bool
+	}{
+		{"pod on a service port", "10.1.0.5", 8080,
+			Peer{Pod: "web-7d9f-x2x4q", Namespace: "prod", Workload: "Deployment/web", Service: "api.prod.svc"}, true},
+		{"pod on another port", "10.1.0.5", 40000,
+			Peer{Pod: "web-7d9f-x2x4q", Namespace: "prod", Workload: "Deployment/web"}, true},
+		{"ClusterIP with one backend", "10.96.0.20", 8080,
+			Peer{Pod: "web-7d9f-x2x4q", Namespace: "prod", Workload: "Deployment/web", Service: "api.prod.svc"}, true},
+		{"ClusterIP with several backends", "10.96.0.30", 5432,
+			Peer{Namespace: "prod", Service: "db.prod.svc"}, true},
+		{"StatefulSet pod", "10.1.0.9", 5432,
+			Peer{Pod: "db-0", Namespace: "prod", Workload: "StatefulSet/db", Service: "db.prod.svc"}, true},
+		{"host network pod", "192.168.1.10", 10250, Peer{}, false},
+		{"outside the cluster", "93.184.216.34", 443, Peer{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := r.Resolve(tt.ip, tt.port)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Resolve(%s, %d) = %+v, %v, want %+v, %v", tt.ip, tt.port, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPeerResolver_ReusedIPPrefersLivePod(t *testing.T) {
+	old := testPod("prod", "worker-old", "10.1.0.50", nil, nil)
+	now := metav1.Now()
+	old.DeletionTimestamp = &now
+	r := newTestPeerResolver(t, old, testPod("prod", "worker-new", "10.1.0.50", nil, nil))
+
+	if got, _ := r.Resolve("10.1.0.50", 0); got.Pod != "worker-new" {
+		t.Errorf("Pod = %q, want worker-new", got.Pod)
+	}
+}
+
+func TestPeerResolver_Enrich(t *testing.T) {
+	r := newTestPeerResolver(t)
+
+	// Captured in web, calling the db service
+	flow := &protocol.Flow{
+		SrcIP: "10.1.0.5", SrcPort: 40000, SrcPod: "web-7d9f-x2x4q", SrcNamespace: "prod",
+		DstIP: "10.96.0.30", DstPort: 5432,
+	}
+	r.Enrich(flow)
+
+	if flow.SrcWorkload != "Deployment/web" || flow.SrcService != "" {
+		t.Errorf("Src workload/service = %q/%q, want Deployment/web and no service", flow.SrcWorkload, flow.SrcService)
+	}
+	if flow.DstService != "db.prod.svc" || flow.DstNamespace != "prod" || flow.DstPod != "" {
+		t.Errorf("Dst = %s/%s service %q, want the db service without a pod", flow.DstNamespace, flow.DstPod, flow.DstService)
+	}
+}
+
+func TestPeerResolver_EnrichKeepsAgentNames(t *testing.T) {
+	r := newTestPeerResolver(t)
+
+	// The agent attributed the address to its own pod
+	flow := &protocol.Flow{SrcIP: "10.1.0.9", SrcPod: "sidecar-test", SrcNamespace: "dev", DstIP: "10.1.0.5", DstPort: 8080}
+	r.Enrich(flow)
+
+	if flow.SrcPod != "sidecar-test" || flow.SrcNamespace != "dev" || flow.SrcWorkload != "" {
+		t.Errorf("Src = %s/%s (%s), want the agent's names kept", flow.SrcNamespace, flow.SrcPod, flow.SrcWorkload)
+	}
+	if flow.DstPod != "web-7d9f-x2x4q" || flow.DstService != "api.prod.svc" {
+		t.Errorf("Dst = %s service %q, want web behind api", flow.DstPod, flow.DstService)
+	}
+}
+
+func TestAddFlow_ResolvesPeers(t *testing.T) {
+	s := setupTestServer(t)
+	s.peers = newTestPeerResolver(t)
+
+	s.AddFlow(&protocol.Flow{ID: "f1", SrcIP: "10.1.0.9", SrcPort: 41000, DstIP: "10.96.0.20", DstPort: 8080})
+
+	flows := s.flowBuffer.GetAll()
+	if len(flows) != 1 || flows[0].SrcPod != "db-0" || flows[0].DstService != "api.prod.svc" {
+		t.Errorf("stored flows = %+v, want db-0 calling api", flows)
+	}
+}
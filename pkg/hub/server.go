@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,6 +36,15 @@ type Server struct {
 	// Flow storage - bounded ring buffer
 	flowBuffer *FlowRingBuffer
 
+	// Who calls whom, aggregated from every flow as it arrives
+	graph *ServiceGraph
+
+	// Rate, errors and latency per service, method and path template
+	endpoints *EndpointMetrics
+
+	// Feeds the graph, endpoint and traffic metrics what each flow adds
+	tracker *flowTracker
+
 	// WebSocket clients
 	wsClients   map[*websocket.Conn]bool
 	wsMutex     sync.Mutex
@@ -50,6 +60,9 @@ type Server struct {
 	// PCAP storage
 	pcapBuffer  *PCAPBuffer
 
+	// Flows persisted next to the PCAP files, nil if the store can't be opened
+	flowStore *FlowStore
+
 	// Pause state - when true, PCAP data is not stored
 	paused      bool
 	pausedMutex sync.RWMutex
@@ -62,6 +75,15 @@ type Server struct {
 	k8sClient     kubernetes.Interface
 	k8sRestConfig *rest.Config
 
+	// Names the pods and services behind flow addresses, nil outside a cluster
+	peers *PeerResolver
+
+	// Connected agents, set once the gRPC server is started
+	agents *GRPCServer
+
+	// Counters for the Prometheus endpoint
+	metrics *HubMetrics
+
 	// API keys from environment
 	anthropicAPIKey string
 }
@@ -82,6 +104,14 @@ func NewServer(httpPort, grpcPort int) *Server {
 	batchIntervalMs := getEnvIntServer("WS_BATCH_INTERVAL_MS", 150)
 	catchupLimit := getEnvIntServer("WS_CATCHUP_LIMIT", 200)
 
+	// Read PCAP retention configuration from environment
+	pcapMaxSizeMB := getEnvIntServer("PCAP_MAX_SIZE_MB", 100)
+	pcapSegmentSizeMB := getEnvIntServer("PCAP_SEGMENT_SIZE_MB", 10)
+	pcapRetention := PCAPRetention(os.Getenv("PCAP_RETENTION"))
+	if pcapRetention != PCAPRetentionStop {
+		pcapRetention = PCAPRetentionRing
+	}
+
 	// Read API key from environment
 	anthropicAPIKey := os.Getenv("ANTHROPIC_API_KEY")
 
@@ -91,6 +121,9 @@ func NewServer(httpPort, grpcPort int) *Server {
 		sessionID:       sessionID,
 		pcapDir:         pcapDir,
 		flowBuffer:      NewFlowRingBuffer(0), // Uses MAX_FLOWS env or default 10000
+		graph:           NewServiceGraph(),
+		endpoints:       NewEndpointMetrics(),
+		metrics:         NewHubMetrics(),
 		wsClients:       make(map[*websocket.Conn]bool),
 		flowBatch:       make([]*protocol.Flow, 0, 64),
 		batchInterval:   time.Duration(batchIntervalMs) * time.Millisecond,
@@ -101,16 +134,44 @@ func NewServer(httpPort, grpcPort int) *Server {
 				return true // Allow all origins for local development
 			},
 		},
-		pcapBuffer: NewPCAPBuffer(pcapDir, 100*1024*1024), // 100MB buffer (stops capturing when full)
+		pcapBuffer: NewPCAPBufferWithRetention(pcapDir,
+			int64(pcapMaxSizeMB)*1024*1024, pcapRetention, int64(pcapSegmentSizeMB)*1024*1024),
 	}
+	s.tracker = newFlowTracker(s.graph, s.endpoints, s.metrics)
+
+	// Pick up the flows of a previous run, so a hub restart keeps them
+	s.openFlowStore()
 
 	// Start batch ticker for WebSocket batching
 	s.batchTicker = time.NewTicker(s.batchInterval)
 	go s.batchBroadcastLoop()
+	go s.graphBroadcastLoop()
 
 	return s
 }
 
+// openFlowStore restores the flows persisted in the PCAP directory and
+// keeps persisting new ones. Without a store the hub runs from memory only.
+func (s *Server) openFlowStore() {
+	store, err := OpenFlowStore(filepath.Join(s.pcapDir, flowStoreFile), s.flowBuffer)
+	if err != nil {
+		log.Printf("Flows will not survive a hub restart: %v", err)
+		return
+	}
+	s.flowStore = store
+
+	if restored := s.flowBuffer.GetAll(); len(restored) > 0 {
+		// The graph and endpoint windows pick up each flow as of when it was
+		// last seen. Traffic counters start over, so they only count what
+		// later snapshots of restored flows add.
+		for _, flow := range restored {
+			seen := flow.Timestamp.Add(time.Duration(flow.Duration) * time.Millisecond)
+			s.tracker.addTo(flow, seen, s.graph, s.endpoints)
+		}
+		log.Printf("Restored %d flows from %s", len(restored), store.path)
+	}
+}
+
 // getEnvIntServer reads an integer from environment variable with a default value.
 func getEnvIntServer(key string, defaultVal int) int {
 	if v := os.Getenv(key); v != "" {
@@ -129,6 +190,9 @@ func (s *Server) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create pcap directory: %w", err)
 	}
 
+	// Watch the cluster before agents connect, so their flows can be named
+	s.startPeerResolver(ctx)
+
 	// Start HTTP server
 	mux := http.NewServeMux()
 
@@ -136,6 +200,8 @@ func (s *Server) Start(ctx context.Context) error {
 	mux.HandleFunc("/api/health", s.handleHealth)
 	mux.HandleFunc("/api/flows", s.handleFlows)
 	mux.HandleFunc("/api/flows/ws", s.handleFlowsWebSocket)
+	mux.HandleFunc("/api/graph", s.handleGraph)
+	mux.HandleFunc("/api/metrics/endpoints", s.handleEndpointMetrics)
 	mux.HandleFunc("/api/pcap", s.handleDownloadPCAP)
 	mux.HandleFunc("/api/pcap/upload", s.handlePCAPUpload)
 	mux.HandleFunc("/api/pcap/reset", s.handlePCAPReset)
@@ -146,6 +212,7 @@ func (s *Server) Start(ctx context.Context) error {
 	mux.HandleFunc("/api/bpf-filter", s.handleBPFFilter)
 	mux.HandleFunc("/api/terminal/ws", s.handleTerminalWebSocket)
 	mux.HandleFunc("/api/ai/anthropic", s.handleAnthropicProxy)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 
 	// Serve static UI files
 	mux.Handle("/", http.FileServer(http.Dir("/app/ui")))
@@ -167,6 +234,9 @@ func (s *Server) Start(ctx context.Context) error {
 		log.Println("Shutting down servers...")
 		httpServer.Shutdown(context.Background())
 		grpcServer.GracefulStop()
+		if s.flowStore != nil {
+			s.flowStore.Close()
+		}
 	}()
 
 	log.Printf("Hub server starting - HTTP: %d, gRPC: %d", s.httpPort, s.grpcPort)
@@ -277,22 +347,49 @@ func (s *Server) handlePCAPReset(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleAgents handles agent registration
+// handleAgents lists agents (GET) and handles agent registration (POST)
 func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	switch r.Method {
+	case http.MethodGet:
+		// Every agent that registered, with how recently it was heard from
+		agents := []AgentStatus{}
+		if s.agents != nil {
+			agents = s.agents.AgentStatuses(time.Now())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agents)
+
+	case http.MethodPost:
+		var agent protocol.AgentInfo
+		if err := json.NewDecoder(r.Body).Decode(&agent); err != nil {
+			http.Error(w, "Invalid agent data", http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Agent connected: %s (%s/%s)", agent.ID, agent.Namespace, agent.PodName)
+		if s.agents != nil {
+			s.agents.register(&agent)
+		}
+		s.pcapBuffer.SetAgentName(agent.ID, agentDisplayName(&agent))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "registered"})
+
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
 	}
+}
 
-	var agent protocol.AgentInfo
-	if err := json.NewDecoder(r.Body).Decode(&agent); err != nil {
-		http.Error(w, "Invalid agent data", http.StatusBadRequest)
-		return
+// agentDisplayName names an agent after the pod it captures, falling back to its ID
+func agentDisplayName(agent *protocol.AgentInfo) string {
+	switch {
+	case agent.PodName == "":
+		return agent.ID
+	case agent.Namespace == "":
+		return agent.PodName
+	default:
+		return agent.Namespace + "/" + agent.PodName
 	}
-
-	log.Printf("Agent connected: %s (%s/%s)", agent.ID, agent.Namespace, agent.PodName)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "registered"})
 }
 
 // handlePause handles pause/resume requests
@@ -479,6 +576,15 @@ func (s *Server) handleFlowsWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The graph is only broadcast when it changes, so start the client off
+	s.wsMutex.Lock()
+	err = conn.WriteJSON(graphMessage(s.graph.Snapshot()))
+	s.wsMutex.Unlock()
+	if err != nil {
+		log.Printf("WebSocket graph error: %v", err)
+		return
+	}
+
 	// Keep connection alive and handle incoming messages
 	for {
 		_, _, err := conn.ReadMessage()
@@ -491,29 +597,35 @@ func (s *Server) handleFlowsWebSocket(w http.ResponseWriter, r *http.Request) {
 // handleDownloadPCAP handles PCAP file downloads for the entire session
 func (s *Server) handleDownloadPCAP(w http.ResponseWriter, r *http.Request) {
 	// Parse filter parameters from query string
-	query := r.URL.Query()
-	onlyHTTP := query.Get("onlyHTTP") == "true"
-	includeDNS := query.Get("includeDNS") == "true"
-	allPorts := query.Get("allPorts") == "true"
-	searchText := query.Get("search")
-
-	// Log filter parameters
-	if onlyHTTP || !includeDNS || allPorts || searchText != "" {
-		log.Printf("PCAP download with filters: onlyHTTP=%v includeDNS=%v allPorts=%v search=%q",
-			onlyHTTP, includeDNS, allPorts, searchText)
-	}
-
-	// TODO: Implement packet filtering based on these parameters
-	// For now, return all packets (filtering happens in UI view)
-	pcapData, err := s.pcapBuffer.GetSessionPCAP()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to generate PCAP: %v", err), http.StatusInternalServerError)
-		return
+	opts := parsePCAPDownloadOptions(r.URL.Query())
+
+	var matcher recordMatcher
+	if opts.filtered() {
+		log.Printf("PCAP download with filters: onlyHTTP=%v includeDNS=%v allPorts=%v search=%q bpf=%q",
+			opts.onlyHTTP, opts.includeDNS, opts.allPorts, opts.search, opts.bpf)
+
+		var filters allOf
+		if opts.selectsFlows() {
+			var flows []*protocol.Flow
+			for _, flow := range s.flowBuffer.GetAll() {
+				if opts.includesFlow(flow) {
+					flows = append(flows, flow)
+				}
+			}
+			filters = append(filters, newFlowSetFilter(flows, opts.includeDNS))
+		}
+		if opts.bpf != "" {
+			bpf, err := newBPFMatcher(opts.bpf)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filters = append(filters, bpf)
+		}
+		matcher = filters
 	}
 
-	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=podscope-%s.pcap", s.sessionID))
-	w.Write(pcapData)
+	s.streamPCAP(w, fmt.Sprintf("podscope-%s", s.sessionID), opts.format, matcher)
 }
 
 // handleDownloadStreamPCAP handles PCAP file downloads for a specific stream
@@ -525,30 +637,58 @@ func (s *Server) handleDownloadStreamPCAP(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Parse filter parameters from query string
-	query := r.URL.Query()
-	onlyHTTP := query.Get("onlyHTTP") == "true"
-	includeDNS := query.Get("includeDNS") == "true"
-	allPorts := query.Get("allPorts") == "true"
-	searchText := query.Get("search")
+	// The stream is already a single flow; only the BPF expression narrows it further
+	opts := parsePCAPDownloadOptions(r.URL.Query())
 
-	// Log filter parameters
-	if onlyHTTP || !includeDNS || allPorts || searchText != "" {
-		log.Printf("Stream PCAP download with filters: stream=%s onlyHTTP=%v includeDNS=%v allPorts=%v search=%q",
-			streamID, onlyHTTP, includeDNS, allPorts, searchText)
+	// Resolve the stream to its flow so we can match packets by 5-tuple
+	flow := s.flowBuffer.Get(streamID)
+	if flow == nil {
+		http.Error(w, fmt.Sprintf("Flow %s not found", streamID), http.StatusNotFound)
+		return
 	}
 
-	// TODO: Implement packet filtering based on these parameters
-	// For now, return all packets (filtering happens in UI view)
-	pcapData, err := s.pcapBuffer.GetStreamPCAP(streamID)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to generate PCAP: %v", err), http.StatusInternalServerError)
-		return
+	matcher := allOf{newFlowFilter(flow)}
+	if opts.bpf != "" {
+		log.Printf("Stream PCAP download with filters: stream=%s bpf=%q", streamID, opts.bpf)
+
+		bpf, err := newBPFMatcher(opts.bpf)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		matcher = append(matcher, bpf)
 	}
 
-	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=stream-%s.pcap", streamID))
-	w.Write(pcapData)
+	s.streamPCAP(w, fmt.Sprintf("stream-%s", streamID), opts.format, matcher)
+}
+
+// streamPCAP writes the time-ordered session capture as a file attachment in
+// the requested format. Headers are already sent once streaming starts, so
+// failures are only logged.
+func (s *Server) streamPCAP(w http.ResponseWriter, name, format string, m recordMatcher) {
+	switch format {
+	case "", "pcap":
+		filename := name + ".pcap"
+		w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+		if err := s.pcapBuffer.WriteSessionPCAP(w, m); err != nil {
+			log.Printf("PCAP download %s aborted: %v", filename, err)
+		}
+
+	case "pcapng":
+		filename := name + ".pcapng"
+		comments := newPCAPNGFlowComments(s.flowBuffer.GetAll())
+		w.Header().Set("Content-Type", "application/x-pcapng")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+		if err := s.pcapBuffer.WriteSessionPCAPNG(w, m, comments.comment); err != nil {
+			log.Printf("PCAP download %s aborted: %v", filename, err)
+		}
+
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported format %q (use pcap or pcapng)", format), http.StatusBadRequest)
+	}
 }
 
 // handleStats returns capture statistics
@@ -563,6 +703,11 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	paused := s.paused
 	s.pausedMutex.RUnlock()
 
+	var agents []AgentConnection
+	if s.agents != nil {
+		agents = s.agents.GetConnectedAgents()
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"flows":        flowCount,
@@ -570,15 +715,77 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 		"wsClients":    clientCount,
 		"pcapSize":     s.pcapBuffer.Size(),
 		"pcapFull":     s.pcapBuffer.IsFull(),
+		"pcap":         s.pcapBuffer.Stats(),
 		"sessionId":    s.sessionID,
 		"uptime":       time.Now().UTC(),
 		"paused":       paused,
+		"completeness": captureCompleteness(agents),
+	})
+}
+
+// handleGraph returns the service graph built from the flows seen so far
+func (s *Server) handleGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.graph.Snapshot())
+}
+
+// handleEndpointMetrics returns RED metrics for each endpoint seen in the
+// last windows. ?service= limits them to one service.
+func (s *Server) handleEndpointMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	endpoints := s.endpoints.Snapshot(time.Now())
+	if service := r.URL.Query().Get("service"); service != "" {
+		filtered := endpoints[:0]
+		for _, e := range endpoints {
+			if e.Service == service {
+				filtered = append(filtered, e)
+			}
+		}
+		endpoints = filtered
+	}
+
+	windows := make([]string, 0, len(EndpointWindows))
+	for _, window := range EndpointWindows {
+		windows = append(windows, windowLabel(window))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"windows":   windows,
+		"endpoints": endpoints,
 	})
 }
 
 // AddFlow adds a new flow and queues it for batched WebSocket broadcast
 func (s *Server) AddFlow(flow *protocol.Flow) {
+	s.metrics.flowsReceived.Add(1)
+	if s.peers != nil {
+		s.peers.Enrich(flow)
+	}
+	mergeExchanges(flow, s.flowBuffer.Get(flow.ID))
+
+	// Delivery is at least once: agents send flows again when the hub's
+	// confirmation is lost. Anything about a flow that already ended is
+	// such a replay.
+	if !s.tracker.add(flow, time.Now()) {
+		return
+	}
+
 	s.flowBuffer.Add(flow)
+	if s.flowStore != nil {
+		if err := s.flowStore.Append(flow); err != nil {
+			log.Printf("Failed to persist flow %s: %v", flow.ID, err)
+		}
+	}
 
 	// Queue for batched broadcast instead of immediate send
 	s.queueFlowForBroadcast(flow)
@@ -629,12 +836,60 @@ func (s *Server) broadcastBatch(flows []*protocol.Flow) {
 		return
 	}
 
+	s.broadcast(data)
+}
+
+// graphBroadcastLoop sends the graph to WebSocket clients when it has
+// changed, at most once per graphBroadcastInterval
+func (s *Server) graphBroadcastLoop() {
+	ticker := time.NewTicker(graphBroadcastInterval)
+	defer ticker.Stop()
+
+	var sent uint64
+	for range ticker.C {
+		if version := s.graph.Version(); version != sent {
+			s.broadcastGraph()
+			sent = version
+		}
+	}
+}
+
+// broadcastGraph sends the current graph to all connected WebSocket clients
+func (s *Server) broadcastGraph() {
+	s.wsMutex.Lock()
+	clients := len(s.wsClients)
+	s.wsMutex.Unlock()
+	if clients == 0 {
+		return
+	}
+
+	data, err := json.Marshal(graphMessage(s.graph.Snapshot()))
+	if err != nil {
+		log.Printf("Failed to marshal graph: %v", err)
+		return
+	}
+
+	s.broadcast(data)
+}
+
+// graphMessage wraps a graph for the WebSocket
+func graphMessage(graph Graph) map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "graph",
+		"graph": graph,
+	}
+}
+
+// broadcast writes a message to all connected WebSocket clients, dropping
+// any that fail
+func (s *Server) broadcast(data []byte) {
 	s.wsMutex.Lock()
 	defer s.wsMutex.Unlock()
 
 	for conn := range s.wsClients {
 		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
 			log.Printf("WebSocket write error: %v", err)
+			s.metrics.broadcastsDropped.Add(1)
 			conn.Close()
 			delete(s.wsClients, conn)
 		}
@@ -679,6 +934,29 @@ func (s *Server) initK8sClient() error {
 	return nil
 }
 
+// startPeerResolver starts watching pods and services to name the remote
+// side of flows. Without a cluster, flows keep the names agents gave them.
+func (s *Server) startPeerResolver(ctx context.Context) {
+	if err := s.initK8sClient(); err != nil {
+		log.Printf("Peer resolution disabled: %v", err)
+		return
+	}
+
+	peers, err := NewPeerResolver(s.k8sClient)
+	if err != nil {
+		log.Printf("Peer resolution disabled: %v", err)
+		return
+	}
+	peers.Start(ctx)
+	s.peers = peers
+
+	go func() {
+		if peers.WaitForSync(ctx) {
+			log.Println("Peer resolution ready")
+		}
+	}()
+}
+
 // getAgentContainer finds the podscope agent ephemeral container in a pod
 func (s *Server) getAgentContainer(ctx context.Context, namespace, podName string) (string, error) {
 	pod, err := s.k8sClient.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
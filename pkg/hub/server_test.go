@@ -1,6 +1,7 @@
 package hub
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/podscope/podscope/pkg/protocol"
+	"github.com/podscope/podscope/pkg/protocol/pb"
 )
 
 // setupTestServer creates a Server instance suitable for testing.
@@ -35,6 +37,9 @@ func setupTestServer(t *testing.T) *Server {
 		sessionID:     sessionID,
 		pcapDir:       pcapDir,
 		flowBuffer:    NewFlowRingBuffer(100), // Small capacity for tests
+		graph:         NewServiceGraph(),
+		endpoints:     NewEndpointMetrics(),
+		metrics:       NewHubMetrics(),
 		wsClients:     make(map[*websocket.Conn]bool),
 		wsMutex:       sync.Mutex{},
 		flowBatch:     make([]*protocol.Flow, 0, 64),
@@ -50,6 +55,7 @@ func setupTestServer(t *testing.T) *Server {
 		pausedMutex:    sync.RWMutex{},
 		bpfFilterMutex: sync.RWMutex{},
 	}
+	s.tracker = newFlowTracker(s.graph, s.endpoints, s.metrics)
 
 	return s
 }
@@ -1753,18 +1759,188 @@ func TestHandleAgents_POST_EmptyBodyReturns400(t *testing.T) {
 	}
 }
 
-// TestHandleAgents_GET_Returns405 tests that GET method returns 405 Method Not Allowed
-func TestHandleAgents_GET_Returns405(t *testing.T) {
+// TestHandleAgents_GET_ListsAgents tests that GET lists registered agents with their health
+func TestHandleAgents_GET_ListsAgents(t *testing.T) {
 	s := setupTestServer(t)
 	defer s.pcapBuffer.Close()
 
-	req := httptest.NewRequest(http.MethodGet, "/api/agents", nil)
+	now := time.Now()
+	s.agents = &GRPCServer{server: s, agents: map[string]*AgentConnection{
+		"b": {ID: "b", PodName: "web-1", Namespace: "prod", NodeName: "node-2", LastHeartbeat: now.Add(-2 * time.Minute),
+			Stats: AgentStats{PacketsCaptured: 10}},
+		"a": {ID: "a", PodName: "api-0", Namespace: "prod", NodeName: "node-1", LastHeartbeat: now,
+			Stats: AgentStats{PacketsCaptured: 500, KernelPacketsDropped: 3}},
+	}}
+
 	w := httptest.NewRecorder()
+	s.handleAgents(w, httptest.NewRequest(http.MethodGet, "/api/agents", nil))
 
-	s.handleAgents(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
 
-	if w.Code != http.StatusMethodNotAllowed {
-		t.Errorf("status code = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	var agents []AgentStatus
+	if err := json.NewDecoder(w.Body).Decode(&agents); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(agents) != 2 {
+		t.Fatalf("got %d agents, want 2", len(agents))
+	}
+	if agents[0].PodName != "api-0" || agents[0].NodeName != "node-1" || agents[0].Health != AgentHealthy {
+		t.Errorf("agents[0] = %+v, want healthy api-0 on node-1", agents[0])
+	}
+	if agents[0].Stats.PacketsCaptured != 500 || agents[0].Stats.KernelPacketsDropped != 3 {
+		t.Errorf("agents[0].Stats = %+v", agents[0].Stats)
+	}
+	if agents[1].PodName != "web-1" || agents[1].Health != AgentLost {
+		t.Errorf("agents[1] = %+v, want lost web-1", agents[1])
+	}
+}
+
+// TestHandleAgents_GET_EmptyList tests that GET returns an empty list before any agent registers
+func TestHandleAgents_GET_EmptyList(t *testing.T) {
+	s := setupTestServer(t)
+	defer s.pcapBuffer.Close()
+
+	w := httptest.NewRecorder()
+	s.handleAgents(w, httptest.NewRequest(http.MethodGet, "/api/agents", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != "[]" {
+		t.Errorf("body = %s, want []", body)
+	}
+}
+
+// TestHandleAgents_POST_AddsToRoster tests that agents registering over HTTP are listed too
+func TestHandleAgents_POST_AddsToRoster(t *testing.T) {
+	s := setupTestServer(t)
+	defer s.pcapBuffer.Close()
+	s.agents = &GRPCServer{server: s, agents: make(map[string]*AgentConnection)}
+
+	agentJSON := `{"id": "agent-9", "podName": "db-0", "namespace": "data", "nodeName": "node-3"}`
+	w := httptest.NewRecorder()
+	s.handleAgents(w, httptest.NewRequest(http.MethodPost, "/api/agents", strings.NewReader(agentJSON)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	agents := s.agents.AgentStatuses(time.Now())
+	if len(agents) != 1 || agents[0].ID != "agent-9" || agents[0].NodeName != "node-3" || agents[0].Health != AgentHealthy {
+		t.Errorf("agents = %+v, want healthy agent-9 on node-3", agents)
+	}
+}
+
+// TestAgentHealth tests how agents are judged by their last heartbeat
+func TestAgentHealth(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		since time.Duration
+		want  string
+	}{
+		{0, AgentHealthy},
+		{agentStaleAfter - time.Second, AgentHealthy},
+		{agentStaleAfter, AgentStale},
+		{agentLostAfter - time.Second, AgentStale},
+		{agentLostAfter, AgentLost},
+	}
+	for _, tt := range tests {
+		if got := agentHealth(now.Add(-tt.since), now); got != tt.want {
+			t.Errorf("agentHealth(%v ago) = %q, want %q", tt.since, got, tt.want)
+		}
+	}
+}
+
+// TestHeartbeat_UnknownAgent tests that a hub that lost its roster, e.g.
+// to a restart, asks the agent to register again
+func TestHeartbeat_UnknownAgent(t *testing.T) {
+	s := setupTestServer(t)
+	defer s.pcapBuffer.Close()
+	gs := &GRPCServer{server: s, agents: make(map[string]*AgentConnection)}
+
+	resp, err := gs.Heartbeat(context.Background(), &pb.HeartbeatRequest{AgentId: "agent-1"})
+	if err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if !resp.GetUnknownAgent() {
+		t.Error("expected an unregistered agent to be asked to register")
+	}
+
+	gs.RegisterAgent(context.Background(), &pb.AgentInfo{Id: "agent-1"})
+	resp, err = gs.Heartbeat(context.Background(), &pb.HeartbeatRequest{AgentId: "agent-1"})
+	if err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if resp.GetUnknownAgent() {
+		t.Error("registered agent was asked to register again")
+	}
+}
+
+// TestRegisterAgent_AgainKeepsCounters tests that an agent registering again
+// after a blip keeps its connection time and delivery counters
+func TestRegisterAgent_AgainKeepsCounters(t *testing.T) {
+	s := setupTestServer(t)
+	defer s.pcapBuffer.Close()
+	gs := &GRPCServer{server: s, agents: make(map[string]*AgentConnection)}
+
+	gs.RegisterAgent(context.Background(), &pb.AgentInfo{Id: "agent-1", PodIp: "10.0.0.5"})
+	first := gs.agents["agent-1"]
+	first.FlowsReceived = 10
+	first.PCAPBytesReceived = 4096
+	first.Stats.PacketsCaptured = 500
+	connectedAt := first.ConnectedAt
+
+	gs.RegisterAgent(context.Background(), &pb.AgentInfo{Id: "agent-1", PodIp: "10.0.0.6"})
+
+	got := gs.GetConnectedAgents()
+	if len(got) != 1 {
+		t.Fatalf("got %d agents, want 1", len(got))
+	}
+	a := got[0]
+	if a.FlowsReceived != 10 || a.PCAPBytesReceived != 4096 || a.Stats.PacketsCaptured != 500 {
+		t.Errorf("counters = %d flows %d bytes %d packets, want 10/4096/500", a.FlowsReceived, a.PCAPBytesReceived, a.Stats.PacketsCaptured)
+	}
+	if !a.ConnectedAt.Equal(connectedAt) {
+		t.Errorf("ConnectedAt = %v, want %v", a.ConnectedAt, connectedAt)
+	}
+	if a.PodIP != "10.0.0.6" {
+		t.Errorf("PodIP = %s, want the newly registered 10.0.0.6", a.PodIP)
+	}
+}
+
+// TestReplayedPCAP tests that a chunk sent again after its confirmation was
+// lost is recognised by its number, also across re-registration
+func TestReplayedPCAP(t *testing.T) {
+	s := setupTestServer(t)
+	defer s.pcapBuffer.Close()
+	gs := &GRPCServer{server: s, agents: make(map[string]*AgentConnection)}
+
+	chunk := func(agent string, seq uint64) *pb.PCAPChunk {
+		return &pb.PCAPChunk{AgentId: agent, Seq: seq, Data: []byte{0x01}}
+	}
+	for _, c := range []struct {
+		chunk *pb.PCAPChunk
+		want  bool
+	}{
+		{chunk("agent-1", 1), false},
+		{chunk("agent-1", 2), false},
+		{chunk("agent-1", 2), true},
+		{chunk("agent-1", 1), true},
+		{chunk("agent-2", 1), false}, // numbered per agent
+		{chunk("agent-1", 0), false}, // unnumbered, from an older agent
+	} {
+		if got := gs.replayedPCAP(c.chunk); got != c.want {
+			t.Errorf("chunk %s #%d replayed = %v, want %v", c.chunk.GetAgentId(), c.chunk.GetSeq(), got, c.want)
+		}
+	}
+
+	gs.RegisterAgent(context.Background(), &pb.AgentInfo{Id: "agent-1"})
+	if !gs.replayedPCAP(chunk("agent-1", 2)) {
+		t.Error("registering again forgot the chunks already written")
 	}
 }
 
@@ -2055,3 +2231,165 @@ func TestHandlePCAPReset_POST_CanWriteAfterReset(t *testing.T) {
 		t.Error("pcapBuffer.Size() = 0 after writing new data, expected > 0")
 	}
 }
+
+// TestHandleDownloadStreamPCAP tests for GET /api/pcap/{streamID} endpoint
+
+// TestHandleDownloadStreamPCAP_UnknownFlowReturns404 tests that unknown stream IDs return 404
+func TestHandleDownloadStreamPCAP_UnknownFlowReturns404(t *testing.T) {
+	s := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pcap/missing", nil)
+	w := httptest.NewRecorder()
+
+	s.handleDownloadStreamPCAP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// TestHandleDownloadStreamPCAP_KnownFlowReturnsPCAP tests that a known flow returns a PCAP attachment
+func TestHandleDownloadStreamPCAP_KnownFlowReturnsPCAP(t *testing.T) {
+	s := setupTestServer(t)
+	s.flowBuffer.Add(&protocol.Flow{
+		ID:        "abc123",
+		Timestamp: time.Now(),
+		SrcIP:     "10.0.0.1",
+		SrcPort:   40000,
+		DstIP:     "10.0.0.2",
+		DstPort:   80,
+		Status:    protocol.StatusOpen,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pcap/abc123", nil)
+	w := httptest.NewRecorder()
+
+	s.handleDownloadStreamPCAP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/vnd.tcpdump.pcap" {
+		t.Errorf("Content-Type = %q, want application/vnd.tcpdump.pcap", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "stream-abc123.pcap") {
+		t.Errorf("Content-Disposition = %q, want filename stream-abc123.pcap", cd)
+	}
+	if w.Body.Len() != pcapGlobalHeaderSize {
+		t.Errorf("body size = %d, want %d", w.Body.Len(), pcapGlobalHeaderSize)
+	}
+}
+
+// TestHandleDownloadPCAP tests for GET /api/pcap endpoint
+
+// TestHandleDownloadPCAP_NoFiltersReturnsAllData tests that unfiltered downloads include every agent record
+func TestHandleDownloadPCAP_NoFiltersReturnsAllData(t *testing.T) {
+	s := setupTestServer(t)
+	writeAgentPacket(t, s.pcapBuffer, "agent-1", []byte("raw-bytes"), time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pcap", nil)
+	w := httptest.NewRecorder()
+
+	s.handleDownloadPCAP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.HasSuffix(w.Body.String(), "raw-bytes") {
+		t.Error("unfiltered download missing agent data")
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "podscope-test-session.pcap") {
+		t.Errorf("Content-Disposition = %q, want filename podscope-test-session.pcap", cd)
+	}
+}
+
+// TestHandleDownloadPCAP_OnlyHTTPKeepsHTTPFlows tests that onlyHTTP drops packets of non-HTTP flows
+func TestHandleDownloadPCAP_OnlyHTTPKeepsHTTPFlows(t *testing.T) {
+	s := setupTestServer(t)
+
+	start := time.Now().Truncate(time.Millisecond)
+	s.flowBuffer.Add(&protocol.Flow{
+		ID: "http", Timestamp: start, SrcIP: "10.0.0.1", SrcPort: 40000,
+		DstIP: "10.0.0.2", DstPort: 80, Protocol: protocol.ProtocolHTTP, Status: protocol.StatusOpen,
+	})
+	s.flowBuffer.Add(&protocol.Flow{
+		ID: "tcp", Timestamp: start, SrcIP: "10.0.0.1", SrcPort: 40001,
+		DstIP: "10.0.0.3", DstPort: 6379, Protocol: protocol.ProtocolTCP, Status: protocol.StatusOpen,
+	})
+
+	httpPacket := buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80)
+	tcpPacket := buildTCPPacket(t, "10.0.0.1", 40001, "10.0.0.3", 6379)
+	writeAgentPacket(t, s.pcapBuffer, "agent-1", httpPacket, start)
+	writeAgentPacket(t, s.pcapBuffer, "agent-1", tcpPacket, start)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pcap?onlyHTTP=true", nil)
+	w := httptest.NewRecorder()
+
+	s.handleDownloadPCAP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := countPCAPRecords(t, w.Body.Bytes()); got != 1 {
+		t.Errorf("record count = %d, want 1", got)
+	}
+	if !strings.Contains(w.Body.String(), string(httpPacket)) {
+		t.Error("filtered download missing HTTP packet")
+	}
+}
+
+// TestHandleDownloadPCAP_SearchSelectsFlows tests that the search text narrows the download
+func TestHandleDownloadPCAP_SearchSelectsFlows(t *testing.T) {
+	s := setupTestServer(t)
+
+	start := time.Now().Truncate(time.Millisecond)
+	s.flowBuffer.Add(&protocol.Flow{
+		ID: "a", Timestamp: start, SrcIP: "10.0.0.1", SrcPort: 40000,
+		DstIP: "10.0.0.2", DstPort: 80, DstPod: "frontend", Status: protocol.StatusOpen,
+	})
+	s.flowBuffer.Add(&protocol.Flow{
+		ID: "b", Timestamp: start, SrcIP: "10.0.0.1", SrcPort: 40001,
+		DstIP: "10.0.0.3", DstPort: 80, DstPod: "backend", Status: protocol.StatusOpen,
+	})
+
+	writeAgentPacket(t, s.pcapBuffer, "agent-1", buildTCPPacket(t, "10.0.0.1", 40000, "10.0.0.2", 80), start)
+	writeAgentPacket(t, s.pcapBuffer, "agent-1", buildTCPPacket(t, "10.0.0.3", 80, "10.0.0.1", 40001), start)
+	writeAgentPacket(t, s.pcapBuffer, "agent-1", buildTCPPacket(t, "10.0.0.1", 40001, "10.0.0.3", 80), start)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pcap?allPorts=true&search=backend", nil)
+	w := httptest.NewRecorder()
+
+	s.handleDownloadPCAP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := countPCAPRecords(t, w.Body.Bytes()); got != 2 {
+		t.Errorf("record count = %d, want 2", got)
+	}
+}
+
+// TestHandleStats_ReturnsPCAPRetention tests that the response describes PCAP retention
+func TestHandleStats_ReturnsPCAPRetention(t *testing.T) {
+	s := setupTestServer(t)
+	s.pcapBuffer = NewPCAPBufferWithRetention(s.pcapDir, 2048, PCAPRetentionRing, 512)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+	w := httptest.NewRecorder()
+
+	s.handleStats(w, req)
+
+	var resp struct {
+		PCAP PCAPBufferStats `json:"pcap"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if resp.PCAP.Retention != PCAPRetentionRing {
+		t.Errorf("retention = %q, want %q", resp.PCAP.Retention, PCAPRetentionRing)
+	}
+	if resp.PCAP.MaxSize != 2048 || resp.PCAP.SegmentSize != 512 {
+		t.Errorf("sizes = %d/%d, want 2048/512", resp.PCAP.MaxSize, resp.PCAP.SegmentSize)
+	}
+}
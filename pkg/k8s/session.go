@@ -46,7 +46,14 @@ func GetHubImage() string {
 
 // SessionOptions contains optional configuration for a session
 type SessionOptions struct {
-	AnthropicAPIKey string // API key for AI features in the Hub
+	AnthropicAPIKey string        // API key for AI features in the Hub
+	HubGracePeriod  time.Duration // how long agents spool data while the Hub is unreachable; 0 keeps the agent default
+
+	// HubPersistentVolume backs the Hub's PCAP volume, which also holds its
+	// flows, with a PersistentVolumeClaim so they outlive the Hub pod. The
+	// claim is deleted with the session namespace.
+	HubPersistentVolume bool
+	HubStorageClass     string // storage class for that claim; empty uses the cluster default
 }
 
 // Session manages a PodScope capture session
@@ -58,6 +65,9 @@ type Session struct {
 	portForwarder   *portforward.PortForwarder
 	stopChan        chan struct{}
 	anthropicAPIKey string
+	hubGracePeriod  time.Duration
+	hubPVC          bool
+	hubStorageClass string
 }
 
 // NewSession creates a new capture session
@@ -70,6 +80,9 @@ func NewSession(client *Client, opts SessionOptions) (*Session, error) {
 		hubService:      "podscope-hub",
 		stopChan:        make(chan struct{}),
 		anthropicAPIKey: opts.AnthropicAPIKey,
+		hubGracePeriod:  opts.HubGracePeriod,
+		hubPVC:          opts.HubPersistentVolume,
+		hubStorageClass: opts.HubStorageClass,
 	}, nil
 }
 
@@ -143,6 +156,60 @@ func (s *Session) createNamespace(ctx context.Context) error {
 	return nil
 }
 
+// hubVolumeClaimName names the claim behind the Hub's PCAP volume
+const hubVolumeClaimName = "podscope-hub-data"
+
+// hubVolumeClaim returns the claim backing the Hub's PCAP volume, or nil
+// when the volume lives and dies with the Hub pod
+func (s *Session) hubVolumeClaim(labels map[string]string) *corev1.PersistentVolumeClaim {
+	if !s.hubPVC {
+		return nil
+	}
+
+	claim := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hubVolumeClaimName,
+			Namespace: s.namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: *resource.NewQuantity(1024*1024*1024, resource.BinarySI), // 1Gi
+				},
+			},
+		},
+	}
+	if s.hubStorageClass != "" {
+		claim.Spec.StorageClassName = &s.hubStorageClass
+	}
+	return claim
+}
+
+// hubVolumeSource returns where the Hub keeps PCAP files and flows
+func (s *Session) hubVolumeSource() corev1.VolumeSource {
+	if s.hubPVC {
+		return corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: hubVolumeClaimName},
+		}
+	}
+	return corev1.VolumeSource{
+		EmptyDir: &corev1.EmptyDirVolumeSource{
+			SizeLimit: resource.NewQuantity(1024*1024*1024, resource.BinarySI), // 1Gi
+		},
+	}
+}
+
+// hubDeploymentStrategy stops the old Hub pod before starting a new one
+// when they would share a ReadWriteOnce claim
+func (s *Session) hubDeploymentStrategy() appsv1.DeploymentStrategy {
+	if s.hubPVC {
+		return appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+	return appsv1.DeploymentStrategy{}
+}
+
 // deployHub creates the Hub deployment and service
 func (s *Session) deployHub(ctx context.Context) error {
 	labels := map[string]string{
@@ -167,7 +234,8 @@ func (s *Session) deployHub(ctx context.Context) error {
 		return fmt.Errorf("failed to create service account: %w", err)
 	}
 
-	// Create ClusterRole with permissions for terminal exec
+	// Create ClusterRole with permissions for terminal exec and for watching
+	// the workloads that flow peers are resolved against
 	clusterRole := &rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   fmt.Sprintf("podscope-hub-%s", s.id),
@@ -177,13 +245,23 @@ func (s *Session) deployHub(ctx context.Context) error {
 			{
 				APIGroups: []string{""},
 				Resources: []string{"pods"},
-				Verbs:     []string{"get", "list"},
+				Verbs:     []string{"get", "list", "watch"},
 			},
 			{
 				APIGroups: []string{""},
 				Resources: []string{"pods/exec"},
 				Verbs:     []string{"create"},
 			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"services"},
+				Verbs:     []string{"list", "watch"},
+			},
+			{
+				APIGroups: []string{"discovery.k8s.io"},
+				Resources: []string{"endpointslices"},
+				Verbs:     []string{"list", "watch"},
+			},
 		},
 	}
 	_, err = s.client.clientset.RbacV1().ClusterRoles().Create(ctx, clusterRole, metav1.CreateOptions{})
@@ -215,6 +293,14 @@ func (s *Session) deployHub(ctx context.Context) error {
 		return fmt.Errorf("failed to create cluster role binding: %w", err)
 	}
 
+	// Create the claim first so the Hub pod can be scheduled against it
+	if claim := s.hubVolumeClaim(labels); claim != nil {
+		_, err = s.client.clientset.CoreV1().PersistentVolumeClaims(s.namespace).Create(ctx, claim, metav1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create hub volume claim: %w", err)
+		}
+	}
+
 	// Create Deployment
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -224,12 +310,19 @@ func (s *Session) deployHub(ctx context.Context) error {
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicas,
+			Strategy: s.hubDeploymentStrategy(),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					// Let an existing Prometheus pick up the hub's /metrics
+					Annotations: map[string]string{
+						"prometheus.io/scrape": "true",
+						"prometheus.io/port":   "8080",
+						"prometheus.io/path":   "/metrics",
+					},
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: serviceAccountName,
@@ -271,12 +364,8 @@ func (s *Session) deployHub(ctx context.Context) error {
 					},
 					Volumes: []corev1.Volume{
 						{
-							Name: "pcap-storage",
-							VolumeSource: corev1.VolumeSource{
-								EmptyDir: &corev1.EmptyDirVolumeSource{
-									SizeLimit: resource.NewQuantity(1024*1024*1024, resource.BinarySI), // 1Gi
-								},
-							},
+							Name:         "pcap-storage",
+							VolumeSource: s.hubVolumeSource(),
 						},
 					},
 				},
@@ -438,6 +527,10 @@ func (s *Session) InjectAgent(ctx context.Context, target PodTarget, privileged
 					Name:  "POD_IP",
 					Value: target.IP,
 				},
+				{
+					Name:  "NODE_NAME",
+					Value: target.Node,
+				},
 				{
 					Name:  "SESSION_ID",
 					Value: s.id,
@@ -446,9 +539,19 @@ func (s *Session) InjectAgent(ctx context.Context, target PodTarget, privileged
 					Name:  "INTERFACE",
 					Value: "eth0",
 				},
+				{
+					Name:  "TARGET_CONTAINER",
+					Value: targetContainer,
+				},
 			},
 		},
 	}
+	if s.hubGracePeriod > 0 {
+		ephemeralContainer.Env = append(ephemeralContainer.Env, corev1.EnvVar{
+			Name:  "HUB_GRACE_PERIOD",
+			Value: s.hubGracePeriod.String(),
+		})
+	}
 
 	// Update the pod with the ephemeral container
 	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, ephemeralContainer)
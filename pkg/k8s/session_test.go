@@ -3,6 +3,7 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -302,7 +303,8 @@ func (ts *testSession) deployHub(ctx context.Context) error {
 		return fmt.Errorf("failed to create service account: %w", err)
 	}
 
-	// Create ClusterRole with permissions for terminal exec
+	// Create ClusterRole with permissions for terminal exec and for watching
+	// the workloads that flow peers are resolved against
 	clusterRole := &rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   fmt.Sprintf("podscope-hub-%s", ts.id),
@@ -312,13 +314,23 @@ func (ts *testSession) deployHub(ctx context.Context) error {
 			{
 				APIGroups: []string{""},
 				Resources: []string{"pods"},
-				Verbs:     []string{"get", "list"},
+				Verbs:     []string{"get", "list", "watch"},
 			},
 			{
 				APIGroups: []string{""},
 				Resources: []string{"pods/exec"},
 				Verbs:     []string{"create"},
 			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"services"},
+				Verbs:     []string{"list", "watch"},
+			},
+			{
+				APIGroups: []string{"discovery.k8s.io"},
+				Resources: []string{"endpointslices"},
+				Verbs:     []string{"list", "watch"},
+			},
 		},
 	}
 	_, err = ts.fakeClientset.RbacV1().ClusterRoles().Create(ctx, clusterRole, metav1.CreateOptions{})
@@ -350,6 +362,14 @@ func (ts *testSession) deployHub(ctx context.Context) error {
 		return fmt.Errorf("failed to create cluster role binding: %w", err)
 	}
 
+	// Create the claim first so the Hub pod can be scheduled against it
+	if claim := ts.hubVolumeClaim(labels); claim != nil {
+		_, err = ts.fakeClientset.CoreV1().PersistentVolumeClaims(ts.namespace).Create(ctx, claim, metav1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create hub volume claim: %w", err)
+		}
+	}
+
 	// Create Deployment
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -359,12 +379,19 @@ func (ts *testSession) deployHub(ctx context.Context) error {
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicas,
+			Strategy: ts.hubDeploymentStrategy(),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					// Let an existing Prometheus pick up the hub's /metrics
+					Annotations: map[string]string{
+						"prometheus.io/scrape": "true",
+						"prometheus.io/port":   "8080",
+						"prometheus.io/path":   "/metrics",
+					},
 				},
 				Spec: corev1.PodSpec{
 					ServiceAccountName: serviceAccountName,
@@ -411,12 +438,8 @@ func (ts *testSession) deployHub(ctx context.Context) error {
 					},
 					Volumes: []corev1.Volume{
 						{
-							Name: "pcap-storage",
-							VolumeSource: corev1.VolumeSource{
-								EmptyDir: &corev1.EmptyDirVolumeSource{
-									SizeLimit: resource.NewQuantity(1024*1024*1024, resource.BinarySI),
-								},
-							},
+							Name:         "pcap-storage",
+							VolumeSource: ts.hubVolumeSource(),
 						},
 					},
 				},
@@ -626,6 +649,46 @@ func TestDeployHub_ClusterRoleHasPodsPermission(t *testing.T) {
 	}
 }
 
+// TestDeployHub_ClusterRoleCanWatchPeers tests that the ClusterRole allows watching the objects flow peers are resolved against
+func TestDeployHub_ClusterRoleCanWatchPeers(t *testing.T) {
+	sessionID := "peer1234"
+	ts := createTestSession(t, sessionID)
+	ctx := context.Background()
+
+	if err := ts.createNamespace(ctx); err != nil {
+		t.Fatalf("createNamespace failed: %v", err)
+	}
+	if err := ts.deployHub(ctx); err != nil {
+		t.Fatalf("deployHub failed: %v", err)
+	}
+
+	clusterRoleName := fmt.Sprintf("podscope-hub-%s", sessionID)
+	clusterRole, err := ts.fakeClientset.RbacV1().ClusterRoles().Get(ctx, clusterRoleName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get ClusterRole: %v", err)
+	}
+
+	canWatch := func(group, resource string) bool {
+		for _, rule := range clusterRole.Rules {
+			if !slices.Contains(rule.APIGroups, group) || !slices.Contains(rule.Resources, resource) {
+				continue
+			}
+			return slices.Contains(rule.Verbs, "list") && slices.Contains(rule.Verbs, "watch")
+		}
+		return false
+	}
+
+	for _, r := range []struct{ group, resource string }{
+		{"", "pods"},
+		{"", "services"},
+		{"discovery.k8s.io", "endpointslices"},
+	} {
+		if !canWatch(r.group, r.resource) {
+			t.Errorf("ClusterRole cannot list and watch %q in group %q", r.resource, r.group)
+		}
+	}
+}
+
 // TestDeployHub_ClusterRoleBindingBindsServiceAccount tests that ClusterRoleBinding binds the ServiceAccount to ClusterRole
 func TestDeployHub_ClusterRoleBindingBindsServiceAccount(t *testing.T) {
 	sessionID := "bind5678"
@@ -908,6 +971,89 @@ func TestDeployHub_DeploymentHasSessionIDLabel(t *testing.T) {
 	}
 }
 
+// TestDeployHub_PodTemplateHasScrapeAnnotations tests that Prometheus can discover the hub
+func TestDeployHub_PodTemplateHasScrapeAnnotations(t *testing.T) {
+	ts := createTestSession(t, "prom1234")
+	ctx := context.Background()
+
+	if err := ts.createNamespace(ctx); err != nil {
+		t.Fatalf("createNamespace failed: %v", err)
+	}
+	if err := ts.deployHub(ctx); err != nil {
+		t.Fatalf("deployHub failed: %v", err)
+	}
+
+	deployment, err := ts.fakeClientset.AppsV1().Deployments(ts.namespace).Get(ctx, "podscope-hub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get Deployment: %v", err)
+	}
+
+	annotations := deployment.Spec.Template.Annotations
+	if annotations["prometheus.io/scrape"] != "true" || annotations["prometheus.io/port"] != "8080" || annotations["prometheus.io/path"] != "/metrics" {
+		t.Errorf("Pod template annotations = %v, want scraping of :8080/metrics", annotations)
+	}
+}
+
+// TestDeployHub_PCAPVolumeIsEmptyDirByDefault tests that no claim is made unless asked for
+func TestDeployHub_PCAPVolumeIsEmptyDirByDefault(t *testing.T) {
+	ts := createTestSession(t, "vol01234")
+	ctx := context.Background()
+
+	if err := ts.createNamespace(ctx); err != nil {
+		t.Fatalf("createNamespace failed: %v", err)
+	}
+	if err := ts.deployHub(ctx); err != nil {
+		t.Fatalf("deployHub failed: %v", err)
+	}
+
+	deployment, err := ts.fakeClientset.AppsV1().Deployments(ts.namespace).Get(ctx, "podscope-hub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get Deployment: %v", err)
+	}
+	if volume := deployment.Spec.Template.Spec.Volumes[0]; volume.EmptyDir == nil {
+		t.Errorf("pcap-storage volume = %+v, want an EmptyDir", volume.VolumeSource)
+	}
+	claims, _ := ts.fakeClientset.CoreV1().PersistentVolumeClaims(ts.namespace).List(ctx, metav1.ListOptions{})
+	if len(claims.Items) != 0 {
+		t.Errorf("got %d volume claims, want none", len(claims.Items))
+	}
+}
+
+// TestDeployHub_PersistentPCAPVolume tests that the Hub's data can outlive its pod
+func TestDeployHub_PersistentPCAPVolume(t *testing.T) {
+	ts := createTestSession(t, "vol56789")
+	ts.hubPVC = true
+	ts.hubStorageClass = "fast"
+	ctx := context.Background()
+
+	if err := ts.createNamespace(ctx); err != nil {
+		t.Fatalf("createNamespace failed: %v", err)
+	}
+	if err := ts.deployHub(ctx); err != nil {
+		t.Fatalf("deployHub failed: %v", err)
+	}
+
+	claim, err := ts.fakeClientset.CoreV1().PersistentVolumeClaims(ts.namespace).Get(ctx, hubVolumeClaimName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get PersistentVolumeClaim: %v", err)
+	}
+	if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName != "fast" {
+		t.Errorf("StorageClassName = %v, want fast", claim.Spec.StorageClassName)
+	}
+
+	deployment, err := ts.fakeClientset.AppsV1().Deployments(ts.namespace).Get(ctx, "podscope-hub", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get Deployment: %v", err)
+	}
+	volume := deployment.Spec.Template.Spec.Volumes[0]
+	if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != hubVolumeClaimName {
+		t.Errorf("pcap-storage volume = %+v, want claim %s", volume.VolumeSource, hubVolumeClaimName)
+	}
+	if deployment.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType {
+		t.Errorf("Strategy = %q, want Recreate so pods don't share the claim", deployment.Spec.Strategy.Type)
+	}
+}
+
 // TestDeployHub_AllResourcesCreated tests that all required resources are created
 func TestDeployHub_AllResourcesCreated(t *testing.T) {
 	sessionID := "all67890"
@@ -1014,6 +1160,10 @@ func (ts *testSession) injectAgent(ctx context.Context, target PodTarget, privil
 					Name:  "POD_IP",
 					Value: target.IP,
 				},
+				{
+					Name:  "NODE_NAME",
+					Value: target.Node,
+				},
 				{
 					Name:  "SESSION_ID",
 					Value: ts.id,
@@ -1025,6 +1175,12 @@ func (ts *testSession) injectAgent(ctx context.Context, target PodTarget, privil
 			},
 		},
 	}
+	if ts.hubGracePeriod > 0 {
+		ephemeralContainer.Env = append(ephemeralContainer.Env, corev1.EnvVar{
+			Name:  "HUB_GRACE_PERIOD",
+			Value: ts.hubGracePeriod.String(),
+		})
+	}
 
 	// Update the pod with the ephemeral container
 	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, ephemeralContainer)
@@ -1434,6 +1590,78 @@ func TestInjectAgent_PodIPEnvVar(t *testing.T) {
 	}
 }
 
+// TestInjectAgent_NodeNameEnvVar tests that NODE_NAME environment variable is set
+func TestInjectAgent_NodeNameEnvVar(t *testing.T) {
+	sessionID := "nn123456"
+	ts := createTestSession(t, sessionID)
+	ctx := context.Background()
+
+	createTestPod(t, ts, ctx, "target-pod", "default", "10.0.0.12")
+
+	target := PodTarget{
+		Name:      "target-pod",
+		Namespace: "default",
+		IP:        "10.0.0.12",
+		Node:      "worker-2",
+	}
+
+	if err := ts.injectAgent(ctx, target, false); err != nil {
+		t.Fatalf("injectAgent failed: %v", err)
+	}
+
+	pod, err := ts.fakeClientset.CoreV1().Pods("default").Get(ctx, "target-pod", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod: %v", err)
+	}
+	if len(pod.Spec.EphemeralContainers) < 1 {
+		t.Fatal("no ephemeral containers found")
+	}
+
+	for _, env := range pod.Spec.EphemeralContainers[0].Env {
+		if env.Name == "NODE_NAME" {
+			if env.Value != "worker-2" {
+				t.Errorf("NODE_NAME = %q, want %q", env.Value, "worker-2")
+			}
+			return
+		}
+	}
+	t.Error("NODE_NAME environment variable not found")
+}
+
+// TestInjectAgent_HubGracePeriodEnvVar tests that HUB_GRACE_PERIOD is only set when configured
+func TestInjectAgent_HubGracePeriodEnvVar(t *testing.T) {
+	for _, tt := range []struct {
+		gracePeriod time.Duration
+		want        string
+	}{
+		{0, ""},
+		{5 * time.Minute, "5m0s"},
+	} {
+		ts := createTestSession(t, "gp123456")
+		ts.hubGracePeriod = tt.gracePeriod
+		ctx := context.Background()
+		createTestPod(t, ts, ctx, "target-pod", "default", "10.0.0.13")
+
+		if err := ts.injectAgent(ctx, PodTarget{Name: "target-pod", Namespace: "default", IP: "10.0.0.13"}, false); err != nil {
+			t.Fatalf("injectAgent failed: %v", err)
+		}
+		pod, err := ts.fakeClientset.CoreV1().Pods("default").Get(ctx, "target-pod", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod: %v", err)
+		}
+
+		var got string
+		for _, env := range pod.Spec.EphemeralContainers[0].Env {
+			if env.Name == "HUB_GRACE_PERIOD" {
+				got = env.Value
+			}
+		}
+		if got != tt.want {
+			t.Errorf("grace period %v: HUB_GRACE_PERIOD = %q, want %q", tt.gracePeriod, got, tt.want)
+		}
+	}
+}
+
 // TestInjectAgent_AllEnvVarsPresent tests that all required environment variables are set
 func TestInjectAgent_AllEnvVarsPresent(t *testing.T) {
 	sessionID := "all12345"
@@ -12,6 +12,10 @@ const (
 	ProtocolHTTP  Protocol = "HTTP"
 	ProtocolHTTPS Protocol = "HTTPS"
 	ProtocolTLS   Protocol = "TLS"
+	ProtocolHTTP2 Protocol = "HTTP2"
+	ProtocolGRPC  Protocol = "GRPC"
+	ProtocolDNS   Protocol = "DNS"
+	ProtocolUDP   Protocol = "UDP"
 )
 
 // FlowStatus represents the status of a flow
@@ -35,13 +39,18 @@ type Flow struct {
 	SrcPort      uint16     `json:"srcPort"`
 	SrcPod       string     `json:"srcPod,omitempty"`
 	SrcNamespace string     `json:"srcNamespace,omitempty"`
+	SrcWorkload  string     `json:"srcWorkload,omitempty"` // owning controller, e.g. Deployment/web
+	SrcService   string     `json:"srcService,omitempty"`
 
 	// Destination info
 	DstIP        string     `json:"dstIp"`
 	DstPort      uint16     `json:"dstPort"`
 	DstPod       string     `json:"dstPod,omitempty"`
 	DstNamespace string     `json:"dstNamespace,omitempty"`
+	DstWorkload  string     `json:"dstWorkload,omitempty"`
 	DstService   string     `json:"dstService,omitempty"`
+	DstName      string     `json:"dstName,omitempty"`       // hostname the destination was reached by
+	DstNameSource string    `json:"dstNameSource,omitempty"` // "dns", "sni" or "host"
 
 	// Protocol info
 	Protocol     Protocol   `json:"protocol"`
@@ -53,20 +62,44 @@ type Flow struct {
 	PacketsSent   uint32     `json:"packetsSent"`
 	PacketsRecv   uint32     `json:"packetsReceived"`
 
+	// TCP stream health
+	Retransmits uint32 `json:"retransmits,omitempty"`
+	OutOfOrder  uint32 `json:"outOfOrder,omitempty"`
+	ZeroWindows uint32 `json:"zeroWindows,omitempty"` // times a receiver advertised a zero window
+	DupAcks     uint32 `json:"dupAcks,omitempty"`
+	ResetBy     string `json:"resetBy,omitempty"`     // "client" or "server", for RESET flows
+	Truncated   bool   `json:"truncated,omitempty"`   // payload exceeded the agent's buffer budget and was not fully parsed
+	JoinedLate  bool   `json:"joinedLate,omitempty"`  // open before capture started; start time and duration are from the first packet seen
+
 	// Timing
 	TCPHandshakeMs  float64 `json:"tcpHandshakeMs,omitempty"`
 	TLSHandshakeMs  float64 `json:"tlsHandshakeMs,omitempty"`
 	TimeToFirstByte float64 `json:"ttfbMs,omitempty"`
+	SmoothedRTTMs   float64 `json:"srttMs,omitempty"` // from data/ACK pairs, see RFC 6298
 
-	// HTTP info (plaintext only)
+	// HTTP info (plaintext only), first exchange on the connection
 	HTTP *HTTPInfo `json:"http,omitempty"`
 
+	// Every request/response pair seen on a keep-alive connection, in order.
+	// Past the most the agent keeps, the oldest are dropped and counted.
+	// Snapshots of an open flow leave out exchanges an earlier one sent, so
+	// ExchangeOffset is the position of the first one listed.
+	HTTPExchanges    []*HTTPExchange `json:"httpExchanges,omitempty"`
+	ExchangeOffset   int             `json:"exchangeOffset,omitempty"`
+	DroppedExchanges int             `json:"droppedExchanges,omitempty"`
+
 	// TLS info
 	TLS *TLSInfo `json:"tls,omitempty"`
 
+	// DNS info, one flow per query/response transaction
+	DNS *DNSInfo `json:"dns,omitempty"`
+
+	// Process in the pod that owns the local end of the flow
+	Process *ProcessInfo `json:"process,omitempty"`
+
 	// Agent traffic identification (for filtering noise from captures)
 	IsAgentTraffic   bool   `json:"isAgentTraffic,omitempty"`
-	AgentTrafficType string `json:"agentTrafficType,omitempty"` // "health", "flow", "pcap", "registration"
+	AgentTrafficType string `json:"agentTrafficType,omitempty"` // "grpc", the agent's connection to the Hub
 }
 
 // HTTPInfo contains HTTP request/response information
@@ -84,6 +117,30 @@ type HTTPInfo struct {
 	ContentLength   int64             `json:"contentLength,omitempty"`
 }
 
+// HTTPExchange is a single request/response pair within a connection.
+// For HTTP/2 each stream is one exchange.
+type HTTPExchange struct {
+	HTTPInfo
+	RequestTime  time.Time `json:"requestTime"`
+	ResponseTime time.Time `json:"responseTime"`
+	DurationMs   float64   `json:"durationMs,omitempty"` // request to first response byte
+	StreamID     uint32    `json:"streamId,omitempty"`   // HTTP/2 only
+	GRPC         *GRPCInfo `json:"grpc,omitempty"`
+}
+
+// GRPCInfo describes a gRPC call carried on an HTTP/2 stream
+type GRPCInfo struct {
+	Service          string `json:"service"`
+	Method           string `json:"method"`
+	StatusCode       int    `json:"statusCode"`
+	Status           string `json:"status,omitempty"` // code name, empty until grpc-status is seen
+	StatusMessage    string `json:"statusMessage,omitempty"`
+	RequestMessages  int    `json:"requestMessages"`
+	ResponseMessages int    `json:"responseMessages"`
+	RequestBytes     int64  `json:"requestBytes"`  // sum of message lengths
+	ResponseBytes    int64  `json:"responseBytes"` // sum of message lengths
+}
+
 // TLSInfo contains TLS handshake information
 type TLSInfo struct {
 	Version       string   `json:"version"`
@@ -94,13 +151,41 @@ type TLSInfo struct {
 	Encrypted     bool     `json:"encrypted"`
 }
 
+// DNSInfo contains a DNS query and its response
+type DNSInfo struct {
+	ID        uint16      `json:"id"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`            // A, AAAA, SRV...
+	RCode     string      `json:"rcode,omitempty"` // NOERROR, NXDOMAIN...; empty without a response
+	Answers   []DNSAnswer `json:"answers,omitempty"`
+	LatencyMs float64     `json:"latencyMs,omitempty"`
+	TimedOut  bool        `json:"timedOut,omitempty"`
+}
+
+// DNSAnswer is one resource record from the answer section
+type DNSAnswer struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"` // address, target name or record text
+	TTL   uint32 `json:"ttl"`
+}
+
+// ProcessInfo identifies a process in the captured pod
+type ProcessInfo struct {
+	PID         int32  `json:"pid"`
+	Command     string `json:"command"`               // from /proc/[pid]/comm
+	Container   string `json:"container,omitempty"`   // empty when the pod shares its PID namespace
+	ContainerID string `json:"containerId,omitempty"` // runtime ID, when the cgroup path shows it
+}
+
 // AgentInfo identifies a capture agent
 type AgentInfo struct {
-	ID        string `json:"id"`
-	PodName   string `json:"podName"`
-	Namespace string `json:"namespace"`
-	PodIP     string `json:"podIp"`
-	NodeName  string `json:"nodeName"`
+	ID             string   `json:"id"`
+	PodName        string   `json:"podName"`
+	Namespace      string   `json:"namespace"`
+	PodIP          string   `json:"podIp"`
+	NodeName       string   `json:"nodeName"`
+	ListeningPorts []uint16 `json:"listeningPorts,omitempty"` // TCP ports the pod accepts connections on
 }
 
 // FlowEvent is sent from agent to hub
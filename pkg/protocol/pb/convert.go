@@ -0,0 +1,367 @@
+package pb
+
+import (
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// FromFlow converts a protocol.Flow into its wire representation
+func FromFlow(f *protocol.Flow) *Flow {
+	if f == nil {
+		return nil
+	}
+
+	out := &Flow{
+		Id:               f.ID,
+		DurationMs:       f.Duration,
+		SrcIp:            f.SrcIP,
+		SrcPort:          uint32(f.SrcPort),
+		SrcPod:           f.SrcPod,
+		SrcNamespace:     f.SrcNamespace,
+		SrcWorkload:      f.SrcWorkload,
+		SrcService:       f.SrcService,
+		DstIp:            f.DstIP,
+		DstPort:          uint32(f.DstPort),
+		DstPod:           f.DstPod,
+		DstNamespace:     f.DstNamespace,
+		DstWorkload:      f.DstWorkload,
+		DstService:       f.DstService,
+		DstName:          f.DstName,
+		DstNameSource:    f.DstNameSource,
+		Protocol:         string(f.Protocol),
+		Status:           string(f.Status),
+		BytesSent:        f.BytesSent,
+		BytesReceived:    f.BytesReceived,
+		PacketsSent:      f.PacketsSent,
+		PacketsReceived:  f.PacketsRecv,
+		Retransmits:      f.Retransmits,
+		OutOfOrder:       f.OutOfOrder,
+		ZeroWindows:      f.ZeroWindows,
+		Truncated:        f.Truncated,
+		SrttMs:           f.SmoothedRTTMs,
+		DupAcks:          f.DupAcks,
+		ResetBy:          f.ResetBy,
+		JoinedLate:       f.JoinedLate,
+		ExchangeOffset:   int32(f.ExchangeOffset),
+		DroppedExchanges: int32(f.DroppedExchanges),
+		TcpHandshakeMs:   f.TCPHandshakeMs,
+		TlsHandshakeMs:   f.TLSHandshakeMs,
+		TtfbMs:           f.TimeToFirstByte,
+		IsAgentTraffic:   f.IsAgentTraffic,
+		AgentTrafficType: f.AgentTrafficType,
+	}
+
+	out.Timestamp = fromTime(f.Timestamp)
+
+	out.Http = fromHTTPInfo(f.HTTP)
+	for _, ex := range f.HTTPExchanges {
+		out.HttpExchanges = append(out.HttpExchanges, &HTTPExchange{
+			Http:         fromHTTPInfo(&ex.HTTPInfo),
+			RequestTime:  fromTime(ex.RequestTime),
+			ResponseTime: fromTime(ex.ResponseTime),
+			DurationMs:   ex.DurationMs,
+			StreamId:     ex.StreamID,
+			Grpc:         fromGRPCInfo(ex.GRPC),
+		})
+	}
+
+	if f.TLS != nil {
+		out.Tls = &TLSInfo{
+			Version:      f.TLS.Version,
+			Sni:          f.TLS.SNI,
+			CipherSuite:  f.TLS.CipherSuite,
+			CipherSuites: f.TLS.CipherSuites,
+			Alpn:         f.TLS.ALPN,
+			Encrypted:    f.TLS.Encrypted,
+		}
+	}
+
+	out.Dns = fromDNSInfo(f.DNS)
+	out.Process = fromProcessInfo(f.Process)
+
+	return out
+}
+
+// ToFlow converts a wire Flow back into a protocol.Flow
+func ToFlow(f *Flow) *protocol.Flow {
+	if f == nil {
+		return nil
+	}
+
+	out := &protocol.Flow{
+		ID:               f.GetId(),
+		Duration:         f.GetDurationMs(),
+		SrcIP:            f.GetSrcIp(),
+		SrcPort:          uint16(f.GetSrcPort()),
+		SrcPod:           f.GetSrcPod(),
+		SrcNamespace:     f.GetSrcNamespace(),
+		SrcWorkload:      f.GetSrcWorkload(),
+		SrcService:       f.GetSrcService(),
+		DstIP:            f.GetDstIp(),
+		DstPort:          uint16(f.GetDstPort()),
+		DstPod:           f.GetDstPod(),
+		DstNamespace:     f.GetDstNamespace(),
+		DstWorkload:      f.GetDstWorkload(),
+		DstService:       f.GetDstService(),
+		DstName:          f.GetDstName(),
+		DstNameSource:    f.GetDstNameSource(),
+		Protocol:         protocol.Protocol(f.GetProtocol()),
+		Status:           protocol.FlowStatus(f.GetStatus()),
+		BytesSent:        f.GetBytesSent(),
+		BytesReceived:    f.GetBytesReceived(),
+		PacketsSent:      f.GetPacketsSent(),
+		PacketsRecv:      f.GetPacketsReceived(),
+		Retransmits:      f.GetRetransmits(),
+		OutOfOrder:       f.GetOutOfOrder(),
+		ZeroWindows:      f.GetZeroWindows(),
+		Truncated:        f.GetTruncated(),
+		SmoothedRTTMs:    f.GetSrttMs(),
+		DupAcks:          f.GetDupAcks(),
+		ResetBy:          f.GetResetBy(),
+		JoinedLate:       f.GetJoinedLate(),
+		ExchangeOffset:   int(f.GetExchangeOffset()),
+		DroppedExchanges: int(f.GetDroppedExchanges()),
+		TCPHandshakeMs:   f.GetTcpHandshakeMs(),
+		TLSHandshakeMs:   f.GetTlsHandshakeMs(),
+		TimeToFirstByte:  f.GetTtfbMs(),
+		IsAgentTraffic:   f.GetIsAgentTraffic(),
+		AgentTrafficType: f.GetAgentTrafficType(),
+	}
+
+	out.Timestamp = toTime(f.GetTimestamp())
+
+	out.HTTP = toHTTPInfo(f.GetHttp())
+	for _, ex := range f.GetHttpExchanges() {
+		exchange := &protocol.HTTPExchange{
+			RequestTime:  toTime(ex.GetRequestTime()),
+			ResponseTime: toTime(ex.GetResponseTime()),
+			DurationMs:   ex.GetDurationMs(),
+			StreamID:     ex.GetStreamId(),
+			GRPC:         toGRPCInfo(ex.GetGrpc()),
+		}
+		if h := toHTTPInfo(ex.GetHttp()); h != nil {
+			exchange.HTTPInfo = *h
+		}
+		out.HTTPExchanges = append(out.HTTPExchanges, exchange)
+	}
+
+	if t := f.GetTls(); t != nil {
+		out.TLS = &protocol.TLSInfo{
+			Version:      t.GetVersion(),
+			SNI:          t.GetSni(),
+			CipherSuite:  t.GetCipherSuite(),
+			CipherSuites: t.GetCipherSuites(),
+			ALPN:         t.GetAlpn(),
+			Encrypted:    t.GetEncrypted(),
+		}
+	}
+
+	out.DNS = toDNSInfo(f.GetDns())
+	out.Process = toProcessInfo(f.GetProcess())
+
+	return out
+}
+
+// fromHTTPInfo converts HTTP request/response details into their wire representation
+func fromHTTPInfo(h *protocol.HTTPInfo) *HTTPInfo {
+	if h == nil {
+		return nil
+	}
+	return &HTTPInfo{
+		Method:          h.Method,
+		Url:             h.URL,
+		Host:            h.Host,
+		StatusCode:      int32(h.StatusCode),
+		StatusText:      h.StatusText,
+		RequestHeaders:  h.RequestHeaders,
+		ResponseHeaders: h.ResponseHeaders,
+		RequestBody:     h.RequestBody,
+		ResponseBody:    h.ResponseBody,
+		ContentType:     h.ContentType,
+		ContentLength:   h.ContentLength,
+	}
+}
+
+// toHTTPInfo converts wire HTTP details back into a protocol.HTTPInfo
+func toHTTPInfo(h *HTTPInfo) *protocol.HTTPInfo {
+	if h == nil {
+		return nil
+	}
+	return &protocol.HTTPInfo{
+		Method:          h.GetMethod(),
+		URL:             h.GetUrl(),
+		Host:            h.GetHost(),
+		StatusCode:      int(h.GetStatusCode()),
+		StatusText:      h.GetStatusText(),
+		RequestHeaders:  h.GetRequestHeaders(),
+		ResponseHeaders: h.GetResponseHeaders(),
+		RequestBody:     h.GetRequestBody(),
+		ResponseBody:    h.GetResponseBody(),
+		ContentType:     h.GetContentType(),
+		ContentLength:   h.GetContentLength(),
+	}
+}
+
+// fromGRPCInfo converts gRPC call details into their wire representation
+func fromGRPCInfo(g *protocol.GRPCInfo) *GRPCInfo {
+	if g == nil {
+		return nil
+	}
+	return &GRPCInfo{
+		Service:          g.Service,
+		Method:           g.Method,
+		StatusCode:       int32(g.StatusCode),
+		Status:           g.Status,
+		StatusMessage:    g.StatusMessage,
+		RequestMessages:  int32(g.RequestMessages),
+		ResponseMessages: int32(g.ResponseMessages),
+		RequestBytes:     g.RequestBytes,
+		ResponseBytes:    g.ResponseBytes,
+	}
+}
+
+// toGRPCInfo converts wire gRPC call details back into a protocol.GRPCInfo
+func toGRPCInfo(g *GRPCInfo) *protocol.GRPCInfo {
+	if g == nil {
+		return nil
+	}
+	return &protocol.GRPCInfo{
+		Service:          g.GetService(),
+		Method:           g.GetMethod(),
+		StatusCode:       int(g.GetStatusCode()),
+		Status:           g.GetStatus(),
+		StatusMessage:    g.GetStatusMessage(),
+		RequestMessages:  int(g.GetRequestMessages()),
+		ResponseMessages: int(g.GetResponseMessages()),
+		RequestBytes:     g.GetRequestBytes(),
+		ResponseBytes:    g.GetResponseBytes(),
+	}
+}
+
+// fromDNSInfo converts a DNS transaction into its wire representation
+func fromDNSInfo(d *protocol.DNSInfo) *DNSInfo {
+	if d == nil {
+		return nil
+	}
+	out := &DNSInfo{
+		Id:        uint32(d.ID),
+		Name:      d.Name,
+		Type:      d.Type,
+		Rcode:     d.RCode,
+		LatencyMs: d.LatencyMs,
+		TimedOut:  d.TimedOut,
+	}
+	for _, a := range d.Answers {
+		out.Answers = append(out.Answers, &DNSAnswer{
+			Name:  a.Name,
+			Type:  a.Type,
+			Value: a.Value,
+			Ttl:   a.TTL,
+		})
+	}
+	return out
+}
+
+// toDNSInfo converts a wire DNS transaction back into a protocol.DNSInfo
+func toDNSInfo(d *DNSInfo) *protocol.DNSInfo {
+	if d == nil {
+		return nil
+	}
+	out := &protocol.DNSInfo{
+		ID:        uint16(d.GetId()),
+		Name:      d.GetName(),
+		Type:      d.GetType(),
+		RCode:     d.GetRcode(),
+		LatencyMs: d.GetLatencyMs(),
+		TimedOut:  d.GetTimedOut(),
+	}
+	for _, a := range d.GetAnswers() {
+		out.Answers = append(out.Answers, protocol.DNSAnswer{
+			Name:  a.GetName(),
+			Type:  a.GetType(),
+			Value: a.GetValue(),
+			TTL:   a.GetTtl(),
+		})
+	}
+	return out
+}
+
+// fromProcessInfo converts a process into its wire representation
+func fromProcessInfo(p *protocol.ProcessInfo) *ProcessInfo {
+	if p == nil {
+		return nil
+	}
+	return &ProcessInfo{
+		Pid:         p.PID,
+		Command:     p.Command,
+		Container:   p.Container,
+		ContainerId: p.ContainerID,
+	}
+}
+
+// toProcessInfo converts a wire process back into a protocol.ProcessInfo
+func toProcessInfo(p *ProcessInfo) *protocol.ProcessInfo {
+	if p == nil {
+		return nil
+	}
+	return &protocol.ProcessInfo{
+		PID:         p.GetPid(),
+		Command:     p.GetCommand(),
+		Container:   p.GetContainer(),
+		ContainerID: p.GetContainerId(),
+	}
+}
+
+// fromTime converts a time to Unix nanoseconds. Zero time would overflow
+// UnixNano, so it is left unset instead.
+func fromTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// toTime converts Unix nanoseconds back to a UTC time, keeping unset as zero
+func toTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns).UTC()
+}
+
+// FromAgentInfo converts a protocol.AgentInfo into its wire representation
+func FromAgentInfo(a *protocol.AgentInfo) *AgentInfo {
+	if a == nil {
+		return nil
+	}
+	out := &AgentInfo{
+		Id:        a.ID,
+		PodName:   a.PodName,
+		Namespace: a.Namespace,
+		PodIp:     a.PodIP,
+		NodeName:  a.NodeName,
+	}
+	for _, port := range a.ListeningPorts {
+		out.ListeningPorts = append(out.ListeningPorts, uint32(port))
+	}
+	return out
+}
+
+// ToAgentInfo converts a wire AgentInfo back into a protocol.AgentInfo
+func ToAgentInfo(a *AgentInfo) *protocol.AgentInfo {
+	if a == nil {
+		return nil
+	}
+	out := &protocol.AgentInfo{
+		ID:        a.GetId(),
+		PodName:   a.GetPodName(),
+		Namespace: a.GetNamespace(),
+		PodIP:     a.GetPodIp(),
+		NodeName:  a.GetNodeName(),
+	}
+	for _, port := range a.GetListeningPorts() {
+		out.ListeningPorts = append(out.ListeningPorts, uint16(port))
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package pb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/podscope/podscope/pkg/protocol"
+)
+
+// TestFlowRoundTrip tests that every protocol.Flow field survives FromFlow/ToFlow
+func TestFlowRoundTrip(t *testing.T) {
+	flow := &protocol.Flow{
+		ID:               "abc12345",
+		Timestamp:        time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC),
+		Duration:         42,
+		SrcIP:            "10.0.0.1",
+		SrcPort:          54321,
+		SrcPod:           "client",
+		SrcNamespace:     "default",
+		SrcWorkload:      "Deployment/client",
+		SrcService:       "client.default.svc",
+		DstIP:            "10.0.0.2",
+		DstPort:          443,
+		DstPod:           "server",
+		DstNamespace:     "prod",
+		DstWorkload:      "StatefulSet/server",
+		DstService:       "api",
+		DstName:          "api.example.com",
+		DstNameSource:    "dns",
+		Protocol:         protocol.ProtocolHTTPS,
+		Status:           protocol.StatusClosed,
+		BytesSent:        100,
+		BytesReceived:    2000,
+		PacketsSent:      3,
+		PacketsRecv:      4,
+		Retransmits:      2,
+		OutOfOrder:       1,
+		ZeroWindows:      3,
+		Truncated:        true,
+		SmoothedRTTMs:    1.25,
+		DupAcks:          4,
+		ResetBy:          "server",
+		JoinedLate:       true,
+		TCPHandshakeMs:   1.5,
+		TLSHandshakeMs:   12.25,
+		TimeToFirstByte:  20.5,
+		IsAgentTraffic:   true,
+		AgentTrafficType: "flow",
+		HTTP: &protocol.HTTPInfo{
+			Method:          "GET",
+			URL:             "/users/1",
+			Host:            "api",
+			StatusCode:      200,
+			StatusText:      "200 OK",
+			RequestHeaders:  map[string]string{"Accept": "*/*"},
+			ResponseHeaders: map[string]string{"Content-Type": "application/json"},
+			RequestBody:     "req",
+			ResponseBody:    "resp",
+			ContentType:     "application/json",
+			ContentLength:   4,
+		},
+		HTTPExchanges: []*protocol.HTTPExchange{
+			{
+				HTTPInfo: protocol.HTTPInfo{
+					Method:     "GET",
+					URL:        "/users/1",
+					StatusCode: 200,
+				},
+				RequestTime:  time.Date(2024, 5, 1, 12, 0, 0, 200000000, time.UTC),
+				ResponseTime: time.Date(2024, 5, 1, 12, 0, 0, 210000000, time.UTC),
+				DurationMs:   10,
+			},
+			{
+				HTTPInfo: protocol.HTTPInfo{
+					Method: "POST",
+					URL:    "/users",
+				},
+				RequestTime: time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC),
+			},
+			{
+				HTTPInfo: protocol.HTTPInfo{
+					Method:     "POST",
+					URL:        "/users.v1.Users/Get",
+					StatusCode: 200,
+				},
+				StreamID: 3,
+				GRPC: &protocol.GRPCInfo{
+					Service:          "users.v1.Users",
+					Method:           "Get",
+					StatusCode:       5,
+					Status:           "NotFound",
+					StatusMessage:    "no such user",
+					RequestMessages:  1,
+					ResponseMessages: 0,
+					RequestBytes:     12,
+				},
+			},
+		},
+		ExchangeOffset:   3,
+		DroppedExchanges: 7,
+		TLS: &protocol.TLSInfo{
+			Version:      "TLS 1.2",
+			SNI:          "api.example.com",
+			CipherSuite:  "TLS_AES_128_GCM_SHA256",
+			CipherSuites: []string{"TLS_AES_128_GCM_SHA256", "TLS_AES_256_GCM_SHA384"},
+			ALPN:         []string{"h2", "http/1.1"},
+			Encrypted:    true,
+		},
+		DNS: &protocol.DNSInfo{
+			ID:    0x1234,
+			Name:  "api.prod.svc.cluster.local",
+			Type:  "A",
+			RCode: "NOERROR",
+			Answers: []protocol.DNSAnswer{
+				{Name: "api.prod.svc.cluster.local", Type: "A", Value: "10.96.0.12", TTL: 30},
+			},
+			LatencyMs: 1.25,
+		},
+		Process: &protocol.ProcessInfo{
+			PID:         42,
+			Command:     "envoy",
+			Container:   "istio-proxy",
+			ContainerID: "3f1c0d7e",
+		},
+	}
+
+	got := ToFlow(FromFlow(flow))
+
+	if !reflect.DeepEqual(got, flow) {
+		t.Errorf("Round trip mismatch:\n got: %+v\nwant: %+v", got, flow)
+	}
+}
+
+// TestFlowRoundTrip_ZeroTimestamp tests that an unset timestamp stays unset
+func TestFlowRoundTrip_ZeroTimestamp(t *testing.T) {
+	got := ToFlow(FromFlow(&protocol.Flow{ID: "x"}))
+
+	if !got.Timestamp.IsZero() {
+		t.Errorf("Expected zero timestamp, got %v", got.Timestamp)
+	}
+	if got.HTTP != nil || got.TLS != nil || got.DNS != nil {
+		t.Error("Expected nil HTTP, TLS and DNS info")
+	}
+}
+
+// TestNilConversions tests that nil inputs convert to nil
+func TestNilConversions(t *testing.T) {
+	if FromFlow(nil) != nil {
+		t.Error("Expected FromFlow(nil) to be nil")
+	}
+	if ToFlow(nil) != nil {
+		t.Error("Expected ToFlow(nil) to be nil")
+	}
+	if FromAgentInfo(nil) != nil {
+		t.Error("Expected FromAgentInfo(nil) to be nil")
+	}
+	if ToAgentInfo(nil) != nil {
+		t.Error("Expected ToAgentInfo(nil) to be nil")
+	}
+}
+
+// TestAgentInfoRoundTrip tests that agent identity survives conversion
+func TestAgentInfoRoundTrip(t *testing.T) {
+	info := &protocol.AgentInfo{
+		ID:             "agent-1",
+		PodName:        "pod",
+		Namespace:      "ns",
+		PodIP:          "10.0.0.9",
+		NodeName:       "node-a",
+		ListeningPorts: []uint16{8080, 15001},
+	}
+
+	got := ToAgentInfo(FromAgentInfo(info))
+
+	if !reflect.DeepEqual(got, info) {
+		t.Errorf("Round trip mismatch: got %+v, want %+v", got, info)
+	}
+}
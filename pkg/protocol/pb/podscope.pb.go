@@ -0,0 +1,2013 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: podscope.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type AgentInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	PodName        string                 `protobuf:"bytes,2,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	Namespace      string                 `protobuf:"bytes,3,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	PodIp          string                 `protobuf:"bytes,4,opt,name=pod_ip,json=podIp,proto3" json:"pod_ip,omitempty"`
+	NodeName       string                 `protobuf:"bytes,5,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	SessionId      string                 `protobuf:"bytes,6,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	ListeningPorts []uint32               `protobuf:"varint,7,rep,packed,name=listening_ports,json=listeningPorts,proto3" json:"listening_ports,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *AgentInfo) Reset() {
+	*x = AgentInfo{}
+	mi := &file_podscope_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentInfo) ProtoMessage() {}
+
+func (x *AgentInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentInfo.ProtoReflect.Descriptor instead.
+func (*AgentInfo) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AgentInfo) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetPodName() string {
+	if x != nil {
+		return x.PodName
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetPodIp() string {
+	if x != nil {
+		return x.PodIp
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *AgentInfo) GetListeningPorts() []uint32 {
+	if x != nil {
+		return x.ListeningPorts
+	}
+	return nil
+}
+
+type RegisterResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Config        *AgentConfig           `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterResponse) Reset() {
+	*x = RegisterResponse{}
+	mi := &file_podscope_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterResponse) ProtoMessage() {}
+
+func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterResponse.ProtoReflect.Descriptor instead.
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RegisterResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *RegisterResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *RegisterResponse) GetConfig() *AgentConfig {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+type AgentConfig struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	HubAddress        string                 `protobuf:"bytes,1,opt,name=hub_address,json=hubAddress,proto3" json:"hub_address,omitempty"`
+	BufferSize        int32                  `protobuf:"varint,2,opt,name=buffer_size,json=bufferSize,proto3" json:"buffer_size,omitempty"`
+	FlushIntervalMs   int32                  `protobuf:"varint,3,opt,name=flush_interval_ms,json=flushIntervalMs,proto3" json:"flush_interval_ms,omitempty"`
+	CaptureInterfaces []string               `protobuf:"bytes,4,rep,name=capture_interfaces,json=captureInterfaces,proto3" json:"capture_interfaces,omitempty"`
+	BpfFilter         string                 `protobuf:"bytes,5,opt,name=bpf_filter,json=bpfFilter,proto3" json:"bpf_filter,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *AgentConfig) Reset() {
+	*x = AgentConfig{}
+	mi := &file_podscope_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentConfig) ProtoMessage() {}
+
+func (x *AgentConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentConfig.ProtoReflect.Descriptor instead.
+func (*AgentConfig) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AgentConfig) GetHubAddress() string {
+	if x != nil {
+		return x.HubAddress
+	}
+	return ""
+}
+
+func (x *AgentConfig) GetBufferSize() int32 {
+	if x != nil {
+		return x.BufferSize
+	}
+	return 0
+}
+
+func (x *AgentConfig) GetFlushIntervalMs() int32 {
+	if x != nil {
+		return x.FlushIntervalMs
+	}
+	return 0
+}
+
+func (x *AgentConfig) GetCaptureInterfaces() []string {
+	if x != nil {
+		return x.CaptureInterfaces
+	}
+	return nil
+}
+
+func (x *AgentConfig) GetBpfFilter() string {
+	if x != nil {
+		return x.BpfFilter
+	}
+	return ""
+}
+
+type FlowEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Flow          *Flow                  `protobuf:"bytes,2,opt,name=flow,proto3" json:"flow,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlowEvent) Reset() {
+	*x = FlowEvent{}
+	mi := &file_podscope_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlowEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlowEvent) ProtoMessage() {}
+
+func (x *FlowEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlowEvent.ProtoReflect.Descriptor instead.
+func (*FlowEvent) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FlowEvent) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *FlowEvent) GetFlow() *Flow {
+	if x != nil {
+		return x.Flow
+	}
+	return nil
+}
+
+type Flow struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Timestamp        int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Unix nanoseconds
+	DurationMs       int64                  `protobuf:"varint,3,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	SrcIp            string                 `protobuf:"bytes,4,opt,name=src_ip,json=srcIp,proto3" json:"src_ip,omitempty"`
+	SrcPort          uint32                 `protobuf:"varint,5,opt,name=src_port,json=srcPort,proto3" json:"src_port,omitempty"`
+	SrcPod           string                 `protobuf:"bytes,6,opt,name=src_pod,json=srcPod,proto3" json:"src_pod,omitempty"`
+	SrcNamespace     string                 `protobuf:"bytes,7,opt,name=src_namespace,json=srcNamespace,proto3" json:"src_namespace,omitempty"`
+	DstIp            string                 `protobuf:"bytes,8,opt,name=dst_ip,json=dstIp,proto3" json:"dst_ip,omitempty"`
+	DstPort          uint32                 `protobuf:"varint,9,opt,name=dst_port,json=dstPort,proto3" json:"dst_port,omitempty"`
+	DstPod           string                 `protobuf:"bytes,10,opt,name=dst_pod,json=dstPod,proto3" json:"dst_pod,omitempty"`
+	DstNamespace     string                 `protobuf:"bytes,11,opt,name=dst_namespace,json=dstNamespace,proto3" json:"dst_namespace,omitempty"`
+	DstService       string                 `protobuf:"bytes,12,opt,name=dst_service,json=dstService,proto3" json:"dst_service,omitempty"`
+	Protocol         string                 `protobuf:"bytes,13,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	Status           string                 `protobuf:"bytes,14,opt,name=status,proto3" json:"status,omitempty"`
+	BytesSent        uint64                 `protobuf:"varint,15,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`
+	BytesReceived    uint64                 `protobuf:"varint,16,opt,name=bytes_received,json=bytesReceived,proto3" json:"bytes_received,omitempty"`
+	PacketsSent      uint32                 `protobuf:"varint,17,opt,name=packets_sent,json=packetsSent,proto3" json:"packets_sent,omitempty"`
+	PacketsReceived  uint32                 `protobuf:"varint,18,opt,name=packets_received,json=packetsReceived,proto3" json:"packets_received,omitempty"`
+	TcpHandshakeMs   float64                `protobuf:"fixed64,19,opt,name=tcp_handshake_ms,json=tcpHandshakeMs,proto3" json:"tcp_handshake_ms,omitempty"`
+	TlsHandshakeMs   float64                `protobuf:"fixed64,20,opt,name=tls_handshake_ms,json=tlsHandshakeMs,proto3" json:"tls_handshake_ms,omitempty"`
+	TtfbMs           float64                `protobuf:"fixed64,21,opt,name=ttfb_ms,json=ttfbMs,proto3" json:"ttfb_ms,omitempty"`
+	Http             *HTTPInfo              `protobuf:"bytes,22,opt,name=http,proto3" json:"http,omitempty"`
+	Tls              *TLSInfo               `protobuf:"bytes,23,opt,name=tls,proto3" json:"tls,omitempty"`
+	IsAgentTraffic   bool                   `protobuf:"varint,24,opt,name=is_agent_traffic,json=isAgentTraffic,proto3" json:"is_agent_traffic,omitempty"`
+	AgentTrafficType string                 `protobuf:"bytes,25,opt,name=agent_traffic_type,json=agentTrafficType,proto3" json:"agent_traffic_type,omitempty"`
+	HttpExchanges    []*HTTPExchange        `protobuf:"bytes,26,rep,name=http_exchanges,json=httpExchanges,proto3" json:"http_exchanges,omitempty"`
+	Dns              *DNSInfo               `protobuf:"bytes,27,opt,name=dns,proto3" json:"dns,omitempty"`
+	Retransmits      uint32                 `protobuf:"varint,28,opt,name=retransmits,proto3" json:"retransmits,omitempty"`
+	OutOfOrder       uint32                 `protobuf:"varint,29,opt,name=out_of_order,json=outOfOrder,proto3" json:"out_of_order,omitempty"`
+	ZeroWindows      uint32                 `protobuf:"varint,30,opt,name=zero_windows,json=zeroWindows,proto3" json:"zero_windows,omitempty"`
+	Truncated        bool                   `protobuf:"varint,31,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	SrttMs           float64                `protobuf:"fixed64,32,opt,name=srtt_ms,json=srttMs,proto3" json:"srtt_ms,omitempty"`
+	DupAcks          uint32                 `protobuf:"varint,33,opt,name=dup_acks,json=dupAcks,proto3" json:"dup_acks,omitempty"`
+	ResetBy          string                 `protobuf:"bytes,34,opt,name=reset_by,json=resetBy,proto3" json:"reset_by,omitempty"`
+	JoinedLate       bool                   `protobuf:"varint,35,opt,name=joined_late,json=joinedLate,proto3" json:"joined_late,omitempty"`
+	Process          *ProcessInfo           `protobuf:"bytes,36,opt,name=process,proto3" json:"process,omitempty"`
+	SrcWorkload      string                 `protobuf:"bytes,37,opt,name=src_workload,json=srcWorkload,proto3" json:"src_workload,omitempty"`
+	SrcService       string                 `protobuf:"bytes,38,opt,name=src_service,json=srcService,proto3" json:"src_service,omitempty"`
+	DstWorkload      string                 `protobuf:"bytes,39,opt,name=dst_workload,json=dstWorkload,proto3" json:"dst_workload,omitempty"`
+	DstName          string                 `protobuf:"bytes,40,opt,name=dst_name,json=dstName,proto3" json:"dst_name,omitempty"`
+	DstNameSource    string                 `protobuf:"bytes,41,opt,name=dst_name_source,json=dstNameSource,proto3" json:"dst_name_source,omitempty"`
+	DroppedExchanges int32                  `protobuf:"varint,42,opt,name=dropped_exchanges,json=droppedExchanges,proto3" json:"dropped_exchanges,omitempty"` // oldest exchanges left out of http_exchanges
+	ExchangeOffset   int32                  `protobuf:"varint,43,opt,name=exchange_offset,json=exchangeOffset,proto3" json:"exchange_offset,omitempty"`       // position of the first of http_exchanges on the connection
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Flow) Reset() {
+	*x = Flow{}
+	mi := &file_podscope_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Flow) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Flow) ProtoMessage() {}
+
+func (x *Flow) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Flow.ProtoReflect.Descriptor instead.
+func (*Flow) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Flow) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Flow) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Flow) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *Flow) GetSrcIp() string {
+	if x != nil {
+		return x.SrcIp
+	}
+	return ""
+}
+
+func (x *Flow) GetSrcPort() uint32 {
+	if x != nil {
+		return x.SrcPort
+	}
+	return 0
+}
+
+func (x *Flow) GetSrcPod() string {
+	if x != nil {
+		return x.SrcPod
+	}
+	return ""
+}
+
+func (x *Flow) GetSrcNamespace() string {
+	if x != nil {
+		return x.SrcNamespace
+	}
+	return ""
+}
+
+func (x *Flow) GetDstIp() string {
+	if x != nil {
+		return x.DstIp
+	}
+	return ""
+}
+
+func (x *Flow) GetDstPort() uint32 {
+	if x != nil {
+		return x.DstPort
+	}
+	return 0
+}
+
+func (x *Flow) GetDstPod() string {
+	if x != nil {
+		return x.DstPod
+	}
+	return ""
+}
+
+func (x *Flow) GetDstNamespace() string {
+	if x != nil {
+		return x.DstNamespace
+	}
+	return ""
+}
+
+func (x *Flow) GetDstService() string {
+	if x != nil {
+		return x.DstService
+	}
+	return ""
+}
+
+func (x *Flow) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *Flow) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Flow) GetBytesSent() uint64 {
+	if x != nil {
+		return x.BytesSent
+	}
+	return 0
+}
+
+func (x *Flow) GetBytesReceived() uint64 {
+	if x != nil {
+		return x.BytesReceived
+	}
+	return 0
+}
+
+func (x *Flow) GetPacketsSent() uint32 {
+	if x != nil {
+		return x.PacketsSent
+	}
+	return 0
+}
+
+func (x *Flow) GetPacketsReceived() uint32 {
+	if x != nil {
+		return x.PacketsReceived
+	}
+	return 0
+}
+
+func (x *Flow) GetTcpHandshakeMs() float64 {
+	if x != nil {
+		return x.TcpHandshakeMs
+	}
+	return 0
+}
+
+func (x *Flow) GetTlsHandshakeMs() float64 {
+	if x != nil {
+		return x.TlsHandshakeMs
+	}
+	return 0
+}
+
+func (x *Flow) GetTtfbMs() float64 {
+	if x != nil {
+		return x.TtfbMs
+	}
+	return 0
+}
+
+func (x *Flow) GetHttp() *HTTPInfo {
+	if x != nil {
+		return x.Http
+	}
+	return nil
+}
+
+func (x *Flow) GetTls() *TLSInfo {
+	if x != nil {
+		return x.Tls
+	}
+	return nil
+}
+
+func (x *Flow) GetIsAgentTraffic() bool {
+	if x != nil {
+		return x.IsAgentTraffic
+	}
+	return false
+}
+
+func (x *Flow) GetAgentTrafficType() string {
+	if x != nil {
+		return x.AgentTrafficType
+	}
+	return ""
+}
+
+func (x *Flow) GetHttpExchanges() []*HTTPExchange {
+	if x != nil {
+		return x.HttpExchanges
+	}
+	return nil
+}
+
+func (x *Flow) GetDns() *DNSInfo {
+	if x != nil {
+		return x.Dns
+	}
+	return nil
+}
+
+func (x *Flow) GetRetransmits() uint32 {
+	if x != nil {
+		return x.Retransmits
+	}
+	return 0
+}
+
+func (x *Flow) GetOutOfOrder() uint32 {
+	if x != nil {
+		return x.OutOfOrder
+	}
+	return 0
+}
+
+func (x *Flow) GetZeroWindows() uint32 {
+	if x != nil {
+		return x.ZeroWindows
+	}
+	return 0
+}
+
+func (x *Flow) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *Flow) GetSrttMs() float64 {
+	if x != nil {
+		return x.SrttMs
+	}
+	return 0
+}
+
+func (x *Flow) GetDupAcks() uint32 {
+	if x != nil {
+		return x.DupAcks
+	}
+	return 0
+}
+
+func (x *Flow) GetResetBy() string {
+	if x != nil {
+		return x.ResetBy
+	}
+	return ""
+}
+
+func (x *Flow) GetJoinedLate() bool {
+	if x != nil {
+		return x.JoinedLate
+	}
+	return false
+}
+
+func (x *Flow) GetProcess() *ProcessInfo {
+	if x != nil {
+		return x.Process
+	}
+	return nil
+}
+
+func (x *Flow) GetSrcWorkload() string {
+	if x != nil {
+		return x.SrcWorkload
+	}
+	return ""
+}
+
+func (x *Flow) GetSrcService() string {
+	if x != nil {
+		return x.SrcService
+	}
+	return ""
+}
+
+func (x *Flow) GetDstWorkload() string {
+	if x != nil {
+		return x.DstWorkload
+	}
+	return ""
+}
+
+func (x *Flow) GetDstName() string {
+	if x != nil {
+		return x.DstName
+	}
+	return ""
+}
+
+func (x *Flow) GetDstNameSource() string {
+	if x != nil {
+		return x.DstNameSource
+	}
+	return ""
+}
+
+func (x *Flow) GetDroppedExchanges() int32 {
+	if x != nil {
+		return x.DroppedExchanges
+	}
+	return 0
+}
+
+func (x *Flow) GetExchangeOffset() int32 {
+	if x != nil {
+		return x.ExchangeOffset
+	}
+	return 0
+}
+
+type HTTPInfo struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Method          string                 `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	Url             string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Host            string                 `protobuf:"bytes,3,opt,name=host,proto3" json:"host,omitempty"`
+	StatusCode      int32                  `protobuf:"varint,4,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	StatusText      string                 `protobuf:"bytes,5,opt,name=status_text,json=statusText,proto3" json:"status_text,omitempty"`
+	RequestHeaders  map[string]string      `protobuf:"bytes,6,rep,name=request_headers,json=requestHeaders,proto3" json:"request_headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	ResponseHeaders map[string]string      `protobuf:"bytes,7,rep,name=response_headers,json=responseHeaders,proto3" json:"response_headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	RequestBody     string                 `protobuf:"bytes,8,opt,name=request_body,json=requestBody,proto3" json:"request_body,omitempty"`
+	ResponseBody    string                 `protobuf:"bytes,9,opt,name=response_body,json=responseBody,proto3" json:"response_body,omitempty"`
+	ContentType     string                 `protobuf:"bytes,10,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	ContentLength   int64                  `protobuf:"varint,11,opt,name=content_length,json=contentLength,proto3" json:"content_length,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *HTTPInfo) Reset() {
+	*x = HTTPInfo{}
+	mi := &file_podscope_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HTTPInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HTTPInfo) ProtoMessage() {}
+
+func (x *HTTPInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HTTPInfo.ProtoReflect.Descriptor instead.
+func (*HTTPInfo) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *HTTPInfo) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *HTTPInfo) GetStatusText() string {
+	if x != nil {
+		return x.StatusText
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetRequestHeaders() map[string]string {
+	if x != nil {
+		return x.RequestHeaders
+	}
+	return nil
+}
+
+func (x *HTTPInfo) GetResponseHeaders() map[string]string {
+	if x != nil {
+		return x.ResponseHeaders
+	}
+	return nil
+}
+
+func (x *HTTPInfo) GetRequestBody() string {
+	if x != nil {
+		return x.RequestBody
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetResponseBody() string {
+	if x != nil {
+		return x.ResponseBody
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *HTTPInfo) GetContentLength() int64 {
+	if x != nil {
+		return x.ContentLength
+	}
+	return 0
+}
+
+type HTTPExchange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Http          *HTTPInfo              `protobuf:"bytes,1,opt,name=http,proto3" json:"http,omitempty"`
+	RequestTime   int64                  `protobuf:"varint,2,opt,name=request_time,json=requestTime,proto3" json:"request_time,omitempty"`    // Unix nanoseconds
+	ResponseTime  int64                  `protobuf:"varint,3,opt,name=response_time,json=responseTime,proto3" json:"response_time,omitempty"` // Unix nanoseconds
+	DurationMs    float64                `protobuf:"fixed64,4,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	StreamId      uint32                 `protobuf:"varint,5,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	Grpc          *GRPCInfo              `protobuf:"bytes,6,opt,name=grpc,proto3" json:"grpc,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HTTPExchange) Reset() {
+	*x = HTTPExchange{}
+	mi := &file_podscope_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HTTPExchange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HTTPExchange) ProtoMessage() {}
+
+func (x *HTTPExchange) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HTTPExchange.ProtoReflect.Descriptor instead.
+func (*HTTPExchange) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *HTTPExchange) GetHttp() *HTTPInfo {
+	if x != nil {
+		return x.Http
+	}
+	return nil
+}
+
+func (x *HTTPExchange) GetRequestTime() int64 {
+	if x != nil {
+		return x.RequestTime
+	}
+	return 0
+}
+
+func (x *HTTPExchange) GetResponseTime() int64 {
+	if x != nil {
+		return x.ResponseTime
+	}
+	return 0
+}
+
+func (x *HTTPExchange) GetDurationMs() float64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *HTTPExchange) GetStreamId() uint32 {
+	if x != nil {
+		return x.StreamId
+	}
+	return 0
+}
+
+func (x *HTTPExchange) GetGrpc() *GRPCInfo {
+	if x != nil {
+		return x.Grpc
+	}
+	return nil
+}
+
+type GRPCInfo struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Service          string                 `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Method           string                 `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`
+	StatusCode       int32                  `protobuf:"varint,3,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Status           string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	StatusMessage    string                 `protobuf:"bytes,5,opt,name=status_message,json=statusMessage,proto3" json:"status_message,omitempty"`
+	RequestMessages  int32                  `protobuf:"varint,6,opt,name=request_messages,json=requestMessages,proto3" json:"request_messages,omitempty"`
+	ResponseMessages int32                  `protobuf:"varint,7,opt,name=response_messages,json=responseMessages,proto3" json:"response_messages,omitempty"`
+	RequestBytes     int64                  `protobuf:"varint,8,opt,name=request_bytes,json=requestBytes,proto3" json:"request_bytes,omitempty"`
+	ResponseBytes    int64                  `protobuf:"varint,9,opt,name=response_bytes,json=responseBytes,proto3" json:"response_bytes,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *GRPCInfo) Reset() {
+	*x = GRPCInfo{}
+	mi := &file_podscope_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GRPCInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GRPCInfo) ProtoMessage() {}
+
+func (x *GRPCInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GRPCInfo.ProtoReflect.Descriptor instead.
+func (*GRPCInfo) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GRPCInfo) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *GRPCInfo) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *GRPCInfo) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *GRPCInfo) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *GRPCInfo) GetStatusMessage() string {
+	if x != nil {
+		return x.StatusMessage
+	}
+	return ""
+}
+
+func (x *GRPCInfo) GetRequestMessages() int32 {
+	if x != nil {
+		return x.RequestMessages
+	}
+	return 0
+}
+
+func (x *GRPCInfo) GetResponseMessages() int32 {
+	if x != nil {
+		return x.ResponseMessages
+	}
+	return 0
+}
+
+func (x *GRPCInfo) GetRequestBytes() int64 {
+	if x != nil {
+		return x.RequestBytes
+	}
+	return 0
+}
+
+func (x *GRPCInfo) GetResponseBytes() int64 {
+	if x != nil {
+		return x.ResponseBytes
+	}
+	return 0
+}
+
+type TLSInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Sni           string                 `protobuf:"bytes,2,opt,name=sni,proto3" json:"sni,omitempty"`
+	CipherSuite   string                 `protobuf:"bytes,3,opt,name=cipher_suite,json=cipherSuite,proto3" json:"cipher_suite,omitempty"`
+	Alpn          []string               `protobuf:"bytes,4,rep,name=alpn,proto3" json:"alpn,omitempty"`
+	Encrypted     bool                   `protobuf:"varint,5,opt,name=encrypted,proto3" json:"encrypted,omitempty"`
+	CipherSuites  []string               `protobuf:"bytes,6,rep,name=cipher_suites,json=cipherSuites,proto3" json:"cipher_suites,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TLSInfo) Reset() {
+	*x = TLSInfo{}
+	mi := &file_podscope_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TLSInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TLSInfo) ProtoMessage() {}
+
+func (x *TLSInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TLSInfo.ProtoReflect.Descriptor instead.
+func (*TLSInfo) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TLSInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetSni() string {
+	if x != nil {
+		return x.Sni
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetCipherSuite() string {
+	if x != nil {
+		return x.CipherSuite
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetAlpn() []string {
+	if x != nil {
+		return x.Alpn
+	}
+	return nil
+}
+
+func (x *TLSInfo) GetEncrypted() bool {
+	if x != nil {
+		return x.Encrypted
+	}
+	return false
+}
+
+func (x *TLSInfo) GetCipherSuites() []string {
+	if x != nil {
+		return x.CipherSuites
+	}
+	return nil
+}
+
+type DNSInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Rcode         string                 `protobuf:"bytes,4,opt,name=rcode,proto3" json:"rcode,omitempty"`
+	Answers       []*DNSAnswer           `protobuf:"bytes,5,rep,name=answers,proto3" json:"answers,omitempty"`
+	LatencyMs     float64                `protobuf:"fixed64,6,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	TimedOut      bool                   `protobuf:"varint,7,opt,name=timed_out,json=timedOut,proto3" json:"timed_out,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DNSInfo) Reset() {
+	*x = DNSInfo{}
+	mi := &file_podscope_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DNSInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSInfo) ProtoMessage() {}
+
+func (x *DNSInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSInfo.ProtoReflect.Descriptor instead.
+func (*DNSInfo) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DNSInfo) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *DNSInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *DNSInfo) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *DNSInfo) GetRcode() string {
+	if x != nil {
+		return x.Rcode
+	}
+	return ""
+}
+
+func (x *DNSInfo) GetAnswers() []*DNSAnswer {
+	if x != nil {
+		return x.Answers
+	}
+	return nil
+}
+
+func (x *DNSInfo) GetLatencyMs() float64 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
+
+func (x *DNSInfo) GetTimedOut() bool {
+	if x != nil {
+		return x.TimedOut
+	}
+	return false
+}
+
+type DNSAnswer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	Ttl           uint32                 `protobuf:"varint,4,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DNSAnswer) Reset() {
+	*x = DNSAnswer{}
+	mi := &file_podscope_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DNSAnswer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSAnswer) ProtoMessage() {}
+
+func (x *DNSAnswer) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSAnswer.ProtoReflect.Descriptor instead.
+func (*DNSAnswer) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *DNSAnswer) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *DNSAnswer) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *DNSAnswer) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *DNSAnswer) GetTtl() uint32 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+type ProcessInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pid           int32                  `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
+	Command       string                 `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	Container     string                 `protobuf:"bytes,3,opt,name=container,proto3" json:"container,omitempty"`
+	ContainerId   string                 `protobuf:"bytes,4,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProcessInfo) Reset() {
+	*x = ProcessInfo{}
+	mi := &file_podscope_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProcessInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessInfo) ProtoMessage() {}
+
+func (x *ProcessInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessInfo.ProtoReflect.Descriptor instead.
+func (*ProcessInfo) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ProcessInfo) GetPid() int32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *ProcessInfo) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *ProcessInfo) GetContainer() string {
+	if x != nil {
+		return x.Container
+	}
+	return ""
+}
+
+func (x *ProcessInfo) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+type PCAPChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Seq           uint64                 `protobuf:"varint,4,opt,name=seq,proto3" json:"seq,omitempty"` // counts up per agent, so a replayed chunk is recognised
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PCAPChunk) Reset() {
+	*x = PCAPChunk{}
+	mi := &file_podscope_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PCAPChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PCAPChunk) ProtoMessage() {}
+
+func (x *PCAPChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PCAPChunk.ProtoReflect.Descriptor instead.
+func (*PCAPChunk) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *PCAPChunk) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *PCAPChunk) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *PCAPChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *PCAPChunk) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+type StreamResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	ReceivedCount int64                  `protobuf:"varint,3,opt,name=received_count,json=receivedCount,proto3" json:"received_count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamResponse) Reset() {
+	*x = StreamResponse{}
+	mi := &file_podscope_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamResponse) ProtoMessage() {}
+
+func (x *StreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamResponse.ProtoReflect.Descriptor instead.
+func (*StreamResponse) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *StreamResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *StreamResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *StreamResponse) GetReceivedCount() int64 {
+	if x != nil {
+		return x.ReceivedCount
+	}
+	return 0
+}
+
+type HeartbeatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Stats         *AgentStats            `protobuf:"bytes,3,opt,name=stats,proto3" json:"stats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_podscope_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *HeartbeatRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *HeartbeatRequest) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *HeartbeatRequest) GetStats() *AgentStats {
+	if x != nil {
+		return x.Stats
+	}
+	return nil
+}
+
+type AgentStats struct {
+	state                   protoimpl.MessageState `protogen:"open.v1"`
+	PacketsCaptured         uint64                 `protobuf:"varint,1,opt,name=packets_captured,json=packetsCaptured,proto3" json:"packets_captured,omitempty"`
+	BytesCaptured           uint64                 `protobuf:"varint,2,opt,name=bytes_captured,json=bytesCaptured,proto3" json:"bytes_captured,omitempty"`
+	FlowsDetected           uint64                 `protobuf:"varint,3,opt,name=flows_detected,json=flowsDetected,proto3" json:"flows_detected,omitempty"`
+	Errors                  uint64                 `protobuf:"varint,4,opt,name=errors,proto3" json:"errors,omitempty"`
+	KernelPacketsReceived   uint64                 `protobuf:"varint,5,opt,name=kernel_packets_received,json=kernelPacketsReceived,proto3" json:"kernel_packets_received,omitempty"`       // seen by the capture socket
+	KernelPacketsDropped    uint64                 `protobuf:"varint,6,opt,name=kernel_packets_dropped,json=kernelPacketsDropped,proto3" json:"kernel_packets_dropped,omitempty"`          // dropped because the buffer was full
+	InterfacePacketsDropped uint64                 `protobuf:"varint,7,opt,name=interface_packets_dropped,json=interfacePacketsDropped,proto3" json:"interface_packets_dropped,omitempty"` // dropped by the network interface
+	ActiveFlows             uint64                 `protobuf:"varint,8,opt,name=active_flows,json=activeFlows,proto3" json:"active_flows,omitempty"`                                       // connections being assembled
+	// Delivery to the hub; flows and PCAP data are dropped when the agent's
+	// queue is full, when its spool fills up while the hub is unreachable, or
+	// when they cannot be delivered before the agent stops
+	FlowsSent                  uint64 `protobuf:"varint,9,opt,name=flows_sent,json=flowsSent,proto3" json:"flows_sent,omitempty"`
+	FlowsDroppedQueueFull      uint64 `protobuf:"varint,10,opt,name=flows_dropped_queue_full,json=flowsDroppedQueueFull,proto3" json:"flows_dropped_queue_full,omitempty"`
+	FlowsDroppedSendFailed     uint64 `protobuf:"varint,11,opt,name=flows_dropped_send_failed,json=flowsDroppedSendFailed,proto3" json:"flows_dropped_send_failed,omitempty"`
+	PcapBytesSent              uint64 `protobuf:"varint,12,opt,name=pcap_bytes_sent,json=pcapBytesSent,proto3" json:"pcap_bytes_sent,omitempty"`
+	PcapBytesDroppedQueueFull  uint64 `protobuf:"varint,13,opt,name=pcap_bytes_dropped_queue_full,json=pcapBytesDroppedQueueFull,proto3" json:"pcap_bytes_dropped_queue_full,omitempty"`
+	PcapBytesDroppedSendFailed uint64 `protobuf:"varint,14,opt,name=pcap_bytes_dropped_send_failed,json=pcapBytesDroppedSendFailed,proto3" json:"pcap_bytes_dropped_send_failed,omitempty"`
+	FlowsDroppedSpoolFull      uint64 `protobuf:"varint,15,opt,name=flows_dropped_spool_full,json=flowsDroppedSpoolFull,proto3" json:"flows_dropped_spool_full,omitempty"`
+	PcapBytesDroppedSpoolFull  uint64 `protobuf:"varint,16,opt,name=pcap_bytes_dropped_spool_full,json=pcapBytesDroppedSpoolFull,proto3" json:"pcap_bytes_dropped_spool_full,omitempty"`
+	unknownFields              protoimpl.UnknownFields
+	sizeCache                  protoimpl.SizeCache
+}
+
+func (x *AgentStats) Reset() {
+	*x = AgentStats{}
+	mi := &file_podscope_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentStats) ProtoMessage() {}
+
+func (x *AgentStats) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentStats.ProtoReflect.Descriptor instead.
+func (*AgentStats) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *AgentStats) GetPacketsCaptured() uint64 {
+	if x != nil {
+		return x.PacketsCaptured
+	}
+	return 0
+}
+
+func (x *AgentStats) GetBytesCaptured() uint64 {
+	if x != nil {
+		return x.BytesCaptured
+	}
+	return 0
+}
+
+func (x *AgentStats) GetFlowsDetected() uint64 {
+	if x != nil {
+		return x.FlowsDetected
+	}
+	return 0
+}
+
+func (x *AgentStats) GetErrors() uint64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+func (x *AgentStats) GetKernelPacketsReceived() uint64 {
+	if x != nil {
+		return x.KernelPacketsReceived
+	}
+	return 0
+}
+
+func (x *AgentStats) GetKernelPacketsDropped() uint64 {
+	if x != nil {
+		return x.KernelPacketsDropped
+	}
+	return 0
+}
+
+func (x *AgentStats) GetInterfacePacketsDropped() uint64 {
+	if x != nil {
+		return x.InterfacePacketsDropped
+	}
+	return 0
+}
+
+func (x *AgentStats) GetActiveFlows() uint64 {
+	if x != nil {
+		return x.ActiveFlows
+	}
+	return 0
+}
+
+func (x *AgentStats) GetFlowsSent() uint64 {
+	if x != nil {
+		return x.FlowsSent
+	}
+	return 0
+}
+
+func (x *AgentStats) GetFlowsDroppedQueueFull() uint64 {
+	if x != nil {
+		return x.FlowsDroppedQueueFull
+	}
+	return 0
+}
+
+func (x *AgentStats) GetFlowsDroppedSendFailed() uint64 {
+	if x != nil {
+		return x.FlowsDroppedSendFailed
+	}
+	return 0
+}
+
+func (x *AgentStats) GetPcapBytesSent() uint64 {
+	if x != nil {
+		return x.PcapBytesSent
+	}
+	return 0
+}
+
+func (x *AgentStats) GetPcapBytesDroppedQueueFull() uint64 {
+	if x != nil {
+		return x.PcapBytesDroppedQueueFull
+	}
+	return 0
+}
+
+func (x *AgentStats) GetPcapBytesDroppedSendFailed() uint64 {
+	if x != nil {
+		return x.PcapBytesDroppedSendFailed
+	}
+	return 0
+}
+
+func (x *AgentStats) GetFlowsDroppedSpoolFull() uint64 {
+	if x != nil {
+		return x.FlowsDroppedSpoolFull
+	}
+	return 0
+}
+
+func (x *AgentStats) GetPcapBytesDroppedSpoolFull() uint64 {
+	if x != nil {
+		return x.PcapBytesDroppedSpoolFull
+	}
+	return 0
+}
+
+type HeartbeatResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ContinueCapture bool                   `protobuf:"varint,1,opt,name=continue_capture,json=continueCapture,proto3" json:"continue_capture,omitempty"`
+	Message         string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	BpfFilter       string                 `protobuf:"bytes,3,opt,name=bpf_filter,json=bpfFilter,proto3" json:"bpf_filter,omitempty"`           // If set, agent should update its BPF filter
+	UnknownAgent    bool                   `protobuf:"varint,4,opt,name=unknown_agent,json=unknownAgent,proto3" json:"unknown_agent,omitempty"` // The hub has no record of the agent, e.g. after a restart; it should register again
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *HeartbeatResponse) Reset() {
+	*x = HeartbeatResponse{}
+	mi := &file_podscope_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResponse) ProtoMessage() {}
+
+func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_podscope_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatResponse.ProtoReflect.Descriptor instead.
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
+	return file_podscope_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *HeartbeatResponse) GetContinueCapture() bool {
+	if x != nil {
+		return x.ContinueCapture
+	}
+	return false
+}
+
+func (x *HeartbeatResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *HeartbeatResponse) GetBpfFilter() string {
+	if x != nil {
+		return x.BpfFilter
+	}
+	return ""
+}
+
+func (x *HeartbeatResponse) GetUnknownAgent() bool {
+	if x != nil {
+		return x.UnknownAgent
+	}
+	return false
+}
+
+var File_podscope_proto protoreflect.FileDescriptor
+
+const file_podscope_proto_rawDesc = "" +
+	"\n" +
+	"\x0epodscope.proto\x12\bpodscope\"\xd0\x01\n" +
+	"\tAgentInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x19\n" +
+	"\bpod_name\x18\x02 \x01(\tR\apodName\x12\x1c\n" +
+	"\tnamespace\x18\x03 \x01(\tR\tnamespace\x12\x15\n" +
+	"\x06pod_ip\x18\x04 \x01(\tR\x05podIp\x12\x1b\n" +
+	"\tnode_name\x18\x05 \x01(\tR\bnodeName\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x06 \x01(\tR\tsessionId\x12'\n" +
+	"\x0flistening_ports\x18\a \x03(\rR\x0elisteningPorts\"u\n" +
+	"\x10RegisterResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12-\n" +
+	"\x06config\x18\x03 \x01(\v2\x15.podscope.AgentConfigR\x06config\"\xc9\x01\n" +
+	"\vAgentConfig\x12\x1f\n" +
+	"\vhub_address\x18\x01 \x01(\tR\n" +
+	"hubAddress\x12\x1f\n" +
+	"\vbuffer_size\x18\x02 \x01(\x05R\n" +
+	"bufferSize\x12*\n" +
+	"\x11flush_interval_ms\x18\x03 \x01(\x05R\x0fflushIntervalMs\x12-\n" +
+	"\x12capture_interfaces\x18\x04 \x03(\tR\x11captureInterfaces\x12\x1d\n" +
+	"\n" +
+	"bpf_filter\x18\x05 \x01(\tR\tbpfFilter\"J\n" +
+	"\tFlowEvent\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\"\n" +
+	"\x04flow\x18\x02 \x01(\v2\x0e.podscope.FlowR\x04flow\"\xba\v\n" +
+	"\x04Flow\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x1f\n" +
+	"\vduration_ms\x18\x03 \x01(\x03R\n" +
+	"durationMs\x12\x15\n" +
+	"\x06src_ip\x18\x04 \x01(\tR\x05srcIp\x12\x19\n" +
+	"\bsrc_port\x18\x05 \x01(\rR\asrcPort\x12\x17\n" +
+	"\asrc_pod\x18\x06 \x01(\tR\x06srcPod\x12#\n" +
+	"\rsrc_namespace\x18\a \x01(\tR\fsrcNamespace\x12\x15\n" +
+	"\x06dst_ip\x18\b \x01(\tR\x05dstIp\x12\x19\n" +
+	"\bdst_port\x18\t \x01(\rR\adstPort\x12\x17\n" +
+	"\adst_pod\x18\n" +
+	" \x01(\tR\x06dstPod\x12#\n" +
+	"\rdst_namespace\x18\v \x01(\tR\fdstNamespace\x12\x1f\n" +
+	"\vdst_service\x18\f \x01(\tR\n" +
+	"dstService\x12\x1a\n" +
+	"\bprotocol\x18\r \x01(\tR\bprotocol\x12\x16\n" +
+	"\x06status\x18\x0e \x01(\tR\x06status\x12\x1d\n" +
+	"\n" +
+	"bytes_sent\x18\x0f \x01(\x04R\tbytesSent\x12%\n" +
+	"\x0ebytes_received\x18\x10 \x01(\x04R\rbytesReceived\x12!\n" +
+	"\fpackets_sent\x18\x11 \x01(\rR\vpacketsSent\x12)\n" +
+	"\x10packets_received\x18\x12 \x01(\rR\x0fpacketsReceived\x12(\n" +
+	"\x10tcp_handshake_ms\x18\x13 \x01(\x01R\x0etcpHandshakeMs\x12(\n" +
+	"\x10tls_handshake_ms\x18\x14 \x01(\x01R\x0etlsHandshakeMs\x12\x17\n" +
+	"\attfb_ms\x18\x15 \x01(\x01R\x06ttfbMs\x12&\n" +
+	"\x04http\x18\x16 \x01(\v2\x12.podscope.HTTPInfoR\x04http\x12#\n" +
+	"\x03tls\x18\x17 \x01(\v2\x11.podscope.TLSInfoR\x03tls\x12(\n" +
+	"\x10is_agent_traffic\x18\x18 \x01(\bR\x0eisAgentTraffic\x12,\n" +
+	"\x12agent_traffic_type\x18\x19 \x01(\tR\x10agentTrafficType\x12=\n" +
+	"\x0ehttp_exchanges\x18\x1a \x03(\v2\x16.podscope.HTTPExchangeR\rhttpExchanges\x12#\n" +
+	"\x03dns\x18\x1b \x01(\v2\x11.podscope.DNSInfoR\x03dns\x12 \n" +
+	"\vretransmits\x18\x1c \x01(\rR\vretransmits\x12 \n" +
+	"\fout_of_order\x18\x1d \x01(\rR\n" +
+	"outOfOrder\x12!\n" +
+	"\fzero_windows\x18\x1e \x01(\rR\vzeroWindows\x12\x1c\n" +
+	"\ttruncated\x18\x1f \x01(\bR\ttruncated\x12\x17\n" +
+	"\asrtt_ms\x18  \x01(\x01R\x06srttMs\x12\x19\n" +
+	"\bdup_acks\x18! \x01(\rR\adupAcks\x12\x19\n" +
+	"\breset_by\x18\" \x01(\tR\aresetBy\x12\x1f\n" +
+	"\vjoined_late\x18# \x01(\bR\n" +
+	"joinedLate\x12/\n" +
+	"\aprocess\x18$ \x01(\v2\x15.podscope.ProcessInfoR\aprocess\x12!\n" +
+	"\fsrc_workload\x18% \x01(\tR\vsrcWorkload\x12\x1f\n" +
+	"\vsrc_service\x18& \x01(\tR\n" +
+	"srcService\x12!\n" +
+	"\fdst_workload\x18' \x01(\tR\vdstWorkload\x12\x19\n" +
+	"\bdst_name\x18( \x01(\tR\adstName\x12&\n" +
+	"\x0fdst_name_source\x18) \x01(\tR\rdstNameSource\x12+\n" +
+	"\x11dropped_exchanges\x18* \x01(\x05R\x10droppedExchanges\x12'\n" +
+	"\x0fexchange_offset\x18+ \x01(\x05R\x0eexchangeOffset\"\xc8\x04\n" +
+	"\bHTTPInfo\x12\x16\n" +
+	"\x06method\x18\x01 \x01(\tR\x06method\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x12\n" +
+	"\x04host\x18\x03 \x01(\tR\x04host\x12\x1f\n" +
+	"\vstatus_code\x18\x04 \x01(\x05R\n" +
+	"statusCode\x12\x1f\n" +
+	"\vstatus_text\x18\x05 \x01(\tR\n" +
+	"statusText\x12O\n" +
+	"\x0frequest_headers\x18\x06 \x03(\v2&.podscope.HTTPInfo.RequestHeadersEntryR\x0erequestHeaders\x12R\n" +
+	"\x10response_headers\x18\a \x03(\v2'.podscope.HTTPInfo.ResponseHeadersEntryR\x0fresponseHeaders\x12!\n" +
+	"\frequest_body\x18\b \x01(\tR\vrequestBody\x12#\n" +
+	"\rresponse_body\x18\t \x01(\tR\fresponseBody\x12!\n" +
+	"\fcontent_type\x18\n" +
+	" \x01(\tR\vcontentType\x12%\n" +
+	"\x0econtent_length\x18\v \x01(\x03R\rcontentLength\x1aA\n" +
+	"\x13RequestHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1aB\n" +
+	"\x14ResponseHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xe4\x01\n" +
+	"\fHTTPExchange\x12&\n" +
+	"\x04http\x18\x01 \x01(\v2\x12.podscope.HTTPInfoR\x04http\x12!\n" +
+	"\frequest_time\x18\x02 \x01(\x03R\vrequestTime\x12#\n" +
+	"\rresponse_time\x18\x03 \x01(\x03R\fresponseTime\x12\x1f\n" +
+	"\vduration_ms\x18\x04 \x01(\x01R\n" +
+	"durationMs\x12\x1b\n" +
+	"\tstream_id\x18\x05 \x01(\rR\bstreamId\x12&\n" +
+	"\x04grpc\x18\x06 \x01(\v2\x12.podscope.GRPCInfoR\x04grpc\"\xc0\x02\n" +
+	"\bGRPCInfo\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12\x16\n" +
+	"\x06method\x18\x02 \x01(\tR\x06method\x12\x1f\n" +
+	"\vstatus_code\x18\x03 \x01(\x05R\n" +
+	"statusCode\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x12%\n" +
+	"\x0estatus_message\x18\x05 \x01(\tR\rstatusMessage\x12)\n" +
+	"\x10request_messages\x18\x06 \x01(\x05R\x0frequestMessages\x12+\n" +
+	"\x11response_messages\x18\a \x01(\x05R\x10responseMessages\x12#\n" +
+	"\rrequest_bytes\x18\b \x01(\x03R\frequestBytes\x12%\n" +
+	"\x0eresponse_bytes\x18\t \x01(\x03R\rresponseBytes\"\xaf\x01\n" +
+	"\aTLSInfo\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12\x10\n" +
+	"\x03sni\x18\x02 \x01(\tR\x03sni\x12!\n" +
+	"\fcipher_suite\x18\x03 \x01(\tR\vcipherSuite\x12\x12\n" +
+	"\x04alpn\x18\x04 \x03(\tR\x04alpn\x12\x1c\n" +
+	"\tencrypted\x18\x05 \x01(\bR\tencrypted\x12#\n" +
+	"\rcipher_suites\x18\x06 \x03(\tR\fcipherSuites\"\xc2\x01\n" +
+	"\aDNSInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x14\n" +
+	"\x05rcode\x18\x04 \x01(\tR\x05rcode\x12-\n" +
+	"\aanswers\x18\x05 \x03(\v2\x13.podscope.DNSAnswerR\aanswers\x12\x1d\n" +
+	"\n" +
+	"latency_ms\x18\x06 \x01(\x01R\tlatencyMs\x12\x1b\n" +
+	"\ttimed_out\x18\a \x01(\bR\btimedOut\"[\n" +
+	"\tDNSAnswer\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\x12\x10\n" +
+	"\x03ttl\x18\x04 \x01(\rR\x03ttl\"z\n" +
+	"\vProcessInfo\x12\x10\n" +
+	"\x03pid\x18\x01 \x01(\x05R\x03pid\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\x12\x1c\n" +
+	"\tcontainer\x18\x03 \x01(\tR\tcontainer\x12!\n" +
+	"\fcontainer_id\x18\x04 \x01(\tR\vcontainerId\"j\n" +
+	"\tPCAPChunk\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12\x10\n" +
+	"\x03seq\x18\x04 \x01(\x04R\x03seq\"k\n" +
+	"\x0eStreamResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12%\n" +
+	"\x0ereceived_count\x18\x03 \x01(\x03R\rreceivedCount\"w\n" +
+	"\x10HeartbeatRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12*\n" +
+	"\x05stats\x18\x03 \x01(\v2\x14.podscope.AgentStatsR\x05stats\"\xa6\x06\n" +
+	"\n" +
+	"AgentStats\x12)\n" +
+	"\x10packets_captured\x18\x01 \x01(\x04R\x0fpacketsCaptured\x12%\n" +
+	"\x0ebytes_captured\x18\x02 \x01(\x04R\rbytesCaptured\x12%\n" +
+	"\x0eflows_detected\x18\x03 \x01(\x04R\rflowsDetected\x12\x16\n" +
+	"\x06errors\x18\x04 \x01(\x04R\x06errors\x126\n" +
+	"\x17kernel_packets_received\x18\x05 \x01(\x04R\x15kernelPacketsReceived\x124\n" +
+	"\x16kernel_packets_dropped\x18\x06 \x01(\x04R\x14kernelPacketsDropped\x12:\n" +
+	"\x19interface_packets_dropped\x18\a \x01(\x04R\x17interfacePacketsDropped\x12!\n" +
+	"\factive_flows\x18\b \x01(\x04R\vactiveFlows\x12\x1d\n" +
+	"\n" +
+	"flows_sent\x18\t \x01(\x04R\tflowsSent\x127\n" +
+	"\x18flows_dropped_queue_full\x18\n" +
+	" \x01(\x04R\x15flowsDroppedQueueFull\x129\n" +
+	"\x19flows_dropped_send_failed\x18\v \x01(\x04R\x16flowsDroppedSendFailed\x12&\n" +
+	"\x0fpcap_bytes_sent\x18\f \x01(\x04R\rpcapBytesSent\x12@\n" +
+	"\x1dpcap_bytes_dropped_queue_full\x18\r \x01(\x04R\x19pcapBytesDroppedQueueFull\x12B\n" +
+	"\x1epcap_bytes_dropped_send_failed\x18\x0e \x01(\x04R\x1apcapBytesDroppedSendFailed\x127\n" +
+	"\x18flows_dropped_spool_full\x18\x0f \x01(\x04R\x15flowsDroppedSpoolFull\x12@\n" +
+	"\x1dpcap_bytes_dropped_spool_full\x18\x10 \x01(\x04R\x19pcapBytesDroppedSpoolFull\"\x9c\x01\n" +
+	"\x11HeartbeatResponse\x12)\n" +
+	"\x10continue_capture\x18\x01 \x01(\bR\x0fcontinueCapture\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1d\n" +
+	"\n" +
+	"bpf_filter\x18\x03 \x01(\tR\tbpfFilter\x12#\n" +
+	"\runknown_agent\x18\x04 \x01(\bR\funknownAgent2\x95\x02\n" +
+	"\fAgentService\x12>\n" +
+	"\vStreamFlows\x12\x13.podscope.FlowEvent\x1a\x18.podscope.StreamResponse(\x01\x12=\n" +
+	"\n" +
+	"StreamPCAP\x12\x13.podscope.PCAPChunk\x1a\x18.podscope.StreamResponse(\x01\x12@\n" +
+	"\rRegisterAgent\x12\x13.podscope.AgentInfo\x1a\x1a.podscope.RegisterResponse\x12D\n" +
+	"\tHeartbeat\x12\x1a.podscope.HeartbeatRequest\x1a\x1b.podscope.HeartbeatResponseB.Z,github.com/podscope/podscope/pkg/protocol/pbb\x06proto3"
+
+var (
+	file_podscope_proto_rawDescOnce sync.Once
+	file_podscope_proto_rawDescData []byte
+)
+
+func file_podscope_proto_rawDescGZIP() []byte {
+	file_podscope_proto_rawDescOnce.Do(func() {
+		file_podscope_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_podscope_proto_rawDesc), len(file_podscope_proto_rawDesc)))
+	})
+	return file_podscope_proto_rawDescData
+}
+
+var file_podscope_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_podscope_proto_goTypes = []any{
+	(*AgentInfo)(nil),         // 0: podscope.AgentInfo
+	(*RegisterResponse)(nil),  // 1: podscope.RegisterResponse
+	(*AgentConfig)(nil),       // 2: podscope.AgentConfig
+	(*FlowEvent)(nil),         // 3: podscope.FlowEvent
+	(*Flow)(nil),              // 4: podscope.Flow
+	(*HTTPInfo)(nil),          // 5: podscope.HTTPInfo
+	(*HTTPExchange)(nil),      // 6: podscope.HTTPExchange
+	(*GRPCInfo)(nil),          // 7: podscope.GRPCInfo
+	(*TLSInfo)(nil),           // 8: podscope.TLSInfo
+	(*DNSInfo)(nil),           // 9: podscope.DNSInfo
+	(*DNSAnswer)(nil),         // 10: podscope.DNSAnswer
+	(*ProcessInfo)(nil),       // 11: podscope.ProcessInfo
+	(*PCAPChunk)(nil),         // 12: podscope.PCAPChunk
+	(*StreamResponse)(nil),    // 13: podscope.StreamResponse
+	(*HeartbeatRequest)(nil),  // 14: podscope.HeartbeatRequest
+	(*AgentStats)(nil),        // 15: podscope.AgentStats
+	(*HeartbeatResponse)(nil), // 16: podscope.HeartbeatResponse
+	nil,                       // 17: podscope.HTTPInfo.RequestHeadersEntry
+	nil,                       // 18: podscope.HTTPInfo.ResponseHeadersEntry
+}
+var file_podscope_proto_depIdxs = []int32{
+	2,  // 0: podscope.RegisterResponse.config:type_name -> podscope.AgentConfig
+	4,  // 1: podscope.FlowEvent.flow:type_name -> podscope.Flow
+	5,  // 2: podscope.Flow.http:type_name -> podscope.HTTPInfo
+	8,  // 3: podscope.Flow.tls:type_name -> podscope.TLSInfo
+	6,  // 4: podscope.Flow.http_exchanges:type_name -> podscope.HTTPExchange
+	9,  // 5: podscope.Flow.dns:type_name -> podscope.DNSInfo
+	11, // 6: podscope.Flow.process:type_name -> podscope.ProcessInfo
+	17, // 7: podscope.HTTPInfo.request_headers:type_name -> podscope.HTTPInfo.RequestHeadersEntry
+	18, // 8: podscope.HTTPInfo.response_headers:type_name -> podscope.HTTPInfo.ResponseHeadersEntry
+	5,  // 9: podscope.HTTPExchange.http:type_name -> podscope.HTTPInfo
+	7,  // 10: podscope.HTTPExchange.grpc:type_name -> podscope.GRPCInfo
+	10, // 11: podscope.DNSInfo.answers:type_name -> podscope.DNSAnswer
+	15, // 12: podscope.HeartbeatRequest.stats:type_name -> podscope.AgentStats
+	3,  // 13: podscope.AgentService.StreamFlows:input_type -> podscope.FlowEvent
+	12, // 14: podscope.AgentService.StreamPCAP:input_type -> podscope.PCAPChunk
+	0,  // 15: podscope.AgentService.RegisterAgent:input_type -> podscope.AgentInfo
+	14, // 16: podscope.AgentService.Heartbeat:input_type -> podscope.HeartbeatRequest
+	13, // 17: podscope.AgentService.StreamFlows:output_type -> podscope.StreamResponse
+	13, // 18: podscope.AgentService.StreamPCAP:output_type -> podscope.StreamResponse
+	1,  // 19: podscope.AgentService.RegisterAgent:output_type -> podscope.RegisterResponse
+	16, // 20: podscope.AgentService.Heartbeat:output_type -> podscope.HeartbeatResponse
+	17, // [17:21] is the sub-list for method output_type
+	13, // [13:17] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_podscope_proto_init() }
+func file_podscope_proto_init() {
+	if File_podscope_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_podscope_proto_rawDesc), len(file_podscope_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   19,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_podscope_proto_goTypes,
+		DependencyIndexes: file_podscope_proto_depIdxs,
+		MessageInfos:      file_podscope_proto_msgTypes,
+	}.Build()
+	File_podscope_proto = out.File
+	file_podscope_proto_goTypes = nil
+	file_podscope_proto_depIdxs = nil
+}
@@ -0,0 +1,297 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: podscope.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	AgentService_StreamFlows_FullMethodName   = "/podscope.AgentService/StreamFlows"
+	AgentService_StreamPCAP_FullMethodName    = "/podscope.AgentService/StreamPCAP"
+	AgentService_RegisterAgent_FullMethodName = "/podscope.AgentService/RegisterAgent"
+	AgentService_Heartbeat_FullMethodName     = "/podscope.AgentService/Heartbeat"
+)
+
+// AgentServiceClient is the client API for AgentService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AgentServiceClient interface {
+	// StreamFlows sends captured flow events from agent to hub
+	StreamFlows(ctx context.Context, opts ...grpc.CallOption) (AgentService_StreamFlowsClient, error)
+	// StreamPCAP sends raw PCAP chunks from agent to hub
+	StreamPCAP(ctx context.Context, opts ...grpc.CallOption) (AgentService_StreamPCAPClient, error)
+	// RegisterAgent registers an agent with the hub
+	RegisterAgent(ctx context.Context, in *AgentInfo, opts ...grpc.CallOption) (*RegisterResponse, error)
+	// Heartbeat keeps the agent connection alive
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+}
+
+type agentServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAgentServiceClient(cc grpc.ClientConnInterface) AgentServiceClient {
+	return &agentServiceClient{cc}
+}
+
+func (c *agentServiceClient) StreamFlows(ctx context.Context, opts ...grpc.CallOption) (AgentService_StreamFlowsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[0], AgentService_StreamFlows_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceStreamFlowsClient{stream}
+	return x, nil
+}
+
+type AgentService_StreamFlowsClient interface {
+	Send(*FlowEvent) error
+	CloseAndRecv() (*StreamResponse, error)
+	grpc.ClientStream
+}
+
+type agentServiceStreamFlowsClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceStreamFlowsClient) Send(m *FlowEvent) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServiceStreamFlowsClient) CloseAndRecv() (*StreamResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) StreamPCAP(ctx context.Context, opts ...grpc.CallOption) (AgentService_StreamPCAPClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[1], AgentService_StreamPCAP_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceStreamPCAPClient{stream}
+	return x, nil
+}
+
+type AgentService_StreamPCAPClient interface {
+	Send(*PCAPChunk) error
+	CloseAndRecv() (*StreamResponse, error)
+	grpc.ClientStream
+}
+
+type agentServiceStreamPCAPClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceStreamPCAPClient) Send(m *PCAPChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServiceStreamPCAPClient) CloseAndRecv() (*StreamResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) RegisterAgent(ctx context.Context, in *AgentInfo, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, AgentService_RegisterAgent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, AgentService_Heartbeat_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AgentServiceServer is the server API for AgentService service.
+// All implementations must embed UnimplementedAgentServiceServer
+// for forward compatibility
+type AgentServiceServer interface {
+	// StreamFlows sends captured flow events from agent to hub
+	StreamFlows(AgentService_StreamFlowsServer) error
+	// StreamPCAP sends raw PCAP chunks from agent to hub
+	StreamPCAP(AgentService_StreamPCAPServer) error
+	// RegisterAgent registers an agent with the hub
+	RegisterAgent(context.Context, *AgentInfo) (*RegisterResponse, error)
+	// Heartbeat keeps the agent connection alive
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	mustEmbedUnimplementedAgentServiceServer()
+}
+
+// UnimplementedAgentServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedAgentServiceServer struct {
+}
+
+func (UnimplementedAgentServiceServer) StreamFlows(AgentService_StreamFlowsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamFlows not implemented")
+}
+func (UnimplementedAgentServiceServer) StreamPCAP(AgentService_StreamPCAPServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamPCAP not implemented")
+}
+func (UnimplementedAgentServiceServer) RegisterAgent(context.Context, *AgentInfo) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterAgent not implemented")
+}
+func (UnimplementedAgentServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedAgentServiceServer) mustEmbedUnimplementedAgentServiceServer() {}
+
+// UnsafeAgentServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AgentServiceServer will
+// result in compilation errors.
+type UnsafeAgentServiceServer interface {
+	mustEmbedUnimplementedAgentServiceServer()
+}
+
+func RegisterAgentServiceServer(s grpc.ServiceRegistrar, srv AgentServiceServer) {
+	s.RegisterService(&AgentService_ServiceDesc, srv)
+}
+
+func _AgentService_StreamFlows_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).StreamFlows(&agentServiceStreamFlowsServer{stream})
+}
+
+type AgentService_StreamFlowsServer interface {
+	SendAndClose(*StreamResponse) error
+	Recv() (*FlowEvent, error)
+	grpc.ServerStream
+}
+
+type agentServiceStreamFlowsServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceStreamFlowsServer) SendAndClose(m *StreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServiceStreamFlowsServer) Recv() (*FlowEvent, error) {
+	m := new(FlowEvent)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AgentService_StreamPCAP_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).StreamPCAP(&agentServiceStreamPCAPServer{stream})
+}
+
+type AgentService_StreamPCAPServer interface {
+	SendAndClose(*StreamResponse) error
+	Recv() (*PCAPChunk, error)
+	grpc.ServerStream
+}
+
+type agentServiceStreamPCAPServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceStreamPCAPServer) SendAndClose(m *StreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServiceStreamPCAPServer) Recv() (*PCAPChunk, error) {
+	m := new(PCAPChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AgentService_RegisterAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).RegisterAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentService_RegisterAgent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).RegisterAgent(ctx, req.(*AgentInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentService_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AgentService_ServiceDesc is the grpc.ServiceDesc for AgentService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AgentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "podscope.AgentService",
+	HandlerType: (*AgentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RegisterAgent",
+			Handler:    _AgentService_RegisterAgent_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _AgentService_Heartbeat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamFlows",
+			Handler:       _AgentService_StreamFlows_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamPCAP",
+			Handler:       _AgentService_StreamPCAP_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "podscope.proto",
+}
@@ -3,7 +3,7 @@ import { FlowList } from './components/FlowList'
 import { FlowDetail } from './components/FlowDetail'
 import { Header } from './components/Header'
 import { Terminal } from './components/Terminal'
-import { Flow } from './types'
+import { Flow, CaptureCompleteness } from './types'
 import { mockFlows, generateMockFlow } from './lib/mockData'
 
 // Enable demo mode when not connected to a real hub (set to true for UI development)
@@ -31,7 +31,14 @@ function App() {
     showOnlyHTTP: true,
     showAllPorts: false,
   })
-  const [stats, setStats] = useState({ flows: 0, wsClients: 0, pcapSize: 0, pcapFull: false, paused: false })
+  const [stats, setStats] = useState<{
+    flows: number
+    wsClients: number
+    pcapSize: number
+    pcapFull: boolean
+    paused: boolean
+    completeness?: CaptureCompleteness
+  }>({ flows: 0, wsClients: 0, pcapSize: 0, pcapFull: false, paused: false })
   const [terminalTarget, setTerminalTarget] = useState<TerminalTarget | null>(null)
   const [terminalMaximized, setTerminalMaximized] = useState(false)
 
@@ -95,7 +102,9 @@ function App() {
               )
               return allFlows.slice(0, 1000)
             })
-          } else {
+          } else if (!message.type) {
+            // Untyped messages are single flows; other types, such as
+            // graph updates, are not for the flow list
             const flow = message as Flow
             console.log('Received flow:', flow.id, flow.protocol, flow.srcPort, '->', flow.dstPort)
             setFlows(prev => {
@@ -174,10 +183,12 @@ function App() {
         flow.srcPod?.toLowerCase().includes(searchLower) ||
         flow.dstPod?.toLowerCase().includes(searchLower) ||
         flow.dstService?.toLowerCase().includes(searchLower) ||
+        flow.dstName?.toLowerCase().includes(searchLower) ||
         flow.protocol?.toLowerCase().includes(searchLower) ||
         flow.http?.url?.toLowerCase().includes(searchLower) ||
         flow.http?.host?.toLowerCase().includes(searchLower) ||
-        flow.tls?.sni?.toLowerCase().includes(searchLower)
+        flow.tls?.sni?.toLowerCase().includes(searchLower) ||
+        flow.dns?.name?.toLowerCase().includes(searchLower)
       )
     })
   }, [flows, filter, filterOptions])
@@ -275,6 +286,7 @@ function App() {
           filteredCount={filteredFlows.length}
           pcapSize={stats.pcapSize}
           pcapFull={stats.pcapFull}
+          completeness={stats.completeness}
           filter={filter}
           onFilterChange={setFilter}
           filterOptions={filterOptions}
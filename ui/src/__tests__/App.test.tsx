@@ -449,6 +449,33 @@ describe('App WebSocket message handling', () => {
     })
   })
 
+  it('keeps graph messages out of the flow list', async () => {
+    render(<App />)
+
+    const ws = instances[0]
+
+    await act(async () => {
+      ws.simulateOpen()
+    })
+
+    await act(async () => {
+      ws.simulateMessage({
+        type: 'batch',
+        flows: [createMockHTTPFlow({ id: 'graph-flow', srcPod: 'graph-pod' })],
+      })
+      ws.simulateMessage({
+        type: 'graph',
+        graph: { nodes: [], edges: [], updatedAt: '2024-01-15T10:30:00Z' },
+      })
+    })
+
+    await waitFor(() => {
+      expect(screen.getByText('graph-pod')).toBeInTheDocument()
+    })
+    // Counted as a flow, the graph would show up as a second, filtered out one
+    expect(screen.queryByText('1/2')).not.toBeInTheDocument()
+  })
+
   it('handles empty catchup message gracefully', async () => {
     render(<App />)
 
@@ -718,6 +745,40 @@ describe('App flow filtering', () => {
     })
   })
 
+  it('text search filters by resolved destination name', async () => {
+    const user = userEvent.setup()
+    render(<App />)
+
+    const ws = instances[0]
+
+    await act(async () => {
+      ws.simulateOpen()
+    })
+
+    const flow1 = createMockHTTPFlow({ id: 'name-1', srcPod: 'pod-a', dstName: 'payments.stripe.com', dstNameSource: 'dns' })
+    const flow2 = createMockHTTPFlow({ id: 'name-2', srcPod: 'pod-b', dstName: 'storage.googleapis.com', dstNameSource: 'dns' })
+
+    await act(async () => {
+      ws.simulateMessage({
+        type: 'catchup',
+        flows: [flow1, flow2],
+      })
+    })
+
+    await waitFor(() => {
+      expect(screen.getByText('pod-a')).toBeInTheDocument()
+      expect(screen.getByText('pod-b')).toBeInTheDocument()
+    })
+
+    const searchInput = screen.getByPlaceholderText(/Filter by IP/)
+    await user.type(searchInput, 'stripe')
+
+    await waitFor(() => {
+      expect(screen.getByText('pod-a')).toBeInTheDocument()
+      expect(screen.queryByText('pod-b')).not.toBeInTheDocument()
+    })
+  })
+
   it('text search filters by HTTP URL', async () => {
     const user = userEvent.setup()
     render(<App />)
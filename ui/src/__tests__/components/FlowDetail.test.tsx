@@ -165,6 +165,56 @@ describe('FlowDetail component', () => {
       })
     })
 
+    describe('destination name display', () => {
+      it('displays the hostname the destination was resolved from', () => {
+        const props = createDefaultProps()
+        props.flow = createMockFlow({ dstName: 'api.github.com', dstNameSource: 'dns' })
+
+        render(<FlowDetail {...props} />)
+
+        expect(screen.getByTitle('Named from DNS')).toHaveTextContent('api.github.com')
+      })
+    })
+
+    describe('workload display', () => {
+      it('displays the workload owning each pod', () => {
+        const props = createDefaultProps()
+        props.flow = createMockFlow({
+          srcWorkload: 'Deployment/frontend',
+          dstWorkload: 'StatefulSet/db',
+        })
+
+        render(<FlowDetail {...props} />)
+
+        expect(screen.getByText('Deployment/frontend')).toBeInTheDocument()
+        expect(screen.getByText('StatefulSet/db')).toBeInTheDocument()
+      })
+    })
+
+    describe('process display', () => {
+      it('displays the owning process and container', () => {
+        const props = createDefaultProps()
+        props.flow = createMockFlow({
+          process: { pid: 42, command: 'envoy', container: 'istio-proxy', containerId: '3f1c0d7e9a2b4c6d8e0f' },
+        })
+
+        render(<FlowDetail {...props} />)
+
+        expect(screen.getByText('envoy')).toBeInTheDocument()
+        expect(screen.getByText('istio-proxy')).toBeInTheDocument()
+        expect(screen.getByText('3f1c0d7e9a2b')).toBeInTheDocument()
+      })
+
+      it('does not display a process when none was found', () => {
+        const props = createDefaultProps()
+        props.flow = createMockFlow({ process: undefined })
+
+        render(<FlowDetail {...props} />)
+
+        expect(screen.queryByText(/pid/)).not.toBeInTheDocument()
+      })
+    })
+
     describe('protocol display', () => {
       it('displays TCP protocol', () => {
         const props = createDefaultProps()
@@ -362,6 +412,40 @@ describe('FlowDetail component', () => {
     })
   })
 
+  describe('TCP health section', () => {
+    it('shows RTT and loss counters', () => {
+      const props = createDefaultProps()
+      props.flow = createMockFlow({ srttMs: 12.34, retransmits: 3, dupAcks: 5, outOfOrder: 1, zeroWindows: 2 })
+
+      render(<FlowDetail {...props} />)
+
+      expect(screen.getByText('TCP Health')).toBeInTheDocument()
+      expect(screen.getByText('12.3ms')).toBeInTheDocument()
+      expect(screen.getByText('Retransmits').nextSibling).toHaveTextContent('3')
+      expect(screen.getByText('Dup ACKs').nextSibling).toHaveTextContent('5')
+      expect(screen.getByText('Zero Window Stalls').nextSibling).toHaveTextContent('2')
+    })
+
+    it('shows which side reset the connection', () => {
+      const props = createDefaultProps()
+      props.flow = createMockFlow({ status: 'RESET', resetBy: 'server' })
+
+      render(<FlowDetail {...props} />)
+
+      expect(screen.getByText('Reset By')).toBeInTheDocument()
+      expect(screen.getByText('server')).toBeInTheDocument()
+    })
+
+    it('is hidden for DNS flows', () => {
+      const props = createDefaultProps()
+      props.flow = createMockFlow({ protocol: 'DNS' })
+
+      render(<FlowDetail {...props} />)
+
+      expect(screen.queryByText('TCP Health')).not.toBeInTheDocument()
+    })
+  })
+
   describe('terminal button', () => {
     it('shows terminal button for source pod when onOpenTerminal is provided', () => {
       const props = createDefaultProps()
@@ -431,6 +515,15 @@ describe('FlowDetail component', () => {
       expect(screen.getByText(/TLS Handshake: 30.2ms/)).toBeInTheDocument()
     })
 
+    it('notes flows that were joined late', () => {
+      const props = createDefaultProps()
+      props.flow = createMockFlow({ joinedLate: true })
+
+      render(<FlowDetail {...props} />)
+
+      expect(screen.getByText(/Joined late/)).toBeInTheDocument()
+    })
+
     it('shows no timing data message when no timing info', () => {
       const props = createDefaultProps()
       props.flow = createMockFlow({
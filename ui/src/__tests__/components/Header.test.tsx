@@ -349,6 +349,46 @@ describe('Header component', () => {
     })
   })
 
+  describe('capture completeness', () => {
+    const completeness = (overall: number) => ({
+      overall,
+      packets: overall,
+      flows: 1,
+      pcap: 1,
+      drops: {
+        kernelPackets: overall < 1 ? 25 : 0,
+        interfacePackets: 0,
+        flowsQueueFull: 0,
+        flowsSpoolFull: 0,
+        flowsSendFailed: 0,
+        pcapBytesQueueFull: 0,
+        pcapBytesSpoolFull: 0,
+        pcapBytesSendFailed: 0,
+        pcapBytesBufferFull: 0,
+      },
+    })
+
+    it('is hidden until stats report it', () => {
+      render(<Header {...createDefaultProps()} />)
+
+      expect(screen.queryByText(/%$/)).not.toBeInTheDocument()
+    })
+
+    it('shows a complete capture as 100%', () => {
+      render(<Header {...createDefaultProps()} completeness={completeness(1)} />)
+
+      expect(screen.getByText('100.0%')).toHaveClass('text-gray-400')
+    })
+
+    it('warns and explains when traffic was dropped', () => {
+      render(<Header {...createDefaultProps()} completeness={completeness(0.9995)} />)
+
+      const percent = screen.getByText('99.9%')
+      expect(percent).toHaveClass('text-status-warning')
+      expect(percent.parentElement).toHaveAttribute('title', expect.stringContaining('25 packets dropped by the capture buffer'))
+    })
+  })
+
   describe('header content', () => {
     it('displays PodScope title', () => {
       const props = createDefaultProps()
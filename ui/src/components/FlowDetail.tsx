@@ -1,6 +1,6 @@
 import { useState } from 'react'
-import { Flow } from '../types'
-import { X, Download, ArrowRight, Lock, Terminal, Clock, Send, Inbox, Shield, Globe, Server, ChevronDown, Activity } from 'lucide-react'
+import { Flow, ProcessInfo } from '../types'
+import { X, Download, ArrowRight, Lock, Terminal, Clock, Send, Inbox, Shield, Globe, Server, ChevronDown, Activity, HeartPulse, Cpu } from 'lucide-react'
 import { formatBytes } from '../utils'
 
 interface FlowDetailProps {
@@ -66,6 +66,8 @@ export function FlowDetail({ flow, onClose, onDownloadPCAP, onOpenTerminal }: Fl
               port={flow.srcPort}
               pod={flow.srcPod}
               namespace={flow.srcNamespace}
+              workload={flow.srcWorkload}
+              service={flow.srcService}
               onOpenTerminal={onOpenTerminal}
             />
             <div className="flex flex-col items-center justify-center py-4">
@@ -80,15 +82,24 @@ export function FlowDetail({ flow, onClose, onDownloadPCAP, onOpenTerminal }: Fl
               port={flow.dstPort}
               pod={flow.dstPod}
               namespace={flow.dstNamespace}
+              workload={flow.dstWorkload}
               service={flow.dstService}
+              hostname={flow.dstName}
+              hostnameSource={flow.dstNameSource}
               onOpenTerminal={onOpenTerminal}
             />
           </div>
+          {flow.process && <ProcessLine process={flow.process} />}
         </Section>
 
         {/* Timing */}
         <Section title="Timing" icon={<Clock className="w-4 h-4" />}>
           <div className="text-xs text-gray-500 mb-3">{formatTimestamp(flow.timestamp)}</div>
+          {flow.joinedLate && (
+            <div className="text-xs text-amber-300 mb-3">
+              Joined late: the connection was open before capture started, so start time and duration are partial
+            </div>
+          )}
           <TimingBar flow={flow} />
         </Section>
 
@@ -114,6 +125,41 @@ export function FlowDetail({ flow, onClose, onDownloadPCAP, onOpenTerminal }: Fl
           </div>
         </Section>
 
+        {/* TCP Health */}
+        {!isDatagramFlow(flow) && (
+          <CollapsibleSection title="TCP Health" icon={<HeartPulse className="w-4 h-4" />}>
+            <div className="grid grid-cols-3 gap-4">
+              <MetricItem
+                label="Smoothed RTT"
+                value={flow.srttMs ? `${flow.srttMs.toFixed(1)}ms` : 'N/A'}
+              />
+              <MetricItem
+                label="Retransmits"
+                value={`${flow.retransmits ?? 0}`}
+                indicator={getCountIndicator(flow.retransmits)}
+              />
+              <MetricItem
+                label="Dup ACKs"
+                value={`${flow.dupAcks ?? 0}`}
+                indicator={getCountIndicator(flow.dupAcks)}
+              />
+              <MetricItem
+                label="Out of Order"
+                value={`${flow.outOfOrder ?? 0}`}
+                indicator={getCountIndicator(flow.outOfOrder)}
+              />
+              <MetricItem
+                label="Zero Window Stalls"
+                value={`${flow.zeroWindows ?? 0}`}
+                indicator={getCountIndicator(flow.zeroWindows)}
+              />
+              {flow.resetBy && (
+                <MetricItem label="Reset By" value={flow.resetBy} indicator="error" />
+              )}
+            </div>
+          </CollapsibleSection>
+        )}
+
         {/* Advanced Metrics */}
         <CollapsibleSection title="Advanced Metrics" icon={<Activity className="w-4 h-4" />}>
           <div className="grid grid-cols-3 gap-4">
@@ -255,7 +301,10 @@ function EndpointCard({
   port,
   pod,
   namespace,
+  workload,
   service,
+  hostname,
+  hostnameSource,
   onOpenTerminal
 }: {
   type: 'source' | 'destination'
@@ -263,7 +312,10 @@ function EndpointCard({
   port: number
   pod?: string
   namespace?: string
+  workload?: string
   service?: string
+  hostname?: string
+  hostnameSource?: string
   onOpenTerminal?: (podName: string) => void
 }) {
   return (
@@ -277,6 +329,11 @@ function EndpointCard({
         </span>
       </div>
 
+      {hostname && (
+        <div className="text-sm text-white mb-1 truncate" title={hostnameSource && `Named from ${hostnameSource.toUpperCase()}`}>
+          {hostname}
+        </div>
+      )}
       <div className="font-mono text-sm text-white mb-2">{ip}:{port}</div>
 
       {pod && (
@@ -294,6 +351,10 @@ function EndpointCard({
         </div>
       )}
 
+      {workload && (
+        <div className="text-xs text-gray-500 mt-1 truncate">{workload}</div>
+      )}
+
       {service && (
         <div className="text-xs text-glow-400 mt-2 truncate">{service}</div>
       )}
@@ -301,6 +362,21 @@ function EndpointCard({
   )
 }
 
+function ProcessLine({ process }: { process: ProcessInfo }) {
+  return (
+    <div className="flex items-center gap-2 mt-3 text-xs text-gray-400">
+      <Cpu className="w-3.5 h-3.5 text-glow-400" />
+      <span>
+        Process <span className="font-mono text-white">{process.command}</span> (pid {process.pid})
+        {process.container && <> in container <span className="font-mono text-white">{process.container}</span></>}
+      </span>
+      {process.containerId && (
+        <span className="font-mono text-gray-500" title={process.containerId}>{process.containerId.slice(0, 12)}</span>
+      )}
+    </div>
+  )
+}
+
 function InfoItem({ label, value }: { label: string; value: string | number }) {
   return (
     <div className="flex justify-between items-center py-2 border-b border-void-700/50">
@@ -361,6 +437,15 @@ function StatusBadge({ code, text }: { code: number; text: string }) {
   )
 }
 
+function isDatagramFlow(flow: Flow): boolean {
+  return flow.protocol === 'DNS' || flow.protocol === 'UDP'
+}
+
+function getCountIndicator(count: number | undefined): 'success' | 'warning' | null {
+  if (count === undefined) return null
+  return count > 0 ? 'warning' : 'success'
+}
+
 function getTTFBIndicator(ttfbMs: number | undefined): 'success' | 'warning' | 'error' | null {
   if (!ttfbMs || ttfbMs === 0) return null
   if (ttfbMs < 200) return 'success'
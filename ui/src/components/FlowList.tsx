@@ -35,7 +35,7 @@ export function FlowList({ flows, selectedId, onSelect }: FlowListProps) {
       (f.srcPod || `${f.srcIp}:${f.srcPort}`).toLowerCase()
 
     const getDestinationString = (f: Flow): string =>
-      (f.http?.host || f.tls?.sni || f.dstService || f.dstPod || `${f.dstIp}:${f.dstPort}`).toLowerCase()
+      (f.dstName || f.http?.host || f.tls?.sni || f.dstService || f.dstPod || `${f.dstIp}:${f.dstPort}`).toLowerCase()
 
     const getLatencyValue = (f: Flow): number =>
       f.ttfbMs ?? f.tcpHandshakeMs ?? -1
@@ -210,6 +210,9 @@ const FlowRowMemo = memo(function FlowRow({ flow, selected, onClick, index }: Fl
     if (flow.http?.statusCode) {
       return `${flow.http.statusCode}`
     }
+    if (flow.dns?.rcode) {
+      return flow.dns.rcode
+    }
     return flow.status
   }
 
@@ -220,6 +223,7 @@ const FlowRowMemo = memo(function FlowRow({ flow, selected, onClick, index }: Fl
   }
 
   const getDestination = (): string => {
+    if (flow.dstName) return flow.dstName
     if (flow.http?.host) return flow.http.host
     if (flow.tls?.sni) return flow.tls.sni
     if (flow.dstService) return flow.dstService
@@ -255,6 +259,10 @@ const FlowRowMemo = memo(function FlowRow({ flow, selected, onClick, index }: Fl
       if (code >= 400 && code < 500) return 'text-status-warning'
       return 'text-status-error'
     }
+    // Failed lookups are the usual reason to look at DNS flows
+    if (flow.dns?.rcode && flow.dns.rcode !== 'NOERROR') {
+      return 'text-status-error'
+    }
     switch (flow.status) {
       case 'CLOSED': return 'text-status-success'
       case 'RESET': return 'text-status-error'
@@ -311,6 +319,11 @@ const FlowRowMemo = memo(function FlowRow({ flow, selected, onClick, index }: Fl
           )}
           <div className="min-w-0">
             <div className="text-sm text-gray-200 truncate">{getDestination()}</div>
+            {flow.dns?.name && (
+              <div className="text-[10px] text-gray-600 truncate">
+                <span className="text-glow-400/60">{flow.dns.type}</span> {flow.dns.name}
+              </div>
+            )}
             {flow.http?.url && flow.http.url !== '/' && (
               <div className="text-[10px] text-gray-600 truncate">
                 <span className="text-glow-400/60">{flow.http.method}</span> {flow.http.url}
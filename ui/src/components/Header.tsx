@@ -1,7 +1,8 @@
-import { Search, Download, Pause, Play, Filter, ChevronDown, Sparkles, HardDrive, Activity, Waves, Trash2, X, Check, AlertTriangle } from 'lucide-react'
+import { Search, Download, Pause, Play, Filter, ChevronDown, Sparkles, HardDrive, Activity, Waves, Trash2, X, Check, AlertTriangle, Gauge } from 'lucide-react'
 import { useState, useRef, useEffect } from 'react'
 import { formatBytes } from '../utils'
 import { bpfPresets, type BPFPreset } from '../lib/bpfPresets'
+import type { CaptureCompleteness } from '../types'
 
 interface FilterOptions {
   searchText: string
@@ -15,6 +16,7 @@ interface HeaderProps {
   filteredCount: number
   pcapSize: number
   pcapFull: boolean
+  completeness?: CaptureCompleteness
   filter: string
   onFilterChange: (filter: string) => void
   filterOptions: FilterOptions
@@ -31,6 +33,7 @@ export function Header({
   filteredCount,
   pcapSize,
   pcapFull,
+  completeness,
   filter,
   onFilterChange,
   filterOptions,
@@ -57,6 +60,9 @@ export function Header({
   const aiEnabled = anthropicEnabled || azureEnabled
   const aiProvider = anthropicEnabled ? 'anthropic' : 'azure'
 
+  // Anything dropped between the wire and the hub is worth a warning
+  const incomplete = completeness !== undefined && completeness.overall < 1
+
   useEffect(() => {
     function handleClickOutside(event: MouseEvent) {
       if (presetsRef.current && !presetsRef.current.contains(event.target as Node)) {
@@ -266,6 +272,19 @@ Rules:
             </span>
           </div>
 
+          {/* Capture completeness */}
+          {completeness && (
+            <div
+              className={`flex items-center gap-2 px-3 py-2 rounded-lg ${incomplete ? 'bg-status-warning/10 border border-status-warning/30' : 'bg-void-800/60 border border-void-700'}`}
+              title={completenessTitle(completeness)}
+            >
+              <Gauge className={`w-3.5 h-3.5 ${incomplete ? 'text-status-warning' : 'text-gray-400'}`} />
+              <span className={`text-xs font-mono ${incomplete ? 'text-status-warning' : 'text-gray-400'}`}>
+                {formatPercent(completeness.overall)}
+              </span>
+            </div>
+          )}
+
           {/* Pause */}
           <button
             onClick={onTogglePause}
@@ -421,3 +440,29 @@ function FilterChip({ children, active, onClick }: { children: React.ReactNode;
     </button>
   )
 }
+
+// formatPercent shows a ratio with one decimal, without rounding a loss up to 100%
+function formatPercent(ratio: number): string {
+  return `${(Math.floor(ratio * 1000) / 10).toFixed(1)}%`
+}
+
+// completenessTitle lists where traffic was dropped
+function completenessTitle(c: CaptureCompleteness): string {
+  const lines = [
+    `Capture completeness ${formatPercent(c.overall)}`,
+    `Packets kept: ${formatPercent(c.packets)}`,
+    `Flows delivered: ${formatPercent(c.flows)}`,
+    `PCAP stored: ${formatPercent(c.pcap)}`,
+  ]
+  const d = c.drops
+  if (d.kernelPackets) lines.push(`${d.kernelPackets} packets dropped by the capture buffer`)
+  if (d.interfacePackets) lines.push(`${d.interfacePackets} packets dropped by the interface`)
+  if (d.flowsQueueFull) lines.push(`${d.flowsQueueFull} flows dropped, agent queue full`)
+  if (d.flowsSpoolFull) lines.push(`${d.flowsSpoolFull} flows dropped, hub unreachable too long`)
+  if (d.flowsSendFailed) lines.push(`${d.flowsSendFailed} flows not delivered before the agent stopped`)
+  if (d.pcapBytesQueueFull) lines.push(`${formatBytes(d.pcapBytesQueueFull)} of PCAP dropped, agent queue full`)
+  if (d.pcapBytesSpoolFull) lines.push(`${formatBytes(d.pcapBytesSpoolFull)} of PCAP dropped, hub unreachable too long`)
+  if (d.pcapBytesSendFailed) lines.push(`${formatBytes(d.pcapBytesSendFailed)} of PCAP not delivered before the agent stopped`)
+  if (d.pcapBytesBufferFull) lines.push(`${formatBytes(d.pcapBytesBufferFull)} of PCAP dropped, hub buffer full`)
+  return lines.join('\n')
+}
@@ -1,4 +1,4 @@
-export type Protocol = 'TCP' | 'HTTP' | 'HTTPS' | 'TLS'
+export type Protocol = 'TCP' | 'HTTP' | 'HTTPS' | 'TLS' | 'HTTP2' | 'GRPC' | 'DNS' | 'UDP'
 export type FlowStatus = 'OPEN' | 'CLOSED' | 'RESET' | 'TIMEOUT'
 
 export interface HTTPInfo {
@@ -15,6 +15,50 @@ export interface HTTPInfo {
   contentLength?: number
 }
 
+export interface HTTPExchange extends HTTPInfo {
+  requestTime: string
+  responseTime: string
+  durationMs?: number
+  streamId?: number
+  grpc?: GRPCInfo
+}
+
+export interface GRPCInfo {
+  service: string
+  method: string
+  statusCode: number
+  status?: string
+  statusMessage?: string
+  requestMessages: number
+  responseMessages: number
+  requestBytes: number
+  responseBytes: number
+}
+
+export interface DNSAnswer {
+  name: string
+  type: string
+  value: string
+  ttl: number
+}
+
+export interface DNSInfo {
+  id: number
+  name: string
+  type: string
+  rcode?: string
+  answers?: DNSAnswer[]
+  latencyMs?: number
+  timedOut?: boolean
+}
+
+export interface ProcessInfo {
+  pid: number
+  command: string
+  container?: string
+  containerId?: string
+}
+
 export interface TLSInfo {
   version: string
   sni: string
@@ -33,12 +77,17 @@ export interface Flow {
   srcPort: number
   srcPod?: string
   srcNamespace?: string
+  srcWorkload?: string
+  srcService?: string
 
   dstIp: string
   dstPort: number
   dstPod?: string
   dstNamespace?: string
+  dstWorkload?: string
   dstService?: string
+  dstName?: string
+  dstNameSource?: 'dns' | 'sni' | 'host'
 
   protocol: Protocol
   status: FlowStatus
@@ -48,16 +97,91 @@ export interface Flow {
   packetsSent: number
   packetsReceived: number
 
+  retransmits?: number
+  outOfOrder?: number
+  zeroWindows?: number
+  dupAcks?: number
+  resetBy?: 'client' | 'server'
+  truncated?: boolean
+  joinedLate?: boolean
+
   tcpHandshakeMs?: number
   tlsHandshakeMs?: number
   ttfbMs?: number
+  srttMs?: number
 
   http?: HTTPInfo
+  httpExchanges?: HTTPExchange[]
+  exchangeOffset?: number // exchanges before the first listed, no longer kept
+  droppedExchanges?: number // oldest exchanges the agent did not keep
   tls?: TLSInfo
+  dns?: DNSInfo
+
+  // Process in the pod that owns the local end of the flow
+  process?: ProcessInfo
 
   // Agent traffic identification (for filtering noise from captures)
   isAgentTraffic?: boolean
-  agentTrafficType?: 'health' | 'flow' | 'pcap' | 'registration' | 'unknown'
+  agentTrafficType?: 'grpc'
+}
+
+// Service dependency map from /api/graph and WebSocket "graph" messages
+export type GraphNodeKind = 'pod' | 'service' | 'external'
+
+export interface GraphNode {
+  id: string
+  kind: GraphNodeKind
+  name: string
+  namespace?: string
+  workload?: string
+  service?: string
+}
+
+export interface LatencyPercentiles {
+  p50: number
+  p95: number
+  p99: number
+}
+
+export interface GraphEdge {
+  source: string
+  target: string
+  protocols: Protocol[]
+  flows: number
+  requests: number
+  errors: number
+  errorRate: number
+  bytesSent: number
+  bytesReceived: number
+  latencyMs?: LatencyPercentiles
+  lastSeen: string
+}
+
+export interface ServiceGraph {
+  nodes: GraphNode[]
+  edges: GraphEdge[]
+  updatedAt: string
+}
+
+// Share of traffic that survived every drop point, from /api/stats and /api/agents
+export interface CaptureDrops {
+  kernelPackets: number
+  interfacePackets: number
+  flowsQueueFull: number
+  flowsSpoolFull: number
+  flowsSendFailed: number
+  pcapBytesQueueFull: number
+  pcapBytesSpoolFull: number
+  pcapBytesSendFailed: number
+  pcapBytesBufferFull: number
+}
+
+export interface CaptureCompleteness {
+  overall: number
+  packets: number
+  flows: number
+  pcap: number
+  drops: CaptureDrops
 }
 
 export type SortColumn = 'timestamp' | 'source' | 'destination' | 'protocol' | 'status' | 'latency' | 'duration' | 'size'